@@ -0,0 +1,608 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"repgen/controller"
+	"repgen/core"
+	"repgen/security"
+	"repgen/web"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Password which passes the password policy
+const testPassword = "Correct-horse-9battery"
+
+// Return a server of every route on a new in-memory storage
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	core.Config = &core.ConfigBase{}
+	core.Config.Storage.Driver = controller.StorageDriverMemory
+	controller.InitializeStorage()
+	controller.InitializeRateLimit()
+	controller.InitializePasswordPolicy()
+	router := web.NewRouter()
+	router.Use(web.RecoverMiddleware)
+	RegisterRoutes(router)
+	server := httptest.NewServer(web.CorsMiddleware(web.CsrfMiddleware(router)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Client of a test server which keeps the session and sends the CSRF token like the web UI
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	http   *http.Client
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{t: t, server: server, http: &http.Client{Jar: jar}}
+}
+
+// Send input as JSON to given path, decode the response into output if it is not nil and return the status
+func (c *testClient) call(method string, path string, input interface{}, output interface{}) int {
+	c.t.Helper()
+	var body bytes.Buffer
+	if input != nil {
+		if err := json.NewEncoder(&body).Encode(input); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, cookie := range c.http.Jar.Cookies(req.URL) {
+		if cookie.Name == web.CookieKeyCsrf {
+			req.Header.Set(web.HeaderCsrfToken, cookie.Value)
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if output != nil {
+		if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+			c.t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Call given path and fail the test unless the status is 200
+func (c *testClient) mustCall(method string, path string, input interface{}, output interface{}) {
+	c.t.Helper()
+	var response json.RawMessage
+	status := c.call(method, path, input, &response)
+	if status != http.StatusOK {
+		c.t.Fatalf("%s %s: %d %s", method, path, status, response)
+	}
+	if output != nil {
+		if err := json.Unmarshal(response, output); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// Register and log in a user of given email
+func (c *testClient) login(email string) {
+	c.t.Helper()
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/users",
+		UserCreateInput{Email: email, Password: testPassword, Name: "Test"}, nil)
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/login", LoginInput{Email: email, Password: testPassword}, nil)
+}
+
+// Create a project and a daily report with a region dimension and an amount column, return the report and its token
+func (c *testClient) createReport(mode string) (controller.Report, string) {
+	c.t.Helper()
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/projects", ProjectCreateInput{Name: "Sales"}, nil)
+	var projects ProjectSelectOutput
+	c.mustCall(http.MethodGet, web.ApiPrefix+"/projects", nil, &projects)
+	if len(projects.Items) != 1 {
+		c.t.Fatalf("projects: %+v", projects)
+	}
+	var created ReportCreateOutput
+	c.mustCall(http.MethodPost, fmt.Sprintf("%s/projects/%d/reports", web.ApiPrefix, projects.Items[0].Id), ReportCreateInput{
+		Name: "Daily", Interval: controller.ReportIntervalDaily, SubmitMode: mode,
+		Definition: []ReportDefinitionInput{
+			{Name: "region", Type: controller.ReportColumnTypeStr, Dimension: true},
+			{Name: "amount", Type: controller.ReportColumnTypeInt},
+		},
+	}, &created)
+	var reports ReportSelectOutput
+	c.mustCall(http.MethodGet, fmt.Sprintf("%s/projects/%d/reports", web.ApiPrefix, projects.Items[0].Id), nil, &reports)
+	if len(reports.Items) != 1 {
+		c.t.Fatalf("reports: %+v", reports)
+	}
+	return reports.Items[0], created.Token
+}
+
+func TestLoginRequired(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	var response web.Response
+	if status := c.call(http.MethodGet, web.ApiPrefix+"/projects", nil, &response); status != http.StatusUnauthorized {
+		t.Fatalf("status: %d", status)
+	}
+	if response.Code != web.ErrorCodeUnauthenticated {
+		t.Fatalf("code: %s", response.Code)
+	}
+	c.login("a@example.com")
+	var wrong web.Response
+	status := c.call(http.MethodPost, web.ApiPrefix+"/login", LoginInput{Email: "a@example.com", Password: "wrong"}, &wrong)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("status: %d %+v", status, wrong)
+	}
+}
+
+func TestCsrfRequired(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.login("a@example.com")
+	req, _ := http.NewRequest(http.MethodPost, server.URL+web.ApiPrefix+"/projects",
+		bytes.NewBufferString(`{"name":"Sales"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("status: %d", resp.StatusCode)
+	}
+}
+
+// Frontend on another origin cannot read the CSRF cookie, it reads the token from the exposed header
+func TestCsrfTokenHeader(t *testing.T) {
+	server := newTestServer(t)
+	core.Config.Cors.AllowedOrigins = []string{"https://app.example.com"}
+	core.Config.Cors.AllowCredentials = true
+	c := newTestClient(t, server)
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/users",
+		UserCreateInput{Email: "a@example.com", Password: testPassword, Name: "Test"}, nil)
+	send := func(method string, path string, body string, csrfToken string) *http.Response {
+		req, _ := http.NewRequest(method, server.URL+web.ApiPrefix+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "https://app.example.com")
+		if len(csrfToken) > 0 {
+			req.Header.Set(web.HeaderCsrfToken, csrfToken)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := send(http.MethodPost, "/login", fmt.Sprintf(`{"email":"a@example.com","password":%q}`, testPassword), "")
+	csrfToken := resp.Header.Get(web.HeaderCsrfToken)
+	if resp.StatusCode != http.StatusOK || len(csrfToken) == 0 {
+		t.Fatalf("login: %d %q", resp.StatusCode, csrfToken)
+	}
+	if exposed := resp.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, web.HeaderCsrfToken) {
+		t.Fatalf("header is not exposed: %q", exposed)
+	}
+	// Token of the session is sent again e.g. after the frontend is reloaded
+	resp = send(http.MethodGet, "/user/roles", "", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(web.HeaderCsrfToken) != csrfToken {
+		t.Fatalf("session token: %d %q", resp.StatusCode, resp.Header.Get(web.HeaderCsrfToken))
+	}
+	if resp = send(http.MethodPost, "/projects", `{"name":"Sales"}`, csrfToken); resp.StatusCode != http.StatusOK {
+		t.Fatalf("project with header token: %d", resp.StatusCode)
+	}
+}
+
+func TestCsrfRequiredWithBearerToken(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.login("a@example.com")
+	req, _ := http.NewRequest(http.MethodPost, server.URL+web.ApiPrefix+"/projects",
+		bytes.NewBufferString(`{"name":"Sales"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer invalid")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("status: %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitAndSelectReportData(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeMerge)
+	for _, row := range []SubmitReportInput{
+		{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}},
+		{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "us", "amount": 4}},
+		{Token: token, Date: "2026-10-02", Data: map[string]interface{}{"region": "eu", "amount": 5}},
+	} {
+		c.mustCall(http.MethodPost, "/submit", row, nil)
+	}
+	var rows []ReportDataOutput
+	c.mustCall(http.MethodGet, fmt.Sprintf("%s/reports/%d/data?from=2026-10-01&to=2026-10-03", web.ApiPrefix, report.Id),
+		nil, &rows)
+	if len(rows) != 3 {
+		t.Fatalf("rows: %+v", rows)
+	}
+	var invalid web.Response
+	status := c.call(http.MethodPost, "/submit", SubmitReportInput{Token: token, Date: "2026-10-01",
+		Data: map[string]interface{}{"region": 1, "amount": "x"}}, &invalid)
+	if status != http.StatusBadRequest || invalid.Code != web.ErrorCodeValidationFailed || len(invalid.Details) != 2 {
+		t.Fatalf("invalid submit: %d %+v", status, invalid)
+	}
+	var unknown web.Response
+	status = c.call(http.MethodPost, "/submit", SubmitReportInput{Token: "rpg_" + strings.Repeat("0", 40),
+		Data: map[string]interface{}{"region": "eu"}}, &unknown)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unknown token: %d %+v", status, unknown)
+	}
+}
+
+func TestSubmitModeReject(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	_, token := c.createReport(controller.ReportSubmitModeReject)
+	row := SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}
+	c.mustCall(http.MethodPost, "/submit", row, nil)
+	var response web.Response
+	if status := c.call(http.MethodPost, "/submit", row, &response); status != http.StatusConflict {
+		t.Fatalf("status: %d %+v", status, response)
+	}
+}
+
+func TestColumnPattern(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, _ := c.createReport(controller.ReportSubmitModeMerge)
+	path := fmt.Sprintf("%s/projects/%d/reports", web.ApiPrefix, report.ProjectId)
+	var invalid web.Response
+	status := c.call(http.MethodPost, path, ReportCreateInput{Name: "Codes", Interval: controller.ReportIntervalDaily,
+		Definition: []ReportDefinitionInput{{Name: "code", Type: controller.ReportColumnTypeStr, Pattern: "[a-z"}}}, &invalid)
+	if status != http.StatusBadRequest || invalid.Field != "definition[0].pattern" {
+		t.Fatalf("invalid pattern: %d %+v", status, invalid)
+	}
+	var created ReportCreateOutput
+	c.mustCall(http.MethodPost, path, ReportCreateInput{Name: "Codes", Interval: controller.ReportIntervalDaily,
+		Definition: []ReportDefinitionInput{{Name: "code", Type: controller.ReportColumnTypeStr, Pattern: "^[A-Z]{3}$"}}},
+		&created)
+	for _, code := range []string{"ABC", "XYZ"} {
+		c.mustCall(http.MethodPost, "/submit", SubmitReportInput{Token: created.Token, Data: map[string]interface{}{"code": code}}, nil)
+	}
+	var mismatch web.Response
+	status = c.call(http.MethodPost, "/submit", SubmitReportInput{Token: created.Token,
+		Data: map[string]interface{}{"code": "abcd"}}, &mismatch)
+	if status != http.StatusBadRequest || mismatch.Field != "data.code" {
+		t.Fatalf("pattern mismatch: %d %+v", status, mismatch)
+	}
+}
+
+func TestShareToken(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeMerge)
+	c.mustCall(http.MethodPost, "/submit",
+		SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}, nil)
+	var shareToken controller.ShareToken
+	c.mustCall(http.MethodPost, fmt.Sprintf("%s/reports/%d/share", web.ApiPrefix, report.Id), ShareInput{}, &shareToken)
+	stored, err := controller.GetShareToken(context.Background(), controller.Store, shareToken.Token)
+	if err != nil || stored != nil {
+		t.Fatalf("plaintext token is stored: %+v %v", stored, err)
+	}
+	var output ShareDataOutput
+	c.mustCall(http.MethodGet, "/share?token="+shareToken.Token, nil, &output)
+	if len(output.Rows) != 1 {
+		t.Fatalf("rows: %+v", output)
+	}
+	var response web.Response
+	if status := c.call(http.MethodGet, "/share?token="+security.HashToken(shareToken.Token), nil, &response); status != http.StatusUnauthorized {
+		t.Fatalf("hash is accepted as token: %d %+v", status, response)
+	}
+}
+
+func TestSubmissionTokenRedacted(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeReject)
+	row := SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}
+	c.mustCall(http.MethodPost, "/submit", row, nil)
+	c.call(http.MethodPost, "/submit", row, nil)
+	var submissions []controller.Submission
+	c.mustCall(http.MethodGet, fmt.Sprintf("%s/reports/%d/submissions?failed=true", web.ApiPrefix, report.Id), nil, &submissions)
+	if len(submissions) != 1 || strings.Contains(submissions[0].Body, token) ||
+		!strings.Contains(submissions[0].Body, controller.SubmissionRedactedToken) {
+		t.Fatalf("submissions: %+v", submissions)
+	}
+	// Replay is submitted to the report of the submission
+	path := fmt.Sprintf("%s/reports/%d/submissions/replay", web.ApiPrefix, report.Id)
+	input := SubmissionReplayInput{SubmissionIds: []int{submissions[0].Id}}
+	var results []SubmissionReplayResult
+	c.mustCall(http.MethodPost, path, input, &results)
+	if len(results) != 1 || results[0].Code != web.ErrorCodeConflict {
+		t.Fatalf("replay: %+v", results)
+	}
+	// Replays need a valid token of the report
+	var reportTokens []controller.ReportToken
+	c.mustCall(http.MethodGet, fmt.Sprintf("%s/reports/%d/tokens", web.ApiPrefix, report.Id), nil, &reportTokens)
+	for _, reportToken := range reportTokens {
+		c.mustCall(http.MethodDelete, fmt.Sprintf("%s/reports/%d/tokens/%d", web.ApiPrefix, report.Id, reportToken.Id), nil, nil)
+	}
+	c.mustCall(http.MethodPost, path, input, &results)
+	if len(results) != 1 || results[0].Code != web.ErrorCodeInvalidToken {
+		t.Fatalf("replay without token: %+v", results)
+	}
+}
+
+func TestLoginMfaAttemptLimit(t *testing.T) {
+	server := newTestServer(t)
+	c := newTestClient(t, server)
+	c.login("a@example.com")
+	var enroll UserMfaEnrollOutput
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/user/mfa/enroll", nil, &enroll)
+	code, err := security.ReturnTotpCode(enroll.Secret, security.ReturnTotpCounter(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recovery UserMfaRecoveryOutput
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/user/mfa/confirm", UserMfaCodeInput{Code: code}, &recovery)
+	// Lockout of the email is disabled by the default config
+	other := newTestClient(t, server)
+	var login LoginMfaOutput
+	other.mustCall(http.MethodPost, web.ApiPrefix+"/login", LoginInput{Email: "a@example.com", Password: testPassword}, &login)
+	for attempt := 0; attempt < controller.MfaChallengeMaxAttempts; attempt++ {
+		var response web.Response
+		status := other.call(http.MethodPost, web.ApiPrefix+"/login/mfa", LoginMfaInput{MfaToken: login.MfaToken, Code: "wrong"}, &response)
+		if status != http.StatusUnauthorized || response.Code != web.ErrorCodeInvalidCredentials {
+			t.Fatalf("attempt %d: %d %+v", attempt, status, response)
+		}
+	}
+	var response web.Response
+	status := other.call(http.MethodPost, web.ApiPrefix+"/login/mfa",
+		LoginMfaInput{MfaToken: login.MfaToken, Code: recovery.RecoveryCodes[0]}, &response)
+	if status != http.StatusUnauthorized || response.Code != web.ErrorCodeInvalidToken {
+		t.Fatalf("token is not invalidated: %d %+v", status, response)
+	}
+	// A new token of the password accepts the code
+	other.mustCall(http.MethodPost, web.ApiPrefix+"/login", LoginInput{Email: "a@example.com", Password: testPassword}, &login)
+	other.mustCall(http.MethodPost, web.ApiPrefix+"/login/mfa", LoginMfaInput{MfaToken: login.MfaToken, Code: recovery.RecoveryCodes[0]}, nil)
+}
+
+func TestProjectRoleRequired(t *testing.T) {
+	server := newTestServer(t)
+	owner := newTestClient(t, server)
+	owner.login("a@example.com")
+	report, _ := owner.createReport(controller.ReportSubmitModeMerge)
+	core.Config.Oidc.GroupRoles = append(core.Config.Oidc.GroupRoles, struct {
+		Group     string `yaml:"group"`
+		ProjectId int    `yaml:"project_id"`
+		Role      string `yaml:"role"`
+	}{Group: "sales", ProjectId: report.ProjectId, Role: controller.ProjectRoleEditor})
+	projectPath := fmt.Sprintf("%s/projects/%d", web.ApiPrefix, report.ProjectId)
+	reportInput := ReportCreateInput{Name: "Weekly", Interval: controller.ReportIntervalDaily,
+		Definition: []ReportDefinitionInput{{Name: "amount", Type: controller.ReportColumnTypeInt}}}
+	owner.mustCall(http.MethodGet, fmt.Sprintf("%s/reports/%d/data", web.ApiPrefix, report.Id), nil, nil)
+
+	c := newTestClient(t, server)
+	c.login("b@example.com")
+	var response web.Response
+	if status := c.call(http.MethodGet, projectPath+"/reports", nil, &response); status != http.StatusForbidden {
+		t.Fatalf("user without role reads reports: %d %+v", status, response)
+	}
+	if status := c.call(http.MethodGet, fmt.Sprintf("%s/reports/%d/data", web.ApiPrefix, report.Id), nil, &response); status != http.StatusForbidden {
+		t.Fatalf("user without role reads report data: %d %+v", status, response)
+	}
+	user, err := controller.GetUserByEmail(context.Background(), controller.Store, "b@example.com")
+	if err != nil || user == nil {
+		t.Fatalf("user: %+v %v", user, err)
+	}
+	err = controller.ReplaceProjectRoles(context.Background(), controller.Store, user.Id,
+		map[int]string{report.ProjectId: controller.ProjectRoleViewer}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mustCall(http.MethodGet, projectPath+"/reports", nil, nil)
+	if status := c.call(http.MethodPost, projectPath+"/reports", reportInput, &response); status != http.StatusForbidden {
+		t.Fatalf("viewer creates report: %d %+v", status, response)
+	}
+	if status := c.call(http.MethodPost, fmt.Sprintf("%s/reports/%d/tokens", web.ApiPrefix, report.Id), nil, &response); status != http.StatusForbidden {
+		t.Fatalf("viewer creates token: %d %+v", status, response)
+	}
+
+	err = controller.ReplaceProjectRoles(context.Background(), controller.Store, user.Id,
+		map[int]string{report.ProjectId: controller.ProjectRoleEditor}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.mustCall(http.MethodPost, projectPath+"/reports", reportInput, nil)
+	if status := c.call(http.MethodPatch, projectPath, ProjectEditInput{Name: "Renamed"}, &response); status != http.StatusForbidden {
+		t.Fatalf("editor edits project: %d %+v", status, response)
+	}
+	owner.mustCall(http.MethodPatch, projectPath, ProjectEditInput{Name: "Renamed"}, nil)
+}
+
+// Send given request and fail the test unless the response has given error code
+func (c *testClient) mustFail(method string, path string, input interface{}, code string) {
+	c.t.Helper()
+	var response web.Response
+	if status := c.call(method, path, input, &response); response.Code != code {
+		c.t.Fatalf("%s %s: %d %+v, expected %s", method, path, status, response, code)
+	}
+}
+
+func TestProjectArchiveAndDelete(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeMerge)
+	c.mustCall(http.MethodPost, web.ApiPrefix+"/projects", ProjectCreateInput{Name: "Other"}, nil)
+	var projects ProjectSelectOutput
+	c.mustCall(http.MethodGet, web.ApiPrefix+"/projects?search=Other", nil, &projects)
+	if len(projects.Items) != 1 {
+		t.Fatalf("projects: %+v", projects)
+	}
+	otherPath := fmt.Sprintf("%s/projects/%d", web.ApiPrefix, projects.Items[0].Id)
+	c.mustCall(http.MethodPost, otherPath+"/reports", ReportCreateInput{Name: "Daily", Interval: controller.ReportIntervalDaily,
+		Definition: []ReportDefinitionInput{{Name: "amount", Type: controller.ReportColumnTypeInt}}}, nil)
+	projectPath := fmt.Sprintf("%s/projects/%d", web.ApiPrefix, report.ProjectId)
+	submit := SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}
+
+	// Only archived projects are deleted
+	c.mustFail(http.MethodDelete, projectPath+"?confirm=Sales", nil, web.ErrorCodeConflict)
+	c.mustFail(http.MethodPost, projectPath+"/restore", nil, web.ErrorCodeConflict)
+	c.mustCall(http.MethodPost, projectPath+"/archive", nil, nil)
+	c.mustFail(http.MethodPost, projectPath+"/archive", nil, web.ErrorCodeConflict)
+	c.mustFail(http.MethodPost, "/submit", submit, web.ErrorCodeArchived)
+	c.mustCall(http.MethodPost, projectPath+"/restore", nil, nil)
+	c.mustCall(http.MethodPost, "/submit", submit, nil)
+	c.mustCall(http.MethodPost, projectPath+"/archive", nil, nil)
+
+	// Name of the project is confirmed
+	c.mustFail(http.MethodDelete, projectPath, nil, web.ErrorCodeFieldInvalid)
+	c.mustFail(http.MethodDelete, projectPath+"?confirm=Other", nil, web.ErrorCodeFieldInvalid)
+	c.mustCall(http.MethodDelete, projectPath+"?confirm=Sales", nil, nil)
+	c.mustFail(http.MethodGet, projectPath+"/reports", nil, web.ErrorCodeNotFound)
+	c.mustFail(http.MethodPost, "/submit", submit, web.ErrorCodeInvalidToken)
+	deleted, err := controller.GetReport(context.Background(), controller.Store, report.Id)
+	if err != nil || deleted != nil {
+		t.Fatalf("report of the project is not deleted: %+v %v", deleted, err)
+	}
+	// Reports of other projects are kept
+	var reports ReportSelectOutput
+	c.mustCall(http.MethodGet, otherPath+"/reports", nil, &reports)
+	if len(reports.Items) != 1 {
+		t.Fatalf("reports of other project: %+v", reports)
+	}
+}
+
+func TestReportArchiveAndDelete(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeMerge)
+	reportPath := fmt.Sprintf("%s/reports/%d", web.ApiPrefix, report.Id)
+	submit := SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}
+
+	c.mustFail(http.MethodDelete, reportPath+"?confirm=Daily", nil, web.ErrorCodeConflict)
+	c.mustFail(http.MethodPost, reportPath+"/restore", nil, web.ErrorCodeConflict)
+	c.mustCall(http.MethodPost, reportPath+"/archive", nil, nil)
+	c.mustFail(http.MethodPost, "/submit", submit, web.ErrorCodeArchived)
+	// Archived reports are listed separately
+	var reports ReportSelectOutput
+	c.mustCall(http.MethodGet, fmt.Sprintf("%s/projects/%d/reports", web.ApiPrefix, report.ProjectId), nil, &reports)
+	if len(reports.Items) != 0 {
+		t.Fatalf("archived report is listed: %+v", reports)
+	}
+	c.mustCall(http.MethodPost, reportPath+"/restore", nil, nil)
+	c.mustCall(http.MethodPost, "/submit", submit, nil)
+	c.mustCall(http.MethodPost, reportPath+"/archive", nil, nil)
+
+	c.mustFail(http.MethodDelete, reportPath+"?confirm=Weekly", nil, web.ErrorCodeFieldInvalid)
+	c.mustCall(http.MethodDelete, reportPath+"?confirm=Daily", nil, nil)
+	c.mustFail(http.MethodGet, reportPath+"/data", nil, web.ErrorCodeNotFound)
+	c.mustFail(http.MethodPost, "/submit", submit, web.ErrorCodeInvalidToken)
+}
+
+func TestListCursorAndSearch(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	for _, name := range []string{"Sales EU", "Sales US", "Marketing"} {
+		c.mustCall(http.MethodPost, web.ApiPrefix+"/projects", ProjectCreateInput{Name: name}, nil)
+	}
+	var projects ProjectSelectOutput
+	c.mustCall(http.MethodGet, web.ApiPrefix+"/projects?search=sales&sort=name&limit=1", nil, &projects)
+	if projects.Total != 2 || len(projects.Items) != 1 || projects.Items[0].Name != "Sales EU" || len(projects.NextCursor) == 0 {
+		t.Fatalf("first page: %+v", projects)
+	}
+	cursor := projects.NextCursor
+	c.mustCall(http.MethodGet, web.ApiPrefix+"/projects?search=sales&sort=name&limit=1&cursor="+cursor, nil, &projects)
+	if len(projects.Items) != 1 || projects.Items[0].Name != "Sales US" || len(projects.NextCursor) != 0 {
+		t.Fatalf("second page: %+v", projects)
+	}
+	// Cursor is bound to the sort key and order of its query
+	c.mustFail(http.MethodGet, web.ApiPrefix+"/projects?search=sales&sort=name&order=desc&cursor="+cursor, nil, web.ErrorCodeFieldInvalid)
+	c.mustFail(http.MethodGet, web.ApiPrefix+"/projects?search=sales&cursor="+cursor, nil, web.ErrorCodeFieldInvalid)
+}
+
+// Unversioned /submit and /share are kept for clients which were configured before the API prefix
+func TestLegacyRouteAliases(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeMerge)
+	for index, path := range []string{"/submit", web.ApiPrefix + "/submit"} {
+		c.mustCall(http.MethodPost, path,
+			SubmitReportInput{Token: token, Date: fmt.Sprintf("2026-10-0%d", index+1), Data: map[string]interface{}{"region": "eu", "amount": 3}}, nil)
+	}
+	var shareToken controller.ShareToken
+	c.mustCall(http.MethodPost, fmt.Sprintf("%s/reports/%d/share", web.ApiPrefix, report.Id), ShareInput{}, &shareToken)
+	for _, path := range []string{"/share", web.ApiPrefix + "/share"} {
+		var output ShareDataOutput
+		c.mustCall(http.MethodGet, path+"?token="+shareToken.Token, nil, &output)
+		if len(output.Rows) != 2 {
+			t.Fatalf("%s: %+v", path, output)
+		}
+	}
+	// Other routes are versioned only
+	c.mustFail(http.MethodGet, "/projects", nil, web.ErrorCodeNotFound)
+}
+
+func TestSubmissionReplay(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.login("a@example.com")
+	report, token := c.createReport(controller.ReportSubmitModeReject)
+	reportPath := fmt.Sprintf("%s/reports/%d", web.ApiPrefix, report.Id)
+	row := SubmitReportInput{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"region": "eu", "amount": 3}}
+	c.mustCall(http.MethodPost, "/submit", row, nil)
+	row.Data = map[string]interface{}{"region": "eu", "amount": 5}
+	c.mustFail(http.MethodPost, "/submit", row, web.ErrorCodeConflict)
+	row.Data = map[string]interface{}{"region": "eu", "amount": "x"}
+	c.call(http.MethodPost, "/submit", row, nil)
+	var submissions []controller.Submission
+	c.mustCall(http.MethodGet, reportPath+"/submissions", nil, &submissions)
+	if len(submissions) != 3 {
+		t.Fatalf("submissions: %+v", submissions)
+	}
+	invalid, rejected, inserted := submissions[0], submissions[1], submissions[2]
+
+	// Replays are applied under the current submit mode
+	c.mustCall(http.MethodPut, reportPath+"/submit_mode", ReportSubmitModeInput{SubmitMode: controller.ReportSubmitModeOverwrite}, nil)
+	var results []SubmissionReplayResult
+	c.mustCall(http.MethodPost, reportPath+"/submissions/replay",
+		SubmissionReplayInput{SubmissionIds: []int{rejected.Id, invalid.Id, inserted.Id, invalid.Id + 100}}, &results)
+	if len(results) != 4 {
+		t.Fatalf("results: %+v", results)
+	}
+	if results[0].Status != http.StatusOK || results[0].ReplayId == nil {
+		t.Fatalf("rejected submission: %+v", results[0])
+	}
+	if results[1].Status != http.StatusBadRequest || results[1].ReplayId == nil {
+		t.Fatalf("invalid submission: %+v", results[1])
+	}
+	if results[2].Code != web.ErrorCodeConflict || results[2].ReplayId != nil {
+		t.Fatalf("inserted submission: %+v", results[2])
+	}
+	if results[3].Code != web.ErrorCodeNotFound || results[3].ReplayId != nil {
+		t.Fatalf("unknown submission: %+v", results[3])
+	}
+	var rows []ReportDataOutput
+	c.mustCall(http.MethodGet, reportPath+"/data", nil, &rows)
+	if len(rows) != 1 || rows[0].Data["amount"] != 5.0 {
+		t.Fatalf("rows: %+v", rows)
+	}
+	// Replays are logged with the submission they replay
+	c.mustCall(http.MethodGet, reportPath+"/submissions?failed=true", nil, &submissions)
+	if len(submissions) != 3 || submissions[0].ReplayId == nil || *submissions[0].ReplayId != invalid.Id {
+		t.Fatalf("failed submissions: %+v", submissions)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"repgen/controller"
+	"repgen/web"
+)
+
+const (
+	listOrderAsc  = "asc"
+	listOrderDesc = "desc"
+)
+
+// Query parameters of every list endpoint
+type ListInput struct {
+	// Page size, 10 if omitted
+	Limit int `json:"limit"`
+	// next_cursor of the previous page, the first page if omitted
+	Cursor string `json:"cursor"`
+	// Sort key, created if omitted
+	Sort string `json:"sort"`
+	// asc or desc, asc if omitted
+	Order string `json:"order"`
+}
+
+// Total count of the rows matching the query and the cursor of the next page
+type ListOutput struct {
+	Total int64 `json:"total"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// Parse list query parameters of given request
+func parseListInput(r *http.Request) (ListInput, error) {
+	limit, err := web.ParseQueryInt(r, "limit")
+	if err != nil {
+		return ListInput{}, err
+	}
+	query := r.URL.Query()
+	return ListInput{Limit: limit, Cursor: query.Get("cursor"), Sort: query.Get("sort"), Order: query.Get("order")}, nil
+}
+
+// Validate given list input against the sort keys of the endpoint and return its query
+func listParser(listInput ListInput, sorts ...string) (controller.ListQuery, error) {
+	query := controller.ListQuery{Limit: listInput.Limit, Sort: listInput.Sort}
+	// <limit>
+	if query.Limit == 0 {
+		query.Limit = controller.ListDefaultLimit
+	}
+	if query.Limit < 1 || query.Limit > controller.ListMaxLimit {
+		return query, web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "limit",
+			fmt.Sprintf("Field is invalid: limit, must be between 1 and %d", controller.ListMaxLimit))
+	}
+	// <sort>
+	if len(query.Sort) == 0 {
+		query.Sort = controller.ListSortCreated
+	}
+	valid := false
+	for _, sort := range sorts {
+		valid = valid || query.Sort == sort
+	}
+	if !valid {
+		return query, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "sort", "Field is invalid: sort")
+	}
+	// <order>
+	switch listInput.Order {
+	case "", listOrderAsc:
+	case listOrderDesc:
+		query.Desc = true
+	default:
+		return query, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "order", "Field is invalid: order")
+	}
+	// <cursor>
+	if len(listInput.Cursor) > 0 {
+		var err error
+		query.After, err = controller.DecodeListCursor(query, listInput.Cursor)
+		if err != nil {
+			return query, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "cursor", "Field is invalid: cursor")
+		}
+	}
+	return query, nil
+}
+
+// Validate search of a list endpoint
+func listSearchParser(search string) error {
+	if len(search) > controller.ListSearchMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "search",
+			fmt.Sprintf("Field is too long: search, max length: %d", controller.ListSearchMaxLength))
+	}
+	return nil
+}
+
+func returnListOutput(page controller.ListPage) ListOutput {
+	output := ListOutput{Total: page.Total}
+	if page.Next != nil {
+		output.NextCursor = controller.EncodeListCursor(*page.Next)
+	}
+	return output
+}
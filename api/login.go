@@ -1,7 +1,6 @@
 package api
 
 import (
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -17,203 +16,207 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse input
-		var loginInput LoginInput
-		err := web.ParsePostBody(w, r, &loginInput)
+// POST /login
+func LoginHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now().UTC()
+	// Rate limit of the client
+	retryAfter, err := controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginIp),
+		web.ReturnRemoteAddr(r), now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many login attempts", retryAfter)
+	}
+	// Parse input
+	var loginInput LoginInput
+	err = web.DecodeJSONBody(w, r, &loginInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = loginInputParser(loginInput)
+	if err != nil {
+		return err
+	}
+	// Rate limit and lockout of the email
+	emailKey := controller.ReturnEmailRateLimitKey(loginInput.Email)
+	retryAfter, err = controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginEmail),
+		emailKey, now)
+	if err == nil && retryAfter == 0 {
+		retryAfter, err = controller.PeekLockout(r.Context(),
+			controller.ReturnRateLimit(controller.RateLimitLoginFailure), emailKey, now)
+	}
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many login attempts", retryAfter)
+	}
+	// Fetch user by email
+	user, err := controller.GetUserByEmail(r.Context(), controller.Store, loginInput.Email)
+	if err != nil {
+		return err
+	}
+	// Check password, unknown emails are compared with a dummy hash so response time does not reveal registered emails
+	hash, err := security.ReturnDummyHash()
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		hash = user.Password
+	}
+	match, err := security.ComparePasswordAndHash(loginInput.Password, hash)
+	if err != nil {
+		return err
+	}
+	if user == nil || !match {
+		// Unknown emails count as failures too so lockout does not reveal registered emails
+		err = controller.TakeLockout(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginFailure),
+			emailKey, now)
 		if err != nil {
 			log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-			return
 		}
-		// Input validation
-		err = loginInputParser(loginInput)
-		if err != nil {
-			log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
+		return web.ReturnError(web.ErrorCodeInvalidCredentials, "Invalid email/password.")
+	}
+	// Rehash the password if it is hashed with outdated parameters, login does not fail on error
+	rehash, err := security.NeedsRehash(user.Password)
+	if err != nil {
+		log.Printf("{LoginHandler} ERR: %s\n", err.Error())
+	} else if rehash {
+		hashedPassword, err := security.GenerateHashFromPassword(loginInput.Password)
+		if err == nil {
+			_, err = controller.UpdateUserPassword(r.Context(), controller.Store,
+				controller.User{Id: user.Id, Password: hashedPassword})
 		}
-		// Fetch user by email
-		user, err := controller.GetUserByEmail(loginInput.Email)
 		if err != nil {
 			log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			response := web.Response{Message: "Invalid email/password."}
-			web.SendJsonResponse(w, response, http.StatusNotFound)
-			return
 		}
-		// Check password
-		match, err := security.ComparePasswordAndHash(loginInput.Password, user.Password)
-		if err != nil {
-			log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		} else if !match {
-			response := web.Response{Message: "Invalid email/password."}
-			web.SendJsonResponse(w, response, http.StatusNotFound)
-			return
-		} else {
-			// User & password is correct -> Proceed to session creation
+	}
+	// Second login step is required if MFA of the user is enabled
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, user.Id)
+	if err != nil {
+		return err
+	}
+	if userMfa != nil && userMfa.Enabled {
+		// Failed logins are forgotten once the second step succeeds
+		return startMfaChallenge(w, r, user.Id, now)
+	}
+	// Failed logins of the email are forgotten
+	err = controller.ResetRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginFailure), emailKey)
+	if err != nil {
+		log.Printf("{LoginHandler} ERR: %s\n", err.Error())
+	}
+	// User & password is correct -> Proceed to session creation
+	return startUserSession(w, r, user.Id)
+}
 
-			// Parse session token from cookie
-			userSessionCookie, err := web.ParseCookieSessionOptional(r)
-			if err != nil {
-				log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-				var response *web.Response
-				if errors.As(err, &response) {
-					web.SendJsonResponse(w, response, response.Status)
-				} else {
-					web.SendHttpMethod(w, http.StatusInternalServerError)
-				}
-				return
-			}
-			// Check if token exists
-			if userSessionCookie != nil {
-				// Token is valid; user is already logged in -> No need to create a new one
-				response := web.Response{Status: http.StatusOK, Message: "User is already logged in."}
-				web.SendJsonResponse(w, response, http.StatusOK)
-				return
-			}
-			// Generate session token
-			// Session duplicate control is skipped here -> Saved 1 query
-			session, err := security.GenerateRandomHex(web.CookieSessionLength)
-			if err != nil {
-				log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-				return
-			}
-			// Register session to database with respect to user id
-			userSession := controller.UserSession{UserId: user.Id, Session: session, Created: time.Now().UTC()}
-			err = controller.CreateUserSession(userSession)
-			if err != nil {
-				log.Printf("{LoginHandler} ERR: %s\n", err.Error())
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-				return
-			}
-			// Append session to cookie
-			cookie := &http.Cookie{
-				Name:  web.CookieKeySession,
-				Value: session,
-				Path:  "/",
-				// HttpOnly: true,
-			}
-			http.SetCookie(w, cookie)
-			response := web.Response{Status: http.StatusOK, Message: "User is logged in."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// Create a session of given user and append it to cookie, unless the request has a valid session already
+func startUserSession(w http.ResponseWriter, r *http.Request, userId int) error {
+	// Parse session token from cookie
+	userSessionCookie, err := web.ParseCookieSessionOptional(r)
+	if err != nil {
+		return err
+	}
+	// Check if token exists
+	if userSessionCookie != nil {
+		// Token is valid; user is already logged in -> No need to create a new one
+		response := web.Response{Status: http.StatusOK, Message: "User is already logged in."}
+		web.SendJsonResponse(w, response, http.StatusOK)
+		return nil
+	}
+	err = createUserSessionCookie(w, r, userId)
+	if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "User is logged in."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// Create a session of given user and append it to cookie
+func createUserSessionCookie(w http.ResponseWriter, r *http.Request, userId int) error {
+	// Generate session token
+	// Session duplicate control is skipped here -> Saved 1 query
+	session, err := security.GenerateRandomHex(web.CookieSessionLength)
+	if err != nil {
+		return err
 	}
+	// Register session to database with respect to user id
+	userSession := controller.UserSession{UserId: userId, Session: session, Created: time.Now().UTC()}
+	err = controller.CreateUserSession(r.Context(), controller.Store, userSession)
+	if err != nil {
+		return err
+	}
+	// Append session to cookie, it is not sent on cross site requests except top level navigations
+	cookie := &http.Cookie{
+		Name:     web.CookieKeySession,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+	// New CSRF token for the new session
+	_, err = web.SetCsrfCookie(w, r)
+	return err
 }
 
 func loginInputParser(loginInput LoginInput) error {
 	// <email>
 	if len(loginInput.Email) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: email"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "email", "Field cannot be empty: email")
 	}
 	if len(loginInput.Email) > controller.UserEmailMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "email", fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength))
 	}
 	_, err := mail.ParseAddress(loginInput.Email)
 	if err != nil {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Email is not valid."}
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "email", "Email is not valid.")
 	}
 	// <password>
 	if len(loginInput.Password) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: password"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "password", "Field cannot be empty: password")
 	}
 	if len(loginInput.Password) > controller.UserPasswordMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: password, max length: %d", controller.UserPasswordMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "password", fmt.Sprintf("Field is too long: password, max length: %d", controller.UserPasswordMaxLength))
 	}
 	return nil
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{LogoutHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Delete session from database
-		err = controller.DeleteUserSession(userSession.Id)
-		if err != nil {
-			log.Printf("{LogoutHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		// Reset cookie
-		cookie := &http.Cookie{
-			Name:    web.CookieKeySession,
-			Path:    "/",
-			MaxAge:  -1,
-			Expires: time.Now().Add(-100 * time.Hour),
-			// HttpOnly: true,
-		}
-		http.SetCookie(w, cookie)
-		response := web.Response{Status: http.StatusOK, Message: "User is logged out."}
-		web.SendJsonResponse(w, response, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// POST /logout
+func LogoutHandler(w http.ResponseWriter, r *http.Request) error {
+	// Delete session from database
+	err := controller.DeleteUserSession(r.Context(), controller.Store, web.ReturnUserSession(r).Id)
+	if err != nil {
+		return err
 	}
+	clearUserSessionCookie(w)
+	response := web.Response{Status: http.StatusOK, Message: "User is logged out."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
-func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{LogoutHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Delete all user sessions from database
-		err = controller.DeleteAllUserSessions(userSession.UserId)
-		if err != nil {
-			log.Printf("{LogoutHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		// Reset cookie
-		cookie := &http.Cookie{
-			Name:    web.CookieKeySession,
-			Path:    "/",
-			MaxAge:  -1,
-			Expires: time.Now().Add(-100 * time.Hour),
-			// HttpOnly: true,
-		}
-		http.SetCookie(w, cookie)
-		response := web.Response{Status: http.StatusOK, Message: "User is logged out from everywhere."}
-		web.SendJsonResponse(w, response, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// POST /logout/all
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) error {
+	// Delete all user sessions from database
+	err := controller.DeleteAllUserSessions(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	clearUserSessionCookie(w)
+	response := web.Response{Status: http.StatusOK, Message: "User is logged out from everywhere."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// Reset session cookie
+func clearUserSessionCookie(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     web.CookieKeySession,
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Now().Add(-100 * time.Hour),
+		HttpOnly: true,
 	}
+	http.SetCookie(w, cookie)
 }
@@ -0,0 +1,363 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"repgen/controller"
+	"repgen/security"
+	"repgen/web"
+	"time"
+)
+
+// Maximum length of a TOTP or recovery code input
+const mfaCodeMaxLength = 64
+
+type LoginMfaInput struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// Password is verified, the token is sent to /login/mfa with a TOTP or recovery code
+type LoginMfaOutput struct {
+	Message  string `json:"message"`
+	MfaToken string `json:"mfa_token"`
+}
+
+type UserMfaEnrollOutput struct {
+	Secret string `json:"secret"`
+	// otpauth URI which authenticator apps enroll from a QR code
+	Uri string `json:"uri"`
+}
+
+type UserMfaCodeInput struct {
+	Code string `json:"code"`
+}
+
+// Recovery codes are returned only once
+type UserMfaRecoveryOutput struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type UserMfaResetInput struct {
+	Email string `json:"email"`
+}
+
+// Create a pending second login step of given user and return its token
+func startMfaChallenge(w http.ResponseWriter, r *http.Request, userId int, now time.Time) error {
+	token, err := security.GenerateRandomHex(controller.MfaChallengeTokenLength)
+	if err != nil {
+		return err
+	}
+	mfaChallenge := controller.MfaChallenge{
+		UserId:  userId,
+		Hash:    security.HashToken(token),
+		Expires: now.Add(controller.MfaChallengeMinutes * time.Minute),
+		Created: now,
+	}
+	err = controller.CreateMfaChallenge(r.Context(), controller.Store, &mfaChallenge)
+	if err != nil {
+		return err
+	}
+	response := LoginMfaOutput{Message: "MFA code is required.", MfaToken: token}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// POST /login/mfa
+func LoginMfaHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now().UTC()
+	// Rate limit of the client
+	retryAfter, err := controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginIp),
+		web.ReturnRemoteAddr(r), now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many login attempts", retryAfter)
+	}
+	// Parse input
+	var loginMfaInput LoginMfaInput
+	err = web.DecodeJSONBody(w, r, &loginMfaInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = loginMfaInputParser(loginMfaInput)
+	if err != nil {
+		return err
+	}
+	// Fetch pending login by its token
+	mfaChallenge, err := controller.GetMfaChallenge(r.Context(), controller.Store,
+		security.HashToken(loginMfaInput.MfaToken))
+	if err != nil {
+		return err
+	}
+	if mfaChallenge == nil || !now.Before(mfaChallenge.Expires) {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	user, err := controller.GetUser(r.Context(), controller.Store, mfaChallenge.UserId)
+	if err != nil {
+		return err
+	}
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, mfaChallenge.UserId)
+	if err != nil {
+		return err
+	}
+	if user == nil || userMfa == nil || !userMfa.Enabled {
+		// MFA is reset after the password is verified
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// Codes of a token are limited regardless of the lockout, attempts are counted before the code is checked
+	// so parallel requests cannot try more codes
+	attempts, err := controller.IncrementMfaChallengeAttempts(r.Context(), controller.Store, mfaChallenge.Id)
+	if err != nil {
+		return err
+	}
+	if attempts == 0 || attempts > controller.MfaChallengeMaxAttempts {
+		_, err = controller.DeleteMfaChallenge(r.Context(), controller.Store, mfaChallenge.Id)
+		if err != nil {
+			log.Printf("{LoginMfaHandler} ERR: %s\n", err.Error())
+		}
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// Failed codes count towards the lockout of the email
+	emailKey := controller.ReturnEmailRateLimitKey(user.Email)
+	lockout := controller.ReturnRateLimit(controller.RateLimitLoginFailure)
+	retryAfter, err = controller.PeekLockout(r.Context(), lockout, emailKey, now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many login attempts", retryAfter)
+	}
+	match, err := controller.VerifyMfaCode(r.Context(), controller.Store, userMfa, loginMfaInput.Code, now)
+	if err != nil {
+		return err
+	}
+	if !match {
+		err = controller.TakeLockout(r.Context(), lockout, emailKey, now)
+		if err != nil {
+			log.Printf("{LoginMfaHandler} ERR: %s\n", err.Error())
+		}
+		return web.ReturnError(web.ErrorCodeInvalidCredentials, "Invalid MFA code.")
+	}
+	// Token is used once
+	rows, err := controller.DeleteMfaChallenge(r.Context(), controller.Store, mfaChallenge.Id)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// Failed logins of the email are forgotten
+	err = controller.ResetRateLimit(r.Context(), lockout, emailKey)
+	if err != nil {
+		log.Printf("{LoginMfaHandler} ERR: %s\n", err.Error())
+	}
+	return startUserSession(w, r, user.Id)
+}
+
+func loginMfaInputParser(loginMfaInput LoginMfaInput) error {
+	// <mfa_token>
+	if len(loginMfaInput.MfaToken) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "mfa_token", "Field cannot be empty: mfa_token")
+	}
+	if len(loginMfaInput.MfaToken) != controller.MfaChallengeTokenLength*2 {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// <code>
+	return mfaCodeParser(loginMfaInput.Code)
+}
+
+func mfaCodeParser(code string) error {
+	if len(code) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "code", "Field cannot be empty: code")
+	}
+	if len(code) > mfaCodeMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "code", fmt.Sprintf("Field is too long: code, max length: %d", mfaCodeMaxLength))
+	}
+	return nil
+}
+
+// POST /user/mfa/enroll
+func UserMfaEnrollHandler(w http.ResponseWriter, r *http.Request) error {
+	userSession := web.ReturnUserSession(r)
+	user, err := controller.GetUser(r.Context(), controller.Store, userSession.UserId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user is not found: %d", userSession.UserId)
+	}
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, user.Id)
+	if err != nil {
+		return err
+	}
+	if userMfa != nil && userMfa.Enabled {
+		return web.ReturnError(web.ErrorCodeConflict, "MFA is already enabled.")
+	}
+	// Generate secret, an unconfirmed enrollment is started over
+	secret, err := security.GenerateTotpSecret()
+	if err != nil {
+		return err
+	}
+	err = controller.RegisterUserMfa(r.Context(), controller.UserMfa{UserId: user.Id, Secret: secret,
+		Created: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	response := UserMfaEnrollOutput{
+		Secret: secret,
+		Uri:    security.ReturnTotpUri(controller.ReturnMfaIssuer(), user.Email, secret),
+	}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// POST /user/mfa/confirm
+func UserMfaConfirmHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var userMfaCodeInput UserMfaCodeInput
+	err := web.DecodeJSONBody(w, r, &userMfaCodeInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = mfaCodeParser(userMfaCodeInput.Code)
+	if err != nil {
+		return err
+	}
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	if userMfa == nil {
+		return web.ReturnError(web.ErrorCodeConflict, "MFA enrollment is not started.")
+	}
+	if userMfa.Enabled {
+		return web.ReturnError(web.ErrorCodeConflict, "MFA is already enabled.")
+	}
+	// Only a TOTP code proves the authenticator app is set up
+	now := time.Now().UTC()
+	counter, match, err := security.ValidateTotpCode(userMfa.Secret, userMfaCodeInput.Code, now, userMfa.LastCounter)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return web.ReturnFieldError(web.ErrorCodeInvalidMfaCode, "code", "Invalid MFA code.")
+	}
+	userMfa.LastCounter = counter
+	codes, recoveryCodes, err := controller.NewRecoveryCodes(userMfa.UserId, now)
+	if err != nil {
+		return err
+	}
+	err = controller.EnableUserMfa(r.Context(), *userMfa, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	response := UserMfaRecoveryOutput{Message: "MFA is enabled.", RecoveryCodes: codes}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// Verify code of the session user whose MFA is enabled
+func verifyUserMfaCode(w http.ResponseWriter, r *http.Request) (*controller.UserMfa, error) {
+	// Parse input
+	var userMfaCodeInput UserMfaCodeInput
+	err := web.DecodeJSONBody(w, r, &userMfaCodeInput)
+	if err != nil {
+		return nil, err
+	}
+	// Input validation
+	err = mfaCodeParser(userMfaCodeInput.Code)
+	if err != nil {
+		return nil, err
+	}
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return nil, err
+	}
+	if userMfa == nil || !userMfa.Enabled {
+		return nil, web.ReturnError(web.ErrorCodeConflict, "MFA is not enabled.")
+	}
+	match, err := controller.VerifyMfaCode(r.Context(), controller.Store, userMfa, userMfaCodeInput.Code,
+		time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, web.ReturnFieldError(web.ErrorCodeInvalidMfaCode, "code", "Invalid MFA code.")
+	}
+	return userMfa, nil
+}
+
+// POST /user/mfa/recovery
+func UserMfaRecoveryHandler(w http.ResponseWriter, r *http.Request) error {
+	userMfa, err := verifyUserMfaCode(w, r)
+	if err != nil {
+		return err
+	}
+	// Previous recovery codes stop working
+	codes, recoveryCodes, err := controller.NewRecoveryCodes(userMfa.UserId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	err = controller.EnableUserMfa(r.Context(), *userMfa, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	response := UserMfaRecoveryOutput{Message: "Recovery codes are renewed.", RecoveryCodes: codes}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// POST /user/mfa/disable
+func UserMfaDisableHandler(w http.ResponseWriter, r *http.Request) error {
+	userMfa, err := verifyUserMfaCode(w, r)
+	if err != nil {
+		return err
+	}
+	err = controller.DisableUserMfa(r.Context(), userMfa.UserId)
+	if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "MFA is disabled."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// POST /user/mfa/reset
+func UserMfaResetHandler(w http.ResponseWriter, r *http.Request) error {
+	// Only admins are able to reset MFA of a user
+	admin, err := controller.GetUser(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	if admin == nil || !controller.IsMfaAdmin(*admin) {
+		return web.ReturnError(web.ErrorCodeForbidden, "Permission denied.")
+	}
+	// Parse input
+	var userMfaResetInput UserMfaResetInput
+	err = web.DecodeJSONBody(w, r, &userMfaResetInput)
+	if err != nil {
+		return err
+	}
+	if len(userMfaResetInput.Email) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "email", "Field cannot be empty: email")
+	}
+	user, err := controller.GetUserByEmail(r.Context(), controller.Store, userMfaResetInput.Email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "email", "Invalid email.")
+	}
+	// User logs in with password only and is able to enroll again
+	err = controller.ResetUserMfa(r.Context(), *user, admin.Id)
+	if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "MFA of the user is reset."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"repgen/controller"
+	"repgen/core"
+	"repgen/security"
+	"repgen/web"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Cookie which keeps state, nonce and PKCE code verifier of a login until the callback
+	CookieKeyOidc     = "oidc"
+	cookieOidcPath    = web.ApiPrefix + "/login/oidc"
+	cookieOidcSeconds = 10 * 60
+	oidcStateLength   = 32
+)
+
+var errOidcDisabled = web.ReturnError(web.ErrorCodeNotFound, "Single sign-on is not configured.")
+
+var errOidcFailed = web.ReturnError(web.ErrorCodeSsoFailed, "Single sign-on is failed.")
+
+// GET /login/oidc
+func OidcLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	if !core.IsOidcEnabled() {
+		return errOidcDisabled
+	}
+	provider, err := core.ReturnOidcProvider(r.Context())
+	if err != nil {
+		return err
+	}
+	// State protects the callback from forged requests and nonce binds the ID token to this login
+	state, err := security.GenerateRandomHex(oidcStateLength)
+	if err != nil {
+		return err
+	}
+	nonce, err := security.GenerateRandomHex(oidcStateLength)
+	if err != nil {
+		return err
+	}
+	codeVerifier, err := security.GenerateCodeVerifier()
+	if err != nil {
+		return err
+	}
+	cookie := &http.Cookie{
+		Name:     CookieKeyOidc,
+		Value:    strings.Join([]string{state, nonce, codeVerifier}, "."),
+		Path:     cookieOidcPath,
+		MaxAge:   cookieOidcSeconds,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Cookie is sent on the top level redirect back from the identity provider
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+	authUrl := provider.ReturnAuthUrl(state, nonce, security.ReturnCodeChallenge(codeVerifier))
+	http.Redirect(w, r, authUrl, http.StatusFound)
+	return nil
+}
+
+// GET /login/oidc/callback
+func OidcCallbackHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now().UTC()
+	if !core.IsOidcEnabled() {
+		return errOidcDisabled
+	}
+	// Rate limit of the client
+	retryAfter, err := controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitLoginIp),
+		web.ReturnRemoteAddr(r), now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many login attempts", retryAfter)
+	}
+	// State, nonce and code verifier are used once
+	state, nonce, codeVerifier := parseOidcCookie(r)
+	http.SetCookie(w, &http.Cookie{Name: CookieKeyOidc, Path: cookieOidcPath, MaxAge: -1, HttpOnly: true})
+	query := r.URL.Query()
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "state", "Invalid state.")
+	}
+	if providerError := query.Get("error"); len(providerError) > 0 {
+		log.Printf("{OidcCallbackHandler} ERR: %s %s\n", providerError, query.Get("error_description"))
+		return errOidcFailed
+	}
+	code := query.Get("code")
+	if len(code) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "code", "Field cannot be empty: code")
+	}
+	// Exchange the code and verify the ID token
+	provider, err := core.ReturnOidcProvider(r.Context())
+	if err != nil {
+		return err
+	}
+	idToken, err := provider.ExchangeCode(r.Context(), code, codeVerifier)
+	if err != nil {
+		log.Printf("{OidcCallbackHandler} ERR: %s\n", err.Error())
+		return errOidcFailed
+	}
+	claims, err := provider.VerifyIdToken(r.Context(), idToken, nonce, now)
+	if err != nil {
+		log.Printf("{OidcCallbackHandler} ERR: %s\n", err.Error())
+		return errOidcFailed
+	}
+	// Users are linked by email only if the identity provider verified it
+	if len(claims.Email) == 0 || !claims.EmailVerified {
+		return web.ReturnError(web.ErrorCodeForbidden, "Email is not verified by the identity provider.")
+	}
+	if len(claims.Email) > controller.UserEmailMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "email", fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength))
+	}
+	// Users created on first login get a random password, they can set one by password reset
+	var hashedPassword string
+	if core.Config.Oidc.AutoCreate {
+		password, err := security.GenerateRandomHex(controller.PasswordResetTokenLength)
+		if err == nil {
+			hashedPassword, err = security.GenerateHashFromPassword(password)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	userIdentity := controller.UserIdentity{Issuer: provider.Issuer, Subject: claims.Subject, Created: now}
+	user, err := controller.LoginUserIdentity(r.Context(), userIdentity, claims.Email,
+		returnOidcUserName(claims), hashedPassword, core.Config.Oidc.AutoCreate,
+		controller.ReturnGroupProjectRoles(claims.Groups))
+	if errors.Is(err, controller.ErrUserIdentityNotFound) {
+		return web.ReturnError(web.ErrorCodeForbidden, "No user is registered with the email.")
+	} else if err != nil {
+		return err
+	}
+	// Second login step is still required if MFA of the user is enabled
+	userMfa, err := controller.GetUserMfa(r.Context(), controller.Store, user.Id)
+	if err != nil {
+		return err
+	}
+	if userMfa != nil && userMfa.Enabled {
+		return startMfaChallenge(w, r, user.Id, now)
+	}
+	if len(core.Config.Oidc.SuccessUrl) == 0 {
+		return startUserSession(w, r, user.Id)
+	}
+	err = createUserSessionCookie(w, r, user.Id)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, core.Config.Oidc.SuccessUrl, http.StatusFound)
+	return nil
+}
+
+// Return state, nonce and code verifier of the login cookie, empty strings if it is missing
+func parseOidcCookie(r *http.Request) (string, string, string) {
+	cookie, err := r.Cookie(CookieKeyOidc)
+	if err != nil {
+		return "", "", ""
+	}
+	values := strings.Split(cookie.Value, ".")
+	if len(values) != 3 {
+		return "", "", ""
+	}
+	return values[0], values[1], values[2]
+}
+
+// Return name of a new user from the claims, the email is used if there is no name
+func returnOidcUserName(claims *core.OidcClaims) string {
+	name := strings.TrimSpace(claims.Name)
+	if len(name) == 0 {
+		name = claims.Email
+	}
+	for len(name) > controller.UserNameMaxLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
@@ -0,0 +1,427 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"repgen/web"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	OpenApiVersion = "3.0.3"
+	// Version of the API, its major version is in web.ApiPrefix
+	ApiVersion = "1.0.0"
+	// Security scheme of the session cookie
+	openApiSessionScheme = "session"
+)
+
+type openApiDocument struct {
+	OpenApi    string                                  `json:"openapi"`
+	Info       openApiInfo                             `json:"info"`
+	Servers    []openApiServer                         `json:"servers"`
+	Paths      map[string]map[string]*openApiOperation `json:"paths"`
+	Components openApiComponents                       `json:"components"`
+}
+
+type openApiInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openApiServer struct {
+	Url string `json:"url"`
+}
+
+type openApiComponents struct {
+	Schemas         map[string]*openApiSchema        `json:"schemas"`
+	SecuritySchemes map[string]openApiSecurityScheme `json:"securitySchemes"`
+}
+
+type openApiSecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+type openApiOperation struct {
+	OperationId string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags"`
+	Parameters  []openApiParameter         `json:"parameters,omitempty"`
+	RequestBody *openApiRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openApiResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openApiParameter struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required,omitempty"`
+	// Arrays are comma separated
+	Style   string         `json:"style,omitempty"`
+	Explode *bool          `json:"explode,omitempty"`
+	Schema  *openApiSchema `json:"schema,omitempty"`
+	// Objects are JSON encoded
+	Content map[string]openApiMediaType `json:"content,omitempty"`
+}
+
+type openApiRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openApiMediaType `json:"content"`
+}
+
+type openApiResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openApiMediaType `json:"content,omitempty"`
+}
+
+type openApiMediaType struct {
+	Schema *openApiSchema `json:"schema"`
+}
+
+type openApiSchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openApiSchema            `json:"items,omitempty"`
+	Properties           map[string]*openApiSchema `json:"properties,omitempty"`
+	AdditionalProperties *openApiSchema            `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// GET /openapi.json
+func OpenApiHandler(w http.ResponseWriter, r *http.Request) error {
+	document, err := ReturnOpenApi()
+	if err != nil {
+		return err
+	}
+	web.SendResponse(w, document, http.StatusOK)
+	return nil
+}
+
+// Return the OpenAPI document of every route, schemas are read from the input and output types of the routes
+func ReturnOpenApi() ([]byte, error) {
+	document := openApiDocument{
+		OpenApi: OpenApiVersion,
+		Info:    openApiInfo{Title: "repgen", Version: ApiVersion},
+		Servers: []openApiServer{{Url: web.ApiPrefix}},
+		Paths:   make(map[string]map[string]*openApiOperation),
+		Components: openApiComponents{
+			Schemas: make(map[string]*openApiSchema),
+			SecuritySchemes: map[string]openApiSecurityScheme{
+				openApiSessionScheme: {Type: "apiKey", In: "cookie", Name: web.CookieKeySession},
+			},
+		},
+	}
+	for _, route := range ReturnRoutes() {
+		operation, err := returnOpenApiOperation(route, document.Components.Schemas)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", route.Method, route.Pattern, err)
+		}
+		if document.Paths[route.Pattern] == nil {
+			document.Paths[route.Pattern] = make(map[string]*openApiOperation)
+		}
+		document.Paths[route.Pattern][strings.ToLower(route.Method)] = operation
+	}
+	body, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// Return differences between given OpenAPI document and the one of the routes, e.g. a document which was not
+// generated again after an input type is changed
+func CompareOpenApi(body []byte) ([]string, error) {
+	expectedBody, err := ReturnOpenApi()
+	if err != nil {
+		return nil, err
+	}
+	var expected, actual map[string]interface{}
+	err = json.Unmarshal(expectedBody, &expected)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &actual)
+	if err != nil {
+		return nil, err
+	}
+	differences := []string{}
+	// Operations and schemas are compared one by one so the differences tell what is changed
+	expectedPaths, _ := expected["paths"].(map[string]interface{})
+	actualPaths, _ := actual["paths"].(map[string]interface{})
+	for _, path := range returnMapKeys(expectedPaths, actualPaths) {
+		expectedOperations, _ := expectedPaths[path].(map[string]interface{})
+		actualOperations, _ := actualPaths[path].(map[string]interface{})
+		for _, method := range returnMapKeys(expectedOperations, actualOperations) {
+			name := strings.ToUpper(method) + " " + path
+			differences = appendDifference(differences, name, expectedOperations[method], actualOperations[method])
+		}
+	}
+	expectedComponents, _ := expected["components"].(map[string]interface{})
+	actualComponents, _ := actual["components"].(map[string]interface{})
+	expectedSchemas, _ := expectedComponents["schemas"].(map[string]interface{})
+	actualSchemas, _ := actualComponents["schemas"].(map[string]interface{})
+	for _, name := range returnMapKeys(expectedSchemas, actualSchemas) {
+		differences = appendDifference(differences, "schema "+name, expectedSchemas[name], actualSchemas[name])
+	}
+	delete(expected, "paths")
+	delete(actual, "paths")
+	delete(expectedComponents, "schemas")
+	delete(actualComponents, "schemas")
+	for _, key := range returnMapKeys(expected, actual) {
+		differences = appendDifference(differences, key, expected[key], actual[key])
+	}
+	return differences, nil
+}
+
+func appendDifference(differences []string, name string, expected interface{}, actual interface{}) []string {
+	switch {
+	case actual == nil:
+		return append(differences, name+" is missing in the document")
+	case expected == nil:
+		return append(differences, name+" is not served")
+	case !reflect.DeepEqual(expected, actual):
+		return append(differences, name+" is changed")
+	}
+	return differences
+}
+
+// Return sorted keys of given maps
+func returnMapKeys(maps ...map[string]interface{}) []string {
+	keyMap := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			keyMap[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keyMap))
+	for key := range keyMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func returnOpenApiOperation(route Route, schemas map[string]*openApiSchema) (*openApiOperation, error) {
+	segments := strings.Split(strings.Trim(route.Pattern, "/"), "/")
+	operation := &openApiOperation{
+		OperationId: returnOperationId(route.Handler),
+		Summary:     route.Summary,
+		Tags:        []string{segments[0]},
+		Responses:   make(map[string]openApiResponse),
+	}
+	// Path parameters are ids
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			operation.Parameters = append(operation.Parameters, openApiParameter{
+				Name:     segment[1 : len(segment)-1],
+				In:       "path",
+				Required: true,
+				Schema:   &openApiSchema{Type: "integer"},
+			})
+		}
+	}
+	if route.Query != nil {
+		parameters, err := returnQueryParameters(reflect.TypeOf(route.Query), schemas)
+		if err != nil {
+			return nil, err
+		}
+		operation.Parameters = append(operation.Parameters, parameters...)
+	}
+	if route.Body != nil {
+		schema, err := returnOpenApiSchema(reflect.TypeOf(route.Body), schemas)
+		if err != nil {
+			return nil, err
+		}
+		operation.RequestBody = &openApiRequestBody{
+			Required: true,
+			Content:  map[string]openApiMediaType{"application/json": {Schema: schema}},
+		}
+	}
+	output := route.Output
+	if output == nil {
+		output = web.Response{}
+	}
+	schema, err := returnOpenApiSchema(reflect.TypeOf(output), schemas)
+	if err != nil {
+		return nil, err
+	}
+	operation.Responses["200"] = openApiResponse{
+		Description: "OK",
+		Content:     map[string]openApiMediaType{"application/json": {Schema: schema}},
+	}
+	// Errors are rendered by web.SendError
+	schema, err = returnOpenApiSchema(reflect.TypeOf(web.Response{}), schemas)
+	if err != nil {
+		return nil, err
+	}
+	operation.Responses["default"] = openApiResponse{
+		Description: "Error",
+		Content:     map[string]openApiMediaType{"application/json": {Schema: schema}},
+	}
+	if route.Auth {
+		operation.Security = []map[string][]string{{openApiSessionScheme: {}}}
+	}
+	return operation, nil
+}
+
+// Return name of the handler function without its package and Handler suffix e.g. ProjectSelect
+func returnOperationId(handler web.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "Handler")
+}
+
+// Return query parameters of the fields of given struct type
+func returnQueryParameters(t reflect.Type, schemas map[string]*openApiSchema) ([]openApiParameter, error) {
+	parameters := []openApiParameter{}
+	fields, err := returnJsonFields(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		parameter := openApiParameter{Name: field.name, In: "query"}
+		schema, err := returnOpenApiSchema(field.t, schemas)
+		if err != nil {
+			return nil, err
+		}
+		switch field.t.Kind() {
+		case reflect.Map, reflect.Struct:
+			parameter.Content = map[string]openApiMediaType{"application/json": {Schema: schema}}
+		case reflect.Slice:
+			explode := false
+			parameter.Style, parameter.Explode, parameter.Schema = "form", &explode, schema
+		default:
+			parameter.Schema = schema
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, nil
+}
+
+type jsonField struct {
+	name string
+	t    reflect.Type
+}
+
+// Return fields of given struct type by their json names, fields of embedded structs are promoted
+func returnJsonFields(t reflect.Type) ([]jsonField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	fields := []jsonField{}
+	names := make(map[string]bool)
+	embedded := []jsonField{}
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || (len(field.PkgPath) > 0 && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+			promoted, err := returnJsonFields(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			embedded = append(embedded, promoted...)
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, t: field.Type})
+		names[name] = true
+	}
+	// Fields of the outer struct win over promoted ones
+	for _, field := range embedded {
+		if !names[field.name] {
+			fields = append(fields, field)
+			names[field.name] = true
+		}
+	}
+	return fields, nil
+}
+
+// Return schema of given type, named structs are added to schemas and referred to
+func returnOpenApiSchema(t reflect.Type, schemas map[string]*openApiSchema) (*openApiSchema, error) {
+	if t == timeType {
+		return &openApiSchema{Type: "string", Format: "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema, err := returnOpenApiSchema(t.Elem(), schemas)
+		if err != nil {
+			return nil, err
+		}
+		// Siblings of $ref are ignored
+		if len(schema.Ref) == 0 {
+			schema.Nullable = true
+		}
+		return schema, nil
+	case reflect.Bool:
+		return &openApiSchema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32:
+		return &openApiSchema{Type: "integer"}, nil
+	case reflect.Int64, reflect.Uint64:
+		return &openApiSchema{Type: "integer", Format: "int64"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &openApiSchema{Type: "number"}, nil
+	case reflect.String:
+		return &openApiSchema{Type: "string"}, nil
+	case reflect.Interface:
+		// Any value
+		return &openApiSchema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := returnOpenApiSchema(t.Elem(), schemas)
+		if err != nil {
+			return nil, err
+		}
+		return &openApiSchema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s has no string keys", t)
+		}
+		values, err := returnOpenApiSchema(t.Elem(), schemas)
+		if err != nil {
+			return nil, err
+		}
+		return &openApiSchema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		name := t.Name()
+		ref := &openApiSchema{Ref: "#/components/schemas/" + name}
+		if len(name) > 0 {
+			if _, ok := schemas[name]; ok {
+				return ref, nil
+			}
+			// Placeholder stops recursion of self referring types
+			schemas[name] = nil
+		}
+		schema := &openApiSchema{Type: "object", Properties: make(map[string]*openApiSchema)}
+		fields, err := returnJsonFields(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			schema.Properties[field.name], err = returnOpenApiSchema(field.t, schemas)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(name) == 0 {
+			return schema, nil
+		}
+		schemas[name] = schema
+		return ref, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", t)
+}
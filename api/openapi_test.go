@@ -0,0 +1,24 @@
+package api
+
+import (
+	"os"
+	"testing"
+)
+
+// Committed document is generated again after routes or their input and output types are changed
+func TestOpenApiDocument(t *testing.T) {
+	body, err := os.ReadFile("../docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	differences, err := CompareOpenApi(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, difference := range differences {
+		t.Error(difference)
+	}
+	if len(differences) > 0 {
+		t.Log("run go run . -openapi-write docs/openapi.json")
+	}
+}
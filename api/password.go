@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"repgen/controller"
+	"repgen/core"
+	"repgen/security"
+	"repgen/web"
+	"strings"
+	"time"
+)
+
+type UserPasswordForgotInput struct {
+	Email string `json:"email"`
+}
+
+type UserPasswordResetInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// POST /user/password/forgot
+func UserPasswordForgotHandler(w http.ResponseWriter, r *http.Request) error {
+	now := time.Now().UTC()
+	// Rate limit of the client
+	retryAfter, err := controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitResetIp),
+		web.ReturnRemoteAddr(r), now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many password reset requests", retryAfter)
+	}
+	// Parse input
+	var userPasswordForgotInput UserPasswordForgotInput
+	err = web.DecodeJSONBody(w, r, &userPasswordForgotInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = userPasswordForgotParser(userPasswordForgotInput)
+	if err != nil {
+		return err
+	}
+	// Rate limit of the email
+	retryAfter, err = controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitResetEmail),
+		controller.ReturnEmailRateLimitKey(userPasswordForgotInput.Email), now)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many password reset requests", retryAfter)
+	}
+	// Response does not reveal whether the email is registered
+	response := web.Response{Status: http.StatusOK, Message: "If the email is registered, a reset link is sent."}
+	user, err := controller.GetUserByEmail(r.Context(), controller.Store, userPasswordForgotInput.Email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		web.SendJsonResponse(w, response, http.StatusOK)
+		return nil
+	}
+	// Generate reset token, the previous tokens of the user stop working
+	token, err := security.GenerateRandomHex(controller.PasswordResetTokenLength)
+	if err != nil {
+		return err
+	}
+	minutes := controller.ReturnPasswordResetMinutes()
+	passwordReset := controller.PasswordReset{
+		UserId:  user.Id,
+		Hash:    security.HashToken(token),
+		Expires: now.Add(time.Duration(minutes) * time.Minute),
+		Created: now,
+	}
+	err = controller.RegisterPasswordReset(r.Context(), &passwordReset)
+	if err != nil {
+		return err
+	}
+	// Email is sent in background so response time does not reveal registered emails
+	go func(email string) {
+		err := core.SendMail(email, "Password reset", returnPasswordResetMailBody(token, minutes))
+		if err != nil {
+			log.Printf("{UserPasswordForgotHandler} ERR: %s\n", err.Error())
+		}
+	}(user.Email)
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+func userPasswordForgotParser(userPasswordForgotInput UserPasswordForgotInput) error {
+	// <email>
+	if len(userPasswordForgotInput.Email) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "email", "Field cannot be empty: email")
+	}
+	if len(userPasswordForgotInput.Email) > controller.UserEmailMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "email", fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength))
+	}
+	_, err := mail.ParseAddress(userPasswordForgotInput.Email)
+	if err != nil {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "email", "Email is not valid.")
+	}
+	return nil
+}
+
+// Return body of password reset email, the token is sent as is if no reset url is configured
+func returnPasswordResetMailBody(token string, minutes int) string {
+	link := token
+	if core.Config != nil && len(core.Config.Password.ResetUrl) > 0 {
+		link = strings.ReplaceAll(core.Config.Password.ResetUrl, "{token}", token)
+	}
+	return fmt.Sprintf("A password reset is requested for your account.\n\n%s\n\n"+
+		"This link is valid for %d minutes. If you did not request it, you can ignore this email.", link, minutes)
+}
+
+// POST /user/password/reset
+func UserPasswordResetHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var userPasswordResetInput UserPasswordResetInput
+	err := web.DecodeJSONBody(w, r, &userPasswordResetInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = userPasswordResetParser(userPasswordResetInput)
+	if err != nil {
+		return err
+	}
+	// Fetch reset token by its hash
+	passwordReset, err := controller.GetPasswordReset(r.Context(), controller.Store,
+		security.HashToken(userPasswordResetInput.Token))
+	if err != nil {
+		return err
+	}
+	if passwordReset == nil || !time.Now().UTC().Before(passwordReset.Expires) {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	hashedPassword, err := security.GenerateHashFromPassword(userPasswordResetInput.Password)
+	if err != nil {
+		return err
+	}
+	// Token is used once, every session of the user is logged out
+	err = controller.ResetPassword(r.Context(), *passwordReset, hashedPassword, time.Now().UTC())
+	if errors.Is(err, controller.ErrPasswordResetNotFound) {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	} else if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "Password is reset."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+func userPasswordResetParser(userPasswordResetInput UserPasswordResetInput) error {
+	// <token>
+	if len(userPasswordResetInput.Token) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "token", "Field cannot be empty: token")
+	}
+	if len(userPasswordResetInput.Token) != controller.PasswordResetTokenLength*2 {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// <password>
+	return passwordPolicyParser(userPasswordResetInput.Password)
+}
@@ -3,223 +3,286 @@ package api
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"repgen/controller"
 	"repgen/web"
-	"strings"
 	"time"
 )
 
 type ProjectCreateInput struct {
 	Name string `json:"name"`
+	// Default time zone of new reports, UTC if empty
+	TimeZone string `json:"time_zone"`
 }
 
-func ProjectCreateHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ProjectCreateHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var projectCreateInput ProjectCreateInput
-		err = web.ParsePostBody(w, r, &projectCreateInput)
-		if err != nil {
-			log.Printf("{ProjectCreateHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = projectCreateParser(projectCreateInput)
-		if err != nil {
-			log.Printf("{ProjectCreateHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Register project
-		project := controller.Project{Name: projectCreateInput.Name, Created: time.Now().UTC(), CreatedUserId: userSession.UserId}
-		err = controller.CreateProject(&project)
-		if err != nil {
-			log.Printf("{ProjectCreateHandler} ERR: %s\n", err.Error())
-			// Check uniqueness of the name
-			if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-				response := web.Response{Message: "Project name already exists."}
-				web.SendJsonResponse(w, response, http.StatusNotAcceptable)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-		} else {
-			response := web.Response{Status: http.StatusOK, Message: "Project is created."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// POST /projects
+func ProjectCreateHandler(w http.ResponseWriter, r *http.Request) error {
+	userSession := web.ReturnUserSession(r)
+	// Parse input
+	var projectCreateInput ProjectCreateInput
+	err := web.DecodeJSONBody(w, r, &projectCreateInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = projectCreateParser(projectCreateInput)
+	if err != nil {
+		return err
 	}
+	// Register project
+	project := controller.Project{Name: projectCreateInput.Name, Created: time.Now().UTC(), CreatedUserId: userSession.UserId,
+		TimeZone: projectCreateInput.TimeZone}
+	if len(project.TimeZone) == 0 {
+		project.TimeZone = controller.DefaultTimeZone
+	}
+	err = controller.CreateProject(r.Context(), controller.Store, &project)
+	// Check uniqueness of the name
+	if errors.Is(err, controller.ErrDuplicate) {
+		return web.ReturnFieldError(web.ErrorCodeAlreadyExists, "name", "Project name already exists.")
+	} else if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "Project is created."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
 func projectCreateParser(projectCreateInput ProjectCreateInput) error {
 	// <name>
 	if len(projectCreateInput.Name) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: name"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "name", "Field cannot be empty: name")
 	}
 	if len(projectCreateInput.Name) > controller.ProjectNameMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: name, max length: %d", controller.ProjectNameMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "name", fmt.Sprintf("Field is too long: name, max length: %d", controller.ProjectNameMaxLength))
+	}
+	// <time_zone>
+	if len(projectCreateInput.TimeZone) > 0 && !controller.IsValidTimeZone(projectCreateInput.TimeZone) {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "time_zone", "Field is invalid: time_zone")
 	}
 	return nil
 }
 
 type ProjectEditInput struct {
-	Id   int    `json:"id"`
+	Id   int    `json:"-"`
 	Name string `json:"name"`
 }
 
-func ProjectEditHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		_, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ProjectEditHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var projectEditInput ProjectEditInput
-		err = web.ParsePostBody(w, r, &projectEditInput)
-		if err != nil {
-			log.Printf("{ProjectEditHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = projectEditParser(projectEditInput)
-		if err != nil {
-			log.Printf("{ProjectEditHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Edit project
-		project := controller.Project{Id: projectEditInput.Id, Name: projectEditInput.Name}
-		rows, err := controller.UpdateProject(&project)
-		if err != nil {
-			log.Printf("{ProjectEditHandler} ERR: %s\n", err.Error())
-			// Check uniqueness of the name
-			if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-				response := web.Response{Message: "Project name already exists."}
-				web.SendJsonResponse(w, response, http.StatusNotAcceptable)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-		} else if rows != 1 {
-			response := web.Response{Message: "Invalid project id."}
-			web.SendJsonResponse(w, response, http.StatusBadRequest)
-		} else {
-			response := web.Response{Message: "Project is updated."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// PATCH /projects/{id}
+func ProjectEditHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var projectEditInput ProjectEditInput
+	err := web.DecodeJSONBody(w, r, &projectEditInput)
+	if err != nil {
+		return err
+	}
+	projectEditInput.Id, err = web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = projectEditParser(projectEditInput)
+	if err != nil {
+		return err
+	}
+	// Edit project
+	project := controller.Project{Id: projectEditInput.Id, Name: projectEditInput.Name}
+	rows, err := controller.UpdateProject(r.Context(), controller.Store, &project)
+	// Check uniqueness of the name
+	if errors.Is(err, controller.ErrDuplicate) {
+		return web.ReturnFieldError(web.ErrorCodeAlreadyExists, "name", "Project name already exists.")
+	} else if err != nil {
+		return err
+	} else if rows != 1 {
+		return errProjectNotFound
 	}
+	response := web.Response{Message: "Project is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
 func projectEditParser(projectEditInput ProjectEditInput) error {
-	// <id>
-	if projectEditInput.Id < 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be lower than zero: id"}
-	}
 	// <name>
 	if len(projectEditInput.Name) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: name"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "name", "Field cannot be empty: name")
 	}
 	if len(projectEditInput.Name) > controller.ProjectNameMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: name, max length: %d", controller.ProjectNameMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "name", fmt.Sprintf("Field is too long: name, max length: %d", controller.ProjectNameMaxLength))
 	}
 	return nil
 }
 
 type ProjectSelectInput struct {
-	Page int `json:"page"`
-}
-
-func ProjectSelectHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		_, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ProjectSelectHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var projectSelectInput ProjectSelectInput
-		err = web.ParsePostBody(w, r, &projectSelectInput)
-		if err != nil {
-			log.Printf("{ProjectSelectHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = projectSelectParser(projectSelectInput)
-		if err != nil {
-			log.Printf("{ProjectSelectHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Select all projects
-		projects, err := controller.SelectProject(projectSelectInput.Page)
-		if err != nil {
-			log.Printf("{ProjectSelectHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
+	ListInput
+	// Case-insensitive part of the project name
+	Search string `json:"search"`
+	// List archived projects instead of active ones
+	Archived bool `json:"archived"`
+	// List projects created by the current user only
+	CreatedByMe bool `json:"created_by_me"`
+}
+
+type ProjectSelectOutput struct {
+	Items []controller.Project `json:"items"`
+	ListOutput
+}
+
+// GET /projects?limit=&cursor=&sort=&order=&search=&archived=&created_by_me=
+func ProjectSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var projectSelectInput ProjectSelectInput
+	var err error
+	projectSelectInput.ListInput, err = parseListInput(r)
+	if err != nil {
+		return err
+	}
+	projectSelectInput.Search = r.URL.Query().Get("search")
+	projectSelectInput.Archived, err = web.ParseQueryBool(r, "archived")
+	if err != nil {
+		return err
+	}
+	projectSelectInput.CreatedByMe, err = web.ParseQueryBool(r, "created_by_me")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	query, err := projectSelectParser(projectSelectInput)
+	if err != nil {
+		return err
+	}
+	if projectSelectInput.CreatedByMe {
+		query.CreatedUserId = web.ReturnUserSession(r).UserId
+	}
+	// Select a page of projects
+	projects, page, err := controller.SelectProject(r.Context(), controller.Store, query)
+	if err != nil {
+		return err
+	}
+	web.SendJsonResponse(w, ProjectSelectOutput{Items: projects, ListOutput: returnListOutput(page)}, http.StatusOK)
+	return nil
+}
+
+func projectSelectParser(projectSelectInput ProjectSelectInput) (controller.ListQuery, error) {
+	// <limit>, <cursor>, <sort>, <order>
+	query, err := listParser(projectSelectInput.ListInput, controller.ListSortCreated, controller.ListSortName)
+	if err != nil {
+		return query, err
+	}
+	// <search>
+	err = listSearchParser(projectSelectInput.Search)
+	query.Search, query.Archived = projectSelectInput.Search, projectSelectInput.Archived
+	return query, err
+}
+
+// POST /projects/{id}/archive
+func ProjectArchiveHandler(w http.ResponseWriter, r *http.Request) error {
+	return projectArchiveHandler(w, r, true)
+}
+
+// POST /projects/{id}/restore
+func ProjectRestoreHandler(w http.ResponseWriter, r *http.Request) error {
+	return projectArchiveHandler(w, r, false)
+}
+
+// Archive or restore project with respect to given flag
+func projectArchiveHandler(w http.ResponseWriter, r *http.Request, archive bool) error {
+	// Fetch project
+	project, err := returnPathProject(r)
+	if err != nil {
+		return err
+	} else if (project.Archived != nil) == archive {
+		response := web.ReturnError(web.ErrorCodeConflict, "Project is already archived.")
+		if !archive {
+			response.Message = "Project is not archived."
 		}
-		web.SendJsonResponse(w, projects, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+		return response
+	}
+	project.Archived = nil
+	if archive {
+		now := time.Now().UTC()
+		project.Archived = &now
+	}
+	rows, err := controller.ArchiveProject(r.Context(), *project, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return errProjectNotFound
+	}
+	response := web.Response{Message: "Project is archived."}
+	if !archive {
+		response.Message = "Project is restored."
+	}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// Query parameters of DELETE /projects/{id} and DELETE /reports/{id}
+type ConfirmQuery struct {
+	// Name of the deleted project or report
+	Confirm string `json:"confirm"`
+}
+
+// DELETE /projects/{id}?confirm=
+func ProjectDeleteHandler(w http.ResponseWriter, r *http.Request) error {
+	// Fetch project
+	project, err := returnPathProject(r)
+	if err != nil {
+		return err
+	}
+	// Only archived projects can be deleted, and only after confirming the project name
+	if project.Archived == nil {
+		return web.ReturnError(web.ErrorCodeConflict, "Project must be archived before deletion.")
+	}
+	if r.URL.Query().Get("confirm") != project.Name {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "confirm", "Field must be equal to project name: confirm")
+	}
+	err = controller.DeleteProjectPermanently(r.Context(), *project, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	response := web.Response{Message: "Project is deleted."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+var errProjectNotFound = web.ReturnError(web.ErrorCodeNotFound, "Project is not found.")
+
+// Return project of the id path parameter
+func returnPathProject(r *http.Request) (*controller.Project, error) {
+	projectId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	project, err := controller.GetProject(r.Context(), controller.Store, projectId)
+	if err != nil {
+		return nil, err
+	} else if project == nil {
+		return nil, errProjectNotFound
 	}
+	// Routes which change the project require a higher role, see Route.Role
+	err = requireProjectRole(r, project.Id, controller.ProjectRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
 }
 
-func projectSelectParser(projectSelectInput ProjectSelectInput) error {
-	// <page>
-	if projectSelectInput.Page < 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be lower than zero: page"}
+// Return an error unless the user of the session has given role or a higher one in given project
+func requireProjectRole(r *http.Request, projectId int, minRole string) error {
+	if !controller.IsProjectRoleManaged(projectId) {
+		return nil
+	}
+	project, err := controller.GetProject(r.Context(), controller.Store, projectId)
+	if err != nil {
+		return err
+	} else if project == nil {
+		return errProjectNotFound
+	}
+	role, err := controller.ReturnUserProjectRole(r.Context(), controller.Store, web.ReturnUserSession(r).UserId, project)
+	if err != nil {
+		return err
+	}
+	if controller.ProjectRoleRankMap[role] < controller.ProjectRoleRankMap[minRole] {
+		return web.ReturnError(web.ErrorCodeForbidden, "Permission denied.")
 	}
 	return nil
 }
@@ -3,365 +3,592 @@ package api
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"regexp"
 	"repgen/controller"
-	"repgen/security"
+	"repgen/core"
 	"repgen/web"
-	"strings"
 	"time"
 )
 
 type ReportCreateInput struct {
-	ProjectId   int                     `json:"project_id"`
+	ProjectId   int                     `json:"-"`
 	Name        string                  `json:"name"`
 	Interval    int                     `json:"interval"`
 	Description string                  `json:"description"`
 	Definition  []ReportDefinitionInput `json:"definition"`
+	SubmitMode  string                  `json:"submit_mode"`
+	// Time zone of report dates, project time zone if empty
+	TimeZone string `json:"time_zone"`
+	// First day of weekly periods, 0 is Sunday, Monday if nil
+	WeekStart *int `json:"week_start"`
+}
+
+// Token is returned only once, its hash is stored
+type ReportCreateOutput struct {
+	Message  string `json:"message"`
+	ReportId int    `json:"report_id"`
+	Token    string `json:"token"`
 }
 
 type ReportDefinitionInput struct {
-	Name    string `json:"name"`
-	Type    int    `json:"type"`
-	Formula string `json:"formula"`
+	Name       string   `json:"name"`
+	Type       int      `json:"type"`
+	Formula    string   `json:"formula"`
+	EnumValues []string `json:"enum_values"`
+	Precision  int      `json:"precision"`
+	Scale      int      `json:"scale"`
+	// Constraints
+	Required  bool     `json:"required"`
+	Min       *float64 `json:"min"`
+	Max       *float64 `json:"max"`
+	MaxLength int      `json:"max_length"`
+	Pattern   string   `json:"pattern"`
+	// Display metadata
+	Unit     string `json:"unit"`
+	Decimals *int   `json:"decimals"`
+	// Dimension columns form the row key together with report date
+	Dimension bool `json:"dimension"`
 }
 
-func ReportCreateHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var reportCreateInput ReportCreateInput
-		err = web.ParsePostBody(w, r, &reportCreateInput)
-		if err != nil {
-			log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = reportCreateParser(reportCreateInput)
-		if err != nil {
-			log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Create report
-		report := controller.Report{
-			ProjectId:     reportCreateInput.ProjectId,
-			Name:          reportCreateInput.Name,
-			Interval:      reportCreateInput.Interval,
-			Description:   reportCreateInput.Description,
+// POST /projects/{id}/reports
+func ReportCreateHandler(w http.ResponseWriter, r *http.Request) error {
+	userSession := web.ReturnUserSession(r)
+	// Parse input
+	var reportCreateInput ReportCreateInput
+	err := web.DecodeJSONBody(w, r, &reportCreateInput)
+	if err != nil {
+		return err
+	}
+	project, err := returnPathProject(r)
+	if err != nil {
+		return err
+	}
+	reportCreateInput.ProjectId = project.Id
+	// Input validation
+	err = reportCreateParser(reportCreateInput)
+	if err != nil {
+		return err
+	}
+	// Create report
+	report := controller.Report{
+		ProjectId:     reportCreateInput.ProjectId,
+		Name:          reportCreateInput.Name,
+		Interval:      reportCreateInput.Interval,
+		Description:   reportCreateInput.Description,
+		Created:       time.Now().UTC(),
+		CreatedUserId: userSession.UserId,
+		SubmitMode:    reportCreateInput.SubmitMode,
+	}
+	if len(report.SubmitMode) == 0 {
+		report.SubmitMode = controller.ReportSubmitModeMerge
+	}
+	// Report time zone falls back to project time zone
+	report.TimeZone = reportCreateInput.TimeZone
+	if len(report.TimeZone) == 0 {
+		report.TimeZone = project.TimeZone
+	}
+	if len(report.TimeZone) == 0 {
+		report.TimeZone = controller.DefaultTimeZone
+	}
+	report.WeekStart = int(time.Monday)
+	if reportCreateInput.WeekStart != nil {
+		report.WeekStart = *reportCreateInput.WeekStart
+	}
+	// Create column definitions
+	report.Columns = make([]controller.ReportColumn, len(reportCreateInput.Definition))
+	for index, column := range reportCreateInput.Definition {
+		report.Columns[index] = controller.ReportColumn{
+			Name:          column.Name,
+			Type:          column.Type,
+			Formula:       column.Formula,
 			Created:       time.Now().UTC(),
 			CreatedUserId: userSession.UserId,
+			EnumValues:    column.EnumValues,
+			Precision:     column.Precision,
+			Scale:         column.Scale,
+			Required:      column.Required || column.Dimension,
+			Min:           column.Min,
+			Max:           column.Max,
+			MaxLength:     column.MaxLength,
+			Pattern:       column.Pattern,
+			Unit:          column.Unit,
+			Decimals:      column.Decimals,
+			Dimension:     column.Dimension,
 		}
-		// Create report
-		for {
-			// Generate token
-			report.Token, err = security.GenerateRandomHex(controller.ReportTokenLength)
-			if err != nil {
-				log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-				return
-			}
-			// Register report
-			err = controller.CreateReport(&report)
-			if err != nil {
-				log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-				// Check uniqueness of the token
-				if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-					// This token exists in database -> Start over
-					continue
-				} else {
-					web.SendHttpMethod(w, http.StatusInternalServerError)
-					return
-				}
-			} else if report.Id == 0 {
-				// Insert is failed
-				log.Printf("{ReportCreateHandler} CreateReport is failed, report id is 0.\n")
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-				return
-			} else {
-				break
-			}
-		}
-		// Create column definitions
-		report.Columns = make([]controller.ReportColumn, len(reportCreateInput.Definition))
-		for index, column := range reportCreateInput.Definition {
-			report.Columns[index] = controller.ReportColumn{
-				ReportId:      report.Id,
-				Name:          column.Name,
-				Type:          column.Type,
-				Formula:       column.Formula,
-				Created:       time.Now().UTC(),
-				CreatedUserId: userSession.UserId,
-			}
-		}
-		// Register column definitions
-		err = controller.CreateReportColumns(report.Columns)
+	}
+	// Register report, column definitions, first token and report data table at once
+	var token string
+	for {
+		// Generate token
+		token, err = generateReportToken()
 		if err != nil {
-			log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
+			return err
 		}
-		// Create report data table with respect to columns
-		err = controller.CreateReportDataTable(report)
-		if err != nil {
-			log.Printf("{ReportCreateHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
+		reportToken := controller.NewReportToken(token, controller.ReportTokenDefaultLabel, userSession.UserId,
+			time.Now().UTC())
+		err = controller.RegisterReport(r.Context(), &report, &reportToken)
+		// Check uniqueness of the token
+		if errors.Is(err, controller.ErrDuplicate) {
+			// This token exists in database -> Start over
+			continue
+		} else if err != nil {
+			return err
 		}
-
-		response := web.Response{Status: http.StatusOK, Message: "Report is created."}
-		web.SendJsonResponse(w, response, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+		break
 	}
+
+	output := ReportCreateOutput{Message: "Report is created.", ReportId: report.Id, Token: token}
+	web.SendJsonResponse(w, output, http.StatusOK)
+	return nil
 }
 
 func reportCreateParser(reportCreateInput ReportCreateInput) error {
 	// <name>
 	if len(reportCreateInput.Name) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: name"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "name", "Field cannot be empty: name")
 	}
 	if len(reportCreateInput.Name) > controller.ReportNameMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: name, max length: %d", controller.ReportNameMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "name", fmt.Sprintf("Field is too long: name, max length: %d", controller.ReportNameMaxLength))
 	}
 	// <interval>
 	if _, ok := controller.ReportIntervalMap[reportCreateInput.Interval]; !ok {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field is invalid: interval"}
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "interval", "Field is invalid: interval")
+	}
+	// <time_zone>
+	if len(reportCreateInput.TimeZone) > 0 && !controller.IsValidTimeZone(reportCreateInput.TimeZone) {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "time_zone", "Field is invalid: time_zone")
+	}
+	// <week_start>
+	if reportCreateInput.WeekStart != nil && !controller.IsValidWeekStart(*reportCreateInput.WeekStart) {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "week_start", "Field is invalid: week_start, must be between 0 and 6")
 	}
 	// <description>
 	if len(reportCreateInput.Description) > controller.ReportDescriptionMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: description, max length: %d", controller.ReportDescriptionMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "description", fmt.Sprintf("Field is too long: description, max length: %d", controller.ReportDescriptionMaxLength))
+	}
+	// <submit_mode>
+	if _, ok := controller.ReportSubmitModeMap[reportCreateInput.SubmitMode]; !ok && len(reportCreateInput.SubmitMode) > 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "submit_mode", "Field is invalid: submit_mode")
 	}
 	// <definition>
 	if len(reportCreateInput.Definition) == 0 {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: "Field is empty: definition",
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "definition", "Field is empty: definition")
 	}
 	if len(reportCreateInput.Definition) > controller.ReportColumnMaxCount {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too many: definition, max count: %d", controller.ReportColumnMaxCount),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "definition", fmt.Sprintf("Field is too many: definition, max count: %d", controller.ReportColumnMaxCount))
 	}
 	var emptyStruct struct{}
 	columnNameMap := make(map[string]struct{})
+	dimensionCount := 0
 	for index, column := range reportCreateInput.Definition {
 		// Column name
 		if len(column.Name) == 0 {
-			return &web.Response{
-				Status:  http.StatusBadRequest,
-				Message: fmt.Sprintf("Field cannot be empty: name at index %d", index+1),
-			}
+			return web.ReturnFieldError(web.ErrorCodeFieldRequired, fmt.Sprintf("definition[%d].name", index), fmt.Sprintf("Field cannot be empty: name at index %d", index+1))
 		}
 		if len(column.Name) > controller.ReportColumnNameMaxLength {
-			return &web.Response{
-				Status: http.StatusBadRequest,
-				Message: fmt.Sprintf("Field is too long: name at index %d, max length: %d",
-					index+1, controller.ReportColumnNameMaxLength),
-			}
+			return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].name", index), fmt.Sprintf("Field is too long: name at index %d, max length: %d", index+1, controller.ReportColumnNameMaxLength))
 		}
 		// Duplicate control
 		if _, ok := columnNameMap[column.Name]; ok {
-			return &web.Response{
-				Status:  http.StatusBadRequest,
-				Message: fmt.Sprintf("Duplicate column name at index %d", index+1),
-			}
+			return web.ReturnFieldError(web.ErrorCodeFieldDuplicate, fmt.Sprintf("definition[%d].name", index), fmt.Sprintf("Duplicate column name at index %d", index+1))
 		}
 		columnNameMap[column.Name] = emptyStruct
 		// Column type
 		if _, ok := controller.ReportColumnTypeMap[column.Type]; !ok {
-			return &web.Response{
-				Status:  http.StatusBadRequest,
-				Message: fmt.Sprintf("Field is invalid: type at index %d", index+1),
-			}
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].type", index), fmt.Sprintf("Field is invalid: type at index %d", index+1))
 		}
 		// Column type -> Formula
 		if column.Type == controller.ReportColumnTypeFormula {
 			if len(column.Formula) == 0 {
-				return &web.Response{
-					Status:  http.StatusBadRequest,
-					Message: fmt.Sprintf("Field cannot be empty: formula at index %d", index+1),
-				}
+				return web.ReturnFieldError(web.ErrorCodeFieldRequired, fmt.Sprintf("definition[%d].formula", index), fmt.Sprintf("Field cannot be empty: formula at index %d", index+1))
 			}
 			if len(column.Formula) > controller.ReportColumnFormulaMaxLength {
-				return &web.Response{
-					Status: http.StatusBadRequest,
-					Message: fmt.Sprintf("Field is too long: formula at index %d, max length: %d",
-						index+1, controller.ReportColumnFormulaMaxLength),
-				}
+				return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].formula", index), fmt.Sprintf("Field is too long: formula at index %d, max length: %d", index+1, controller.ReportColumnFormulaMaxLength))
 			}
 		}
+		// Column type -> Enum
+		if column.Type == controller.ReportColumnTypeEnum {
+			err := reportEnumValuesParser(column.EnumValues, index)
+			if err != nil {
+				return err
+			}
+		} else if len(column.EnumValues) > 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Field is only valid for enum: enum_values at index %d", index+1))
+		}
+		// Column type -> Decimal
+		if column.Type == controller.ReportColumnTypeDecimal {
+			if column.Precision < 1 || column.Precision > controller.ReportColumnDecimalMaxDigits {
+				return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, fmt.Sprintf("definition[%d].precision", index), fmt.Sprintf("Field is invalid: precision at index %d, must be between 1 and %d", index+1, controller.ReportColumnDecimalMaxDigits))
+			}
+			if column.Scale < 0 || column.Scale > column.Precision {
+				return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, fmt.Sprintf("definition[%d].scale", index), fmt.Sprintf("Field is invalid: scale at index %d, must be between 0 and precision", index+1))
+			}
+		} else if column.Precision != 0 || column.Scale != 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].precision", index), fmt.Sprintf("Field is only valid for decimal: precision at index %d", index+1))
+		}
+		// Constraints
+		err := reportColumnConstraintParser(column, index)
+		if err != nil {
+			return err
+		}
+		if column.Dimension {
+			dimensionCount++
+		}
+	}
+	if dimensionCount > controller.ReportColumnDimensionMaxCount {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "definition", fmt.Sprintf("Field has too many dimensions: definition, max count: %d", controller.ReportColumnDimensionMaxCount))
 	}
 
 	return nil
 }
 
-type ReportSelectInput struct {
-	ProjectId int `json:"project_id"`
-	Page      int `json:"page"`
+func reportEnumValuesParser(enumValues []string, index int) error {
+	if len(enumValues) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Field is empty: enum_values at index %d", index+1))
+	}
+	if len(enumValues) > controller.ReportColumnEnumMaxCount {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Field is too many: enum_values at index %d, max count: %d", index+1, controller.ReportColumnEnumMaxCount))
+	}
+	enumValueMap := make(map[string]struct{})
+	for _, enumValue := range enumValues {
+		if len(enumValue) == 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldRequired, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Field cannot contain empty value: enum_values at index %d", index+1))
+		}
+		if len(enumValue) > controller.ReportColumnEnumMaxLength {
+			return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Field is too long: enum_values at index %d, max length: %d", index+1, controller.ReportColumnEnumMaxLength))
+		}
+		if _, ok := enumValueMap[enumValue]; ok {
+			return web.ReturnFieldError(web.ErrorCodeFieldDuplicate, fmt.Sprintf("definition[%d].enum_values", index), fmt.Sprintf("Duplicate enum value at index %d: %s", index+1, enumValue))
+		}
+		enumValueMap[enumValue] = struct{}{}
+	}
+	return nil
 }
 
-func ReportSelectHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		_, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ReportSelectHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
+func reportColumnConstraintParser(column ReportDefinitionInput, index int) error {
+	if column.Required && column.Type == controller.ReportColumnTypeFormula {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].required", index), fmt.Sprintf("Formula cannot be required: required at index %d", index+1))
+	}
+	// <min> & <max>
+	if column.Min != nil || column.Max != nil {
+		if !controller.IsNumericColumnType(column.Type) {
+			field := "min"
+			if column.Min == nil {
+				field = "max"
 			}
-			return
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].%s", index, field), fmt.Sprintf("Field is only valid for numeric columns: %s at index %d", field, index+1))
 		}
-		// Parse input
-		var reportSelectInput ReportSelectInput
-		err = web.ParsePostBody(w, r, &reportSelectInput)
-		if err != nil {
-			log.Printf("{ReportSelectHandler} ERR: %s\n", err.Error())
-			return
+		if column.Min != nil && column.Max != nil && *column.Min > *column.Max {
+			return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, fmt.Sprintf("definition[%d].min", index), fmt.Sprintf("Field cannot be greater than max: min at index %d", index+1))
 		}
-		// Input validation
-		err = reportSelectParser(reportSelectInput)
-		if err != nil {
-			log.Printf("{ReportSelectHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
+	}
+	// <max_length> & <pattern>
+	if column.MaxLength != 0 || len(column.Pattern) > 0 {
+		if column.Type != controller.ReportColumnTypeStr {
+			field := "max_length"
+			if column.MaxLength == 0 {
+				field = "pattern"
 			}
-			return
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].%s", index, field), fmt.Sprintf("Field is only valid for str columns: %s at index %d", field, index+1))
 		}
-		// Select all projects
-		projects, err := controller.SelectReport(reportSelectInput.ProjectId, reportSelectInput.Page)
-		if err != nil {
-			log.Printf("{ReportSelectHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
+		if column.MaxLength < 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, fmt.Sprintf("definition[%d].max_length", index), fmt.Sprintf("Field cannot be lower than zero: max_length at index %d", index+1))
+		}
+		if len(column.Pattern) > controller.ReportColumnPatternMaxLength {
+			return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].pattern", index), fmt.Sprintf("Field is too long: pattern at index %d, max length: %d", index+1, controller.ReportColumnPatternMaxLength))
 		}
-		web.SendJsonResponse(w, projects, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+		if _, err := regexp.Compile(column.Pattern); err != nil {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].pattern", index), fmt.Sprintf("Field is invalid: pattern at index %d", index+1))
+		}
+	}
+	// <unit>
+	if len(column.Unit) > controller.ReportColumnUnitMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, fmt.Sprintf("definition[%d].unit", index), fmt.Sprintf("Field is too long: unit at index %d, max length: %d", index+1, controller.ReportColumnUnitMaxLength))
 	}
+	// <decimals>
+	if column.Decimals != nil && (*column.Decimals < 0 || *column.Decimals > controller.ReportColumnDecimalMaxDigits) {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, fmt.Sprintf("definition[%d].decimals", index), fmt.Sprintf("Field is invalid: decimals at index %d, must be between 0 and %d", index+1, controller.ReportColumnDecimalMaxDigits))
+	}
+	// <dimension>
+	if column.Dimension && !controller.IsDimensionColumnType(column.Type) {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, fmt.Sprintf("definition[%d].dimension", index), fmt.Sprintf("Field is only valid for str, int, bool, date and enum columns: dimension at index %d", index+1))
+	}
+	return nil
 }
 
-func reportSelectParser(reportSelectInput ReportSelectInput) error {
-	// <page>
-	if reportSelectInput.Page < 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be lower than zero: page"}
+type ReportSelectInput struct {
+	ProjectId int `json:"-"`
+	ListInput
+	// Case-insensitive part of the report name
+	Search string `json:"search"`
+	// List archived reports instead of active ones
+	Archived bool `json:"archived"`
+	// List reports created by the current user only
+	CreatedByMe bool `json:"created_by_me"`
+}
+
+type ReportSelectOutput struct {
+	Items []controller.Report `json:"items"`
+	ListOutput
+}
+
+// GET /projects/{id}/reports?limit=&cursor=&sort=&order=&search=&archived=&created_by_me=
+func ReportSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	project, err := returnPathProject(r)
+	if err != nil {
+		return err
+	}
+	// Parse input
+	reportSelectInput := ReportSelectInput{ProjectId: project.Id}
+	reportSelectInput.ListInput, err = parseListInput(r)
+	if err != nil {
+		return err
 	}
+	reportSelectInput.Search = r.URL.Query().Get("search")
+	reportSelectInput.Archived, err = web.ParseQueryBool(r, "archived")
+	if err != nil {
+		return err
+	}
+	reportSelectInput.CreatedByMe, err = web.ParseQueryBool(r, "created_by_me")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	query, err := reportSelectParser(reportSelectInput)
+	if err != nil {
+		return err
+	}
+	if reportSelectInput.CreatedByMe {
+		query.CreatedUserId = web.ReturnUserSession(r).UserId
+	}
+	// Select a page of reports of the project
+	reports, page, err := controller.SelectReport(r.Context(), controller.Store, reportSelectInput.ProjectId, query)
+	if err != nil {
+		return err
+	}
+	// Column definitions with constraints and display metadata
+	for index := range reports {
+		err = controller.PopulateReportColumns(r.Context(), controller.Store, &reports[index])
+		if err != nil {
+			return err
+		}
+	}
+	web.SendJsonResponse(w, ReportSelectOutput{Items: reports, ListOutput: returnListOutput(page)}, http.StatusOK)
 	return nil
 }
 
+func reportSelectParser(reportSelectInput ReportSelectInput) (controller.ListQuery, error) {
+	// <limit>, <cursor>, <sort>, <order>
+	query, err := listParser(reportSelectInput.ListInput, controller.ListSortCreated, controller.ListSortName)
+	if err != nil {
+		return query, err
+	}
+	// <search>
+	err = listSearchParser(reportSelectInput.Search)
+	query.Search, query.Archived = reportSelectInput.Search, reportSelectInput.Archived
+	return query, err
+}
+
 type ReportRefreshTokenInput struct {
-	ReportId int `json:"report_id"`
+	ReportId int `json:"-"`
+	// Token to rotate, every active token of the report if zero
+	TokenId int `json:"token_id"`
+	// Label of the new token, label of the rotated token if empty
+	Label string `json:"label"`
+	// Minutes the rotated tokens keep working, rotation_grace_minutes of config if nil
+	GraceMinutes *int `json:"grace_minutes"`
 }
 
-func ReportRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		_, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{ReportRefreshTokenHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var reportRefreshTokenInput ReportRefreshTokenInput
-		err = web.ParsePostBody(w, r, &reportRefreshTokenInput)
+// POST /reports/{id}/tokens/refresh
+func ReportRefreshTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var reportRefreshTokenInput ReportRefreshTokenInput
+	err := web.DecodeJSONBody(w, r, &reportRefreshTokenInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = ReportRefreshTokenParser(reportRefreshTokenInput)
+	if err != nil {
+		return err
+	}
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	// New token keeps the label of the rotated token
+	label := reportRefreshTokenInput.Label
+	if len(label) == 0 {
+		label = controller.ReportTokenDefaultLabel
+		reportTokens, err := controller.SelectReportToken(r.Context(), controller.Store, report.Id)
 		if err != nil {
-			log.Printf("{ReportRefreshTokenHandler} ERR: %s\n", err.Error())
-			return
+			return err
 		}
-		// Input validation
-		err = ReportRefreshTokenParser(reportRefreshTokenInput)
-		if err != nil {
-			log.Printf("{ReportRefreshTokenHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
+		for _, reportToken := range reportTokens {
+			if reportToken.Id == reportRefreshTokenInput.TokenId {
+				label = reportToken.Label
 			}
-			return
 		}
-		report := controller.Report{
-			Id: reportRefreshTokenInput.ReportId,
+	}
+	graceMinutes := core.Config.Token.RotationGrace
+	if reportRefreshTokenInput.GraceMinutes != nil {
+		graceMinutes = *reportRefreshTokenInput.GraceMinutes
+	}
+	for {
+		// Generate token
+		token, err := generateReportToken()
+		if err != nil {
+			return err
 		}
-		for {
-			// Generate token
-			report.Token, err = security.GenerateRandomHex(controller.ReportTokenLength)
-			if err != nil {
-				log.Printf("{ReportRefreshTokenHandler} ERR: %s\n", err.Error())
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-				return
-			}
-			// Update report token
-			rows, err := controller.UpdateReportToken(report)
-			if err != nil {
-				log.Printf("{ReportRefreshTokenHandler} ERR: %s\n", err.Error())
-				// Check uniqueness of the token
-				if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-					// This token exists in database -> Start over
-					continue
-				} else {
-					web.SendHttpMethod(w, http.StatusInternalServerError)
-					return
-				}
-			} else if rows != 1 {
-				// Update did not change any rows
-				response := web.Response{Message: "Invalid report id."}
-				web.SendJsonResponse(w, response, http.StatusBadRequest)
-				return
-			} else {
-				response := web.Response{Status: http.StatusOK, Message: "Report token is refreshed."}
-				web.SendJsonResponse(w, response, http.StatusOK)
-				return
-			}
+		reportToken := controller.NewReportToken(token, label, web.ReturnUserSession(r).UserId, time.Now().UTC())
+		reportToken.ReportId = report.Id
+		// Replace report token, rotated tokens expire after the grace period
+		err = controller.RotateReportToken(r.Context(), &reportToken, reportRefreshTokenInput.TokenId,
+			time.Duration(graceMinutes)*time.Minute)
+		// Check uniqueness of the token
+		if errors.Is(err, controller.ErrDuplicate) {
+			// This token exists in database -> Start over
+			continue
+		} else if errors.Is(err, controller.ErrReportTokenNotFound) {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "token_id", "Invalid token id.")
+		} else if err != nil {
+			return err
 		}
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+		web.SendJsonResponse(w, ReportTokenOutput{ReportToken: reportToken, Token: token}, http.StatusOK)
+		return nil
 	}
 }
 
 func ReportRefreshTokenParser(reportRefreshTokenInput ReportRefreshTokenInput) error {
-	// <id>
-	if reportRefreshTokenInput.ReportId < 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be lower than zero: report_id"}
+	// <label>
+	if len(reportRefreshTokenInput.Label) > controller.ReportTokenLabelMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "label", fmt.Sprintf("Field is too long: label, max length: %d", controller.ReportTokenLabelMaxLength))
+	}
+	// <grace_minutes>
+	graceMinutes := reportRefreshTokenInput.GraceMinutes
+	if graceMinutes != nil && (*graceMinutes < 0 || *graceMinutes > controller.ReportTokenGraceMaxMinutes) {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "grace_minutes", fmt.Sprintf("Field is invalid: grace_minutes, must be between 0 and %d", controller.ReportTokenGraceMaxMinutes))
 	}
 	return nil
 }
+
+// POST /reports/{id}/archive
+func ReportArchiveHandler(w http.ResponseWriter, r *http.Request) error {
+	return reportArchiveHandler(w, r, true)
+}
+
+// POST /reports/{id}/restore
+func ReportRestoreHandler(w http.ResponseWriter, r *http.Request) error {
+	return reportArchiveHandler(w, r, false)
+}
+
+// Archive or restore report with respect to given flag
+func reportArchiveHandler(w http.ResponseWriter, r *http.Request, archive bool) error {
+	// Fetch report
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	} else if (report.Archived != nil) == archive {
+		response := web.ReturnError(web.ErrorCodeConflict, "Report is already archived.")
+		if !archive {
+			response.Message = "Report is not archived."
+		}
+		return response
+	}
+	report.Archived = nil
+	if archive {
+		now := time.Now().UTC()
+		report.Archived = &now
+	}
+	rows, err := controller.ArchiveReport(r.Context(), *report, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return errReportNotFound
+	}
+	response := web.Response{Message: "Report is archived."}
+	if !archive {
+		response.Message = "Report is restored."
+	}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// DELETE /reports/{id}?confirm=
+func ReportDeleteHandler(w http.ResponseWriter, r *http.Request) error {
+	// Fetch report
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	// Only archived reports can be deleted, and only after confirming the report name
+	if report.Archived == nil {
+		return web.ReturnError(web.ErrorCodeConflict, "Report must be archived before deletion.")
+	}
+	if r.URL.Query().Get("confirm") != report.Name {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "confirm", "Field must be equal to report name: confirm")
+	}
+	err = controller.DeleteReportPermanently(r.Context(), *report, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	response := web.Response{Message: "Report is deleted."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+type ReportSubmitModeInput struct {
+	SubmitMode string `json:"submit_mode"`
+}
+
+// PUT /reports/{id}/submit_mode
+func ReportSubmitModeHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var reportSubmitModeInput ReportSubmitModeInput
+	err := web.DecodeJSONBody(w, r, &reportSubmitModeInput)
+	if err != nil {
+		return err
+	}
+	reportId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	if _, ok := controller.ReportSubmitModeMap[reportSubmitModeInput.SubmitMode]; !ok {
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "submit_mode", "Field is invalid: submit_mode")
+	}
+	// Update submit mode
+	report := controller.Report{Id: reportId, SubmitMode: reportSubmitModeInput.SubmitMode}
+	rows, err := controller.UpdateReportSubmitMode(r.Context(), controller.Store, report)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return errReportNotFound
+	}
+	response := web.Response{Message: "Report submit mode is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+var errReportNotFound = web.ReturnError(web.ErrorCodeNotFound, "Report is not found.")
+
+// Return report of the id path parameter
+func returnPathReport(r *http.Request) (*controller.Report, error) {
+	reportId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	report, err := controller.GetReport(r.Context(), controller.Store, reportId)
+	if err != nil {
+		return nil, err
+	} else if report == nil {
+		return nil, errReportNotFound
+	}
+	// Routes which change the report require a higher role, see Route.Role
+	err = requireProjectRole(r, report.ProjectId, controller.ProjectRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"repgen/controller"
+	"repgen/web"
+	"strings"
+	"time"
+)
+
+type ReportDataInput struct {
+	ReportId int `json:"-"`
+	// Report dates between [from, to) in the date format of report interval
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Dimension name -> Value or array of values
+	Filter map[string]interface{} `json:"filter"`
+	// Dimension names kept in the result, rows are aggregated over the other dimensions
+	GroupBy   []string `json:"group_by"`
+	Aggregate string   `json:"aggregate"`
+	Limit     int      `json:"limit"`
+}
+
+type ReportDataOutput struct {
+	ReportDate string                 `json:"report_date"`
+	SentDate   time.Time              `json:"sent_date"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// GET /reports/{id}/data?from=&to=&filter=&group_by=&aggregate=&limit=
+func ReportDataHandler(w http.ResponseWriter, r *http.Request) error {
+	// Fetch report with its columns
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	err = controller.PopulateReportColumns(r.Context(), controller.Store, report)
+	if err != nil {
+		return err
+	}
+	// Parse input
+	reportDataInput, err := reportDataQueryParser(r)
+	if err != nil {
+		return err
+	}
+	reportDataInput.ReportId = report.Id
+	// Input validation
+	query, err := reportDataParser(report, *reportDataInput)
+	if err != nil {
+		return err
+	}
+	// Select report data
+	rows, err := controller.QueryReportData(r.Context(), controller.Store, report, *query)
+	if err != nil {
+		return err
+	}
+	outputs := returnReportDataOutputs(report, rows)
+	web.SendJsonResponse(w, outputs, http.StatusOK)
+	return nil
+}
+
+// Read report data input from the query string, filter is a JSON object and group_by is comma separated
+func reportDataQueryParser(r *http.Request) (*ReportDataInput, error) {
+	values := r.URL.Query()
+	reportDataInput := &ReportDataInput{
+		From:      values.Get("from"),
+		To:        values.Get("to"),
+		Aggregate: values.Get("aggregate"),
+	}
+	// <filter>
+	if filter := values.Get("filter"); len(filter) > 0 {
+		err := web.DecodeJSON(strings.NewReader(filter), &reportDataInput.Filter)
+		if err != nil {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "filter", "Field is invalid: filter")
+		}
+	}
+	// <group_by> is aggregated over every dimension if it is given empty
+	if groupBy, ok := values["group_by"]; ok {
+		reportDataInput.GroupBy = []string{}
+		for _, name := range strings.Split(strings.Join(groupBy, ","), ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				reportDataInput.GroupBy = append(reportDataInput.GroupBy, name)
+			}
+		}
+	}
+	// <limit>
+	var err error
+	reportDataInput.Limit, err = web.ParseQueryInt(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	return reportDataInput, nil
+}
+
+// Convert report data rows into outputs keyed by column name
+func returnReportDataOutputs(report *controller.Report, rows []controller.ReportData) []ReportDataOutput {
+	// Map column ids to names
+	reportColumnNameMap := make(map[int]string)
+	reportColumnTypeMap := make(map[int]int)
+	for _, reportColumn := range report.Columns {
+		reportColumnNameMap[reportColumn.Id] = reportColumn.Name
+		reportColumnTypeMap[reportColumn.Id] = reportColumn.Type
+	}
+	// Dates are rendered in the time zone of the report
+	location := controller.ReturnLocation(report.TimeZone)
+	outputs := make([]ReportDataOutput, 0, len(rows))
+	for _, row := range rows {
+		output := ReportDataOutput{
+			ReportDate: controller.FormatReportDate(*report, row.ReportDate),
+			SentDate:   row.SentDate.In(location),
+			Data:       make(map[string]interface{}),
+		}
+		for columnId, value := range row.ColumnMap {
+			if timestamp, ok := value.(time.Time); ok && reportColumnTypeMap[columnId] == controller.ReportColumnTypeTimestamp {
+				value = timestamp.In(location)
+			}
+			output.Data[reportColumnNameMap[columnId]] = value
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs
+}
+
+func reportDataParser(report *controller.Report, reportDataInput ReportDataInput) (*controller.ReportDataQuery, error) {
+	query := &controller.ReportDataQuery{Aggregate: reportDataInput.Aggregate, Limit: reportDataInput.Limit}
+	// <from> & <to>
+	if len(reportDataInput.From) > 0 {
+		from, err := submitReportDateParser(report, reportDataInput.From)
+		if err != nil {
+			return nil, err
+		}
+		query.From = *from
+	}
+	if len(reportDataInput.To) > 0 {
+		to, err := submitReportDateParser(report, reportDataInput.To)
+		if err != nil {
+			return nil, err
+		}
+		query.To = *to
+	}
+	// Map: Dimension name -> Column
+	dimensionMap := make(map[string]controller.ReportColumn)
+	for _, reportColumn := range report.Columns {
+		if reportColumn.Dimension {
+			dimensionMap[reportColumn.Name] = reportColumn
+		}
+	}
+	// <filter>
+	query.Filter = make(map[int][]interface{})
+	for name, value := range reportDataInput.Filter {
+		reportColumn, ok := dimensionMap[name]
+		if !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "filter."+name, fmt.Sprintf("Field is not a dimension: filter.%s", name))
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		if len(values) == 0 {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldRequired, "filter."+name, fmt.Sprintf("Field cannot be empty: filter.%s", name))
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case string, float64, bool:
+			default:
+				return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "filter."+name, fmt.Sprintf("Field is invalid: filter.%s", name))
+			}
+		}
+		query.Filter[reportColumn.Id] = values
+	}
+	// <group_by>
+	if reportDataInput.GroupBy != nil {
+		query.GroupBy = make([]int, 0, len(reportDataInput.GroupBy))
+		for _, name := range reportDataInput.GroupBy {
+			reportColumn, ok := dimensionMap[name]
+			if !ok {
+				return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "group_by", fmt.Sprintf("Field is not a dimension: group_by.%s", name))
+			}
+			query.GroupBy = append(query.GroupBy, reportColumn.Id)
+		}
+	}
+	// <aggregate>
+	if len(query.Aggregate) > 0 {
+		if _, ok := controller.RollupFunctionMap[query.Aggregate]; !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "aggregate", "Field is invalid: aggregate")
+		}
+	}
+	// <limit>
+	if query.Limit < 0 || query.Limit > controller.ReportDataQueryMaxLimit {
+		return nil, web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "limit", fmt.Sprintf("Field is invalid: limit, must be between 0 and %d", controller.ReportDataQueryMaxLimit))
+	}
+	return query, nil
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"repgen/controller"
+	"repgen/security"
+	"repgen/web"
+	"time"
+)
+
+type ReportTokenCreateInput struct {
+	ReportId int    `json:"-"`
+	Label    string `json:"label"`
+}
+
+// Plaintext token is returned only once on creation
+type ReportTokenOutput struct {
+	controller.ReportToken
+	Token string `json:"token"`
+}
+
+// Return a new plaintext report token with prefix
+func generateReportToken() (string, error) {
+	token, err := security.GenerateRandomHex(controller.ReportTokenLength)
+	if err != nil {
+		return "", err
+	}
+	return controller.ReportTokenPrefix + token, nil
+}
+
+// GET /reports/{id}/tokens
+func ReportTokenSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	reportTokens, err := controller.SelectReportToken(r.Context(), controller.Store, report.Id)
+	if err != nil {
+		return err
+	}
+	web.SendJsonResponse(w, reportTokens, http.StatusOK)
+	return nil
+}
+
+// POST /reports/{id}/tokens
+func ReportTokenCreateHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var reportTokenCreateInput ReportTokenCreateInput
+	err := web.DecodeJSONBody(w, r, &reportTokenCreateInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = reportTokenCreateParser(reportTokenCreateInput)
+	if err != nil {
+		return err
+	}
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	// Check active token count of the report
+	reportTokens, err := controller.SelectReportToken(r.Context(), controller.Store, report.Id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	active := 0
+	for _, reportToken := range reportTokens {
+		if !controller.IsReportTokenExpired(reportToken, now) {
+			active++
+		}
+	}
+	if active >= controller.ReportTokenMaxCount {
+		return web.ReturnError(web.ErrorCodeLimitExceeded, fmt.Sprintf("Report cannot have more than %d tokens.", controller.ReportTokenMaxCount))
+	}
+	for {
+		// Generate token
+		token, err := generateReportToken()
+		if err != nil {
+			return err
+		}
+		reportToken := controller.NewReportToken(token, reportTokenCreateInput.Label, web.ReturnUserSession(r).UserId, now)
+		reportToken.ReportId = report.Id
+		err = controller.CreateReportToken(r.Context(), controller.Store, &reportToken)
+		// Check uniqueness of the token
+		if errors.Is(err, controller.ErrDuplicate) {
+			// This token exists in database -> Start over
+			continue
+		} else if err != nil {
+			return err
+		}
+		web.SendJsonResponse(w, ReportTokenOutput{ReportToken: reportToken, Token: token}, http.StatusOK)
+		return nil
+	}
+}
+
+func reportTokenCreateParser(reportTokenCreateInput ReportTokenCreateInput) error {
+	// <label>
+	if len(reportTokenCreateInput.Label) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "label", "Field cannot be empty: label")
+	}
+	if len(reportTokenCreateInput.Label) > controller.ReportTokenLabelMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "label", fmt.Sprintf("Field is too long: label, max length: %d", controller.ReportTokenLabelMaxLength))
+	}
+	return nil
+}
+
+// DELETE /reports/{id}/tokens/{token_id}
+func ReportTokenRevokeHandler(w http.ResponseWriter, r *http.Request) error {
+	reportId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	tokenId, err := web.ParsePathId(r, "token_id")
+	if err != nil {
+		return err
+	}
+	// Token stops working at once
+	rows, err := controller.DeleteReportToken(r.Context(), controller.Store, reportId, tokenId)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return web.ReturnFieldError(web.ErrorCodeNotFound, "token_id", "Invalid token id.")
+	}
+	response := web.Response{Status: http.StatusOK, Message: "Report token is revoked."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"repgen/controller"
+	"repgen/web"
+)
+
+type ReportRetentionInput struct {
+	RetentionDays  *int   `json:"retention_days"`
+	RollupReportId *int   `json:"rollup_report_id"`
+	RollupFunction string `json:"rollup_function"`
+}
+
+// PUT /reports/{id}/retention
+func ReportRetentionHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var reportRetentionInput ReportRetentionInput
+	err := web.DecodeJSONBody(w, r, &reportRetentionInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = reportRetentionParser(reportRetentionInput)
+	if err != nil {
+		return err
+	}
+	// Fetch report
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	report.RetentionDays = reportRetentionInput.RetentionDays
+	report.RollupReportId = reportRetentionInput.RollupReportId
+	report.RollupFunction = ""
+	// Rollup report must be coarser than the report
+	if reportRetentionInput.RollupReportId != nil {
+		rollupReport, err := controller.GetReport(r.Context(), controller.Store, *reportRetentionInput.RollupReportId)
+		if err != nil {
+			return err
+		} else if rollupReport == nil {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "rollup_report_id", "Invalid rollup report id.")
+		} else if !controller.IsCoarserInterval(rollupReport.Interval, report.Interval) {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "rollup_report_id", "Rollup report interval must be coarser than report interval.")
+		}
+		report.RollupFunction = reportRetentionInput.RollupFunction
+		if len(report.RollupFunction) == 0 {
+			report.RollupFunction = controller.RollupFunctionSum
+		}
+	}
+	// Update retention policy
+	rows, err := controller.UpdateReportRetention(r.Context(), controller.Store, *report)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return errReportNotFound
+	}
+	response := web.Response{Message: "Report retention is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+func reportRetentionParser(reportRetentionInput ReportRetentionInput) error {
+	// <retention_days>
+	if reportRetentionInput.RetentionDays != nil && *reportRetentionInput.RetentionDays < 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "retention_days", "Field cannot be lower than zero: retention_days")
+	}
+	// <rollup_function>
+	if len(reportRetentionInput.RollupFunction) > 0 {
+		if reportRetentionInput.RollupReportId == nil {
+			return web.ReturnFieldError(web.ErrorCodeFieldRequired, "rollup_report_id", "Field cannot be empty: rollup_report_id")
+		}
+		if _, ok := controller.RollupFunctionMap[reportRetentionInput.RollupFunction]; !ok {
+			return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "rollup_function", "Field is invalid: rollup_function")
+		}
+	}
+	return nil
+}
+
+type ProjectRetentionInput struct {
+	RetentionDays *int `json:"retention_days"`
+}
+
+// PUT /projects/{id}/retention
+func ProjectRetentionHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var projectRetentionInput ProjectRetentionInput
+	err := web.DecodeJSONBody(w, r, &projectRetentionInput)
+	if err != nil {
+		return err
+	}
+	projectId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = projectRetentionParser(projectRetentionInput)
+	if err != nil {
+		return err
+	}
+	// Update retention policy
+	project := controller.Project{Id: projectId, RetentionDays: projectRetentionInput.RetentionDays}
+	rows, err := controller.UpdateProjectRetention(r.Context(), controller.Store, project)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return errProjectNotFound
+	}
+	response := web.Response{Message: "Project retention is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+func projectRetentionParser(projectRetentionInput ProjectRetentionInput) error {
+	// <retention_days>
+	if projectRetentionInput.RetentionDays != nil && *projectRetentionInput.RetentionDays < 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "retention_days", "Field cannot be lower than zero: retention_days")
+	}
+	return nil
+}
+
+// GET /reports/{id}/retention/preview
+// Dry run of the retention policy, returns how many rows would be removed
+func ReportRetentionPreviewHandler(w http.ResponseWriter, r *http.Request) error {
+	// Fetch report
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	result, err := controller.PreviewRetention(r.Context(), report)
+	if err != nil {
+		return err
+	}
+	web.SendJsonResponse(w, result, http.StatusOK)
+	return nil
+}
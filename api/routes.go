@@ -0,0 +1,214 @@
+package api
+
+import (
+	"net/http"
+	"repgen/controller"
+	"repgen/web"
+	"strings"
+)
+
+// Endpoint of the API with the types which describe it in the OpenAPI document
+type Route struct {
+	Method  string
+	Pattern string
+	Handler web.HandlerFunc
+	// Session cookie is required
+	Auth bool
+	// Minimum role of the user in the project of the path id, or in the project of the report of the path id
+	Role    string
+	Summary string
+	// Struct whose fields are the query parameters by their json names
+	Query interface{}
+	// JSON request body
+	Body interface{}
+	// JSON response body, web.Response if nil
+	Output interface{}
+}
+
+// Return every endpoint served under web.ApiPrefix
+func ReturnRoutes() []Route {
+	return []Route{
+		// Session
+		{Method: http.MethodPost, Pattern: "/login", Handler: LoginHandler,
+			Summary: "Log in with email and password, answers an mfa_token if MFA is enabled",
+			Body:    LoginInput{}, Output: LoginMfaOutput{}},
+		{Method: http.MethodPost, Pattern: "/login/mfa", Handler: LoginMfaHandler,
+			Summary: "Complete a login with a TOTP or recovery code",
+			Body:    LoginMfaInput{}},
+		{Method: http.MethodGet, Pattern: "/login/oidc", Handler: OidcLoginHandler,
+			Summary: "Redirect the browser to the single sign-on provider"},
+		{Method: http.MethodGet, Pattern: "/login/oidc/callback", Handler: OidcCallbackHandler,
+			Summary: "Complete a single sign-on login, called by the provider redirect"},
+		{Method: http.MethodPost, Pattern: "/logout", Handler: LogoutHandler, Auth: true,
+			Summary: "Log out of the current session"},
+		{Method: http.MethodPost, Pattern: "/logout/all", Handler: LogoutAllHandler, Auth: true,
+			Summary: "Log out of every session of the user"},
+		// User
+		{Method: http.MethodPost, Pattern: "/users", Handler: UserCreateHandler,
+			Summary: "Register a user",
+			Body:    UserCreateInput{}},
+		{Method: http.MethodGet, Pattern: "/users", Handler: UserSelectHandler, Auth: true,
+			Summary: "List users, allowed to MFA admins only",
+			Query:   UserSelectInput{}, Output: UserSelectOutput{}},
+		{Method: http.MethodPatch, Pattern: "/user", Handler: UserEditHandler, Auth: true,
+			Summary: "Edit the current user",
+			Body:    UserEditInput{}},
+		{Method: http.MethodPut, Pattern: "/user/password", Handler: UserChangePasswordHandler, Auth: true,
+			Summary: "Change password of the current user",
+			Body:    UserChangePasswordInput{}},
+		{Method: http.MethodPost, Pattern: "/user/password/forgot", Handler: UserPasswordForgotHandler,
+			Summary: "Send a password reset link by email",
+			Body:    UserPasswordForgotInput{}},
+		{Method: http.MethodPost, Pattern: "/user/password/reset", Handler: UserPasswordResetHandler,
+			Summary: "Set a new password with a reset token",
+			Body:    UserPasswordResetInput{}},
+		{Method: http.MethodGet, Pattern: "/user/sessions", Handler: UserSessionSelectHandler, Auth: true,
+			Summary: "List sessions of the current user",
+			Query:   UserSessionSelectInput{}, Output: UserSessionSelectOutput{}},
+		{Method: http.MethodGet, Pattern: "/user/roles", Handler: UserRolesHandler, Auth: true,
+			Summary: "List project roles of the current user",
+			Output:  []controller.ProjectRole{}},
+		{Method: http.MethodPost, Pattern: "/user/mfa/enroll", Handler: UserMfaEnrollHandler, Auth: true,
+			Summary: "Start MFA enrollment and return the TOTP secret",
+			Output:  UserMfaEnrollOutput{}},
+		{Method: http.MethodPost, Pattern: "/user/mfa/confirm", Handler: UserMfaConfirmHandler, Auth: true,
+			Summary: "Enable MFA with a code of the authenticator app",
+			Body:    UserMfaCodeInput{}, Output: UserMfaRecoveryOutput{}},
+		{Method: http.MethodPost, Pattern: "/user/mfa/recovery", Handler: UserMfaRecoveryHandler, Auth: true,
+			Summary: "Renew the recovery codes",
+			Body:    UserMfaCodeInput{}, Output: UserMfaRecoveryOutput{}},
+		{Method: http.MethodPost, Pattern: "/user/mfa/disable", Handler: UserMfaDisableHandler, Auth: true,
+			Summary: "Disable MFA of the current user",
+			Body:    UserMfaCodeInput{}},
+		{Method: http.MethodPost, Pattern: "/user/mfa/reset", Handler: UserMfaResetHandler, Auth: true,
+			Summary: "Reset MFA of a user, allowed to MFA admins only",
+			Body:    UserMfaResetInput{}},
+		// Project
+		{Method: http.MethodGet, Pattern: "/projects", Handler: ProjectSelectHandler, Auth: true,
+			Summary: "List projects",
+			Query:   ProjectSelectInput{}, Output: ProjectSelectOutput{}},
+		{Method: http.MethodPost, Pattern: "/projects", Handler: ProjectCreateHandler, Auth: true,
+			Summary: "Create a project",
+			Body:    ProjectCreateInput{}},
+		{Method: http.MethodPatch, Pattern: "/projects/{id}", Handler: ProjectEditHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Edit a project",
+			Body:    ProjectEditInput{}},
+		{Method: http.MethodDelete, Pattern: "/projects/{id}", Handler: ProjectDeleteHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Permanently delete an archived project, confirm must be equal to its name",
+			Query:   ConfirmQuery{}},
+		{Method: http.MethodPut, Pattern: "/projects/{id}/retention", Handler: ProjectRetentionHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Set retention days of a project",
+			Body:    ProjectRetentionInput{}},
+		{Method: http.MethodPost, Pattern: "/projects/{id}/archive", Handler: ProjectArchiveHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Archive a project"},
+		{Method: http.MethodPost, Pattern: "/projects/{id}/restore", Handler: ProjectRestoreHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Restore an archived project"},
+		{Method: http.MethodPost, Pattern: "/projects/{id}/share", Handler: ProjectShareHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Create or rotate the share token of a project",
+			Body:    ShareInput{}, Output: controller.ShareToken{}},
+		{Method: http.MethodDelete, Pattern: "/projects/{id}/share", Handler: ProjectShareRevokeHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Revoke the share token of a project"},
+		{Method: http.MethodGet, Pattern: "/projects/{id}/reports", Handler: ReportSelectHandler, Auth: true,
+			Summary: "List reports of a project",
+			Query:   ReportSelectInput{}, Output: ReportSelectOutput{}},
+		{Method: http.MethodPost, Pattern: "/projects/{id}/reports", Handler: ReportCreateHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Create a report with its first report token",
+			Body:    ReportCreateInput{}, Output: ReportCreateOutput{}},
+		// Report
+		{Method: http.MethodDelete, Pattern: "/reports/{id}", Handler: ReportDeleteHandler, Auth: true, Role: controller.ProjectRoleOwner,
+			Summary: "Permanently delete an archived report, confirm must be equal to its name",
+			Query:   ConfirmQuery{}},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/archive", Handler: ReportArchiveHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Archive a report"},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/restore", Handler: ReportRestoreHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Restore an archived report"},
+		{Method: http.MethodPut, Pattern: "/reports/{id}/submit_mode", Handler: ReportSubmitModeHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Change submit mode of a report",
+			Body:    ReportSubmitModeInput{}},
+		{Method: http.MethodPut, Pattern: "/reports/{id}/retention", Handler: ReportRetentionHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Set retention policy of a report",
+			Body:    ReportRetentionInput{}},
+		{Method: http.MethodGet, Pattern: "/reports/{id}/retention/preview", Handler: ReportRetentionPreviewHandler, Auth: true,
+			Summary: "Return how many rows the retention policy would remove",
+			Output:  controller.RetentionResult{}},
+		{Method: http.MethodGet, Pattern: "/reports/{id}/data", Handler: ReportDataHandler, Auth: true,
+			Summary: "Return rows of a report",
+			Query:   ReportDataInput{}, Output: []ReportDataOutput{}},
+		{Method: http.MethodGet, Pattern: "/reports/{id}/tokens", Handler: ReportTokenSelectHandler, Auth: true,
+			Summary: "List report tokens of a report",
+			Output:  []controller.ReportToken{}},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/tokens", Handler: ReportTokenCreateHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Create a report token, the token is returned once",
+			Body:    ReportTokenCreateInput{}, Output: ReportTokenOutput{}},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/tokens/refresh", Handler: ReportRefreshTokenHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Rotate report tokens, the new token is returned once",
+			Body:    ReportRefreshTokenInput{}, Output: ReportTokenOutput{}},
+		{Method: http.MethodDelete, Pattern: "/reports/{id}/tokens/{token_id}", Handler: ReportTokenRevokeHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Revoke a report token"},
+		{Method: http.MethodGet, Pattern: "/reports/{id}/submissions", Handler: SubmissionSelectHandler, Auth: true,
+			Summary: "List submissions of a report newest first",
+			Query:   SubmissionSelectInput{}, Output: []controller.Submission{}},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/submissions/replay", Handler: SubmissionReplayHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Submit failed submissions again",
+			Body:    SubmissionReplayInput{}, Output: []SubmissionReplayResult{}},
+		{Method: http.MethodPost, Pattern: "/reports/{id}/share", Handler: ReportShareHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Create or rotate the share token of a report",
+			Body:    ShareInput{}, Output: controller.ShareToken{}},
+		{Method: http.MethodDelete, Pattern: "/reports/{id}/share", Handler: ReportShareRevokeHandler, Auth: true, Role: controller.ProjectRoleEditor,
+			Summary: "Revoke the share token of a report"},
+		// Report tokens and share tokens
+		{Method: http.MethodPost, Pattern: "/submit", Handler: SubmitReportHandler,
+			Summary: "Submit report data with a report token",
+			Body:    SubmitReportInput{}},
+		{Method: http.MethodGet, Pattern: "/share", Handler: ShareDataHandler,
+			Summary: "Return shared report data as json, csv or html",
+			Query:   ShareDataQuery{}, Output: ShareDataOutput{}},
+		// Document
+		{Method: http.MethodGet, Pattern: "/openapi.json", Handler: OpenApiHandler,
+			Summary: "Return this OpenAPI document"},
+	}
+}
+
+// Register every endpoint under web.ApiPrefix
+func RegisterRoutes(router *web.Router) {
+	for _, route := range ReturnRoutes() {
+		var middlewares []web.Middleware
+		if route.Auth {
+			middlewares = append(middlewares, web.AuthMiddleware)
+		}
+		if len(route.Role) > 0 {
+			middlewares = append(middlewares, projectRoleMiddleware(route.Pattern, route.Role))
+		}
+		router.Handle(route.Method, web.ApiPrefix+route.Pattern, route.Handler, middlewares...)
+	}
+	// Unversioned paths which report tokens and share links were given out with before /api/v1
+	router.Post("/submit", SubmitReportHandler)
+	router.Get("/share", ShareDataHandler)
+}
+
+// Return middleware which requires given role in the project of the path id, or in the project of the report of the
+// path id for /reports routes
+func projectRoleMiddleware(pattern string, minRole string) web.Middleware {
+	return func(next web.HandlerFunc) web.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			projectId, err := web.ParsePathId(r, "id")
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(pattern, "/reports/") {
+				report, err := controller.GetReport(r.Context(), controller.Store, projectId)
+				if err != nil {
+					return err
+				} else if report == nil {
+					return errReportNotFound
+				}
+				projectId = report.ProjectId
+			}
+			err = requireProjectRole(r, projectId, minRole)
+			if err != nil {
+				return err
+			}
+			return next(w, r)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"repgen/controller"
+	"repgen/security"
+	"repgen/web"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ShareInput struct {
+	// Zero never expires
+	ExpiresDays int `json:"expires_days"`
+}
+
+// Query parameters of GET /share, described in the OpenAPI document
+type ShareDataQuery struct {
+	Token string `json:"token"`
+	// Required by project share tokens
+	ReportId int    `json:"report_id"`
+	Format   string `json:"format"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Limit    int    `json:"limit"`
+}
+
+type ShareColumnOutput struct {
+	Name     string `json:"name"`
+	Type     int    `json:"type"`
+	Unit     string `json:"unit,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+type ShareDataOutput struct {
+	Report   string              `json:"report"`
+	TimeZone string              `json:"time_zone"`
+	Columns  []ShareColumnOutput `json:"columns"`
+	Rows     []ReportDataOutput  `json:"rows"`
+}
+
+// POST /reports/{id}/share
+func ReportShareHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var shareInput ShareInput
+	err := web.DecodeJSONBody(w, r, &shareInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = shareExpiresDaysParser(shareInput.ExpiresDays)
+	if err != nil {
+		return err
+	}
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	shareToken := controller.ShareToken{
+		Entity:        controller.ShareEntityReport,
+		EntityId:      report.Id,
+		CreatedUserId: web.ReturnUserSession(r).UserId,
+	}
+	return rotateShareToken(w, r, &shareToken, shareInput.ExpiresDays)
+}
+
+// DELETE /reports/{id}/share
+func ReportShareRevokeHandler(w http.ResponseWriter, r *http.Request) error {
+	reportId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	rows, err := controller.DeleteShareToken(r.Context(), controller.Store, controller.ShareEntityReport, reportId)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return web.ReturnError(web.ErrorCodeNotFound, "Report is not shared.")
+	}
+	response := web.Response{Status: http.StatusOK, Message: "Share token is revoked."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+// POST /projects/{id}/share
+func ProjectShareHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var shareInput ShareInput
+	err := web.DecodeJSONBody(w, r, &shareInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = shareExpiresDaysParser(shareInput.ExpiresDays)
+	if err != nil {
+		return err
+	}
+	project, err := returnPathProject(r)
+	if err != nil {
+		return err
+	}
+	shareToken := controller.ShareToken{
+		Entity:        controller.ShareEntityProject,
+		EntityId:      project.Id,
+		CreatedUserId: web.ReturnUserSession(r).UserId,
+	}
+	return rotateShareToken(w, r, &shareToken, shareInput.ExpiresDays)
+}
+
+// DELETE /projects/{id}/share
+func ProjectShareRevokeHandler(w http.ResponseWriter, r *http.Request) error {
+	projectId, err := web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	rows, err := controller.DeleteShareToken(r.Context(), controller.Store, controller.ShareEntityProject, projectId)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return web.ReturnError(web.ErrorCodeNotFound, "Project is not shared.")
+	}
+	response := web.Response{Status: http.StatusOK, Message: "Share token is revoked."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
+}
+
+func shareExpiresDaysParser(expiresDays int) error {
+	// <expires_days>
+	if expiresDays < 0 || expiresDays > controller.ShareTokenMaxDays {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "expires_days", fmt.Sprintf("Field is invalid: expires_days, must be between 0 and %d", controller.ShareTokenMaxDays))
+	}
+	return nil
+}
+
+// Generate a new token for given share token and replace the previous one of its project or report
+func rotateShareToken(w http.ResponseWriter, r *http.Request, shareToken *controller.ShareToken, expiresDays int) error {
+	shareToken.Created = time.Now().UTC()
+	if expiresDays > 0 {
+		expires := shareToken.Created.AddDate(0, 0, expiresDays)
+		shareToken.Expires = &expires
+	}
+	for {
+		// Generate token
+		token, err := security.GenerateRandomHex(controller.ShareTokenLength)
+		if err != nil {
+			return err
+		}
+		shareToken.Token = token
+		shareToken.Hash = security.HashToken(token)
+		err = controller.RotateShareToken(r.Context(), shareToken)
+		// Check uniqueness of the token
+		if errors.Is(err, controller.ErrDuplicate) {
+			// This token exists in database -> Start over
+			continue
+		} else if err != nil {
+			return err
+		}
+		web.SendJsonResponse(w, shareToken, http.StatusOK)
+		return nil
+	}
+}
+
+// GET /share?token=&report_id=&format=&from=&to=&limit=
+// Unauthenticated read only access to report data with a share token, parameters are read from the query string
+// so the HTML page can be opened in a browser
+func ShareDataHandler(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	// Resolve report of the share token
+	report, err := shareReportParser(r, query)
+	if err != nil {
+		return err
+	}
+	err = controller.PopulateReportColumns(r.Context(), controller.Store, report)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	format, dataQuery, err := shareDataParser(report, query)
+	if err != nil {
+		return err
+	}
+	// Select report data
+	rows, err := controller.QueryReportData(r.Context(), controller.Store, report, *dataQuery)
+	if err != nil {
+		return err
+	}
+	output := ShareDataOutput{
+		Report:   report.Name,
+		TimeZone: controller.ReturnLocation(report.TimeZone).String(),
+		Columns:  make([]ShareColumnOutput, 0, len(report.Columns)),
+		Rows:     returnReportDataOutputs(report, rows),
+	}
+	// Columns are listed in the order they are created
+	reportColumns := append([]controller.ReportColumn{}, report.Columns...)
+	sort.Slice(reportColumns, func(i, j int) bool { return reportColumns[i].Id < reportColumns[j].Id })
+	for _, reportColumn := range reportColumns {
+		output.Columns = append(output.Columns, ShareColumnOutput{
+			Name:     reportColumn.Name,
+			Type:     reportColumn.Type,
+			Unit:     reportColumn.Unit,
+			Decimals: reportColumn.Decimals,
+		})
+	}
+	switch format {
+	case controller.ShareFormatCsv:
+		body, err := returnShareCsv(output)
+		if err != nil {
+			return err
+		}
+		web.SendContentResponse(w, "text/csv; charset=utf-8", body, http.StatusOK)
+	case controller.ShareFormatHtml:
+		body, err := returnShareHtml(output)
+		if err != nil {
+			return err
+		}
+		web.SendContentResponse(w, "text/html; charset=utf-8", body, http.StatusOK)
+	default:
+		web.SendJsonResponse(w, output, http.StatusOK)
+	}
+	return nil
+}
+
+// Return the report given share token gives access to, a project token needs the report id of one of its reports
+func shareReportParser(r *http.Request, query url.Values) (*controller.Report, error) {
+	// <token> is looked up by its hash
+	shareToken, err := controller.GetShareToken(r.Context(), controller.Store, security.HashToken(query.Get("token")))
+	if err != nil {
+		return nil, err
+	}
+	if shareToken == nil || controller.IsShareTokenExpired(*shareToken, time.Now().UTC()) {
+		return nil, web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
+	}
+	// <report_id>
+	reportId := shareToken.EntityId
+	if value := query.Get("report_id"); len(value) > 0 {
+		reportId, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "report_id", "Field is invalid: report_id")
+		}
+	} else if shareToken.Entity == controller.ShareEntityProject {
+		return nil, web.ReturnFieldError(web.ErrorCodeFieldRequired, "report_id", "Field cannot be empty: report_id")
+	}
+	report, err := controller.GetReport(r.Context(), controller.Store, reportId)
+	if err != nil {
+		return nil, err
+	}
+	// Reports outside of the share token are reported as missing
+	if report == nil ||
+		(shareToken.Entity == controller.ShareEntityReport && report.Id != shareToken.EntityId) ||
+		(shareToken.Entity == controller.ShareEntityProject && report.ProjectId != shareToken.EntityId) {
+		return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "report_id", "Invalid report id.")
+	}
+	// Archived reports and reports of archived projects are not shared
+	if report.Archived != nil {
+		return nil, web.ReturnError(web.ErrorCodeArchived, "Report is archived.")
+	}
+	project, err := controller.GetProject(r.Context(), controller.Store, report.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	if project != nil && project.Archived != nil {
+		return nil, web.ReturnError(web.ErrorCodeArchived, "Project is archived.")
+	}
+	return report, nil
+}
+
+func shareDataParser(report *controller.Report, query url.Values) (string, *controller.ReportDataQuery, error) {
+	dataQuery := &controller.ReportDataQuery{Limit: controller.ShareDataDefaultLimit}
+	// <format>
+	format := controller.ShareFormatJson
+	if value := query.Get("format"); len(value) > 0 {
+		if _, ok := controller.ShareFormatMap[value]; !ok {
+			return "", nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "format", "Field is invalid: format")
+		}
+		format = value
+	}
+	// <from> & <to>
+	if value := query.Get("from"); len(value) > 0 {
+		from, err := submitReportDateParser(report, value)
+		if err != nil {
+			return "", nil, err
+		}
+		dataQuery.From = *from
+	}
+	if value := query.Get("to"); len(value) > 0 {
+		to, err := submitReportDateParser(report, value)
+		if err != nil {
+			return "", nil, err
+		}
+		dataQuery.To = *to
+	}
+	// <limit>
+	if value := query.Get("limit"); len(value) > 0 {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > controller.ReportDataQueryMaxLimit {
+			return "", nil, web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "limit", fmt.Sprintf("Field is invalid: limit, must be between 1 and %d", controller.ReportDataQueryMaxLimit))
+		}
+		dataQuery.Limit = limit
+	}
+	return format, dataQuery, nil
+}
+
+// Render shared report data as CSV with report date, sent date and a column per report column
+func returnShareCsv(output ShareDataOutput) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	header := []string{"report_date", "sent_date"}
+	for _, column := range output.Columns {
+		header = append(header, column.Name)
+	}
+	err := writer.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range output.Rows {
+		record := []string{row.ReportDate, row.SentDate.Format(time.RFC3339)}
+		for _, column := range output.Columns {
+			value, err := returnShareCsvValue(row.Data[column.Name])
+			if err != nil {
+				return nil, err
+			}
+			record = append(record, value)
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func returnShareCsvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+}
+
+var shareHtmlTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Report}}</title>
+</head>
+<body>
+<h1>{{.Report}}</h1>
+<table>
+<thead>
+<tr><th>report_date</th><th>sent_date</th>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+<p>Time zone: {{.TimeZone}}</p>
+</body>
+</html>
+`))
+
+// Render shared report data as an HTML table, numbers are shown with the decimals and unit of their column
+func returnShareHtml(output ShareDataOutput) ([]byte, error) {
+	page := struct {
+		Report   string
+		TimeZone string
+		Columns  []string
+		Rows     [][]string
+	}{Report: output.Report, TimeZone: output.TimeZone}
+	for _, column := range output.Columns {
+		page.Columns = append(page.Columns, column.Name)
+	}
+	for _, row := range output.Rows {
+		cells := []string{row.ReportDate, row.SentDate.Format("2006-01-02 15:04:05")}
+		for _, column := range output.Columns {
+			cells = append(cells, returnShareHtmlValue(column, row.Data[column.Name]))
+		}
+		page.Rows = append(page.Rows, cells)
+	}
+	var buffer bytes.Buffer
+	err := shareHtmlTemplate.Execute(&buffer, page)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func returnShareHtmlValue(column ShareColumnOutput, value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+		if column.Decimals != nil {
+			text = strconv.FormatFloat(v, 'f', *column.Decimals, 64)
+		}
+	case int64:
+		text = strconv.FormatInt(v, 10)
+		if column.Decimals != nil && *column.Decimals > 0 {
+			text = strconv.FormatFloat(float64(v), 'f', *column.Decimals, 64)
+		}
+	case string:
+		text = v
+		// Decimal columns are kept as strings to preserve their precision
+		if column.Type != controller.ReportColumnTypeDecimal || column.Decimals == nil {
+			break
+		}
+		if rat, ok := new(big.Rat).SetString(v); ok {
+			text = rat.FloatString(*column.Decimals)
+		}
+	default:
+		text = fmt.Sprint(v)
+	}
+	if len(column.Unit) > 0 {
+		text += " " + column.Unit
+	}
+	return text
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"repgen/controller"
+	"repgen/web"
+	"time"
+)
+
+type SubmissionSelectInput struct {
+	ReportId int `json:"-"`
+	Page     int `json:"page"`
+	// Only failed submissions
+	Failed bool `json:"failed"`
+}
+
+// GET /reports/{id}/submissions?page=&failed=
+func SubmissionSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	report, err := returnPathReport(r)
+	if err != nil {
+		return err
+	}
+	// Parse input
+	submissionSelectInput := SubmissionSelectInput{ReportId: report.Id}
+	submissionSelectInput.Page, err = web.ParseQueryInt(r, "page")
+	if err != nil {
+		return err
+	}
+	submissionSelectInput.Failed, err = web.ParseQueryBool(r, "failed")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	if submissionSelectInput.Page < 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "page", "Field cannot be lower than zero: page")
+	}
+	// Select submissions of the report
+	submissions, err := controller.SelectSubmission(r.Context(), controller.Store, submissionSelectInput.ReportId,
+		submissionSelectInput.Page, submissionSelectInput.Failed)
+	if err != nil {
+		return err
+	}
+	web.SendJsonResponse(w, submissions, http.StatusOK)
+	return nil
+}
+
+type SubmissionReplayInput struct {
+	ReportId      int   `json:"-"`
+	SubmissionIds []int `json:"submission_ids"`
+}
+
+type SubmissionReplayResult struct {
+	SubmissionId int `json:"submission_id"`
+	// Submission log entry of the replay, nil if the submission is not replayed
+	ReplayId *int `json:"replay_id"`
+	// Response of the replay or the error of the submission id
+	web.Response
+}
+
+// POST /reports/{id}/submissions/replay
+// Submit payloads of given failed submissions again e.g. after fixing the report definition
+func SubmissionReplayHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var submissionReplayInput SubmissionReplayInput
+	err := web.DecodeJSONBody(w, r, &submissionReplayInput)
+	if err != nil {
+		return err
+	}
+	submissionReplayInput.ReportId, err = web.ParsePathId(r, "id")
+	if err != nil {
+		return err
+	}
+	// Input validation
+	if len(submissionReplayInput.SubmissionIds) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "submission_ids", "Field is empty: submission_ids")
+	}
+	if len(submissionReplayInput.SubmissionIds) > controller.SubmissionReplayMaxCount {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "submission_ids", fmt.Sprintf("Field is too many: submission_ids, max count: %d", controller.SubmissionReplayMaxCount))
+	}
+	// Replay each submission in given order
+	results := make([]SubmissionReplayResult, 0, len(submissionReplayInput.SubmissionIds))
+	for _, submissionId := range submissionReplayInput.SubmissionIds {
+		result := SubmissionReplayResult{SubmissionId: submissionId}
+		submission, err := controller.GetSubmission(r.Context(), controller.Store, submissionId)
+		if err != nil {
+			return err
+		}
+		if submission == nil || submission.ReportId == nil || *submission.ReportId != submissionReplayInput.ReportId {
+			result.Response = *web.ReturnFieldError(web.ErrorCodeNotFound, "submission_ids", "Invalid submission id.")
+			results = append(results, result)
+			continue
+		}
+		if submission.Status == http.StatusOK {
+			result.Response = *web.ReturnFieldError(web.ErrorCodeConflict, "submission_ids", "Submission is not failed.")
+			results = append(results, result)
+			continue
+		}
+		replay := controller.Submission{
+			ReportId:   submission.ReportId,
+			ReplayId:   &submission.Id,
+			Body:       submission.Body,
+			RemoteAddr: web.ReturnRemoteAddr(r),
+			Received:   time.Now().UTC(),
+		}
+		// Replays without date keep the period of the original submission
+		response := submitReport(r.Context(), &replay, submission.Received)
+		replay.Status, replay.Message = response.Status, returnSubmissionMessage(response)
+		err = controller.CreateSubmission(r.Context(), controller.Store, &replay)
+		if err != nil {
+			return err
+		}
+		result.ReplayId = &replay.Id
+		result.Response = *response
+		results = append(results, result)
+	}
+	web.SendJsonResponse(w, results, http.StatusOK)
+	return nil
+}
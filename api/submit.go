@@ -1,242 +1,441 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"math/big"
 	"net/http"
 	"reflect"
+	"regexp"
 	"repgen/controller"
+	"repgen/security"
 	"repgen/web"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-var nilTime = (time.Time{}).UnixNano()
-var ReportIntervalDateFormatMap = map[int]string{
-	controller.ReportIntervalMonthly: "2006-01",
-	controller.ReportIntervalWeekly:  "2006-01-02",
-	controller.ReportIntervalDaily:   "2006-01-02",
-	controller.ReportIntervalHourly:  "2006-01-02 15",
-}
+var decimalRegexp = regexp.MustCompile(`^([+-]?)([0-9]+)(?:\.([0-9]+))?$`)
 
 type SubmitReportInput struct {
-	Token string                 `json:"token"`
-	Date  string                 `json:"date"`
-	Data  map[string]interface{} `json:"data"`
+	Token string `json:"token"`
+	// Report date in the notation of report interval, RFC 3339 timestamp or Unix epoch as a number,
+	// current period if omitted
+	Date interface{}            `json:"date"`
+	Data map[string]interface{} `json:"data"`
 }
 
-func SubmitReportHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse input
-		var submitReportInput SubmitReportInput
-		err := web.ParsePostBody(w, r, &submitReportInput)
-		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = submitReportParser(submitReportInput)
-		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Fetch report from token
-		report, err := controller.GetReportByToken(submitReportInput.Token)
-		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		if report == nil {
-			response := web.Response{Status: http.StatusBadRequest, Message: "Invalid token."}
-			web.SendJsonResponse(w, response, response.Status)
-			return
-		}
-		// Parse report date
-		date, err := submitReportDateParser(report, submitReportInput.Date)
-		if err != nil {
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Populate report columns
-		err = controller.PopulateReportColumns(report)
-		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		// Validate columns
-		reportColumnIdValueMap, err := submitReportColumnParser(report, submitReportInput)
-		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
+// POST /submit
+func SubmitReportHandler(w http.ResponseWriter, r *http.Request) error {
+	submission := controller.Submission{RemoteAddr: web.ReturnRemoteAddr(r), Received: time.Now().UTC()}
+	// Rate limit of the client, rejected requests are not recorded to submission log
+	retryAfter, err := controller.TakeRateLimit(r.Context(), controller.ReturnRateLimit(controller.RateLimitSubmitIp),
+		submission.RemoteAddr, submission.Received)
+	if err != nil {
+		return err
+	} else if retryAfter > 0 {
+		return web.ReturnTooManyRequests("Too many requests", retryAfter)
+	}
+	// Read raw body, then parse and insert report data
+	response := submitReportBodyParser(w, r, &submission)
+	if response == nil {
+		response = submitReport(r.Context(), &submission, submission.Received)
+	}
+	// Record payload without its token and its outcome to submission log
+	submission.Body = controller.RedactSubmissionBody(submission.Body)
+	submission.Status, submission.Message = response.Status, returnSubmissionMessage(response)
+	err = controller.CreateSubmission(r.Context(), controller.Store, &submission)
+	if err != nil {
+		log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
+	}
+	web.SendJsonResponse(w, response, response.Status)
+	return nil
+}
+
+// Read request body into given submission
+func submitReportBodyParser(w http.ResponseWriter, r *http.Request, submission *controller.Submission) *web.Response {
+	err := web.CheckJSONContentType(r)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, web.MaxBodySize))
+	// Submission log keeps valid text only
+	submission.Body = strings.ToValidUTF8(strings.ReplaceAll(string(body), "\x00", ""), "\uFFFD")
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return web.ReturnError(web.ErrorCodeBodyTooLarge, "Request body must not be larger than 1MB")
 		}
-		// Record column values
-		reportData := controller.ReportData{
-			ReportDate: *date,
-			SentDate:   time.Now().UTC(),
-			ColumnMap:  reportColumnIdValueMap,
+		return submitErrorResponse(err)
+	}
+	return nil
+}
+
+// Return message of given response for submission log, messages of the details are joined
+func returnSubmissionMessage(response *web.Response) string {
+	if len(response.Details) == 0 {
+		return response.Message
+	}
+	messages := make([]string, 0, len(response.Details))
+	for _, detail := range response.Details {
+		messages = append(messages, detail.Message)
+	}
+	return fmt.Sprintf("%s %s", response.Message, strings.Join(messages, "; "))
+}
+
+// Return response of given error, unexpected errors are logged and turned into internal server error
+func submitErrorResponse(err error) *web.Response {
+	if response := web.ReturnErrorResponse(err); response != nil {
+		return response
+	}
+	log.Printf("{submitReport} ERR: %s\n", err.Error())
+	return web.ReturnError(web.ErrorCodeInternal, http.StatusText(http.StatusInternalServerError))
+}
+
+// Parse body of given submission and insert its report data, report id of the token is set to the submission.
+// Reports submitted without date get the period of submitted time.
+func submitReport(ctx context.Context, submission *controller.Submission, submitted time.Time) *web.Response {
+	// Parse input
+	var submitReportInput SubmitReportInput
+	err := web.DecodeJSON(strings.NewReader(submission.Body), &submitReportInput)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	// Input validation
+	err = submitReportParser(submitReportInput)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	// Fetch report from token, tokens of replays are redacted so they are submitted to their report
+	// as long as it has a valid token
+	var report *controller.Report
+	if submission.ReplayId != nil && submission.ReportId != nil {
+		report, err = controller.GetReportWithToken(ctx, controller.Store, *submission.ReportId, time.Now().UTC())
+	} else {
+		// <token>
+		if !controller.IsValidReportToken(submitReportInput.Token) {
+			return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid field length: token")
 		}
-		// Insert report data
-		err = controller.InsertReportData(report.Id, &reportData)
+		// Rate limit of the token, the token is kept hashed in the rate limit store
+		var retryAfter time.Duration
+		retryAfter, err = controller.TakeRateLimit(ctx, controller.ReturnRateLimit(controller.RateLimitSubmitToken),
+			security.HashToken(submitReportInput.Token), submitted)
 		if err != nil {
-			log.Printf("{SubmitReportHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
+			return submitErrorResponse(err)
+		} else if retryAfter > 0 {
+			return web.ReturnTooManyRequests("Too many submits for token", retryAfter)
 		}
-		response := web.Response{Status: http.StatusOK, Message: "Report data is submitted."}
-		web.SendJsonResponse(w, response, http.StatusOK)
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+		report, err = controller.GetReportByToken(ctx, controller.Store, submitReportInput.Token, time.Now().UTC())
+	}
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	if report == nil {
+		return web.ReturnError(web.ErrorCodeInvalidToken, "Invalid token.")
 	}
+	submission.ReportId = &report.Id
+	// Archived reports and reports of archived projects do not accept data
+	if report.Archived != nil {
+		return web.ReturnError(web.ErrorCodeArchived, "Report is archived.")
+	}
+	project, err := controller.GetProject(ctx, controller.Store, report.ProjectId)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	if project != nil && project.Archived != nil {
+		return web.ReturnError(web.ErrorCodeArchived, "Project is archived.")
+	}
+	// Parse report date
+	date, err := submitReportDateValueParser(report, submitReportInput.Date, submitted)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	// Populate report columns
+	err = controller.PopulateReportColumns(ctx, controller.Store, report)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	// Validate columns
+	reportColumnIdValueMap, err := submitReportColumnParser(report, submitReportInput)
+	if err != nil {
+		return submitErrorResponse(err)
+	}
+	// Record column values
+	reportData := controller.ReportData{
+		ReportDate: *date,
+		SentDate:   time.Now().UTC(),
+		ColumnMap:  reportColumnIdValueMap,
+	}
+	// Insert report data
+	inserted, err := controller.InsertReportData(ctx, controller.Store, report.Id, report.SubmitMode, &reportData)
+	if errors.Is(err, controller.ErrDuplicate) {
+		return web.ReturnError(web.ErrorCodeConflict, "Report data already exists for date.")
+	} else if err != nil {
+		return submitErrorResponse(err)
+	}
+	if !inserted {
+		return &web.Response{Status: http.StatusOK, Message: "Report data is updated."}
+	}
+	return &web.Response{Status: http.StatusOK, Message: "Report data is inserted."}
 }
 
+// Validate submit input except the token, which is checked unless the submission is a replay
 func submitReportParser(submitReportInput SubmitReportInput) error {
-	// <token>
-	if len(submitReportInput.Token) != controller.ReportTokenLength*2 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Invalid field length: token"}
-	}
 	// <date>
-	if len(submitReportInput.Date) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: date"}
+	switch submitReportInput.Date.(type) {
+	case nil, string, float64:
+	default:
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "date", "Field is invalid: date")
 	}
 	// <data>
 	if len(submitReportInput.Data) == 0 {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: "Field is empty: data",
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "data", "Field is empty: data")
 	}
 	return nil
 }
 
+// Parse submitted report date which is either a string, an epoch number or omitted
+func submitReportDateValueParser(report *controller.Report, submitDate interface{}, submitted time.Time) (*time.Time, error) {
+	switch value := submitDate.(type) {
+	case string:
+		if len(value) > 0 {
+			return submitReportDateParser(report, value)
+		}
+	case float64:
+		date, err := controller.ReturnEpochPeriodStart(*report, value)
+		if err != nil {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "date",
+				"Invalid date, epoch must be seconds or milliseconds between 1970 and 2286.")
+		}
+		return &date, nil
+	}
+	// Omitted date -> Current period
+	date := controller.ReturnPeriodStart(*report, submitted)
+	return &date, nil
+}
+
 func submitReportDateParser(report *controller.Report, submitDate string) (*time.Time, error) {
-	// Fetch date format with respect to report interval
-	dateFormat, ok := ReportIntervalDateFormatMap[report.Interval]
-	if !ok {
-		log.Printf("{SubmitReportDateParser} ERR: Report id %d has invalid interval %d\n", report.Id, report.Interval)
-		response := &web.Response{
-			Status:  http.StatusInternalServerError,
-			Message: http.StatusText(http.StatusInternalServerError),
-		}
-		return nil, response
-	}
-	// Parse date
-	date, err := time.Parse(dateFormat, submitDate)
+	// Parse date with respect to report interval, dates within a period are normalized to its beginning
+	date, err := controller.ParseReportDate(*report, submitDate)
 	if err != nil {
-		var parseError *time.ParseError
-		if errors.As(err, &parseError) {
-			response := &web.Response{Status: http.StatusBadRequest, Message: "Invalid date."}
+		if errors.Is(err, controller.ErrInvalidReportDate) {
+			response := web.ReturnFieldError(web.ErrorCodeFieldInvalid, "date", fmt.Sprintf("Invalid date, expected format: %s", controller.ReportIntervalNotationMap[report.Interval]))
 			return nil, response
 		} else {
 			log.Printf("{SubmitReportDateParser} ERR: %s\n", err.Error())
-			response := &web.Response{
-				Status:  http.StatusInternalServerError,
-				Message: http.StatusText(http.StatusInternalServerError),
-			}
+			response := web.ReturnError(web.ErrorCodeInternal, http.StatusText(http.StatusInternalServerError))
 			return nil, response
 		}
 	}
-	// Check if date is valid
-	if date.UnixNano() == nilTime {
-		response := &web.Response{Status: http.StatusBadRequest, Message: "Invalid date."}
-		return nil, response
-	}
 	return &date, nil
 }
 
+// Parse submitted data of each column, invalid columns are sent together in the details of the error
 func submitReportColumnParser(report *controller.Report, submitReportInput SubmitReportInput) (map[int]interface{}, error) {
-	// Map: Column name -> Type
-	reportColumnNameTypeMap := make(map[string]int)
-	// Map: Column name -> Column id
-	reportColumnNameIdMap := make(map[string]int)
+	// Map: Column name -> Column
+	reportColumnNameMap := make(map[string]controller.ReportColumn)
 	// Map: Column id -> Value
 	reportColumnIdValueMap := make(map[int]interface{})
 	for _, reportColumn := range report.Columns {
-		reportColumnNameTypeMap[reportColumn.Name] = reportColumn.Type
-		reportColumnNameIdMap[reportColumn.Name] = reportColumn.Id
+		reportColumnNameMap[reportColumn.Name] = reportColumn
 	}
+	details := []web.Response{}
 	// Validate column types
 	for columnName, value := range submitReportInput.Data {
-		if columnType, ok := reportColumnNameTypeMap[columnName]; ok {
-			switch columnType {
-			case controller.ReportColumnTypeStr:
-				if reflect.TypeOf(value).String() != "string" {
-					response := &web.Response{
-						Status:  http.StatusBadRequest,
-						Message: fmt.Sprintf("Invalid column type: %s", columnName),
-					}
-					return nil, response
-				}
-			case controller.ReportColumnTypeInt:
-				if reflect.TypeOf(value).String() != "float64" {
-					response := &web.Response{
-						Status:  http.StatusBadRequest,
-						Message: fmt.Sprintf("Invalid column type: %s", columnName),
-					}
-					return nil, response
-				} else {
-					// Check if value is int or float i.e. 3.0 or 3
-					// -> Go serializes integer for empty interface as float64
-					if value != math.Trunc(value.(float64)) {
-						response := &web.Response{
-							Status:  http.StatusBadRequest,
-							Message: fmt.Sprintf("Invalid column type: %s", columnName),
-						}
-						return nil, response
-					}
-				}
-			case controller.ReportColumnTypeFloat:
-				if reflect.TypeOf(value).String() != "float64" {
-					response := &web.Response{
-						Status:  http.StatusBadRequest,
-						Message: fmt.Sprintf("Invalid column type: %s", columnName),
-					}
-					return nil, response
-				}
-			case controller.ReportColumnTypeFormula:
-				response := &web.Response{
-					Status:  http.StatusBadRequest,
-					Message: fmt.Sprintf("Data cannot be send to formula: %s", columnName),
-				}
-				return nil, response
-			default:
-				log.Printf("{submitReportColumnParser} ERR: Report id %d has invalid column type for: %s\n", report.Id, columnName)
-				response := &web.Response{
-					Status:  http.StatusInternalServerError,
-					Message: http.StatusText(http.StatusInternalServerError),
-				}
-				return nil, response
+		reportColumn, ok := reportColumnNameMap[columnName]
+		if !ok {
+			details = append(details, *web.ReturnFieldError(web.ErrorCodeFieldUnknown, "data."+columnName, fmt.Sprintf("Column does not exist: %s", columnName)))
+			continue
+		}
+		value, err := submitColumnValueParser(report, reportColumn, value)
+		if err != nil {
+			// Errors of the column are collected, unexpected errors end the submit at once
+			var response *web.Response
+			if errors.As(err, &response) && response.Status < http.StatusInternalServerError {
+				details = append(details, *response)
+				continue
 			}
-			// Add value to map
-			columnId := reportColumnNameIdMap[columnName]
-			reportColumnIdValueMap[columnId] = value
+			return nil, err
+		}
+		// Add value to map
+		reportColumnIdValueMap[reportColumn.Id] = value
+	}
+	// Required columns must be submitted
+	for _, reportColumn := range report.Columns {
+		if _, ok := submitReportInput.Data[reportColumn.Name]; reportColumn.Required && !ok {
+			details = append(details, *web.ReturnFieldError(web.ErrorCodeFieldRequired, "data."+reportColumn.Name, fmt.Sprintf("Column is required: %s", reportColumn.Name)))
+		}
+	}
+	if len(details) > 0 {
+		// Same payload gets the same error regardless of map order
+		sort.Slice(details, func(i, j int) bool {
+			return details[i].Field < details[j].Field
+		})
+		return nil, web.ReturnDetailsError("Report data is invalid.", details)
+	}
+	return reportColumnIdValueMap, nil
+}
+
+// Validate submitted value of given column and return the value to insert, null clears the value of optional columns
+func submitColumnValueParser(report *controller.Report, reportColumn controller.ReportColumn, value interface{}) (interface{}, error) {
+	columnName := reportColumn.Name
+	if value == nil {
+		if reportColumn.Required || reportColumn.Type == controller.ReportColumnTypeFormula {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldRequired, "data."+columnName, fmt.Sprintf("Column cannot be null: %s", columnName))
+		}
+		return nil, nil
+	}
+	switch reportColumn.Type {
+	case controller.ReportColumnTypeStr:
+		if reflect.TypeOf(value).String() != "string" {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+	case controller.ReportColumnTypeInt:
+		if reflect.TypeOf(value).String() != "float64" {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
 		} else {
-			response := &web.Response{
-				Status:  http.StatusBadRequest,
-				Message: fmt.Sprintf("Column does not exist: %s", columnName),
+			// Check if value is int or float i.e. 3.0 or 3
+			// -> Go serializes integer for empty interface as float64
+			if value != math.Trunc(value.(float64)) {
+				return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
 			}
-			return nil, response
 		}
+	case controller.ReportColumnTypeFloat:
+		if reflect.TypeOf(value).String() != "float64" {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+	case controller.ReportColumnTypeBool:
+		if _, ok := value.(bool); !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+	case controller.ReportColumnTypeDate, controller.ReportColumnTypeTimestamp:
+		// Dates are sent as "2006-01-02", timestamps as RFC 3339
+		layout := controller.ReportColumnDateFormat
+		if reportColumn.Type == controller.ReportColumnTypeTimestamp {
+			layout = time.RFC3339
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+		date, err := time.Parse(layout, text)
+		if err != nil {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid date: %s", columnName))
+		}
+		value = date.UTC()
+	case controller.ReportColumnTypeDecimal:
+		decimal, err := submitDecimalParser(reportColumn, value)
+		if err != nil {
+			return nil, err
+		}
+		value = decimal
+	case controller.ReportColumnTypeEnum:
+		text, ok := value.(string)
+		if !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+		valid := false
+		for _, enumValue := range reportColumn.EnumValues {
+			if text == enumValue {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid enum value: %s", columnName))
+		}
+	case controller.ReportColumnTypeJson:
+		// Only json objects are accepted
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Invalid column type: %s", columnName))
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		value = string(encoded)
+	case controller.ReportColumnTypeFormula:
+		return nil, web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+columnName, fmt.Sprintf("Data cannot be send to formula: %s", columnName))
+	default:
+		log.Printf("{submitColumnValueParser} ERR: Report id %d has invalid column type for: %s\n", report.Id, columnName)
+		return nil, web.ReturnError(web.ErrorCodeInternal, http.StatusText(http.StatusInternalServerError))
 	}
-	return reportColumnIdValueMap, nil
+	// Validate column constraints
+	err := submitColumnConstraintParser(reportColumn, value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Validate given type checked value against min, max, max length and pattern of the column
+func submitColumnConstraintParser(reportColumn controller.ReportColumn, value interface{}) error {
+	if reportColumn.Min != nil || reportColumn.Max != nil {
+		var number *big.Rat
+		switch v := value.(type) {
+		case float64:
+			number = new(big.Rat).SetFloat64(v)
+		case string:
+			number, _ = new(big.Rat).SetString(v)
+		}
+		if number != nil && reportColumn.Min != nil && number.Cmp(new(big.Rat).SetFloat64(*reportColumn.Min)) < 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "data."+reportColumn.Name, fmt.Sprintf("Column is lower than min: %s, min: %g", reportColumn.Name, *reportColumn.Min))
+		}
+		if number != nil && reportColumn.Max != nil && number.Cmp(new(big.Rat).SetFloat64(*reportColumn.Max)) > 0 {
+			return web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "data."+reportColumn.Name, fmt.Sprintf("Column is greater than max: %s, max: %g", reportColumn.Name, *reportColumn.Max))
+		}
+	}
+	if text, ok := value.(string); ok && reportColumn.Type == controller.ReportColumnTypeStr {
+		if reportColumn.MaxLength > 0 && utf8.RuneCountInString(text) > reportColumn.MaxLength {
+			return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "data."+reportColumn.Name, fmt.Sprintf("Column is too long: %s, max length: %d", reportColumn.Name, reportColumn.MaxLength))
+		}
+		if len(reportColumn.Pattern) > 0 {
+			pattern, err := controller.ReturnColumnPattern(reportColumn)
+			if err != nil {
+				// Stored before patterns were validated, it is the report owner's error rather than the submitter's
+				log.Printf("{submitColumnConstraintParser} ERR: Pattern of column %d: %s\n", reportColumn.Id, err.Error())
+			} else if !pattern.MatchString(text) {
+				return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+reportColumn.Name, fmt.Sprintf("Column does not match pattern: %s", reportColumn.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// Validate decimal value against column precision and scale, return its canonical text
+// Decimals may be sent as string to avoid float rounding e.g. "1234.50"
+func submitDecimalParser(reportColumn controller.ReportColumn, value interface{}) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+reportColumn.Name, fmt.Sprintf("Invalid column type: %s", reportColumn.Name))
+	}
+	match := decimalRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return "", web.ReturnFieldError(web.ErrorCodeFieldInvalid, "data."+reportColumn.Name, fmt.Sprintf("Invalid decimal: %s", reportColumn.Name))
+	}
+	sign, integer, fraction := match[1], strings.TrimLeft(match[2], "0"), match[3]
+	if len(integer) > reportColumn.Precision-reportColumn.Scale || len(fraction) > reportColumn.Scale {
+		return "", web.ReturnFieldError(web.ErrorCodeFieldOutOfRange, "data."+reportColumn.Name, fmt.Sprintf("Decimal is out of range: %s, precision: %d, scale: %d", reportColumn.Name, reportColumn.Precision, reportColumn.Scale))
+	}
+	if len(integer) == 0 {
+		integer = "0"
+	}
+	if sign == "+" {
+		sign = ""
+	}
+	if len(fraction) > 0 {
+		return sign + integer + "." + fraction, nil
+	}
+	return sign + integer, nil
 }
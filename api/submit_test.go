@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"repgen/controller"
+	"repgen/web"
+	"testing"
+	"time"
+)
+
+// Return code of given error response, empty if err is nil
+func returnTestErrorCode(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var response *web.Response
+	if !errors.As(err, &response) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return response.Code
+}
+
+func TestSubmitColumnValueParser(t *testing.T) {
+	report := &controller.Report{Id: 1}
+	decimal := controller.ReportColumn{Name: "price", Type: controller.ReportColumnTypeDecimal, Precision: 5, Scale: 2}
+	enum := controller.ReportColumn{Name: "status", Type: controller.ReportColumnTypeEnum, EnumValues: []string{"open", "closed"}}
+	date := controller.ReportColumn{Name: "day", Type: controller.ReportColumnTypeDate}
+	timestamp := controller.ReportColumn{Name: "at", Type: controller.ReportColumnTypeTimestamp}
+	boolean := controller.ReportColumn{Name: "done", Type: controller.ReportColumnTypeBool}
+	jsonColumn := controller.ReportColumn{Name: "meta", Type: controller.ReportColumnTypeJson}
+	for _, test := range []struct {
+		column   controller.ReportColumn
+		value    interface{}
+		expected interface{}
+		code     string
+	}{
+		{decimal, "123.45", "123.45", ""},
+		{decimal, "+007.5", "7.5", ""},
+		{decimal, -0.25, "-0.25", ""},
+		{decimal, "999.99", "999.99", ""},
+		{decimal, "1000", nil, web.ErrorCodeFieldOutOfRange},
+		{decimal, "1.234", nil, web.ErrorCodeFieldOutOfRange},
+		{decimal, "1e3", nil, web.ErrorCodeFieldInvalid},
+		{decimal, "12.", nil, web.ErrorCodeFieldInvalid},
+		{decimal, true, nil, web.ErrorCodeFieldInvalid},
+		{enum, "open", "open", ""},
+		{enum, "Open", nil, web.ErrorCodeFieldInvalid},
+		{enum, 1.0, nil, web.ErrorCodeFieldInvalid},
+		{date, "2026-10-19", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), ""},
+		{date, "2026-02-30", nil, web.ErrorCodeFieldInvalid},
+		{date, "2026-10-19T10:00:00Z", nil, web.ErrorCodeFieldInvalid},
+		{timestamp, "2026-10-19T10:07:00+03:00", time.Date(2026, 10, 19, 7, 7, 0, 0, time.UTC), ""},
+		{timestamp, "2026-10-19 10:07", nil, web.ErrorCodeFieldInvalid},
+		{timestamp, 1792393620.0, nil, web.ErrorCodeFieldInvalid},
+		{boolean, false, false, ""},
+		{boolean, "true", nil, web.ErrorCodeFieldInvalid},
+		{jsonColumn, map[string]interface{}{"a": []interface{}{1.0}}, `{"a":[1]}`, ""},
+		{jsonColumn, "{}", nil, web.ErrorCodeFieldInvalid},
+		{jsonColumn, []interface{}{1.0}, nil, web.ErrorCodeFieldInvalid},
+		{jsonColumn, 1.0, nil, web.ErrorCodeFieldInvalid},
+	} {
+		value, err := submitColumnValueParser(report, test.column, test.value)
+		if code := returnTestErrorCode(t, err); code != test.code {
+			t.Errorf("%s %v: %v, expected %s", test.column.Name, test.value, err, test.code)
+			continue
+		}
+		if expectedDate, ok := test.expected.(time.Time); ok {
+			if date, ok := value.(time.Time); !ok || !date.Equal(expectedDate) {
+				t.Errorf("%s %v: %v, expected %v", test.column.Name, test.value, value, test.expected)
+			}
+		} else if err == nil && value != test.expected {
+			t.Errorf("%s %v: %#v, expected %#v", test.column.Name, test.value, value, test.expected)
+		}
+	}
+}
+
+func TestReportCreateParserColumnTypes(t *testing.T) {
+	for _, test := range []struct {
+		column ReportDefinitionInput
+		code   string
+		field  string
+	}{
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal, Precision: 10, Scale: 2}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal, Precision: 38, Scale: 38}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal}, web.ErrorCodeFieldOutOfRange, "definition[0].precision"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal, Precision: 39}, web.ErrorCodeFieldOutOfRange, "definition[0].precision"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal, Precision: 5, Scale: 6}, web.ErrorCodeFieldOutOfRange, "definition[0].scale"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDecimal, Precision: 5, Scale: -1}, web.ErrorCodeFieldOutOfRange, "definition[0].scale"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeInt, Precision: 5}, web.ErrorCodeFieldInvalid, "definition[0].precision"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeEnum, EnumValues: []string{"a", "b"}}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeEnum}, web.ErrorCodeFieldRequired, "definition[0].enum_values"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeEnum, EnumValues: []string{"a", ""}}, web.ErrorCodeFieldRequired, "definition[0].enum_values"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeEnum, EnumValues: []string{"a", "a"}}, web.ErrorCodeFieldDuplicate, "definition[0].enum_values"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeStr, EnumValues: []string{"a"}}, web.ErrorCodeFieldInvalid, "definition[0].enum_values"},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeBool}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeDate}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeTimestamp}, "", ""},
+		{ReportDefinitionInput{Type: controller.ReportColumnTypeJson}, "", ""},
+		{ReportDefinitionInput{Type: 99}, web.ErrorCodeFieldInvalid, "definition[0].type"},
+	} {
+		test.column.Name = "column"
+		err := reportCreateParser(ReportCreateInput{Name: "Daily", Interval: controller.ReportIntervalDaily,
+			Definition: []ReportDefinitionInput{test.column}})
+		if code := returnTestErrorCode(t, err); code != test.code {
+			t.Errorf("%+v: %v, expected %s", test.column, err, test.code)
+			continue
+		}
+		var response *web.Response
+		if errors.As(err, &response) && response.Field != test.field {
+			t.Errorf("%+v: field %s, expected %s", test.column, response.Field, test.field)
+		}
+	}
+}
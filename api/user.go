@@ -3,14 +3,13 @@ package api
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/mail"
 	"repgen/controller"
 	"repgen/security"
 	"repgen/web"
-	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type UserCreateInput struct {
@@ -19,90 +18,61 @@ type UserCreateInput struct {
 	Name     string `json:"name"`
 }
 
-func UserCreateHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse input
-		var userInput UserCreateInput
-		err := web.ParsePostBody(w, r, &userInput)
-		if err != nil {
-			log.Printf("{UserCreateHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = userCreateInputParser(userInput)
-		if err != nil {
-			log.Printf("{UserCreateHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Hash user password
-		hashedPassword, err := security.GenerateHashFromPassword(userInput.Password)
-		if err != nil {
-			log.Printf("{UserCreateHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		// Register user
-		user := controller.User{Email: userInput.Email, Password: hashedPassword, Name: userInput.Name, Created: time.Now().UTC()}
-		err = controller.CreateUser(&user)
-		if err != nil {
-			log.Printf("{UserCreateHandler} ERR: %s\n", err.Error())
-			// Check uniqueness of the email
-			if strings.Contains(err.Error(), "(SQLSTATE 23505)") {
-				response := web.Response{Message: "Email already exists."}
-				web.SendJsonResponse(w, response, http.StatusNotAcceptable)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-		} else {
-			response := web.Response{Status: http.StatusOK, Message: "User is created."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
-	default:
-		web.SendHttpMethod(w, http.StatusMethodNotAllowed)
+// POST /users
+func UserCreateHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var userInput UserCreateInput
+	err := web.DecodeJSONBody(w, r, &userInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = userCreateInputParser(userInput)
+	if err != nil {
+		return err
+	}
+	// Hash user password
+	hashedPassword, err := security.GenerateHashFromPassword(userInput.Password)
+	if err != nil {
+		return err
 	}
+	// Register user
+	user := controller.User{Email: userInput.Email, Password: hashedPassword, Name: userInput.Name, Created: time.Now().UTC()}
+	err = controller.CreateUser(r.Context(), controller.Store, &user)
+	// Check uniqueness of the email
+	if errors.Is(err, controller.ErrDuplicate) {
+		return web.ReturnFieldError(web.ErrorCodeAlreadyExists, "email", "Email already exists.")
+	} else if err != nil {
+		return err
+	}
+	response := web.Response{Status: http.StatusOK, Message: "User is created."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
 func userCreateInputParser(userInput UserCreateInput) error {
 	// <email>
 	if len(userInput.Email) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: email"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "email", "Field cannot be empty: email")
 	}
 	if len(userInput.Email) > controller.UserEmailMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "email", fmt.Sprintf("Field is too long: email, max length: %d", controller.UserEmailMaxLength))
 	}
 	_, err := mail.ParseAddress(userInput.Email)
 	if err != nil {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Email is not valid."}
+		return web.ReturnFieldError(web.ErrorCodeFieldInvalid, "email", "Email is not valid.")
 	}
 	// <password>
-	if len(userInput.Password) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: password"}
-	}
-	if len(userInput.Password) > controller.UserPasswordMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: password, max length: %d", controller.UserPasswordMaxLength),
-		}
+	err = passwordPolicyParser(userInput.Password)
+	if err != nil {
+		return err
 	}
 	// <name>
 	if len(userInput.Name) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: name"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "name", "Field cannot be empty: name")
 	}
 	if len(userInput.Name) > controller.UserNameMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: name, max length: %d", controller.UserNameMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "name", fmt.Sprintf("Field is too long: name, max length: %d", controller.UserNameMaxLength))
 	}
 	return nil
 }
@@ -111,66 +81,39 @@ type UserEditInput struct {
 	Name string `json:"name"`
 }
 
-func UserEditHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{UserEditHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var userEdit UserEditInput
-		err = web.ParsePostBody(w, r, &userEdit)
-		if err != nil {
-			log.Printf("{UserEditHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = userEditInputParser(userEdit)
-		if err != nil {
-			log.Printf("{UserEditHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		user := controller.User{Id: userSession.UserId, Name: userEdit.Name}
-		// Edit user
-		rows, err := controller.UpdateUser(user)
-		if err != nil {
-			log.Printf("{UserEditHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-		} else if rows != 1 {
-			log.Printf("{UserEditHandler} ERR: Update failed for user id: %d\n", user.Id)
-			web.SendHttpMethod(w, http.StatusBadRequest)
-		} else {
-			response := web.Response{Message: "User is updated."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
+// PATCH /user
+func UserEditHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var userEdit UserEditInput
+	err := web.DecodeJSONBody(w, r, &userEdit)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = userEditInputParser(userEdit)
+	if err != nil {
+		return err
+	}
+	user := controller.User{Id: web.ReturnUserSession(r).UserId, Name: userEdit.Name}
+	// Edit user
+	rows, err := controller.UpdateUser(r.Context(), controller.Store, user)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return web.ReturnError(web.ErrorCodeBadRequest, http.StatusText(http.StatusBadRequest))
 	}
+	response := web.Response{Message: "User is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
 func userEditInputParser(userEdit UserEditInput) error {
 	// <name>
 	if len(userEdit.Name) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: name"}
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "name", "Field cannot be empty: name")
 	}
 	if len(userEdit.Name) > controller.UserNameMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: name, max length: %d", controller.UserNameMaxLength),
-		}
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "name", fmt.Sprintf("Field is too long: name, max length: %d", controller.UserNameMaxLength))
 	}
 	return nil
 }
@@ -179,73 +122,170 @@ type UserChangePasswordInput struct {
 	Password string `json:"password"`
 }
 
-func UserChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "POST":
-		// Parse session token from cookie
-		userSession, err := web.ParseCookieSession(r)
-		if err != nil {
-			log.Printf("{UserChangePasswordHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Parse input
-		var userChangePasswordInput UserChangePasswordInput
-		err = web.ParsePostBody(w, r, &userChangePasswordInput)
-		if err != nil {
-			log.Printf("{UserChangePasswordHandler} ERR: %s\n", err.Error())
-			return
-		}
-		// Input validation
-		err = UserChangePasswordParser(userChangePasswordInput)
-		if err != nil {
-			log.Printf("{UserChangePasswordHandler} ERR: %s\n", err.Error())
-			var response *web.Response
-			if errors.As(err, &response) {
-				web.SendJsonResponse(w, response, response.Status)
-			} else {
-				web.SendHttpMethod(w, http.StatusInternalServerError)
-			}
-			return
-		}
-		// Hash user password
-		hashedPassword, err := security.GenerateHashFromPassword(userChangePasswordInput.Password)
-		if err != nil {
-			log.Printf("{UserChangePasswordHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-			return
-		}
-		user := controller.User{Id: userSession.UserId, Password: hashedPassword}
-		// Update user password
-		rows, err := controller.UpdateUserPassword(user)
-		if err != nil {
-			log.Printf("{UserChangePasswordHandler} ERR: %s\n", err.Error())
-			web.SendHttpMethod(w, http.StatusInternalServerError)
-		} else if rows != 1 {
-			log.Printf("{UserChangePasswordHandler} ERR: Update failed for user id: %d\n", user.Id)
-			web.SendHttpMethod(w, http.StatusBadRequest)
-		} else {
-			response := web.Response{Message: "User is updated."}
-			web.SendJsonResponse(w, response, http.StatusOK)
-		}
+// PUT /user/password
+func UserChangePasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	// Parse input
+	var userChangePasswordInput UserChangePasswordInput
+	err := web.DecodeJSONBody(w, r, &userChangePasswordInput)
+	if err != nil {
+		return err
+	}
+	// Input validation
+	err = UserChangePasswordParser(userChangePasswordInput)
+	if err != nil {
+		return err
 	}
+	// Hash user password
+	hashedPassword, err := security.GenerateHashFromPassword(userChangePasswordInput.Password)
+	if err != nil {
+		return err
+	}
+	user := controller.User{Id: web.ReturnUserSession(r).UserId, Password: hashedPassword}
+	// Update user password
+	rows, err := controller.UpdateUserPassword(r.Context(), controller.Store, user)
+	if err != nil {
+		return err
+	} else if rows != 1 {
+		return web.ReturnError(web.ErrorCodeBadRequest, http.StatusText(http.StatusBadRequest))
+	}
+	response := web.Response{Message: "User is updated."}
+	web.SendJsonResponse(w, response, http.StatusOK)
+	return nil
 }
 
 func UserChangePasswordParser(userChangePasswordInput UserChangePasswordInput) error {
 	// <password>
-	if len(userChangePasswordInput.Password) == 0 {
-		return &web.Response{Status: http.StatusBadRequest, Message: "Field cannot be empty: password"}
+	return passwordPolicyParser(userChangePasswordInput.Password)
+}
+
+// Check given new password against the password policy
+func passwordPolicyParser(password string) error {
+	if len(password) == 0 {
+		return web.ReturnFieldError(web.ErrorCodeFieldRequired, "password", "Field cannot be empty: password")
+	}
+	policy := controller.ReturnPasswordPolicy()
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooShort, "password", fmt.Sprintf("Field is too short: password, min length: %d", policy.MinLength))
+	}
+	if length > policy.MaxLength || len(password) > controller.UserPasswordMaxLength {
+		return web.ReturnFieldError(web.ErrorCodeFieldTooLong, "password", fmt.Sprintf("Field is too long: password, max length: %d", policy.MaxLength))
+	}
+	if controller.IsBreachedPassword(password) {
+		return web.ReturnFieldError(web.ErrorCodePasswordBreached, "password", "Password is found in a breached password list, choose another one.")
+	}
+	return nil
+}
+
+// GET /user/roles
+func UserRolesHandler(w http.ResponseWriter, r *http.Request) error {
+	projectRoles, err := controller.SelectProjectRoles(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	web.SendJsonResponse(w, projectRoles, http.StatusOK)
+	return nil
+}
+
+type UserSelectInput struct {
+	ListInput
+	// Case-insensitive part of the name or the email
+	Search string `json:"search"`
+}
+
+type UserOutput struct {
+	Id      int       `json:"id"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+type UserSelectOutput struct {
+	Items []UserOutput `json:"items"`
+	ListOutput
+}
+
+// GET /users?limit=&cursor=&sort=&order=&search=
+// Users are listed to MFA admins only as they are the ones who manage other users
+func UserSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	admin, err := controller.GetUser(r.Context(), controller.Store, web.ReturnUserSession(r).UserId)
+	if err != nil {
+		return err
+	}
+	if admin == nil || !controller.IsMfaAdmin(*admin) {
+		return web.ReturnError(web.ErrorCodeForbidden, "Permission denied.")
+	}
+	// Parse input
+	var userSelectInput UserSelectInput
+	userSelectInput.ListInput, err = parseListInput(r)
+	if err != nil {
+		return err
+	}
+	userSelectInput.Search = r.URL.Query().Get("search")
+	// Input validation
+	query, err := listParser(userSelectInput.ListInput, controller.ListSortCreated, controller.ListSortName)
+	if err != nil {
+		return err
+	}
+	err = listSearchParser(userSelectInput.Search)
+	if err != nil {
+		return err
+	}
+	query.Search = userSelectInput.Search
+	// Select a page of users without their password hashes
+	users, page, err := controller.SelectUser(r.Context(), controller.Store, query)
+	if err != nil {
+		return err
+	}
+	output := UserSelectOutput{Items: make([]UserOutput, 0, len(users)), ListOutput: returnListOutput(page)}
+	for _, user := range users {
+		output.Items = append(output.Items, UserOutput{Id: user.Id, Email: user.Email, Name: user.Name, Created: user.Created})
+	}
+	web.SendJsonResponse(w, output, http.StatusOK)
+	return nil
+}
+
+type UserSessionSelectInput struct {
+	ListInput
+}
+
+type UserSessionOutput struct {
+	Id      int       `json:"id"`
+	Created time.Time `json:"created"`
+	// Session of this request
+	Current bool `json:"current"`
+}
+
+type UserSessionSelectOutput struct {
+	Items []UserSessionOutput `json:"items"`
+	ListOutput
+}
+
+// GET /user/sessions?limit=&cursor=&sort=&order=
+func UserSessionSelectHandler(w http.ResponseWriter, r *http.Request) error {
+	userSession := web.ReturnUserSession(r)
+	// Parse input
+	var userSessionSelectInput UserSessionSelectInput
+	var err error
+	userSessionSelectInput.ListInput, err = parseListInput(r)
+	if err != nil {
+		return err
+	}
+	// Input validation, sessions have no name
+	query, err := listParser(userSessionSelectInput.ListInput, controller.ListSortCreated)
+	if err != nil {
+		return err
+	}
+	// Select a page of sessions of the user without their tokens
+	userSessions, page, err := controller.SelectUserSession(r.Context(), controller.Store, userSession.UserId, query)
+	if err != nil {
+		return err
 	}
-	if len(userChangePasswordInput.Password) > controller.UserPasswordMaxLength {
-		return &web.Response{
-			Status:  http.StatusBadRequest,
-			Message: fmt.Sprintf("Field is too long: password, max length: %d", controller.UserPasswordMaxLength),
-		}
+	output := UserSessionSelectOutput{Items: make([]UserSessionOutput, 0, len(userSessions)), ListOutput: returnListOutput(page)}
+	for _, session := range userSessions {
+		output.Items = append(output.Items, UserSessionOutput{Id: session.Id, Created: session.Created,
+			Current: session.Id == userSession.Id})
 	}
+	web.SendJsonResponse(w, output, http.StatusOK)
 	return nil
 }
@@ -0,0 +1,202 @@
+// Package client is the Go client of the repgen API, it logs in with a session cookie like the web UI and submits
+// report data with report tokens. It depends on the standard library only.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of versioned endpoints, same as web.ApiPrefix
+const ApiPrefix = "/api/v1"
+
+const (
+	cookieKeyCsrf   = "csrf"
+	headerCsrfToken = "X-CSRF-Token"
+	// Larger error bodies are cut, error responses are small
+	errorBodyMaxSize = 1 << 20
+)
+
+// Client of a repgen server, it keeps the session of Login in its cookie jar and is safe for concurrent use
+type Client struct {
+	// Server address without the API prefix e.g. https://repgen.example.com
+	BaseUrl    string
+	HttpClient *http.Client
+}
+
+// Error response of the API, Code is stable between releases and meant to be branched on
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Request field which caused the error e.g. definition[2].name
+	Field string `json:"field"`
+	// Errors of each invalid item e.g. each invalid column of a submit
+	Details []Error `json:"details"`
+	// Wait requested by a rate limited response
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("repgen: %d: %s", e.Status, e.Message)
+	}
+	if len(e.Field) > 0 {
+		return fmt.Sprintf("repgen: %d %s: %s (%s)", e.Status, e.Code, e.Message, e.Field)
+	}
+	return fmt.Sprintf("repgen: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Return true if given error is an API error of given code
+func IsErrorCode(err error, code string) bool {
+	var apiError *Error
+	return errors.As(err, &apiError) && apiError.Code == code
+}
+
+// Message of successful requests which return nothing else
+type Response struct {
+	Message string `json:"message"`
+}
+
+// Return client of the server at given address with a cookie jar for the session
+func NewClient(baseUrl string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		BaseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		HttpClient: &http.Client{Jar: jar, Timeout: 30 * time.Second},
+	}
+}
+
+// Send a request of given method to given path under the API prefix, input is sent as JSON body and the JSON
+// response is decoded into output if it is not nil
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, input interface{}, output interface{}) error {
+	endpoint := c.BaseUrl + ApiPrefix + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var body io.Reader
+	if input != nil {
+		encoded, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	// Double submit of the CSRF cookie which the server sets on login
+	if method != http.MethodGet && c.HttpClient.Jar != nil {
+		for _, cookie := range c.HttpClient.Jar.Cookies(req.URL) {
+			if cookie.Name == cookieKeyCsrf {
+				req.Header.Set(headerCsrfToken, cookie.Value)
+			}
+		}
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return returnError(resp)
+	}
+	if output == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// Return API error of given error response, bodies which are not API errors keep the status only
+func returnError(resp *http.Response) error {
+	apiError := &Error{}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, errorBodyMaxSize))
+	if err != nil || json.Unmarshal(body, apiError) != nil || len(apiError.Message) == 0 {
+		apiError = &Error{Message: strings.TrimSpace(string(body))}
+	}
+	apiError.Status = resp.StatusCode
+	if len(apiError.Message) == 0 {
+		apiError.Message = http.StatusText(resp.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiError
+}
+
+// Return true if a request which failed with given error may succeed later, i.e. network errors, server errors
+// and rate limits
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiError *Error
+	if errors.As(err, &apiError) {
+		return apiError.Status >= http.StatusInternalServerError || apiError.Status == http.StatusTooManyRequests
+	}
+	// Transport errors e.g. connection refused
+	return true
+}
+
+type loginInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginOutput struct {
+	Message  string `json:"message"`
+	MfaToken string `json:"mfa_token"`
+}
+
+// Returned by Login when the user has two-factor authentication, the token is sent to LoginMfa with a code
+type MfaRequiredError struct {
+	MfaToken string
+}
+
+func (e *MfaRequiredError) Error() string {
+	return "repgen: two-factor authentication code is required"
+}
+
+// Log in with email and password, *MfaRequiredError is returned if the user has two-factor authentication
+func (c *Client) Login(ctx context.Context, email string, password string) error {
+	var output loginOutput
+	err := c.do(ctx, http.MethodPost, "/login", nil, loginInput{Email: email, Password: password}, &output)
+	if err != nil {
+		return err
+	}
+	if len(output.MfaToken) > 0 {
+		return &MfaRequiredError{MfaToken: output.MfaToken}
+	}
+	return nil
+}
+
+type loginMfaInput struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// Complete a login with a TOTP or recovery code
+func (c *Client) LoginMfa(ctx context.Context, mfaToken string, code string) error {
+	return c.do(ctx, http.MethodPost, "/login/mfa", nil, loginMfaInput{MfaToken: mfaToken, Code: code}, nil)
+}
+
+// Log out of the current session
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/logout", nil, nil, nil)
+}
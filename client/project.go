@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Sort keys and orders of list options
+const (
+	SortCreated = "created"
+	SortName    = "name"
+	OrderAsc    = "asc"
+	OrderDesc   = "desc"
+)
+
+// Query of a list endpoint, zero values are left to the server defaults
+type ListOptions struct {
+	// Page size, 10 if zero and 100 at most
+	Limit int
+	// NextCursor of the previous page, it is valid with the same Sort and Order only
+	Cursor string
+	Sort   string
+	Order  string
+	// Case-insensitive part of the name
+	Search string
+	// List archived projects or reports instead of active ones
+	Archived bool
+	// List projects or reports created by the logged in user only
+	CreatedByMe bool
+}
+
+func (options ListOptions) values() url.Values {
+	values := url.Values{}
+	if options.Limit > 0 {
+		values.Set("limit", strconv.Itoa(options.Limit))
+	}
+	for name, value := range map[string]string{"cursor": options.Cursor, "sort": options.Sort, "order": options.Order,
+		"search": options.Search} {
+		if len(value) > 0 {
+			values.Set(name, value)
+		}
+	}
+	if options.Archived {
+		values.Set("archived", "true")
+	}
+	if options.CreatedByMe {
+		values.Set("created_by_me", "true")
+	}
+	return values
+}
+
+type Project struct {
+	Id            int        `json:"id"`
+	Name          string     `json:"name"`
+	Created       time.Time  `json:"created"`
+	RetentionDays *int       `json:"retention_days"`
+	Archived      *time.Time `json:"archived"`
+	TimeZone      string     `json:"time_zone"`
+}
+
+type ProjectPage struct {
+	Items []Project `json:"items"`
+	// Count of every project matching the options
+	Total int64 `json:"total"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+type ProjectCreateInput struct {
+	Name string `json:"name"`
+	// Default time zone of new reports, UTC if empty
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Create a project, its id is listed by ListProjects
+func (c *Client) CreateProject(ctx context.Context, input ProjectCreateInput) error {
+	return c.do(ctx, http.MethodPost, "/projects", nil, input, nil)
+}
+
+// Return a page of projects
+func (c *Client) ListProjects(ctx context.Context, options ListOptions) (*ProjectPage, error) {
+	page := &ProjectPage{}
+	err := c.do(ctx, http.MethodGet, "/projects", options.values(), nil, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Return the project of given name, nil if there is no active project with the name
+func (c *Client) FindProject(ctx context.Context, name string) (*Project, error) {
+	options := ListOptions{Limit: 100, Search: name}
+	for {
+		page, err := c.ListProjects(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for index := range page.Items {
+			if page.Items[index].Name == name {
+				return &page.Items[index], nil
+			}
+		}
+		if len(page.NextCursor) == 0 {
+			return nil, nil
+		}
+		options.Cursor = page.NextCursor
+	}
+}
+
+func (c *Client) ArchiveProject(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/archive", id), nil, nil, nil)
+}
+
+func (c *Client) RestoreProject(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/restore", id), nil, nil, nil)
+}
+
+// Permanently delete an archived project with its reports, confirm must be equal to the project name
+func (c *Client) DeleteProject(ctx context.Context, id int, confirm string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/projects/%d", id), url.Values{"confirm": {confirm}}, nil, nil)
+}
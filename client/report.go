@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report intervals
+const (
+	IntervalMonthly        = 0
+	IntervalWeekly         = 1
+	IntervalDaily          = 2
+	IntervalHourly         = 3
+	IntervalMinute         = 4
+	IntervalFiveMinutes    = 5
+	IntervalFifteenMinutes = 6
+	IntervalQuarterly      = 7
+	IntervalYearly         = 8
+)
+
+// Column types
+const (
+	ColumnTypeStr       = 0
+	ColumnTypeInt       = 1
+	ColumnTypeFloat     = 2
+	ColumnTypeFormula   = 3
+	ColumnTypeBool      = 4
+	ColumnTypeDate      = 5
+	ColumnTypeTimestamp = 6
+	ColumnTypeDecimal   = 7
+	ColumnTypeEnum      = 8
+	ColumnTypeJson      = 9
+)
+
+// Submit modes
+const (
+	SubmitModeMerge      = "merge"
+	SubmitModeOverwrite  = "overwrite"
+	SubmitModeReject     = "reject"
+	SubmitModeAccumulate = "accumulate"
+)
+
+// Reports are sent with the field names of the server
+type Report struct {
+	Id          int
+	ProjectId   int
+	Name        string
+	Interval    int
+	Description string
+	Created     time.Time
+	Columns     []ReportColumn
+	Archived    *time.Time
+	SubmitMode  string
+	TimeZone    string
+	WeekStart   int
+}
+
+type ReportColumn struct {
+	Id         int
+	Name       string
+	Type       int
+	Formula    string
+	EnumValues []string
+	Precision  int
+	Scale      int
+	Required   bool
+	Min        *float64
+	Max        *float64
+	MaxLength  int
+	Pattern    string
+	Unit       string
+	Decimals   *int
+	Dimension  bool
+}
+
+type ReportPage struct {
+	Items []Report `json:"items"`
+	// Count of every report matching the options
+	Total int64 `json:"total"`
+	// Empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// Column of a new report
+type ColumnInput struct {
+	Name       string   `json:"name"`
+	Type       int      `json:"type"`
+	Formula    string   `json:"formula,omitempty"`
+	EnumValues []string `json:"enum_values,omitempty"`
+	Precision  int      `json:"precision,omitempty"`
+	Scale      int      `json:"scale,omitempty"`
+	Required   bool     `json:"required,omitempty"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	MaxLength  int      `json:"max_length,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	Decimals   *int     `json:"decimals,omitempty"`
+	Dimension  bool     `json:"dimension,omitempty"`
+}
+
+type ReportCreateInput struct {
+	Name        string        `json:"name"`
+	Interval    int           `json:"interval"`
+	Description string        `json:"description,omitempty"`
+	Definition  []ColumnInput `json:"definition"`
+	// Merge if empty
+	SubmitMode string `json:"submit_mode,omitempty"`
+	// Project time zone if empty
+	TimeZone string `json:"time_zone,omitempty"`
+	// First day of weekly periods, 0 is Sunday, Monday if nil
+	WeekStart *int `json:"week_start,omitempty"`
+}
+
+// Created report with its first report token, the token is returned only once
+type ReportCreateOutput struct {
+	Message  string `json:"message"`
+	ReportId int    `json:"report_id"`
+	Token    string `json:"token"`
+}
+
+// Create a report in given project
+func (c *Client) CreateReport(ctx context.Context, projectId int, input ReportCreateInput) (*ReportCreateOutput, error) {
+	output := &ReportCreateOutput{}
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/reports", projectId), nil, input, output)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// Return a page of reports of given project
+func (c *Client) ListReports(ctx context.Context, projectId int, options ListOptions) (*ReportPage, error) {
+	page := &ReportPage{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%d/reports", projectId), options.values(), nil, page)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (c *Client) ArchiveReport(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/reports/%d/archive", id), nil, nil, nil)
+}
+
+func (c *Client) RestoreReport(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/reports/%d/restore", id), nil, nil, nil)
+}
+
+// Permanently delete an archived report with its data, confirm must be equal to the report name
+func (c *Client) DeleteReport(ctx context.Context, id int, confirm string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/reports/%d", id), url.Values{"confirm": {confirm}}, nil, nil)
+}
+
+type ReportToken struct {
+	Id       int    `json:"id"`
+	ReportId int    `json:"report_id"`
+	Hint     string `json:"hint"`
+	Label    string `json:"label"`
+	// Plaintext token, returned only when the token is created
+	Token    string     `json:"token"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used"`
+	Expires  *time.Time `json:"expires"`
+}
+
+type reportTokenCreateInput struct {
+	Label string `json:"label"`
+}
+
+// Create another report token of given report
+func (c *Client) CreateReportToken(ctx context.Context, reportId int, label string) (*ReportToken, error) {
+	reportToken := &ReportToken{}
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/reports/%d/tokens", reportId), nil,
+		reportTokenCreateInput{Label: label}, reportToken)
+	if err != nil {
+		return nil, err
+	}
+	return reportToken, nil
+}
+
+// Query of report data, zero values are left to the server defaults
+type DataQuery struct {
+	// Report dates between [From, To) in the date format of the report interval
+	From string
+	To   string
+	// Dimension name -> Value or slice of values
+	Filter map[string]interface{}
+	// Dimension names kept in the result, nil keeps every dimension and empty aggregates over all of them
+	GroupBy   []string
+	Aggregate string
+	Limit     int
+}
+
+type DataRow struct {
+	ReportDate string                 `json:"report_date"`
+	SentDate   time.Time              `json:"sent_date"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// Return rows of given report
+func (c *Client) ReportData(ctx context.Context, reportId int, query DataQuery) ([]DataRow, error) {
+	values := url.Values{}
+	for name, value := range map[string]string{"from": query.From, "to": query.To, "aggregate": query.Aggregate} {
+		if len(value) > 0 {
+			values.Set(name, value)
+		}
+	}
+	if len(query.Filter) > 0 {
+		filter, err := json.Marshal(query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("filter", string(filter))
+	}
+	if query.GroupBy != nil {
+		values.Set("group_by", strings.Join(query.GroupBy, ","))
+	}
+	if query.Limit > 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+	rows := []DataRow{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/reports/%d/data", reportId), values, nil, &rows)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
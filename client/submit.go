@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Report data of one report date, sent with a report token
+type Submission struct {
+	Token string `json:"token"`
+	// Report date in the notation of the report interval, time.Time, RFC 3339 text or Unix epoch as a number,
+	// the current period if nil
+	Date interface{}            `json:"date,omitempty"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Submit report data, the message tells whether the row is inserted or updated. Invalid columns are
+// returned together in the Details of the error.
+func (c *Client) Submit(ctx context.Context, submission Submission) (string, error) {
+	var response Response
+	err := c.do(ctx, http.MethodPost, "/submit", nil, submission, &response)
+	return response.Message, err
+}
+
+var ErrSubmitterClosed = errors.New("repgen: submitter is closed")
+
+type SubmitterConfig struct {
+	// Rows waiting to be sent, Add blocks while the buffer is full, 1000 if zero
+	BufferSize int
+	// Buffered rows are sent when this many rows are waiting, 100 if zero
+	BatchSize int
+	// Buffered rows are sent at least this often, 1 second if zero
+	FlushInterval time.Duration
+	// Rows of a batch sent at the same time, 1 if zero. Rows of the same report date may be applied out of order
+	// if it is more than 1.
+	Concurrency int
+	// Attempts of a row before it is given up, 5 if zero
+	MaxAttempts int
+	// Rows are sent to reports of accumulate mode. A row which fails with a network error or a server error may be
+	// applied already, so it is passed to OnError instead of retried and added twice. Rate limits are still retried.
+	Accumulate bool
+	// Wait before the first retry, doubled for each retry up to MaxBackoff, 500ms and 30 seconds if zero.
+	// Rate limited rows wait at least for the Retry-After of the response.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Called with each row which is not submitted and its error, e.g. invalid columns or the last retryable error
+	OnError func(submission Submission, err error)
+}
+
+// Submitter sends rows in the background in batches, rows failing with network errors, server errors or rate limits
+// are retried with exponential backoff. Close sends the buffered rows before the program exits.
+type Submitter struct {
+	client  *Client
+	config  SubmitterConfig
+	rows    chan Submission
+	flushes chan chan struct{}
+	// Requests and retries of the submitter, cancelled if Close times out
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	// Closed by Close to release Add and Flush calls which wait without holding mu
+	closing chan struct{}
+	// Add calls which may still send to rows, rows is closed after them
+	adding sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Return a started submitter of given client, zero values of the config get their defaults
+func NewSubmitter(client *Client, config SubmitterConfig) *Submitter {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Submitter{
+		client:  client,
+		config:  config,
+		rows:    make(chan Submission, config.BufferSize),
+		flushes: make(chan chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Buffer given row, it blocks while the buffer is full until ctx is done or the submitter is closed
+func (s *Submitter) Add(ctx context.Context, submission Submission) error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrSubmitterClosed
+	}
+	s.adding.Add(1)
+	s.mu.RUnlock()
+	defer s.adding.Done()
+	select {
+	case s.rows <- submission:
+		return nil
+	case <-s.closing:
+		return ErrSubmitterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send every buffered row and wait until they are submitted or given up
+func (s *Submitter) Flush(ctx context.Context) error {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return ErrSubmitterClosed
+	}
+	flushed := make(chan struct{})
+	select {
+	case s.flushes <- flushed:
+	case <-s.closing:
+		return ErrSubmitterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send every buffered row and stop the submitter. If ctx is done first, requests in flight are cancelled and the rows
+// which are not sent are passed to OnError.
+func (s *Submitter) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSubmitterClosed
+	}
+	s.closed = true
+	close(s.closing)
+	s.mu.Unlock()
+	// Blocked Add calls return once closing is closed
+	s.adding.Wait()
+	close(s.rows)
+	select {
+	case <-s.done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+func (s *Submitter) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Submission, 0, s.config.BatchSize)
+	for {
+		select {
+		case submission, ok := <-s.rows:
+			if !ok {
+				// Closed, the buffer is drained
+				s.send(batch)
+				return
+			}
+			batch = append(batch, submission)
+			if len(batch) >= s.config.BatchSize {
+				s.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.send(batch)
+			batch = batch[:0]
+		case flushed := <-s.flushes:
+			// Rows added before the flush
+			for len(s.rows) > 0 {
+				submission, ok := <-s.rows
+				if !ok {
+					break
+				}
+				batch = append(batch, submission)
+			}
+			s.send(batch)
+			batch = batch[:0]
+			close(flushed)
+		}
+	}
+}
+
+// Submit given rows with the configured concurrency and wait until every row is done
+func (s *Submitter) send(batch []Submission) {
+	if len(batch) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, s.config.Concurrency)
+	for _, submission := range batch {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(submission Submission) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := s.submit(submission)
+			if err != nil && s.config.OnError != nil {
+				s.config.OnError(submission, err)
+			}
+		}(submission)
+	}
+	wg.Wait()
+}
+
+// Submit given row, retryable errors are retried with backoff until the attempts run out
+func (s *Submitter) submit(submission Submission) error {
+	backoff := s.config.Backoff
+	for attempt := 1; ; attempt++ {
+		_, err := s.client.Submit(s.ctx, submission)
+		if err == nil || !IsRetryable(err) || attempt >= s.config.MaxAttempts {
+			return err
+		}
+		var apiError *Error
+		rateLimited := errors.As(err, &apiError) && apiError.Status == http.StatusTooManyRequests
+		// Rate limited rows are rejected before they are applied
+		if s.config.Accumulate && !rateLimited {
+			return err
+		}
+		wait := backoff
+		if apiError != nil && apiError.RetryAfter > wait {
+			wait = apiError.RetryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+		if backoff > s.config.MaxBackoff {
+			backoff = s.config.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"repgen/api"
+	"repgen/controller"
+	"repgen/core"
+	"repgen/web"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Return a server of every route on a new in-memory storage, handler may answer a request before the routes by
+// returning true
+func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	core.Config = &core.ConfigBase{}
+	core.Config.Storage.Driver = controller.StorageDriverMemory
+	controller.InitializeStorage()
+	controller.InitializeRateLimit()
+	controller.InitializePasswordPolicy()
+	router := web.NewRouter()
+	router.Use(web.RecoverMiddleware)
+	api.RegisterRoutes(router)
+	routes := web.CorsMiddleware(web.CsrfMiddleware(router))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler != nil && handler(w, r) {
+			return
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Register and log in a user, then create a daily report of an amount column in given mode and return its id and token
+func newTestReport(t *testing.T, c *Client, mode string) (int, string) {
+	t.Helper()
+	ctx := context.Background()
+	user := api.UserCreateInput{Email: "a@example.com", Password: "Correct-horse-9battery", Name: "Test"}
+	if err := c.do(ctx, http.MethodPost, "/users", nil, user, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login(ctx, user.Email, user.Password); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateProject(ctx, ProjectCreateInput{Name: "Sales"}); err != nil {
+		t.Fatal(err)
+	}
+	project, err := c.FindProject(ctx, "Sales")
+	if err != nil || project == nil {
+		t.Fatalf("project: %+v %v", project, err)
+	}
+	report, err := c.CreateReport(ctx, project.Id, ReportCreateInput{Name: "Daily", Interval: IntervalDaily,
+		SubmitMode: mode, Definition: []ColumnInput{{Name: "amount", Type: ColumnTypeInt}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.ReportId, report.Token
+}
+
+// Return sum of the amount column of given report
+func sumTestAmount(t *testing.T, c *Client, reportId int) float64 {
+	t.Helper()
+	rows, err := c.ReportData(context.Background(), reportId, DataQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0.0
+	for _, row := range rows {
+		amount, _ := row.Data["amount"].(float64)
+		sum += amount
+	}
+	return sum
+}
+
+// Answer the first failures submits with given status
+func failSubmits(status int, failures int32, attempts *int32) func(w http.ResponseWriter, r *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != ApiPrefix+"/submit" {
+			return false
+		}
+		if atomic.AddInt32(attempts, 1) > failures {
+			return false
+		}
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		web.SendJsonResponse(w, web.ReturnError(web.ErrorCodeInternal, "Failed."), status)
+		return true
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	c := NewClient(newTestServer(t, nil).URL)
+	reportId, token := newTestReport(t, c, SubmitModeMerge)
+	ctx := context.Background()
+	if _, err := c.Submit(ctx, Submission{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"amount": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Submit(ctx, Submission{Token: token, Date: "2026-10-01", Data: map[string]interface{}{"amount": "x"}})
+	var apiError *Error
+	if !errors.As(err, &apiError) || apiError.Status != http.StatusBadRequest || IsRetryable(err) {
+		t.Fatalf("invalid column: %v", err)
+	}
+	if sum := sumTestAmount(t, c, reportId); sum != 3 {
+		t.Fatalf("sum: %v", sum)
+	}
+}
+
+func TestSubmitterRetry(t *testing.T) {
+	for _, status := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		var attempts int32
+		c := NewClient(newTestServer(t, failSubmits(status, 2, &attempts)).URL)
+		reportId, token := newTestReport(t, c, SubmitModeMerge)
+		s := NewSubmitter(c, SubmitterConfig{Backoff: time.Millisecond, OnError: func(submission Submission, err error) {
+			t.Errorf("%d: row is given up: %v", status, err)
+		}})
+		if err := s.Add(context.Background(), Submission{Token: token, Data: map[string]interface{}{"amount": 2}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 3 {
+			t.Fatalf("%d: attempts: %d", status, attempts)
+		}
+		if sum := sumTestAmount(t, c, reportId); sum != 2 {
+			t.Fatalf("%d: sum: %v", status, sum)
+		}
+		if err := s.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSubmitterAccumulateIsNotRetried(t *testing.T) {
+	var attempts int32
+	c := NewClient(newTestServer(t, failSubmits(http.StatusInternalServerError, 1, &attempts)).URL)
+	reportId, token := newTestReport(t, c, SubmitModeAccumulate)
+	var givenUp int32
+	s := NewSubmitter(c, SubmitterConfig{Accumulate: true, Backoff: time.Millisecond,
+		OnError: func(submission Submission, err error) {
+			atomic.AddInt32(&givenUp, 1)
+		}})
+	for i := 0; i < 2; i++ {
+		if err := s.Add(context.Background(), Submission{Token: token, Data: map[string]interface{}{"amount": 2}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || givenUp != 1 {
+		t.Fatalf("attempts: %d, given up: %d", attempts, givenUp)
+	}
+	if sum := sumTestAmount(t, c, reportId); sum != 2 {
+		t.Fatalf("sum: %v", sum)
+	}
+}
+
+func TestSubmitterFlushAndClose(t *testing.T) {
+	c := NewClient(newTestServer(t, nil).URL)
+	reportId, token := newTestReport(t, c, SubmitModeAccumulate)
+	s := NewSubmitter(c, SubmitterConfig{Accumulate: true, FlushInterval: time.Hour})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := s.Add(ctx, Submission{Token: token, Data: map[string]interface{}{"amount": 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sum := sumTestAmount(t, c, reportId); sum != 3 {
+		t.Fatalf("flushed sum: %v", sum)
+	}
+	if err := s.Add(ctx, Submission{Token: token, Data: map[string]interface{}{"amount": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sum := sumTestAmount(t, c, reportId); sum != 4 {
+		t.Fatalf("closed sum: %v", sum)
+	}
+	if err := s.Add(ctx, Submission{Token: token}); err != ErrSubmitterClosed {
+		t.Fatalf("add after close: %v", err)
+	}
+	if err := s.Flush(ctx); err != ErrSubmitterClosed {
+		t.Fatalf("flush after close: %v", err)
+	}
+}
+
+func TestSubmitterCloseReleasesBlockedAdd(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	// Submits hang until their request is cancelled
+	c := NewClient(newTestServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != ApiPrefix+"/submit" {
+			return false
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		return true
+	}).URL)
+	_, token := newTestReport(t, c, SubmitModeMerge)
+	var mu sync.Mutex
+	givenUp := 0
+	s := NewSubmitter(c, SubmitterConfig{BufferSize: 1, BatchSize: 1, OnError: func(submission Submission, err error) {
+		mu.Lock()
+		givenUp++
+		mu.Unlock()
+	}})
+	ctx := context.Background()
+	// First row is in flight and the second one fills the buffer
+	for i := 0; i < 2; i++ {
+		if err := s.Add(ctx, Submission{Token: token, Data: map[string]interface{}{"amount": 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	added := make(chan error)
+	go func() {
+		added <- s.Add(ctx, Submission{Token: token, Data: map[string]interface{}{"amount": 1}})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	closeCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	closed := make(chan error)
+	go func() {
+		closed <- s.Close(closeCtx)
+	}()
+	select {
+	case err := <-closed:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close is blocked by add")
+	}
+	if err := <-added; err != ErrSubmitterClosed {
+		t.Fatalf("blocked add: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if givenUp != 2 {
+		t.Fatalf("given up: %d", givenUp)
+	}
+}
@@ -0,0 +1,227 @@
+// Mock OpenID Connect provider for local testing of single sign-on, every authorization request is approved
+// as the configured user without a login page. Do not expose it outside of a development machine.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"repgen/security"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyId       = "mockidp"
+	codeMinutes = 1
+)
+
+// Authorization request waiting for its code to be exchanged
+type authorization struct {
+	clientId      string
+	redirectUri   string
+	nonce         string
+	codeChallenge string
+	email         string
+	groups        []string
+	expires       time.Time
+}
+
+type mockProvider struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	email        string
+	name         string
+	groups       []string
+	key          *rsa.PrivateKey
+	mu           sync.Mutex
+	codes        map[string]authorization
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "Listen address, the issuer is http://<addr>")
+	clientId := flag.String("client-id", "repgen", "Client id of repgen")
+	clientSecret := flag.String("client-secret", "", "Client secret of repgen, empty accepts public clients")
+	email := flag.String("email", "user@example.com", "Verified email of the logged in user")
+	name := flag.String("name", "Mock User", "Name of the logged in user")
+	groups := flag.String("groups", "", "Comma separated groups of the logged in user")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &mockProvider{
+		issuer:       "http://" + *addr,
+		clientId:     *clientId,
+		clientSecret: *clientSecret,
+		email:        *email,
+		name:         *name,
+		groups:       splitGroups(*groups),
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discoveryHandler)
+	mux.HandleFunc("/jwks", p.jwksHandler)
+	mux.HandleFunc("/authorize", p.authorizeHandler)
+	mux.HandleFunc("/token", p.tokenHandler)
+	log.Printf("Mock identity provider is listening on %s\n", p.issuer)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func splitGroups(groups string) []string {
+	list := []string{}
+	for _, group := range strings.Split(groups, ",") {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			list = append(list, group)
+		}
+	}
+	return list
+}
+
+func sendJson(w http.ResponseWriter, value interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func sendTokenError(w http.ResponseWriter, code string, description string) {
+	sendJson(w, map[string]string{"error": code, "error_description": description}, http.StatusBadRequest)
+}
+
+func (p *mockProvider) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{security.JwtAlgorithmRs256},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile", "groups"},
+	}, http.StatusOK)
+}
+
+func (p *mockProvider) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, map[string]interface{}{
+		"keys": []security.Jwk{security.ReturnRsaJwk(keyId, &p.key.PublicKey)},
+	}, http.StatusOK)
+}
+
+// Approve the request at once, email and groups query parameters override the configured user
+func (p *mockProvider) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectUri, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || len(redirectUri.Host) == 0 {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != p.clientId {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" ||
+		len(query.Get("code_challenge")) == 0 {
+		http.Error(w, "authorization code flow with S256 PKCE is required", http.StatusBadRequest)
+		return
+	}
+	auth := authorization{
+		clientId:      p.clientId,
+		redirectUri:   redirectUri.String(),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		email:         p.email,
+		groups:        p.groups,
+		expires:       time.Now().Add(codeMinutes * time.Minute),
+	}
+	if email := query.Get("email"); len(email) > 0 {
+		auth.email = email
+	}
+	if groups, ok := query["groups"]; ok {
+		auth.groups = splitGroups(strings.Join(groups, ","))
+	}
+	code, err := security.GenerateRandomHex(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.mu.Lock()
+	p.codes[code] = auth
+	p.mu.Unlock()
+	values := redirectUri.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectUri.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (p *mockProvider) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		sendTokenError(w, "unsupported_grant_type", "authorization_code is required")
+		return
+	}
+	// Client authentication by basic auth or form values
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId != p.clientId || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		sendJson(w, map[string]string{"error": "invalid_client"}, http.StatusUnauthorized)
+		return
+	}
+	// Codes are used once
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(auth.expires) || auth.redirectUri != r.PostForm.Get("redirect_uri") {
+		sendTokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	if security.ReturnCodeChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge {
+		sendTokenError(w, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+	now := time.Now()
+	idToken, err := security.SignJwt(map[string]interface{}{
+		"iss":            p.issuer,
+		"sub":            "mock|" + auth.email,
+		"aud":            auth.clientId,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": true,
+		"name":           p.name,
+		"groups":         auth.groups,
+	}, keyId, p.key)
+	if err != nil {
+		sendTokenError(w, "server_error", err.Error())
+		return
+	}
+	sendJson(w, map[string]interface{}{
+		"access_token": code,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	}, http.StatusOK)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"context"
+	"time"
+)
+
+type AuditLog struct {
+	Id       int
+	UserId   int
+	Action   string
+	Entity   string
+	EntityId int
+	Detail   string
+	Created  time.Time
+}
+
+const (
+	AuditActionArchive  = "archive"
+	AuditActionRestore  = "restore"
+	AuditActionDelete   = "delete"
+	AuditActionMfaReset = "mfa_reset"
+	AuditEntityProject  = "project"
+	AuditEntityReport   = "report"
+	AuditEntityUser     = "user"
+)
+
+func CreateAuditLog(ctx context.Context, repo Repository, auditLog *AuditLog) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateAuditLog(ctx, auditLog)
+}
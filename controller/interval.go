@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Approximate length of each report interval, used to compare intervals
+var ReportIntervalDurationMap = map[int]time.Duration{
+	ReportIntervalMonthly:        30 * 24 * time.Hour,
+	ReportIntervalWeekly:         7 * 24 * time.Hour,
+	ReportIntervalDaily:          24 * time.Hour,
+	ReportIntervalHourly:         time.Hour,
+	ReportIntervalMinute:         time.Minute,
+	ReportIntervalFiveMinutes:    5 * time.Minute,
+	ReportIntervalFifteenMinutes: 15 * time.Minute,
+	ReportIntervalQuarterly:      91 * 24 * time.Hour,
+	ReportIntervalYearly:         365 * 24 * time.Hour,
+}
+
+// Canonical notation of report dates of each interval
+var ReportIntervalNotationMap = map[int]string{
+	ReportIntervalMonthly:        "2006-01",
+	ReportIntervalWeekly:         "2006-W01",
+	ReportIntervalDaily:          "2006-01-02",
+	ReportIntervalHourly:         "2006-01-02 15",
+	ReportIntervalMinute:         "2006-01-02 15:04",
+	ReportIntervalFiveMinutes:    "2006-01-02 15:04",
+	ReportIntervalFifteenMinutes: "2006-01-02 15:04",
+	ReportIntervalQuarterly:      "2006-Q1",
+	ReportIntervalYearly:         "2006",
+}
+
+// Layouts of report dates which are parsed by time.Parse, weekly reports also accept a date of the week
+var reportIntervalLayoutMap = map[int]string{
+	ReportIntervalMonthly:        "2006-01",
+	ReportIntervalWeekly:         "2006-01-02",
+	ReportIntervalDaily:          "2006-01-02",
+	ReportIntervalHourly:         "2006-01-02 15",
+	ReportIntervalMinute:         "2006-01-02 15:04",
+	ReportIntervalFiveMinutes:    "2006-01-02 15:04",
+	ReportIntervalFifteenMinutes: "2006-01-02 15:04",
+	ReportIntervalYearly:         "2006",
+}
+
+// Length of sub hourly intervals in minutes
+var reportIntervalMinutesMap = map[int]int{
+	ReportIntervalMinute:         1,
+	ReportIntervalFiveMinutes:    5,
+	ReportIntervalFifteenMinutes: 15,
+}
+
+var isoWeekRegexp = regexp.MustCompile(`^([0-9]{4})-W([0-9]{2})$`)
+var quarterRegexp = regexp.MustCompile(`^([0-9]{4})-Q([1-4])$`)
+
+// Epochs up to epochSecondsMax (year 2286) are seconds, epochs from epochMillisecondsThreshold up to
+// epochMillisecondsMax are milliseconds. Epochs between them are rejected as they would be seconds after the year 5000.
+const (
+	epochSecondsMax            = 1e10
+	epochMillisecondsThreshold = 1e11
+	epochMillisecondsMax       = 1e13
+)
+
+// Returned when a report date does not match the notation of report interval
+var ErrInvalidReportDate = errors.New("invalid report date")
+
+// Return true if periods of the first interval are longer than the second one
+func IsCoarserInterval(interval int, other int) bool {
+	return ReportIntervalDurationMap[interval] > ReportIntervalDurationMap[other]
+}
+
+// Time zone of reports and projects without an explicit one
+const DefaultTimeZone = "UTC"
+
+// Return location of given IANA time zone, UTC if it is empty or unknown
+func ReturnLocation(timeZone string) *time.Location {
+	if len(timeZone) == 0 {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Return true if given IANA time zone is known
+func IsValidTimeZone(timeZone string) bool {
+	if len(timeZone) == 0 {
+		return false
+	}
+	_, err := time.LoadLocation(timeZone)
+	return err == nil
+}
+
+// Return true if given week start is a day of the week
+func IsValidWeekStart(weekStart int) bool {
+	return weekStart >= int(time.Sunday) && weekStart <= int(time.Saturday)
+}
+
+// Return beginning of the report period which contains given date, in UTC
+// Periods are computed in the time zone of the report
+func ReturnPeriodStart(report Report, date time.Time) time.Time {
+	location := ReturnLocation(report.TimeZone)
+	date = date.In(location)
+	var start time.Time
+	switch report.Interval {
+	case ReportIntervalYearly:
+		start = time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, location)
+	case ReportIntervalQuarterly:
+		start = time.Date(date.Year(), (date.Month()-1)/3*3+1, 1, 0, 0, 0, 0, location)
+	case ReportIntervalMonthly:
+		start = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, location)
+	case ReportIntervalWeekly:
+		day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, location)
+		offset := (int(day.Weekday()) - report.WeekStart + 7) % 7
+		start = day.AddDate(0, 0, -offset)
+	case ReportIntervalDaily:
+		start = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, location)
+	case ReportIntervalMinute, ReportIntervalFiveMinutes, ReportIntervalFifteenMinutes:
+		start = truncateLocalInstant(date, int64(reportIntervalMinutesMap[report.Interval])*60)
+	default:
+		start = truncateLocalInstant(date, 3600)
+	}
+	return start.UTC()
+}
+
+// Truncate given instant to a multiple of given seconds of its local time. The offset of the instant is used instead
+// of rebuilding the wall clock, so the repeated hour of a DST change is a separate period and fractional offsets
+// e.g. +05:45 keep local hours.
+func truncateLocalInstant(date time.Time, seconds int64) time.Time {
+	_, offset := date.Zone()
+	local := date.Unix() + int64(offset)
+	remainder := local % seconds
+	if remainder < 0 {
+		remainder += seconds
+	}
+	return time.Unix(local-remainder-int64(offset), 0)
+}
+
+// Return beginning of the report period which follows the period starting at given date, in UTC
+func ReturnNextPeriodStart(report Report, periodStart time.Time) time.Time {
+	periodStart = periodStart.In(ReturnLocation(report.TimeZone))
+	switch report.Interval {
+	case ReportIntervalYearly:
+		return periodStart.AddDate(1, 0, 0).UTC()
+	case ReportIntervalQuarterly:
+		return periodStart.AddDate(0, 3, 0).UTC()
+	case ReportIntervalMonthly:
+		return periodStart.AddDate(0, 1, 0).UTC()
+	case ReportIntervalWeekly:
+		return periodStart.AddDate(0, 0, 7).UTC()
+	case ReportIntervalDaily:
+		return periodStart.AddDate(0, 0, 1).UTC()
+	case ReportIntervalMinute, ReportIntervalFiveMinutes, ReportIntervalFifteenMinutes:
+		return periodStart.Add(time.Duration(reportIntervalMinutesMap[report.Interval]) * time.Minute).UTC()
+	default:
+		return periodStart.Add(time.Hour).UTC()
+	}
+}
+
+// Parse report date given in the notation of report interval and the time zone of report or RFC 3339 timestamp,
+// returns beginning of the period which contains it in UTC. Epochs are numbers, see ReturnEpochPeriodStart,
+// as digits of a text are rather a date without separators e.g. 20261019.
+func ParseReportDate(report Report, value string) (time.Time, error) {
+	date, err := parseReportDateNotation(report, value)
+	if errors.Is(err, ErrInvalidReportDate) {
+		// RFC 3339 timestamps are exact instants
+		if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return ReturnPeriodStart(report, timestamp), nil
+		}
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Date is given in the time zone of the report
+	local := time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(),
+		ReturnLocation(report.TimeZone))
+	// Hours skipped by a DST change do not exist, time.Date would move them to another hour
+	if _, ok := reportIntervalMinutesMap[report.Interval]; ok || report.Interval == ReportIntervalHourly {
+		if local.Day() != date.Day() || local.Hour() != date.Hour() || local.Minute() != date.Minute() {
+			return time.Time{}, ErrInvalidReportDate
+		}
+	}
+	date = local
+	// Dates within a period are normalized to its beginning
+	return ReturnPeriodStart(report, date), nil
+}
+
+// Parse report date given in the notation of report interval as wall clock time
+func parseReportDateNotation(report Report, value string) (time.Time, error) {
+	var date time.Time
+	switch {
+	case report.Interval == ReportIntervalWeekly && isoWeekRegexp.MatchString(value):
+		match := isoWeekRegexp.FindStringSubmatch(value)
+		year, _ := strconv.Atoi(match[1])
+		week, _ := strconv.Atoi(match[2])
+		// January 4th is always in the first ISO week
+		january4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		monday := january4.AddDate(0, 0, -((int(january4.Weekday()) + 6) % 7))
+		date = monday.AddDate(0, 0, (week-1)*7)
+		if isoYear, isoWeek := date.ISOWeek(); isoYear != year || isoWeek != week {
+			return time.Time{}, ErrInvalidReportDate
+		}
+	case report.Interval == ReportIntervalQuarterly:
+		match := quarterRegexp.FindStringSubmatch(value)
+		if match == nil {
+			return time.Time{}, ErrInvalidReportDate
+		}
+		year, _ := strconv.Atoi(match[1])
+		quarter, _ := strconv.Atoi(match[2])
+		date = time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		layout, ok := reportIntervalLayoutMap[report.Interval]
+		if !ok {
+			return time.Time{}, fmt.Errorf("report id %d has invalid interval %d", report.Id, report.Interval)
+		}
+		var err error
+		date, err = time.Parse(layout, value)
+		if err != nil {
+			return time.Time{}, ErrInvalidReportDate
+		}
+	}
+	if date.IsZero() {
+		return time.Time{}, ErrInvalidReportDate
+	}
+	return date, nil
+}
+
+// Return beginning of the period which contains given Unix epoch in seconds or milliseconds, in UTC. Seconds may have
+// a fraction, milliseconds may not.
+func ReturnEpochPeriodStart(report Report, epoch float64) (time.Time, error) {
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) || epoch < 0 {
+		return time.Time{}, ErrInvalidReportDate
+	}
+	if epoch >= epochMillisecondsThreshold {
+		if epoch >= epochMillisecondsMax || epoch != math.Trunc(epoch) {
+			return time.Time{}, ErrInvalidReportDate
+		}
+		epoch /= 1000
+	} else if epoch >= epochSecondsMax {
+		return time.Time{}, ErrInvalidReportDate
+	}
+	seconds, fraction := math.Modf(epoch)
+	return ReturnPeriodStart(report, time.Unix(int64(seconds), int64(fraction*1e9))), nil
+}
+
+// Format report date in the notation of report interval and the time zone of report
+func FormatReportDate(report Report, date time.Time) string {
+	date = date.In(ReturnLocation(report.TimeZone))
+	switch report.Interval {
+	case ReportIntervalWeekly:
+		// Week is named after the ISO week of its Monday
+		monday := date.AddDate(0, 0, (int(time.Monday)-report.WeekStart+7)%7)
+		year, week := monday.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case ReportIntervalQuarterly:
+		return fmt.Sprintf("%04d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+	default:
+		return date.Format(reportIntervalLayoutMap[report.Interval])
+	}
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseReportDate(t *testing.T) {
+	report := Report{Id: 1, Interval: ReportIntervalDaily, TimeZone: "Europe/Istanbul"}
+	for value, expected := range map[string]time.Time{
+		"2026-10-19":                time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC),
+		"2026-10-19T10:07:00+03:00": time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC),
+		"2026-10-19T23:30:00Z":      time.Date(2026, 10, 19, 21, 0, 0, 0, time.UTC),
+	} {
+		date, err := ParseReportDate(report, value)
+		if err != nil || !date.Equal(expected) {
+			t.Fatalf("%s: %s %v", value, date, err)
+		}
+	}
+	// Digits are not read as an epoch
+	for _, value := range []string{"20261019", "1792393620", ""} {
+		if date, err := ParseReportDate(report, value); err != ErrInvalidReportDate {
+			t.Fatalf("%q is accepted: %s %v", value, date, err)
+		}
+	}
+	for _, epoch := range []float64{1792393620, 1792393620.25, 1792393620000} {
+		date, err := ReturnEpochPeriodStart(report, epoch)
+		if err != nil || !date.Equal(time.Date(2026, 10, 18, 21, 0, 0, 0, time.UTC)) {
+			t.Fatalf("epoch %f: %s %v", epoch, date, err)
+		}
+	}
+	for _, epoch := range []float64{-1, 1e300, 99999999999, 1e10, 1e13, 1792393620000.5, math.NaN(), math.Inf(1)} {
+		if date, err := ReturnEpochPeriodStart(report, epoch); err != ErrInvalidReportDate {
+			t.Fatalf("epoch %g is accepted: %s %v", epoch, date, err)
+		}
+	}
+}
+
+func TestReturnPeriodStartDst(t *testing.T) {
+	for _, test := range []struct {
+		interval int
+		timeZone string
+		date     time.Time
+		expected time.Time
+	}{
+		// Both 01:xx hours of the fall back day are separate periods
+		{ReportIntervalHourly, "America/New_York", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC)},
+		{ReportIntervalHourly, "America/New_York", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)},
+		{ReportIntervalFifteenMinutes, "America/New_York", time.Date(2026, 11, 1, 6, 20, 0, 0, time.UTC), time.Date(2026, 11, 1, 6, 15, 0, 0, time.UTC)},
+		// 03:00 follows 01:59 on the spring forward day
+		{ReportIntervalHourly, "America/New_York", time.Date(2026, 3, 8, 7, 10, 0, 0, time.UTC), time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC)},
+		// Fractional offset keeps local hours
+		{ReportIntervalHourly, "Asia/Kathmandu", time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 3, 15, 0, 0, time.UTC)},
+		{ReportIntervalDaily, "America/New_York", time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC)},
+	} {
+		report := Report{Interval: test.interval, TimeZone: test.timeZone}
+		if start := ReturnPeriodStart(report, test.date); !start.Equal(test.expected) {
+			t.Errorf("%s %s: %s, expected %s", test.timeZone, test.date, start, test.expected)
+		}
+	}
+	report := Report{Interval: ReportIntervalHourly, TimeZone: "America/New_York"}
+	start := time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC)
+	if next := ReturnNextPeriodStart(report, start); !next.Equal(start.Add(time.Hour)) {
+		t.Errorf("next period of the repeated hour: %s", next)
+	}
+}
+
+func TestParseReportDateDst(t *testing.T) {
+	report := Report{Id: 1, Interval: ReportIntervalHourly, TimeZone: "America/New_York"}
+	for value, expected := range map[string]time.Time{
+		"2026-03-08 01":             time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC),
+		"2026-03-08 03":             time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC),
+		"2026-11-01T01:30:00-05:00": time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC),
+	} {
+		date, err := ParseReportDate(report, value)
+		if err != nil || !date.Equal(expected) {
+			t.Errorf("%s: %s %v", value, date, err)
+		}
+	}
+	// Skipped local times do not exist
+	for _, value := range []string{"2026-03-08 02"} {
+		if date, err := ParseReportDate(report, value); err != ErrInvalidReportDate {
+			t.Errorf("%q is accepted: %s %v", value, date, err)
+		}
+	}
+	report.Interval = ReportIntervalFiveMinutes
+	if date, err := ParseReportDate(report, "2026-03-08 02:30"); err != ErrInvalidReportDate {
+		t.Errorf("skipped minute is accepted: %s %v", date, err)
+	}
+}
+
+func TestReportDateNotation(t *testing.T) {
+	for _, test := range []struct {
+		interval  int
+		weekStart int
+		value     string
+		expected  time.Time
+		// Canonical notation of the period, same as value if empty
+		formatted string
+	}{
+		{ReportIntervalWeekly, int(time.Monday), "2026-W42", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalWeekly, int(time.Monday), "2026-W01", time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalWeekly, int(time.Monday), "2026-W53", time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalWeekly, int(time.Monday), "2026-10-15", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), "2026-W42"},
+		{ReportIntervalWeekly, int(time.Sunday), "2026-W42", time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalWeekly, int(time.Sunday), "2026-10-17", time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC), "2026-W42"},
+		{ReportIntervalWeekly, int(time.Saturday), "2026-W42", time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalQuarterly, 0, "2026-Q1", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalQuarterly, 0, "2026-Q4", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalYearly, 0, "2026", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalMonthly, 0, "2026-10", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), ""},
+		{ReportIntervalMinute, 0, "2026-10-19 10:07", time.Date(2026, 10, 19, 10, 7, 0, 0, time.UTC), ""},
+		{ReportIntervalFiveMinutes, 0, "2026-10-19 10:05", time.Date(2026, 10, 19, 10, 5, 0, 0, time.UTC), ""},
+		{ReportIntervalFifteenMinutes, 0, "2026-10-19 10:45", time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC), ""},
+		// Minutes within a period are normalized to its beginning
+		{ReportIntervalFiveMinutes, 0, "2026-10-19 10:07", time.Date(2026, 10, 19, 10, 5, 0, 0, time.UTC), "2026-10-19 10:05"},
+		{ReportIntervalFifteenMinutes, 0, "2026-10-19 10:59", time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC), "2026-10-19 10:45"},
+	} {
+		report := Report{Id: 1, Interval: test.interval, WeekStart: test.weekStart}
+		date, err := ParseReportDate(report, test.value)
+		if err != nil || !date.Equal(test.expected) {
+			t.Errorf("%d %s: %s %v, expected %s", test.interval, test.value, date, err, test.expected)
+			continue
+		}
+		formatted := test.formatted
+		if len(formatted) == 0 {
+			formatted = test.value
+		}
+		if value := FormatReportDate(report, date); value != formatted {
+			t.Errorf("%d %s: formatted as %s, expected %s", test.interval, test.value, value, formatted)
+		}
+	}
+}
+
+func TestReportDateNotationInvalid(t *testing.T) {
+	for _, test := range []struct {
+		interval int
+		value    string
+	}{
+		{ReportIntervalWeekly, "2025-W53"},
+		{ReportIntervalWeekly, "2026-W00"},
+		{ReportIntervalWeekly, "2026-W54"},
+		{ReportIntervalWeekly, "2026-W4"},
+		{ReportIntervalQuarterly, "2026-Q5"},
+		{ReportIntervalQuarterly, "2026-Q0"},
+		{ReportIntervalQuarterly, "2026-10"},
+		{ReportIntervalYearly, "26"},
+		{ReportIntervalYearly, "2026-01"},
+		{ReportIntervalMonthly, "2026-13"},
+		{ReportIntervalMinute, "2026-10-19 10:60"},
+		{ReportIntervalFiveMinutes, "2026-10-19 10:7"},
+		{ReportIntervalFifteenMinutes, "2026-10-19 24:00"},
+		{ReportIntervalFifteenMinutes, "2026-10-19 10"},
+	} {
+		report := Report{Id: 1, Interval: test.interval}
+		if date, err := ParseReportDate(report, test.value); err != ErrInvalidReportDate {
+			t.Errorf("%d %q is accepted: %s %v", test.interval, test.value, date, err)
+		}
+	}
+}
+
+func TestReturnPeriodStart(t *testing.T) {
+	date := time.Date(2026, 10, 19, 10, 59, 30, 0, time.UTC)
+	for interval, expected := range map[int]time.Time{
+		ReportIntervalYearly:         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		ReportIntervalQuarterly:      time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		ReportIntervalMonthly:        time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		ReportIntervalWeekly:         time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		ReportIntervalDaily:          time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		ReportIntervalHourly:         time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		ReportIntervalMinute:         time.Date(2026, 10, 19, 10, 59, 0, 0, time.UTC),
+		ReportIntervalFiveMinutes:    time.Date(2026, 10, 19, 10, 55, 0, 0, time.UTC),
+		ReportIntervalFifteenMinutes: time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC),
+	} {
+		report := Report{Interval: interval, WeekStart: int(time.Monday)}
+		start := ReturnPeriodStart(report, date)
+		if !start.Equal(expected) {
+			t.Errorf("%d: %s, expected %s", interval, start, expected)
+		}
+		if next := ReturnNextPeriodStart(report, start); !next.After(date) || !ReturnPeriodStart(report, next).Equal(next) {
+			t.Errorf("%d: next period %s", interval, next)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Sort keys of list queries, ties are broken by id
+const (
+	ListSortCreated = "created"
+	// Names are sorted case-insensitively
+	ListSortName = "name"
+)
+
+const (
+	ListDefaultLimit    = 10
+	ListMaxLimit        = 100
+	ListSearchMaxLength = 200
+)
+
+var ErrInvalidListCursor = errors.New("invalid list cursor")
+
+// Query of a list of projects, reports, users or user sessions
+type ListQuery struct {
+	// Page size
+	Limit int
+	Sort  string
+	Desc  bool
+	// Case-insensitive part of the name, empty matches every row
+	Search string
+	// Rows created by given user only, zero matches every user
+	CreatedUserId int
+	// List archived rows instead of active ones
+	Archived bool
+	// Page starts after the row of the cursor, nil starts from the first row
+	After *ListCursor
+}
+
+// Position of the last row of a page, it is bound to the sort order of the query which returned it
+type ListCursor struct {
+	Sort    string    `json:"s"`
+	Desc    bool      `json:"d,omitempty"`
+	Name    string    `json:"n,omitempty"`
+	Created time.Time `json:"c"`
+	Id      int       `json:"i"`
+}
+
+// Total count of the rows matching a list query and the cursor of the next page, nil on the last page
+type ListPage struct {
+	Total int64
+	Next  *ListCursor
+}
+
+// Return opaque text of given cursor which is sent to clients
+func EncodeListCursor(cursor ListCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// Parse cursor text of given query, cursors of another sort order are invalid
+func DecodeListCursor(query ListQuery, text string) (*ListCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, ErrInvalidListCursor
+	}
+	var cursor ListCursor
+	err = json.Unmarshal(decoded, &cursor)
+	if err != nil || cursor.Id < 1 || cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+		return nil, ErrInvalidListCursor
+	}
+	return &cursor, nil
+}
+
+// Return query which fetches one more row than the page size, the extra row tells that there is a next page
+func (query ListQuery) fetchQuery() ListQuery {
+	query.Limit++
+	return query
+}
+
+// Return page of a query which has more rows after given last row of the page
+func (query ListQuery) returnNextPage(total int64, last ListCursor) ListPage {
+	last.Sort, last.Desc = query.Sort, query.Desc
+	if query.Sort != ListSortName {
+		last.Name = ""
+	}
+	return ListPage{Total: total, Next: &last}
+}
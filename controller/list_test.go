@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeListCursor(t *testing.T) {
+	query := ListQuery{Sort: ListSortName, Desc: true}
+	text := EncodeListCursor(ListCursor{Sort: ListSortName, Desc: true, Name: "a", Id: 3})
+	cursor, err := DecodeListCursor(query, text)
+	if err != nil || cursor.Id != 3 || cursor.Name != "a" {
+		t.Fatalf("cursor: %+v %v", cursor, err)
+	}
+	// Cursors of another sort key or order would skip or repeat rows
+	for _, other := range []ListQuery{{Sort: ListSortCreated, Desc: true}, {Sort: ListSortName}} {
+		if cursor, err := DecodeListCursor(other, text); err != ErrInvalidListCursor {
+			t.Fatalf("cursor of %+v is accepted: %+v %v", other, cursor, err)
+		}
+	}
+	for _, text := range []string{"", "x", EncodeListCursor(ListCursor{Sort: ListSortName, Desc: true})} {
+		if cursor, err := DecodeListCursor(query, text); err != ErrInvalidListCursor {
+			t.Fatalf("%q is accepted: %+v %v", text, cursor, err)
+		}
+	}
+}
+
+func TestSelectProjectSearchAndCursor(t *testing.T) {
+	ctx := context.Background()
+	s, report := newTestMemoryStorage(t)
+	for _, name := range []string{"Sales EU", "sales_us", "Marketing", "Sales 100%"} {
+		if err := s.CreateProject(ctx, &Project{Name: name, CreatedUserId: report.CreatedUserId, Created: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for search, expected := range map[string][]string{
+		"SALES":  {"Sales 100%", "Sales EU", "sales_us"},
+		"_":      {"sales_us"},
+		"%":      {"Sales 100%"},
+		"keting": {"Marketing"},
+		"none":   {},
+	} {
+		names := []string{}
+		query := ListQuery{Limit: 2, Sort: ListSortName, Search: search}
+		// Pages of the search are followed by their cursors
+		for {
+			projects, page, err := SelectProject(ctx, s, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != int64(len(expected)) {
+				t.Fatalf("%q: total %d", search, page.Total)
+			}
+			for _, project := range projects {
+				names = append(names, project.Name)
+			}
+			if page.Next == nil {
+				break
+			}
+			query.After = page.Next
+		}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%q: %v, expected %v", search, names, expected)
+		}
+	}
+}
+
+func TestPostgresListConditionsEscapeSearch(t *testing.T) {
+	conditions, args := postgresListConditions(ListQuery{Search: `50%_\`}, nil, nil, "name", "email")
+	if len(conditions) != 1 || conditions[0] != "(lower(name) LIKE lower($1) OR lower(email) LIKE lower($1))" {
+		t.Fatalf("conditions: %v", conditions)
+	}
+	if len(args) != 1 || args[0] != `%50\%\_\\%` {
+		t.Fatalf("args: %v", args)
+	}
+}
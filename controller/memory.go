@@ -0,0 +1,1357 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tables of the in-memory storage
+type memoryData struct {
+	users          map[int]User
+	userSessions   map[int]UserSession
+	projects       map[int]Project
+	reports        map[int]Report
+	reportColumns  map[int]ReportColumn
+	auditLogs      map[int]AuditLog
+	submissions    map[int]Submission
+	shareTokens    map[int]ShareToken
+	reportTokens   map[int]ReportToken
+	passwordResets map[int]PasswordReset
+	userIdentities map[int]UserIdentity
+	projectRoles   map[int]ProjectRole
+	// User id -> MFA of the user
+	userMfas      map[int]UserMfa
+	recoveryCodes map[int]RecoveryCode
+	mfaChallenges map[int]MfaChallenge
+	// Report id -> Row key of report date and dimension values -> Report data
+	reportData map[int]map[string]ReportData
+	// Last given id of each table
+	sequences map[string]int
+}
+
+type memoryRepository struct {
+	mu   sync.Locker
+	data *memoryData
+	// Undo of each change made in a transaction, nil outside transactions
+	undo *[]func()
+}
+
+// MemoryStorage keeps every record in process memory,
+// it is meant for tests and small installations which do not need persistence
+type MemoryStorage struct {
+	memoryRepository
+	lock sync.Mutex
+}
+
+// Transactions change the storage data in place while holding the storage lock,
+// rollback reverts the changes in reverse order
+type memoryTransaction struct {
+	memoryRepository
+	storage *MemoryStorage
+	undo    []func()
+	done    bool
+}
+
+// Transaction already holds the storage lock
+type memoryNoLock struct{}
+
+func (memoryNoLock) Lock()   {}
+func (memoryNoLock) Unlock() {}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:          make(map[int]User),
+		userSessions:   make(map[int]UserSession),
+		projects:       make(map[int]Project),
+		reports:        make(map[int]Report),
+		reportColumns:  make(map[int]ReportColumn),
+		auditLogs:      make(map[int]AuditLog),
+		submissions:    make(map[int]Submission),
+		shareTokens:    make(map[int]ShareToken),
+		reportTokens:   make(map[int]ReportToken),
+		passwordResets: make(map[int]PasswordReset),
+		userIdentities: make(map[int]UserIdentity),
+		projectRoles:   make(map[int]ProjectRole),
+		userMfas:       make(map[int]UserMfa),
+		recoveryCodes:  make(map[int]RecoveryCode),
+		mfaChallenges:  make(map[int]MfaChallenge),
+		reportData:     make(map[int]map[string]ReportData),
+		sequences:      make(map[string]int),
+	}
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	s := &MemoryStorage{}
+	s.memoryRepository = memoryRepository{mu: &s.lock, data: newMemoryData()}
+	return s
+}
+
+// Set value of given key, the previous value is restored if the transaction is rolled back
+func memorySet[K comparable, V any](r *memoryRepository, table map[K]V, key K, value V) {
+	if r.undo != nil {
+		previous, ok := table[key]
+		*r.undo = append(*r.undo, func() {
+			if ok {
+				table[key] = previous
+			} else {
+				delete(table, key)
+			}
+		})
+	}
+	table[key] = value
+}
+
+// Delete given key, the value is restored if the transaction is rolled back
+func memoryDelete[K comparable, V any](r *memoryRepository, table map[K]V, key K) {
+	previous, ok := table[key]
+	if !ok {
+		return
+	}
+	if r.undo != nil {
+		*r.undo = append(*r.undo, func() {
+			table[key] = previous
+		})
+	}
+	delete(table, key)
+}
+
+// Start a transaction, other storage calls block until it is committed or rolled back.
+// Stored values are replaced rather than modified, so the undo keeps the previous values intact.
+func (s *MemoryStorage) Begin(ctx context.Context) (Transaction, error) {
+	s.lock.Lock()
+	if err := ctx.Err(); err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	tx := &memoryTransaction{storage: s, undo: []func(){}}
+	tx.memoryRepository = memoryRepository{mu: memoryNoLock{}, data: s.data, undo: &tx.undo}
+	return tx, nil
+}
+
+func (t *memoryTransaction) Commit() error {
+	if t.done {
+		return errTransactionDone
+	}
+	t.done = true
+	t.undo = nil
+	t.storage.lock.Unlock()
+	return nil
+}
+
+func (t *memoryTransaction) Rollback() error {
+	if t.done {
+		return errTransactionDone
+	}
+	t.done = true
+	for index := len(t.undo) - 1; index >= 0; index-- {
+		t.undo[index]()
+	}
+	t.undo = nil
+	t.storage.lock.Unlock()
+	return nil
+}
+
+// Return next identity value of given table
+func (d *memoryData) nextId(table string) int {
+	d.sequences[table]++
+	return d.sequences[table]
+}
+
+// Sort key of a row of a list query
+type memoryListRow struct {
+	id      int
+	name    string
+	created time.Time
+}
+
+// Return true if row a comes before row b in the sort order of given query
+func memoryListLess(query ListQuery, a memoryListRow, b memoryListRow) bool {
+	var compare int
+	if query.Sort == ListSortName {
+		compare = strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+	} else if !a.created.Equal(b.created) {
+		compare = 1
+		if a.created.Before(b.created) {
+			compare = -1
+		}
+	}
+	if compare == 0 {
+		compare = a.id - b.id
+	}
+	if query.Desc {
+		return compare > 0
+	}
+	return compare < 0
+}
+
+// Return ids of a page of given rows which match the filters of the query, and the count of the rows
+func memoryList(query ListQuery, rows []memoryListRow) ([]int, int64) {
+	sort.Slice(rows, func(i, j int) bool {
+		return memoryListLess(query, rows[i], rows[j])
+	})
+	ids := []int{}
+	for _, row := range rows {
+		if len(ids) == query.Limit {
+			break
+		}
+		if query.After != nil &&
+			!memoryListLess(query, memoryListRow{id: query.After.Id, name: query.After.Name, created: query.After.Created}, row) {
+			continue
+		}
+		ids = append(ids, row.id)
+	}
+	return ids, int64(len(rows))
+}
+
+// Return true if given texts contain the search of the query case-insensitively, empty search matches every text
+func memoryListSearch(query ListQuery, texts ...string) bool {
+	if len(query.Search) == 0 {
+		return true
+	}
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), strings.ToLower(query.Search)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.data.users {
+		if existing.Email == user.Email {
+			return fmt.Errorf("%w: users_un", ErrDuplicate)
+		}
+	}
+	user.Id = r.data.nextId("users")
+	memorySet(r, r.data.users, user.Id, *user)
+	return nil
+}
+
+func (r *memoryRepository) UpdateUser(ctx context.Context, user User) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.users[user.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.Name = user.Name
+	memorySet(r, r.data.users, user.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateUserPassword(ctx context.Context, user User) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.users[user.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.Password = user.Password
+	memorySet(r, r.data.users, user.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) GetUser(ctx context.Context, id int) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.data.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (r *memoryRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.data.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) SelectUser(ctx context.Context, query ListQuery) ([]User, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := []memoryListRow{}
+	for id, user := range r.data.users {
+		if memoryListSearch(query, user.Name, user.Email) {
+			rows = append(rows, memoryListRow{id: id, name: user.Name, created: user.Created})
+		}
+	}
+	ids, total := memoryList(query, rows)
+	users := []User{}
+	for _, id := range ids {
+		users = append(users, r.data.users[id])
+	}
+	return users, total, nil
+}
+
+func (r *memoryRepository) CreatePasswordReset(ctx context.Context, passwordReset *PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[passwordReset.UserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", passwordReset.UserId)
+	}
+	for _, existing := range r.data.passwordResets {
+		if existing.Hash == passwordReset.Hash {
+			return fmt.Errorf("%w: password_reset_un", ErrDuplicate)
+		}
+	}
+	passwordReset.Id = r.data.nextId("password_reset")
+	memorySet(r, r.data.passwordResets, passwordReset.Id, *passwordReset)
+	return nil
+}
+
+func (r *memoryRepository) GetPasswordReset(ctx context.Context, hash string) (*PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, passwordReset := range r.data.passwordResets {
+		if passwordReset.Hash == hash {
+			return &passwordReset, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) DeletePasswordResets(ctx context.Context, userId int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, passwordReset := range r.data.passwordResets {
+		if passwordReset.UserId == userId {
+			memoryDelete(r, r.data.passwordResets, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) DeletePasswordReset(ctx context.Context, hash string, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, passwordReset := range r.data.passwordResets {
+		if passwordReset.Hash == hash && passwordReset.Expires.After(now) {
+			memoryDelete(r, r.data.passwordResets, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) DeleteExpiredPasswordResets(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, passwordReset := range r.data.passwordResets {
+		if !passwordReset.Expires.After(before) {
+			memoryDelete(r, r.data.passwordResets, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateUserIdentity(ctx context.Context, userIdentity *UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[userIdentity.UserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", userIdentity.UserId)
+	}
+	for _, existing := range r.data.userIdentities {
+		if existing.Issuer == userIdentity.Issuer && existing.Subject == userIdentity.Subject {
+			return fmt.Errorf("%w: user_identity_un", ErrDuplicate)
+		}
+	}
+	userIdentity.Id = r.data.nextId("user_identity")
+	memorySet(r, r.data.userIdentities, userIdentity.Id, *userIdentity)
+	return nil
+}
+
+func (r *memoryRepository) GetUserIdentity(ctx context.Context, issuer string, subject string) (*UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, userIdentity := range r.data.userIdentities {
+		if userIdentity.Issuer == issuer && userIdentity.Subject == subject {
+			return &userIdentity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) CreateProjectRoles(ctx context.Context, projectRoles []ProjectRole) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, projectRole := range projectRoles {
+		if _, ok := r.data.projects[projectRole.ProjectId]; !ok {
+			return fmt.Errorf("project does not exist: %d", projectRole.ProjectId)
+		}
+		if _, ok := r.data.users[projectRole.UserId]; !ok {
+			return fmt.Errorf("user does not exist: %d", projectRole.UserId)
+		}
+		for _, existing := range r.data.projectRoles {
+			if existing.ProjectId == projectRole.ProjectId && existing.UserId == projectRole.UserId {
+				return fmt.Errorf("%w: project_role_pk", ErrDuplicate)
+			}
+		}
+	}
+	for _, projectRole := range projectRoles {
+		memorySet(r, r.data.projectRoles, r.data.nextId("project_role"), projectRole)
+	}
+	return nil
+}
+
+func (r *memoryRepository) SelectProjectRoles(ctx context.Context, userId int) ([]ProjectRole, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	projectRoles := []ProjectRole{}
+	for _, projectRole := range r.data.projectRoles {
+		if projectRole.UserId == userId {
+			projectRoles = append(projectRoles, projectRole)
+		}
+	}
+	sort.Slice(projectRoles, func(i, j int) bool {
+		return projectRoles[i].ProjectId < projectRoles[j].ProjectId
+	})
+	return projectRoles, nil
+}
+
+func (r *memoryRepository) DeleteProjectRoles(ctx context.Context, userId int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, projectRole := range r.data.projectRoles {
+		if projectRole.UserId == userId {
+			memoryDelete(r, r.data.projectRoles, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateUserMfa(ctx context.Context, userMfa UserMfa) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[userMfa.UserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", userMfa.UserId)
+	}
+	if _, ok := r.data.userMfas[userMfa.UserId]; ok {
+		return fmt.Errorf("%w: user_mfa_pk", ErrDuplicate)
+	}
+	memorySet(r, r.data.userMfas, userMfa.UserId, userMfa)
+	return nil
+}
+
+func (r *memoryRepository) GetUserMfa(ctx context.Context, userId int) (*UserMfa, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userMfa, ok := r.data.userMfas[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &userMfa, nil
+}
+
+func (r *memoryRepository) UpdateUserMfa(ctx context.Context, userMfa UserMfa) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.userMfas[userMfa.UserId]
+	if !ok {
+		return 0, nil
+	}
+	existing.Enabled = userMfa.Enabled
+	existing.LastCounter = userMfa.LastCounter
+	memorySet(r, r.data.userMfas, userMfa.UserId, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateUserMfaCounter(ctx context.Context, userMfa UserMfa) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.userMfas[userMfa.UserId]
+	if !ok || existing.LastCounter >= userMfa.LastCounter {
+		return 0, nil
+	}
+	existing.LastCounter = userMfa.LastCounter
+	memorySet(r, r.data.userMfas, userMfa.UserId, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteUserMfa(ctx context.Context, userId int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.userMfas[userId]; !ok {
+		return 0, nil
+	}
+	memoryDelete(r, r.data.userMfas, userId)
+	return 1, nil
+}
+
+func (r *memoryRepository) CreateRecoveryCodes(ctx context.Context, recoveryCodes []RecoveryCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range recoveryCodes {
+		if _, ok := r.data.users[recoveryCodes[i].UserId]; !ok {
+			return fmt.Errorf("user does not exist: %d", recoveryCodes[i].UserId)
+		}
+		recoveryCodes[i].Id = r.data.nextId("recovery_code")
+		memorySet(r, r.data.recoveryCodes, recoveryCodes[i].Id, recoveryCodes[i])
+	}
+	return nil
+}
+
+func (r *memoryRepository) DeleteRecoveryCode(ctx context.Context, userId int, hash string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, recoveryCode := range r.data.recoveryCodes {
+		if recoveryCode.UserId == userId && recoveryCode.Hash == hash {
+			memoryDelete(r, r.data.recoveryCodes, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) DeleteRecoveryCodes(ctx context.Context, userId int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, recoveryCode := range r.data.recoveryCodes {
+		if recoveryCode.UserId == userId {
+			memoryDelete(r, r.data.recoveryCodes, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateMfaChallenge(ctx context.Context, mfaChallenge *MfaChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[mfaChallenge.UserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", mfaChallenge.UserId)
+	}
+	for _, existing := range r.data.mfaChallenges {
+		if existing.Hash == mfaChallenge.Hash {
+			return fmt.Errorf("%w: mfa_challenge_un", ErrDuplicate)
+		}
+	}
+	mfaChallenge.Id = r.data.nextId("mfa_challenge")
+	memorySet(r, r.data.mfaChallenges, mfaChallenge.Id, *mfaChallenge)
+	return nil
+}
+
+func (r *memoryRepository) GetMfaChallenge(ctx context.Context, hash string) (*MfaChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, mfaChallenge := range r.data.mfaChallenges {
+		if mfaChallenge.Hash == hash {
+			return &mfaChallenge, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) IncrementMfaChallengeAttempts(ctx context.Context, id int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mfaChallenge, ok := r.data.mfaChallenges[id]
+	if !ok {
+		return 0, nil
+	}
+	mfaChallenge.Attempts++
+	memorySet(r, r.data.mfaChallenges, id, mfaChallenge)
+	return mfaChallenge.Attempts, nil
+}
+
+func (r *memoryRepository) DeleteMfaChallenge(ctx context.Context, id int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.mfaChallenges[id]; !ok {
+		return 0, nil
+	}
+	memoryDelete(r, r.data.mfaChallenges, id)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteExpiredMfaChallenges(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, mfaChallenge := range r.data.mfaChallenges {
+		if !mfaChallenge.Expires.After(before) {
+			memoryDelete(r, r.data.mfaChallenges, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateUserSession(ctx context.Context, userSession UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[userSession.UserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", userSession.UserId)
+	}
+	for _, existing := range r.data.userSessions {
+		if existing.Session == userSession.Session {
+			return fmt.Errorf("%w: user_sessions_un", ErrDuplicate)
+		}
+	}
+	userSession.Id = r.data.nextId("user_session")
+	memorySet(r, r.data.userSessions, userSession.Id, userSession)
+	return nil
+}
+
+func (r *memoryRepository) DeleteUserSession(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	memoryDelete(r, r.data.userSessions, id)
+	return nil
+}
+
+func (r *memoryRepository) DeleteAllUserSessions(ctx context.Context, userId int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, userSession := range r.data.userSessions {
+		if userSession.UserId == userId {
+			memoryDelete(r, r.data.userSessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetUserSession(ctx context.Context, session string) (*UserSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, userSession := range r.data.userSessions {
+		if userSession.Session == session {
+			return &userSession, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) SelectUserSession(ctx context.Context, userId int, query ListQuery) ([]UserSession, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := []memoryListRow{}
+	for id, userSession := range r.data.userSessions {
+		if userSession.UserId == userId {
+			rows = append(rows, memoryListRow{id: id, created: userSession.Created})
+		}
+	}
+	ids, total := memoryList(query, rows)
+	userSessions := []UserSession{}
+	for _, id := range ids {
+		userSessions = append(userSessions, r.data.userSessions[id])
+	}
+	return userSessions, total, nil
+}
+
+func (r *memoryRepository) CreateProject(ctx context.Context, project *Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.users[project.CreatedUserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", project.CreatedUserId)
+	}
+	for _, existing := range r.data.projects {
+		if existing.Name == project.Name {
+			return fmt.Errorf("%w: project_un", ErrDuplicate)
+		}
+	}
+	project.Id = r.data.nextId("project")
+	memorySet(r, r.data.projects, project.Id, *project)
+	return nil
+}
+
+func (r *memoryRepository) UpdateProject(ctx context.Context, project *Project) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.projects[project.Id]
+	if !ok {
+		return 0, nil
+	}
+	for _, other := range r.data.projects {
+		if other.Id != project.Id && other.Name == project.Name {
+			return 0, fmt.Errorf("%w: project_un", ErrDuplicate)
+		}
+	}
+	existing.Name = project.Name
+	memorySet(r, r.data.projects, project.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) SelectProject(ctx context.Context, query ListQuery) ([]Project, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := []memoryListRow{}
+	for id, project := range r.data.projects {
+		if (project.Archived != nil) == query.Archived && memoryListSearch(query, project.Name) &&
+			(query.CreatedUserId == 0 || project.CreatedUserId == query.CreatedUserId) {
+			rows = append(rows, memoryListRow{id: id, name: project.Name, created: project.Created})
+		}
+	}
+	ids, total := memoryList(query, rows)
+	projects := []Project{}
+	for _, id := range ids {
+		projects = append(projects, r.data.projects[id])
+	}
+	return projects, total, nil
+}
+
+func (r *memoryRepository) GetProject(ctx context.Context, id int) (*Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if project, ok := r.data.projects[id]; ok {
+		return &project, nil
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) UpdateProjectRetention(ctx context.Context, project Project) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.projects[project.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.RetentionDays = project.RetentionDays
+	memorySet(r, r.data.projects, project.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateProjectArchived(ctx context.Context, project Project) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.projects[project.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.Archived = project.Archived
+	memorySet(r, r.data.projects, project.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteProject(ctx context.Context, id int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.projects[id]; !ok {
+		return 0, nil
+	}
+	for _, report := range r.data.reports {
+		if report.ProjectId == id {
+			return 0, fmt.Errorf("project %d is still referenced by report %d", id, report.Id)
+		}
+	}
+	r.deleteShareToken(ShareEntityProject, id)
+	for roleId, projectRole := range r.data.projectRoles {
+		if projectRole.ProjectId == id {
+			memoryDelete(r, r.data.projectRoles, roleId)
+		}
+	}
+	memoryDelete(r, r.data.projects, id)
+	return 1, nil
+}
+
+func (r *memoryRepository) CreateReport(ctx context.Context, report *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.projects[report.ProjectId]; !ok {
+		return fmt.Errorf("project does not exist: %d", report.ProjectId)
+	}
+	if _, ok := r.data.users[report.CreatedUserId]; !ok {
+		return fmt.Errorf("user does not exist: %d", report.CreatedUserId)
+	}
+	report.Id = r.data.nextId("report")
+	stored := *report
+	stored.Columns = nil
+	memorySet(r, r.data.reports, report.Id, stored)
+	return nil
+}
+
+func (r *memoryRepository) SelectReport(ctx context.Context, projectId int, query ListQuery) ([]Report, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := []memoryListRow{}
+	for id, report := range r.data.reports {
+		if report.ProjectId == projectId && (report.Archived != nil) == query.Archived && memoryListSearch(query, report.Name) &&
+			(query.CreatedUserId == 0 || report.CreatedUserId == query.CreatedUserId) {
+			rows = append(rows, memoryListRow{id: id, name: report.Name, created: report.Created})
+		}
+	}
+	ids, total := memoryList(query, rows)
+	reports := []Report{}
+	for _, id := range ids {
+		reports = append(reports, r.data.reports[id])
+	}
+	return reports, total, nil
+}
+
+func (r *memoryRepository) GetReport(ctx context.Context, id int) (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if report, ok := r.data.reports[id]; ok {
+		return &report, nil
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) SelectAllReports(ctx context.Context) ([]Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]int, 0, len(r.data.reports))
+	for id := range r.data.reports {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	reports := []Report{}
+	for _, id := range ids {
+		reports = append(reports, r.data.reports[id])
+	}
+	return reports, nil
+}
+
+func (r *memoryRepository) SelectProjectReports(ctx context.Context, projectId int) ([]Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []int{}
+	for id, report := range r.data.reports {
+		if report.ProjectId == projectId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	reports := []Report{}
+	for _, id := range ids {
+		reports = append(reports, r.data.reports[id])
+	}
+	return reports, nil
+}
+
+func (r *memoryRepository) UpdateReportRetention(ctx context.Context, report Report) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.reports[report.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.RetentionDays = report.RetentionDays
+	existing.RollupReportId = report.RollupReportId
+	existing.RollupFunction = report.RollupFunction
+	memorySet(r, r.data.reports, report.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateReportArchived(ctx context.Context, report Report) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.reports[report.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.Archived = report.Archived
+	memorySet(r, r.data.reports, report.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateReportSubmitMode(ctx context.Context, report Report) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.reports[report.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.SubmitMode = report.SubmitMode
+	memorySet(r, r.data.reports, report.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteReport(ctx context.Context, id int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.reports[id]; !ok {
+		return 0, nil
+	}
+	memoryDelete(r, r.data.reportData, id)
+	for otherId, other := range r.data.reports {
+		if other.RollupReportId != nil && *other.RollupReportId == id {
+			other.RollupReportId = nil
+			memorySet(r, r.data.reports, otherId, other)
+		}
+	}
+	for columnId, reportColumn := range r.data.reportColumns {
+		if reportColumn.ReportId == id {
+			memoryDelete(r, r.data.reportColumns, columnId)
+		}
+	}
+	for submissionId, submission := range r.data.submissions {
+		if submission.ReportId != nil && *submission.ReportId == id {
+			memoryDelete(r, r.data.submissions, submissionId)
+		}
+	}
+	r.deleteShareToken(ShareEntityReport, id)
+	for reportTokenId, reportToken := range r.data.reportTokens {
+		if reportToken.ReportId == id {
+			memoryDelete(r, r.data.reportTokens, reportTokenId)
+		}
+	}
+	memoryDelete(r, r.data.reports, id)
+	return 1, nil
+}
+
+func (r *memoryRepository) CreateAuditLog(ctx context.Context, auditLog *AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	auditLog.Id = r.data.nextId("audit_log")
+	memorySet(r, r.data.auditLogs, auditLog.Id, *auditLog)
+	return nil
+}
+
+func (r *memoryRepository) CreateSubmission(ctx context.Context, submission *Submission) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	submission.Id = r.data.nextId("submission_log")
+	memorySet(r, r.data.submissions, submission.Id, *submission)
+	return nil
+}
+
+func (r *memoryRepository) SelectSubmission(ctx context.Context, reportId int, page int, failed bool) ([]Submission, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []int{}
+	for id, submission := range r.data.submissions {
+		if submission.ReportId == nil || *submission.ReportId != reportId {
+			continue
+		}
+		if failed && submission.Status == http.StatusOK {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	// Newest first
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	submissions := []Submission{}
+	for index := SubmissionPageLimit * page; index < len(ids) && index < SubmissionPageLimit*(page+1); index++ {
+		submissions = append(submissions, r.data.submissions[ids[index]])
+	}
+	return submissions, nil
+}
+
+func (r *memoryRepository) GetSubmission(ctx context.Context, id int) (*Submission, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	submission, ok := r.data.submissions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &submission, nil
+}
+
+func (r *memoryRepository) DeleteSubmissions(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, submission := range r.data.submissions {
+		if submission.Received.Before(before) {
+			memoryDelete(r, r.data.submissions, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateShareToken(ctx context.Context, shareToken *ShareToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.data.shareTokens {
+		if existing.Hash == shareToken.Hash {
+			return fmt.Errorf("%w: share_token_un", ErrDuplicate)
+		}
+		if existing.Entity == shareToken.Entity && existing.EntityId == shareToken.EntityId {
+			return fmt.Errorf("%w: share_token_entity_un", ErrDuplicate)
+		}
+	}
+	shareToken.Id = r.data.nextId("share_token")
+	// Plaintext token is not stored
+	stored := *shareToken
+	stored.Token = ""
+	memorySet(r, r.data.shareTokens, shareToken.Id, stored)
+	return nil
+}
+
+func (r *memoryRepository) GetShareToken(ctx context.Context, hash string) (*ShareToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, shareToken := range r.data.shareTokens {
+		if shareToken.Hash == hash {
+			return &shareToken, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) DeleteShareToken(ctx context.Context, entity string, entityId int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deleteShareToken(entity, entityId), nil
+}
+
+// Delete share token of given project or report, caller must hold the lock
+func (r *memoryRepository) deleteShareToken(entity string, entityId int) int64 {
+	var rows int64
+	for id, shareToken := range r.data.shareTokens {
+		if shareToken.Entity == entity && shareToken.EntityId == entityId {
+			memoryDelete(r, r.data.shareTokens, id)
+			rows++
+		}
+	}
+	return rows
+}
+
+func (r *memoryRepository) CreateReportToken(ctx context.Context, reportToken *ReportToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.reports[reportToken.ReportId]; !ok {
+		return fmt.Errorf("report does not exist: %d", reportToken.ReportId)
+	}
+	for _, existing := range r.data.reportTokens {
+		if existing.Hash == reportToken.Hash {
+			return fmt.Errorf("%w: report_token_un", ErrDuplicate)
+		}
+	}
+	reportToken.Id = r.data.nextId("report_token")
+	memorySet(r, r.data.reportTokens, reportToken.Id, *reportToken)
+	return nil
+}
+
+func (r *memoryRepository) GetReportToken(ctx context.Context, hash string) (*ReportToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reportToken := range r.data.reportTokens {
+		if reportToken.Hash == hash {
+			return &reportToken, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) SelectReportToken(ctx context.Context, reportId int) ([]ReportToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reportTokens := []ReportToken{}
+	for _, reportToken := range r.data.reportTokens {
+		if reportToken.ReportId == reportId {
+			reportTokens = append(reportTokens, reportToken)
+		}
+	}
+	sort.Slice(reportTokens, func(i, j int) bool { return reportTokens[i].Id < reportTokens[j].Id })
+	return reportTokens, nil
+}
+
+func (r *memoryRepository) UpdateReportTokenExpires(ctx context.Context, reportToken ReportToken) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.reportTokens[reportToken.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.Expires = reportToken.Expires
+	memorySet(r, r.data.reportTokens, reportToken.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) UpdateReportTokenLastUsed(ctx context.Context, reportToken ReportToken) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.data.reportTokens[reportToken.Id]
+	if !ok {
+		return 0, nil
+	}
+	existing.LastUsed = reportToken.LastUsed
+	memorySet(r, r.data.reportTokens, reportToken.Id, existing)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteReportToken(ctx context.Context, reportId int, id int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reportToken, ok := r.data.reportTokens[id]
+	if !ok || reportToken.ReportId != reportId {
+		return 0, nil
+	}
+	memoryDelete(r, r.data.reportTokens, id)
+	return 1, nil
+}
+
+func (r *memoryRepository) DeleteExpiredReportTokens(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, reportToken := range r.data.reportTokens {
+		if reportToken.Expires != nil && !reportToken.Expires.After(before) {
+			memoryDelete(r, r.data.reportTokens, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CreateReportColumns(ctx context.Context, reportColumns []ReportColumn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reportColumn := range reportColumns {
+		if _, ok := r.data.reports[reportColumn.ReportId]; !ok {
+			return fmt.Errorf("report does not exist: %d", reportColumn.ReportId)
+		}
+	}
+	for index := range reportColumns {
+		reportColumns[index].Id = r.data.nextId("report_column")
+		memorySet(r, r.data.reportColumns, reportColumns[index].Id, reportColumns[index])
+	}
+	return nil
+}
+
+func (r *memoryRepository) PopulateReportColumns(ctx context.Context, report *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []int{}
+	for id, reportColumn := range r.data.reportColumns {
+		if reportColumn.ReportId == report.Id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		report.Columns = append(report.Columns, r.data.reportColumns[id])
+	}
+	return nil
+}
+
+func (r *memoryRepository) CreateReportDataTable(ctx context.Context, report Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.data.reportData[report.Id]; ok {
+		return fmt.Errorf("relation \"%s\" already exists", ReturnReportTableName(report.Id))
+	}
+	for _, column := range report.Columns {
+		if _, ok := ReportColumnTypeMap[column.Type]; !ok {
+			return fmt.Errorf("Invalid report column type: %d", column.Type)
+		}
+	}
+	memorySet(r, r.data.reportData, report.Id, make(map[string]ReportData))
+	return nil
+}
+
+func (r *memoryRepository) InsertReportData(ctx context.Context, reportId int, mode string, reportData *ReportData) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	table, ok := r.data.reportData[reportId]
+	if !ok {
+		return false, fmt.Errorf("relation \"%s\" does not exist", ReturnReportTableName(reportId))
+	}
+	// Rows are identified by report date and dimension values
+	reportColumns := []ReportColumn{}
+	for _, reportColumn := range r.data.reportColumns {
+		if reportColumn.ReportId == reportId {
+			reportColumns = append(reportColumns, reportColumn)
+		}
+	}
+	dimensionKey, err := ReturnDimensionKey(reportColumns, reportData.ColumnMap)
+	if err != nil {
+		return false, err
+	}
+	key := returnRowKey(reportData.ReportDate, dimensionKey)
+	row, exists := table[key]
+	if exists && mode == ReportSubmitModeReject {
+		return false, ErrDuplicate
+	}
+	if !exists {
+		// Insert
+		row = ReportData{
+			Id:           r.data.nextId(ReturnReportTableName(reportId)),
+			ReportDate:   reportData.ReportDate,
+			ColumnMap:    make(map[int]interface{}),
+			DimensionKey: dimensionKey,
+		}
+	} else {
+		// Stored rows are not modified in place
+		columnMap := make(map[int]interface{}, len(row.ColumnMap))
+		if mode != ReportSubmitModeOverwrite {
+			for columnId, value := range row.ColumnMap {
+				columnMap[columnId] = value
+			}
+		}
+		row.ColumnMap = columnMap
+	}
+	// Update only submitted columns, same as ON CONFLICT DO UPDATE
+	row.SentDate = reportData.SentDate
+	for columnId, value := range reportData.ColumnMap {
+		if mode == ReportSubmitModeAccumulate {
+			value = accumulateValue(r.data.reportColumns[columnId], row.ColumnMap[columnId], value)
+		}
+		row.ColumnMap[columnId] = value
+	}
+	memorySet(r, table, key, row)
+	reportData.Id = row.Id
+	reportData.DimensionKey = dimensionKey
+	return !exists, nil
+}
+
+// Add submitted value to existing value of numeric columns, other columns take the submitted value
+func accumulateValue(reportColumn ReportColumn, existing interface{}, value interface{}) interface{} {
+	if existing == nil || value == nil || !IsNumericColumnType(reportColumn.Type) || reportColumn.Dimension {
+		return value
+	}
+	if reportColumn.Type == ReportColumnTypeDecimal {
+		a, okA := returnRatValue(existing)
+		b, okB := returnRatValue(value)
+		if !okA || !okB {
+			return value
+		}
+		return new(big.Rat).Add(a, b).FloatString(reportColumn.Scale)
+	}
+	a, okA := returnFloatValue(existing)
+	b, okB := returnFloatValue(value)
+	if !okA || !okB {
+		return value
+	}
+	return a + b
+}
+
+// Return report data rows of given report with respect to given filter ordered by report date and dimension key
+func (r *memoryRepository) rangeReportData(reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	table, ok := r.data.reportData[reportId]
+	if !ok {
+		return nil, fmt.Errorf("relation \"%s\" does not exist", ReturnReportTableName(reportId))
+	}
+	// Dimension column id -> Accepted dimension values
+	dimensionMap := make(map[int]map[string]struct{})
+	for columnId, values := range filter.Dimensions {
+		dimensionMap[columnId] = make(map[string]struct{})
+		for _, value := range values {
+			dimensionMap[columnId][value] = emptyStruct
+		}
+	}
+	rows := []ReportData{}
+	for _, row := range table {
+		if !filter.From.IsZero() && row.ReportDate.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !row.ReportDate.Before(filter.To) {
+			continue
+		}
+		matched, err := r.matchReportData(row, dimensionMap)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].ReportDate.Equal(rows[j].ReportDate) {
+			return rows[i].ReportDate.Before(rows[j].ReportDate)
+		}
+		return rows[i].DimensionKey < rows[j].DimensionKey
+	})
+	if filter.Limit <= 0 {
+		return rows, nil
+	}
+	if !filter.LimitDates {
+		if len(rows) > filter.Limit {
+			rows = rows[:filter.Limit]
+		}
+		return rows, nil
+	}
+	dates := 0
+	for index, row := range rows {
+		if index == 0 || !row.ReportDate.Equal(rows[index-1].ReportDate) {
+			dates++
+		}
+		if dates > filter.Limit {
+			return rows[:index], nil
+		}
+	}
+	return rows, nil
+}
+
+// Return true if dimension values of given row are accepted by given dimension map
+func (r *memoryRepository) matchReportData(row ReportData, dimensionMap map[int]map[string]struct{}) (bool, error) {
+	for columnId, valueMap := range dimensionMap {
+		reportColumn, ok := r.data.reportColumns[columnId]
+		if !ok {
+			return false, fmt.Errorf("column \"%s\" does not exist", ReturnReportColumnName(columnId))
+		}
+		value, err := ReturnDimensionValue(reportColumn, row.ColumnMap)
+		if err != nil {
+			return false, err
+		}
+		if _, ok := valueMap[value]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *memoryRepository) SelectReportData(ctx context.Context, reportId int, from time.Time, to time.Time, limit int) ([]ReportData, error) {
+	return r.FilterReportData(ctx, reportId, ReportDataFilter{From: from, To: to, Limit: limit})
+}
+
+func (r *memoryRepository) FilterReportData(ctx context.Context, reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows, err := r.rangeReportData(reportId, filter)
+	if err != nil {
+		return nil, err
+	}
+	for index, row := range rows {
+		// Callers must not modify stored values
+		columnMap := make(map[int]interface{}, len(row.ColumnMap))
+		for columnId, value := range row.ColumnMap {
+			columnMap[columnId] = value
+		}
+		rows[index].ColumnMap = columnMap
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository) CountReportData(ctx context.Context, reportId int, from time.Time, to time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows, err := r.rangeReportData(reportId, ReportDataFilter{From: from, To: to})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+func (r *memoryRepository) DeleteReportData(ctx context.Context, reportId int, rows []ReportData) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	table, ok := r.data.reportData[reportId]
+	if !ok {
+		return 0, fmt.Errorf("relation \"%s\" does not exist", ReturnReportTableName(reportId))
+	}
+	var count int64
+	for _, row := range rows {
+		key := returnRowKey(row.ReportDate, row.DimensionKey)
+		if _, ok := table[key]; ok {
+			memoryDelete(r, table, key)
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Return a storage with a user, a project and a report of one int column
+func newTestMemoryStorage(t *testing.T) (*MemoryStorage, Report) {
+	t.Helper()
+	ctx := context.Background()
+	s := NewMemoryStorage()
+	user := &User{Email: "a@example.com", Created: time.Now()}
+	if err := s.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	project := &Project{Name: "A", CreatedUserId: user.Id, Created: time.Now()}
+	if err := s.CreateProject(ctx, project); err != nil {
+		t.Fatal(err)
+	}
+	report := Report{ProjectId: project.Id, CreatedUserId: user.Id, Name: "Daily", Interval: ReportIntervalDaily}
+	if err := s.CreateReport(ctx, &report); err != nil {
+		t.Fatal(err)
+	}
+	report.Columns = []ReportColumn{{ReportId: report.Id, Name: "amount", Type: ReportColumnTypeInt}}
+	if err := s.CreateReportColumns(ctx, report.Columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateReportDataTable(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	return s, report
+}
+
+// Return names of the first page of projects
+func selectTestProjectNames(t *testing.T, s *MemoryStorage) []string {
+	t.Helper()
+	projects, _, err := s.SelectProject(context.Background(), ListQuery{Limit: ListDefaultLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+	return names
+}
+
+func TestMemoryTransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	s, report := newTestMemoryStorage(t)
+	reportDate := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	columnId := report.Columns[0].Id
+	_, err := s.InsertReportData(ctx, report.Id, ReportSubmitModeMerge,
+		&ReportData{ReportDate: reportDate, ColumnMap: map[int]interface{}{columnId: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateProject(ctx, &Project{Id: report.ProjectId, Name: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.CreateProject(ctx, &Project{Name: "C", CreatedUserId: report.CreatedUserId}); err != nil {
+		t.Fatal(err)
+	}
+	// Existing row is changed and a new row is inserted
+	for _, date := range []time.Time{reportDate, reportDate.AddDate(0, 0, 1)} {
+		_, err := tx.InsertReportData(ctx, report.Id, ReportSubmitModeAccumulate,
+			&ReportData{ReportDate: date, ColumnMap: map[int]interface{}{columnId: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if names := selectTestProjectNames(t, s); len(names) != 1 || names[0] != "A" {
+		t.Fatalf("projects are not restored: %v", names)
+	}
+	rows, err := s.SelectReportData(ctx, report.Id, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ColumnMap[columnId] != 1 {
+		t.Fatalf("report data is not restored: %+v", rows)
+	}
+}
+
+func TestMemoryTransactionCommit(t *testing.T) {
+	ctx := context.Background()
+	s, report := newTestMemoryStorage(t)
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.UpdateProject(ctx, &Project{Id: report.ProjectId, Name: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != errTransactionDone {
+		t.Fatalf("rollback after commit: %v", err)
+	}
+	if names := selectTestProjectNames(t, s); len(names) != 1 || names[0] != "B" {
+		t.Fatalf("project is not updated: %v", names)
+	}
+}
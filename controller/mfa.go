@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"repgen/core"
+	"repgen/security"
+	"strings"
+	"time"
+)
+
+// TOTP second factor of a user, the secret is needed to verify codes so it is not hashed
+type UserMfa struct {
+	UserId int
+	Secret string
+	// Login requires a code once the enrollment is confirmed with a code
+	Enabled bool
+	// Time step of the last accepted code, so a code is accepted once
+	LastCounter int64
+	Created     time.Time
+}
+
+// Single use code which replaces a TOTP code, only its hash is stored
+type RecoveryCode struct {
+	Id      int
+	UserId  int
+	Hash    string
+	Created time.Time
+}
+
+// Second login step of a user whose password is verified, only the hash of its token is stored
+type MfaChallenge struct {
+	Id      int
+	UserId  int
+	Hash    string
+	Expires time.Time
+	Created time.Time
+	// Codes tried with the token
+	Attempts int
+}
+
+const (
+	MfaDefaultIssuer        = "repgen"
+	MfaRecoveryCodeCount    = 10
+	MfaRecoveryCodeLength   = 8
+	MfaChallengeTokenLength = 32
+	MfaChallengeMinutes     = 5
+	// Codes tried with a token before it is invalidated, applied even if the login lockout is disabled
+	MfaChallengeMaxAttempts = 5
+)
+
+// Return issuer name shown by authenticator apps with respect to config
+func ReturnMfaIssuer() string {
+	if core.Config == nil || len(core.Config.Mfa.Issuer) == 0 {
+		return MfaDefaultIssuer
+	}
+	return core.Config.Mfa.Issuer
+}
+
+// Return true if given user is able to reset MFA of other users
+func IsMfaAdmin(user User) bool {
+	if core.Config == nil {
+		return false
+	}
+	for _, email := range core.Config.Mfa.AdminEmails {
+		if strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate recovery codes of given user, plaintext codes are returned once and only their hashes are stored
+func NewRecoveryCodes(userId int, created time.Time) ([]string, []RecoveryCode, error) {
+	codes := make([]string, 0, MfaRecoveryCodeCount)
+	recoveryCodes := make([]RecoveryCode, 0, MfaRecoveryCodeCount)
+	for i := 0; i < MfaRecoveryCodeCount; i++ {
+		code, err := security.GenerateRecoveryCode(MfaRecoveryCodeLength)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		recoveryCodes = append(recoveryCodes, RecoveryCode{
+			UserId:  userId,
+			Hash:    security.HashToken(security.NormalizeRecoveryCode(code)),
+			Created: created,
+		})
+	}
+	return codes, recoveryCodes, nil
+}
+
+// Verify given TOTP code or recovery code of the user at given time, an accepted code cannot be used again
+func VerifyMfaCode(ctx context.Context, repo Repository, userMfa *UserMfa, code string, now time.Time) (bool, error) {
+	if len(code) == security.TotpDigits {
+		counter, ok, err := security.ValidateTotpCode(userMfa.Secret, code, now, userMfa.LastCounter)
+		if err != nil || !ok {
+			return false, err
+		}
+		userMfa.LastCounter = counter
+		rows, err := UpdateUserMfaCounter(ctx, repo, *userMfa)
+		if err != nil {
+			return false, err
+		}
+		// Zero rows means the code is used by a concurrent request
+		return rows == 1, nil
+	}
+	rows, err := DeleteRecoveryCode(ctx, repo, userMfa.UserId, security.HashToken(security.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func CreateUserMfa(ctx context.Context, repo Repository, userMfa UserMfa) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateUserMfa(ctx, userMfa)
+}
+
+func GetUserMfa(ctx context.Context, repo Repository, userId int) (*UserMfa, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetUserMfa(ctx, userId)
+}
+
+func UpdateUserMfa(ctx context.Context, repo Repository, userMfa UserMfa) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateUserMfa(ctx, userMfa)
+}
+
+// Set last counter of the user if given counter is newer, zero rows means the code is already used
+func UpdateUserMfaCounter(ctx context.Context, repo Repository, userMfa UserMfa) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateUserMfaCounter(ctx, userMfa)
+}
+
+func DeleteUserMfa(ctx context.Context, repo Repository, userId int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteUserMfa(ctx, userId)
+}
+
+func CreateRecoveryCodes(ctx context.Context, repo Repository, recoveryCodes []RecoveryCode) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateRecoveryCodes(ctx, recoveryCodes)
+}
+
+// Delete recovery code of given hash, zero rows means it does not exist or it is already used
+func DeleteRecoveryCode(ctx context.Context, repo Repository, userId int, hash string) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteRecoveryCode(ctx, userId, hash)
+}
+
+// Delete every recovery code of given user
+func DeleteRecoveryCodes(ctx context.Context, repo Repository, userId int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteRecoveryCodes(ctx, userId)
+}
+
+func CreateMfaChallenge(ctx context.Context, repo Repository, mfaChallenge *MfaChallenge) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateMfaChallenge(ctx, mfaChallenge)
+}
+
+func GetMfaChallenge(ctx context.Context, repo Repository, hash string) (*MfaChallenge, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetMfaChallenge(ctx, hash)
+}
+
+// Count a code tried with given challenge and return the attempts including this one, zero if the challenge does not exist
+func IncrementMfaChallengeAttempts(ctx context.Context, repo Repository, id int) (int, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.IncrementMfaChallengeAttempts(ctx, id)
+}
+
+func DeleteMfaChallenge(ctx context.Context, repo Repository, id int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteMfaChallenge(ctx, id)
+}
+
+// Delete MFA challenges which are expired before given time
+func DeleteExpiredMfaChallenges(ctx context.Context, repo Repository, before time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteExpiredMfaChallenges(ctx, before)
+}
+
+// Start enrollment with given secret, an unconfirmed enrollment of the user is replaced
+func RegisterUserMfa(ctx context.Context, userMfa UserMfa) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		_, err := DeleteUserMfa(ctx, tx, userMfa.UserId)
+		if err != nil {
+			return err
+		}
+		return CreateUserMfa(ctx, tx, userMfa)
+	})
+}
+
+// Enable MFA of the user and replace its recovery codes with given ones
+func EnableUserMfa(ctx context.Context, userMfa UserMfa, recoveryCodes []RecoveryCode) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		userMfa.Enabled = true
+		_, err := UpdateUserMfa(ctx, tx, userMfa)
+		if err != nil {
+			return err
+		}
+		_, err = DeleteRecoveryCodes(ctx, tx, userMfa.UserId)
+		if err != nil {
+			return err
+		}
+		return CreateRecoveryCodes(ctx, tx, recoveryCodes)
+	})
+}
+
+// Remove MFA and recovery codes of the user
+func DisableUserMfa(ctx context.Context, userId int) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		return disableUserMfa(ctx, tx, userId)
+	})
+}
+
+// Remove MFA of given user on behalf of an admin and record it to audit log
+func ResetUserMfa(ctx context.Context, user User, adminUserId int) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		err := disableUserMfa(ctx, tx, user.Id)
+		if err != nil {
+			return err
+		}
+		return CreateAuditLog(ctx, tx, &AuditLog{UserId: adminUserId, Action: AuditActionMfaReset, Entity: AuditEntityUser,
+			EntityId: user.Id, Detail: user.Email, Created: time.Now().UTC()})
+	})
+}
+
+func disableUserMfa(ctx context.Context, repo Repository, userId int) error {
+	_, err := DeleteUserMfa(ctx, repo, userId)
+	if err != nil {
+		return err
+	}
+	_, err = DeleteRecoveryCodes(ctx, repo, userId)
+	return err
+}
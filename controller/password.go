@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"repgen/core"
+	"repgen/security"
+	"strings"
+	"time"
+)
+
+// Single use token which lets a user set a new password, only its hash is stored
+type PasswordReset struct {
+	Id      int
+	UserId  int
+	Hash    string
+	Expires time.Time
+	Created time.Time
+}
+
+// Length limits of new passwords
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+}
+
+const (
+	PasswordDefaultMinLength    = 8
+	PasswordDefaultMaxLength    = 128
+	PasswordResetTokenLength    = 32
+	PasswordResetDefaultMinutes = 60
+)
+
+var ErrPasswordResetNotFound = errors.New("password reset does not exist")
+
+// Breached passwords which cannot be used as new passwords
+var breachedPasswords = make(map[string]struct{})
+
+// Apply password hashing parameters and load breached password list with respect to config
+func InitializePasswordPolicy() {
+	argon2 := core.Config.Password.Argon2
+	security.SetHashParams(argon2.Memory, argon2.Iterations, argon2.Parallelism, argon2.SaltLength, argon2.KeyLength)
+	if len(core.Config.Password.BreachedList) == 0 {
+		return
+	}
+	file, err := os.Open(core.Config.Password.BreachedList)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		password := strings.TrimSpace(scanner.Text())
+		if len(password) > 0 {
+			breachedPasswords[password] = emptyStruct
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+	log.Printf("Breached password list is loaded with %d passwords.", len(breachedPasswords))
+}
+
+// Return password policy with respect to config, the maximum length is capped by UserPasswordMaxLength
+func ReturnPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{MinLength: PasswordDefaultMinLength, MaxLength: PasswordDefaultMaxLength}
+	if core.Config != nil {
+		if core.Config.Password.MinLength > 0 {
+			policy.MinLength = core.Config.Password.MinLength
+		}
+		if core.Config.Password.MaxLength > 0 {
+			policy.MaxLength = core.Config.Password.MaxLength
+		}
+	}
+	if policy.MaxLength > UserPasswordMaxLength {
+		policy.MaxLength = UserPasswordMaxLength
+	}
+	return policy
+}
+
+// Return true if given password is in the breached password list
+func IsBreachedPassword(password string) bool {
+	_, ok := breachedPasswords[password]
+	return ok
+}
+
+// Return minutes a password reset token is valid with respect to config
+func ReturnPasswordResetMinutes() int {
+	if core.Config == nil || core.Config.Password.ResetMinutes <= 0 {
+		return PasswordResetDefaultMinutes
+	}
+	return core.Config.Password.ResetMinutes
+}
+
+func CreatePasswordReset(ctx context.Context, repo Repository, passwordReset *PasswordReset) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreatePasswordReset(ctx, passwordReset)
+}
+
+func GetPasswordReset(ctx context.Context, repo Repository, hash string) (*PasswordReset, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetPasswordReset(ctx, hash)
+}
+
+// Delete every password reset token of given user
+func DeletePasswordResets(ctx context.Context, repo Repository, userId int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeletePasswordResets(ctx, userId)
+}
+
+// Delete password reset of given token hash unless it is expired at given time
+func DeletePasswordReset(ctx context.Context, repo Repository, hash string, now time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeletePasswordReset(ctx, hash, now)
+}
+
+// Delete password reset tokens which are expired before given time
+func DeleteExpiredPasswordResets(ctx context.Context, repo Repository, before time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteExpiredPasswordResets(ctx, before)
+}
+
+// Replace password reset tokens of the user with given one
+func RegisterPasswordReset(ctx context.Context, passwordReset *PasswordReset) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		_, err := DeletePasswordResets(ctx, tx, passwordReset.UserId)
+		if err != nil {
+			return err
+		}
+		return CreatePasswordReset(ctx, tx, passwordReset)
+	})
+}
+
+// Set hashed password of the user of given reset token, the reset tokens and sessions of the user are deleted.
+// ErrPasswordResetNotFound is returned if the token is used or expired meanwhile, so a token resets once.
+func ResetPassword(ctx context.Context, passwordReset PasswordReset, hashedPassword string, now time.Time) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		rows, err := DeletePasswordReset(ctx, tx, passwordReset.Hash, now)
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrPasswordResetNotFound
+		}
+		_, err = UpdateUserPassword(ctx, tx, User{Id: passwordReset.UserId, Password: hashedPassword})
+		if err != nil {
+			return err
+		}
+		_, err = DeletePasswordResets(ctx, tx, passwordReset.UserId)
+		if err != nil {
+			return err
+		}
+		return DeleteAllUserSessions(ctx, tx, passwordReset.UserId)
+	})
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordOnce(t *testing.T) {
+	ctx := context.Background()
+	s, report := newTestMemoryStorage(t)
+	Store = s
+	now := time.Now().UTC()
+	passwordReset := PasswordReset{UserId: report.CreatedUserId, Hash: "hash", Expires: now.Add(time.Hour), Created: now}
+	if err := RegisterPasswordReset(ctx, &passwordReset); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetPassword(ctx, passwordReset, "first", now); err != nil {
+		t.Fatal(err)
+	}
+	// Reset which is read before the first one is committed
+	if err := ResetPassword(ctx, passwordReset, "second", now); err != ErrPasswordResetNotFound {
+		t.Fatalf("token is used twice: %v", err)
+	}
+	user, err := s.GetUserByEmail(ctx, "a@example.com")
+	if err != nil || user == nil || user.Password != "first" {
+		t.Fatalf("user: %+v %v", user, err)
+	}
+	// Expired tokens do not reset
+	passwordReset = PasswordReset{UserId: report.CreatedUserId, Hash: "expired", Expires: now, Created: now}
+	if err := RegisterPasswordReset(ctx, &passwordReset); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetPassword(ctx, passwordReset, "third", now); err != ErrPasswordResetNotFound {
+		t.Fatalf("expired token is used: %v", err)
+	}
+}
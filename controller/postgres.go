@@ -0,0 +1,1581 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"repgen/core"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// PostgreSQL error code for unique constraint violation
+const postgresUniqueViolation = "23505"
+
+// Common interface of *sql.DB and *sql.Tx
+type postgresQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+type postgresRepository struct {
+	q postgresQuerier
+	// Report data layout
+	layout string
+	// Partitions of report_value_partitioned which are known to exist
+	partitions *sync.Map
+}
+
+type PostgresStorage struct {
+	postgresRepository
+	db *sql.DB
+}
+
+type postgresTransaction struct {
+	postgresRepository
+	tx *sql.Tx
+}
+
+func NewPostgresStorage(db *sql.DB, layout string) *PostgresStorage {
+	return &PostgresStorage{
+		postgresRepository: postgresRepository{q: db, layout: layout, partitions: &sync.Map{}},
+		db:                 db,
+	}
+}
+
+// Start a transaction, it is rolled back if given context is cancelled before commit
+func (s *PostgresStorage) Begin(ctx context.Context) (Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	repository := s.postgresRepository
+	repository.q = tx
+	return &postgresTransaction{postgresRepository: repository, tx: tx}, nil
+}
+
+func (t *postgresTransaction) Commit() error {
+	return postgresError(t.tx.Commit())
+}
+
+func (t *postgresTransaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// Convert PostgreSQL specific errors into storage errors
+func postgresError(err error) error {
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) && pgError.Code == postgresUniqueViolation {
+		return fmt.Errorf("%w: %s", ErrDuplicate, pgError.ConstraintName)
+	}
+	return err
+}
+
+func (r *postgresRepository) CreateUser(ctx context.Context, user *User) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO users (email, password, name, created) VALUES($1, $2, $3, $4) RETURNING id",
+		user.Email, user.Password, user.Name, user.Created)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&user.Id)
+		if err != nil {
+			return err
+		}
+
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) UpdateUser(ctx context.Context, user User) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE users SET name = $1 WHERE id = $2", user.Name, user.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateUserPassword(ctx context.Context, user User) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", user.Password, user.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) GetUser(ctx context.Context, id int) (*User, error) {
+	user := &User{}
+	err := r.q.QueryRowContext(ctx, "SELECT id, email, password, name, created FROM users WHERE id = $1", id).
+		Scan(&user.Id, &user.Email, &user.Password, &user.Name, &user.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *postgresRepository) SelectUser(ctx context.Context, query ListQuery) ([]User, int64, error) {
+	conditions, args := postgresListConditions(query, nil, nil, "name", "email")
+	total, err := r.countRows(ctx, "users", conditions, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	where, clauses, args := postgresListClauses(query, conditions, args)
+	rows, err := r.q.QueryContext(ctx, "SELECT id, email, password, name, created FROM users WHERE "+where+clauses, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Name, &user.Created)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *postgresRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT id, email, password, name, created FROM users WHERE email = $1", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var user *User
+	for rows.Next() {
+		user = &User{}
+		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Name, &user.Created)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (r *postgresRepository) CreatePasswordReset(ctx context.Context, passwordReset *PasswordReset) error {
+	err := r.q.QueryRowContext(ctx, "INSERT INTO password_reset (user_id, hash, expires, created) VALUES($1, $2, $3, $4) "+
+		"RETURNING id", passwordReset.UserId, passwordReset.Hash, passwordReset.Expires, passwordReset.Created).
+		Scan(&passwordReset.Id)
+	return postgresError(err)
+}
+
+func (r *postgresRepository) GetPasswordReset(ctx context.Context, hash string) (*PasswordReset, error) {
+	passwordReset := &PasswordReset{}
+	err := r.q.QueryRowContext(ctx, "SELECT id, user_id, hash, expires, created FROM password_reset WHERE hash = $1", hash).
+		Scan(&passwordReset.Id, &passwordReset.UserId, &passwordReset.Hash, &passwordReset.Expires, &passwordReset.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return passwordReset, nil
+}
+
+func (r *postgresRepository) DeletePasswordResets(ctx context.Context, userId int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM password_reset WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeletePasswordReset(ctx context.Context, hash string, now time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM password_reset WHERE hash = $1 AND expires > $2", hash, now)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteExpiredPasswordResets(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM password_reset WHERE expires <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateUserIdentity(ctx context.Context, userIdentity *UserIdentity) error {
+	err := r.q.QueryRowContext(ctx, "INSERT INTO user_identity (user_id, issuer, subject, created) VALUES($1, $2, $3, $4) "+
+		"RETURNING id", userIdentity.UserId, userIdentity.Issuer, userIdentity.Subject, userIdentity.Created).
+		Scan(&userIdentity.Id)
+	return postgresError(err)
+}
+
+func (r *postgresRepository) GetUserIdentity(ctx context.Context, issuer string, subject string) (*UserIdentity, error) {
+	userIdentity := &UserIdentity{}
+	err := r.q.QueryRowContext(ctx, "SELECT id, user_id, issuer, subject, created FROM user_identity "+
+		"WHERE issuer = $1 AND subject = $2", issuer, subject).
+		Scan(&userIdentity.Id, &userIdentity.UserId, &userIdentity.Issuer, &userIdentity.Subject, &userIdentity.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return userIdentity, nil
+}
+
+func (r *postgresRepository) CreateProjectRoles(ctx context.Context, projectRoles []ProjectRole) error {
+	columns := []string{"project_id", "user_id", "role", "created"}
+	sql := fmt.Sprintf("INSERT INTO project_role (%s) VALUES %s",
+		strings.Join(columns, ","), core.PrepareQueryBulk(len(columns), len(projectRoles)))
+
+	values := []interface{}{}
+	for _, row := range projectRoles {
+		values = append(values, row.ProjectId, row.UserId, row.Role, row.Created)
+	}
+	_, err := r.q.ExecContext(ctx, sql, values...)
+	return postgresError(err)
+}
+
+func (r *postgresRepository) SelectProjectRoles(ctx context.Context, userId int) ([]ProjectRole, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT project_id, user_id, role, created FROM project_role "+
+		"WHERE user_id = $1 ORDER BY project_id ASC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projectRoles := []ProjectRole{}
+	for rows.Next() {
+		var projectRole ProjectRole
+		err := rows.Scan(&projectRole.ProjectId, &projectRole.UserId, &projectRole.Role, &projectRole.Created)
+		if err != nil {
+			return nil, err
+		}
+		projectRoles = append(projectRoles, projectRole)
+	}
+	return projectRoles, rows.Err()
+}
+
+func (r *postgresRepository) DeleteProjectRoles(ctx context.Context, userId int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM project_role WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateUserMfa(ctx context.Context, userMfa UserMfa) error {
+	_, err := r.q.ExecContext(ctx, "INSERT INTO user_mfa (user_id, secret, enabled, last_counter, created) "+
+		"VALUES($1, $2, $3, $4, $5)", userMfa.UserId, userMfa.Secret, userMfa.Enabled, userMfa.LastCounter, userMfa.Created)
+	return postgresError(err)
+}
+
+func (r *postgresRepository) GetUserMfa(ctx context.Context, userId int) (*UserMfa, error) {
+	userMfa := &UserMfa{}
+	err := r.q.QueryRowContext(ctx, "SELECT user_id, secret, enabled, last_counter, created FROM user_mfa WHERE user_id = $1",
+		userId).Scan(&userMfa.UserId, &userMfa.Secret, &userMfa.Enabled, &userMfa.LastCounter, &userMfa.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return userMfa, nil
+}
+
+func (r *postgresRepository) UpdateUserMfa(ctx context.Context, userMfa UserMfa) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE user_mfa SET enabled = $1, last_counter = $2 WHERE user_id = $3",
+		userMfa.Enabled, userMfa.LastCounter, userMfa.UserId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateUserMfaCounter(ctx context.Context, userMfa UserMfa) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE user_mfa SET last_counter = $1 WHERE user_id = $2 AND last_counter < $1",
+		userMfa.LastCounter, userMfa.UserId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteUserMfa(ctx context.Context, userId int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateRecoveryCodes(ctx context.Context, recoveryCodes []RecoveryCode) error {
+	columns := []string{"user_id", "hash", "created"}
+	sql := fmt.Sprintf("INSERT INTO recovery_code (%s) VALUES %s RETURNING id",
+		strings.Join(columns, ","), core.PrepareQueryBulk(len(columns), len(recoveryCodes)))
+
+	values := []interface{}{}
+	for _, row := range recoveryCodes {
+		values = append(values, row.UserId, row.Hash, row.Created)
+	}
+	rows, err := r.q.QueryContext(ctx, sql, values...)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	index := 0
+	for rows.Next() {
+		err := rows.Scan(&recoveryCodes[index].Id)
+		if err != nil {
+			return err
+		}
+		index++
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) DeleteRecoveryCode(ctx context.Context, userId int, hash string) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = $1 AND hash = $2", userId, hash)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteRecoveryCodes(ctx context.Context, userId int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateMfaChallenge(ctx context.Context, mfaChallenge *MfaChallenge) error {
+	err := r.q.QueryRowContext(ctx, "INSERT INTO mfa_challenge (user_id, hash, expires, created) VALUES($1, $2, $3, $4) "+
+		"RETURNING id", mfaChallenge.UserId, mfaChallenge.Hash, mfaChallenge.Expires, mfaChallenge.Created).
+		Scan(&mfaChallenge.Id)
+	return postgresError(err)
+}
+
+func (r *postgresRepository) GetMfaChallenge(ctx context.Context, hash string) (*MfaChallenge, error) {
+	mfaChallenge := &MfaChallenge{}
+	err := r.q.QueryRowContext(ctx, "SELECT id, user_id, hash, expires, created, attempts FROM mfa_challenge WHERE hash = $1", hash).
+		Scan(&mfaChallenge.Id, &mfaChallenge.UserId, &mfaChallenge.Hash, &mfaChallenge.Expires, &mfaChallenge.Created,
+			&mfaChallenge.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return mfaChallenge, nil
+}
+
+func (r *postgresRepository) IncrementMfaChallengeAttempts(ctx context.Context, id int) (int, error) {
+	var attempts int
+	err := r.q.QueryRowContext(ctx, "UPDATE mfa_challenge SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts", id).
+		Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return attempts, err
+}
+
+func (r *postgresRepository) DeleteMfaChallenge(ctx context.Context, id int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM mfa_challenge WHERE id = $1", id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteExpiredMfaChallenges(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM mfa_challenge WHERE expires <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) SelectUserSession(ctx context.Context, userId int, query ListQuery) ([]UserSession, int64, error) {
+	conditions, args := []string{"user_id = $1"}, []interface{}{userId}
+	total, err := r.countRows(ctx, "user_session", conditions, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	where, clauses, args := postgresListClauses(query, conditions, args)
+	rows, err := r.q.QueryContext(ctx, "SELECT id, user_id, session, created FROM user_session WHERE "+where+clauses, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	userSessions := []UserSession{}
+	for rows.Next() {
+		var userSession UserSession
+		err := rows.Scan(&userSession.Id, &userSession.UserId, &userSession.Session, &userSession.Created)
+		if err != nil {
+			return nil, 0, err
+		}
+		userSessions = append(userSessions, userSession)
+	}
+	return userSessions, total, rows.Err()
+}
+
+func (r *postgresRepository) CreateUserSession(ctx context.Context, userSession UserSession) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO user_session (user_id, session, created) VALUES($1, $2, $3)",
+		userSession.UserId, userSession.Session, userSession.Created)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	return nil
+}
+
+func (r *postgresRepository) DeleteUserSession(ctx context.Context, id int) error {
+	rows, err := r.q.QueryContext(ctx, "DELETE FROM user_session WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return nil
+}
+
+func (r *postgresRepository) DeleteAllUserSessions(ctx context.Context, userId int) error {
+	rows, err := r.q.QueryContext(ctx, "DELETE FROM user_session WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return nil
+}
+
+func (r *postgresRepository) GetUserSession(ctx context.Context, session string) (*UserSession, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT id, user_id, session, created FROM user_session WHERE session = $1", session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userSession *UserSession
+	for rows.Next() {
+		userSession = &UserSession{}
+		err := rows.Scan(&userSession.Id, &userSession.UserId, &userSession.Session, &userSession.Created)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return userSession, nil
+}
+
+func (r *postgresRepository) CreateProject(ctx context.Context, project *Project) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO project (name, created, created_user_id, time_zone) VALUES($1, $2, $3, $4) "+
+		"RETURNING id", project.Name, project.Created, project.CreatedUserId, project.TimeZone)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&project.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) UpdateProject(ctx context.Context, project *Project) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE project SET name = $1 WHERE id = $2", project.Name, project.Id)
+	if err != nil {
+		return 0, postgresError(err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// Columns of project table in scan order of scanProject
+const postgresProjectColumns = "id, name, created, created_user_id, retention_days, archived, time_zone"
+
+type postgresScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProject(row postgresScanner, project *Project) error {
+	return row.Scan(&project.Id, &project.Name, &project.Created, &project.CreatedUserId, &project.RetentionDays,
+		&project.Archived, &project.TimeZone)
+}
+
+// Escape wildcards of LIKE patterns with the default escape character
+var postgresLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Append conditions of the search and the creator of given list query, search matches any of given columns
+func postgresListConditions(query ListQuery, conditions []string, args []interface{}, searchColumns ...string) ([]string, []interface{}) {
+	if len(query.Search) > 0 {
+		// LIKE of lower() uses the trigram indexes of the search columns, wildcards of the search are escaped
+		args = append(args, "%"+postgresLikeEscaper.Replace(query.Search)+"%")
+		matches := make([]string, 0, len(searchColumns))
+		for _, column := range searchColumns {
+			matches = append(matches, fmt.Sprintf("lower(%s) LIKE lower($%d)", column, len(args)))
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	if query.CreatedUserId > 0 {
+		args = append(args, query.CreatedUserId)
+		conditions = append(conditions, fmt.Sprintf("created_user_id = $%d", len(args)))
+	}
+	return conditions, args
+}
+
+// Return given conditions joined with the cursor condition of given list query, and its ORDER BY and LIMIT clauses
+func postgresListClauses(query ListQuery, conditions []string, args []interface{}) (string, string, []interface{}) {
+	key, direction, operator := "created", "ASC", ">"
+	if query.Sort == ListSortName {
+		key = "lower(name)"
+	}
+	if query.Desc {
+		direction, operator = "DESC", "<"
+	}
+	if query.After != nil {
+		if query.Sort == ListSortName {
+			args = append(args, query.After.Name)
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s (lower($%d), $%d)", key, operator, len(args), len(args)+1))
+		} else {
+			args = append(args, query.After.Created)
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", key, operator, len(args), len(args)+1))
+		}
+		args = append(args, query.After.Id)
+	}
+	args = append(args, query.Limit)
+	clauses := fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", key, direction, direction, len(args))
+	if len(conditions) == 0 {
+		return "TRUE", clauses, args
+	}
+	return strings.Join(conditions, " AND "), clauses, args
+}
+
+// Return count of the rows of given table which match every condition
+func (r *postgresRepository) countRows(ctx context.Context, table string, conditions []string, args []interface{}) (int64, error) {
+	where := "TRUE"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+	var count int64
+	err := r.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// Return condition which selects either archived or active rows
+func returnArchivedSql(archived bool) string {
+	if archived {
+		return "archived IS NOT NULL"
+	}
+	return "archived IS NULL"
+}
+
+func (r *postgresRepository) SelectProject(ctx context.Context, query ListQuery) ([]Project, int64, error) {
+	conditions, args := postgresListConditions(query, []string{returnArchivedSql(query.Archived)}, nil, "name")
+	total, err := r.countRows(ctx, "project", conditions, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	where, clauses, args := postgresListClauses(query, conditions, args)
+	rows, err := r.q.QueryContext(ctx, "SELECT "+postgresProjectColumns+" FROM project WHERE "+where+clauses, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	projects := []Project{}
+	for rows.Next() {
+		var project Project
+		err := scanProject(rows, &project)
+		if err != nil {
+			return nil, 0, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, total, rows.Err()
+}
+
+func (r *postgresRepository) GetProject(ctx context.Context, id int) (*Project, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT "+postgresProjectColumns+" FROM project WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var project *Project
+	for rows.Next() {
+		project = &Project{}
+		err := scanProject(rows, project)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return project, nil
+}
+
+func (r *postgresRepository) UpdateProjectRetention(ctx context.Context, project Project) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE project SET retention_days = $1 WHERE id = $2", project.RetentionDays, project.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateProjectArchived(ctx context.Context, project Project) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE project SET archived = $1 WHERE id = $2", project.Archived, project.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteProject(ctx context.Context, id int) (int64, error) {
+	_, err := r.DeleteShareToken(ctx, ShareEntityProject, id)
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.q.ExecContext(ctx, "DELETE FROM project WHERE id = $1", id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// Columns of report table in scan order of scanReport
+const postgresReportColumns = "id, project_id, name, interval, description, created, created_user_id, " +
+	"retention_days, rollup_report_id, rollup_function, archived, submit_mode, time_zone, week_start"
+
+func scanReport(row postgresScanner, report *Report) error {
+	return row.Scan(&report.Id, &report.ProjectId, &report.Name, &report.Interval,
+		&report.Description, &report.Created, &report.CreatedUserId,
+		&report.RetentionDays, &report.RollupReportId, &report.RollupFunction, &report.Archived, &report.SubmitMode,
+		&report.TimeZone, &report.WeekStart)
+}
+
+// Run given report query and return every scanned report
+func (r *postgresRepository) queryReports(ctx context.Context, query string, args ...interface{}) ([]Report, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reports := []Report{}
+	for rows.Next() {
+		var report Report
+		err := scanReport(rows, &report)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (r *postgresRepository) CreateReport(ctx context.Context, report *Report) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO report (project_id, name, interval, description, created, created_user_id, "+
+		"submit_mode, time_zone, week_start) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id", report.ProjectId,
+		report.Name, report.Interval, report.Description, report.Created, report.CreatedUserId, report.SubmitMode,
+		report.TimeZone, report.WeekStart)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&report.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) GetReport(ctx context.Context, id int) (*Report, error) {
+	reports, err := r.queryReports(ctx, "SELECT "+postgresReportColumns+" FROM report WHERE id = $1", id)
+	if err != nil || len(reports) == 0 {
+		return nil, err
+	}
+	return &reports[0], nil
+}
+
+func (r *postgresRepository) SelectReport(ctx context.Context, projectId int, query ListQuery) ([]Report, int64, error) {
+	conditions, args := postgresListConditions(query, []string{"project_id = $1", returnArchivedSql(query.Archived)},
+		[]interface{}{projectId}, "name")
+	total, err := r.countRows(ctx, "report", conditions, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	where, clauses, args := postgresListClauses(query, conditions, args)
+	reports, err := r.queryReports(ctx, "SELECT "+postgresReportColumns+" FROM report WHERE "+where+clauses, args...)
+	return reports, total, err
+}
+
+func (r *postgresRepository) SelectAllReports(ctx context.Context) ([]Report, error) {
+	return r.queryReports(ctx, "SELECT "+postgresReportColumns+" FROM report ORDER BY id ASC")
+}
+
+func (r *postgresRepository) SelectProjectReports(ctx context.Context, projectId int) ([]Report, error) {
+	return r.queryReports(ctx, "SELECT "+postgresReportColumns+" FROM report WHERE project_id = $1 ORDER BY id ASC", projectId)
+}
+
+func (r *postgresRepository) UpdateReportRetention(ctx context.Context, report Report) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE report SET retention_days=$1, rollup_report_id=$2, rollup_function=$3 WHERE id=$4",
+		report.RetentionDays, report.RollupReportId, report.RollupFunction, report.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateReportArchived(ctx context.Context, report Report) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE report SET archived=$1 WHERE id=$2", report.Archived, report.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateReportSubmitMode(ctx context.Context, report Report) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE report SET submit_mode=$1 WHERE id=$2", report.SubmitMode, report.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteReport(ctx context.Context, id int) (int64, error) {
+	// Report data
+	var err error
+	if r.layout == ReportDataLayoutTable {
+		_, err = r.q.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", ReturnReportTableName(id)))
+	} else {
+		_, err = r.q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE report_id = $1", r.reportValueTable()), id)
+		if err == nil {
+			_, err = r.q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE report_id = $1", r.reportValueRowTable()), id)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Reports rolling up into this report
+	_, err = r.q.ExecContext(ctx, "UPDATE report SET rollup_report_id=NULL WHERE rollup_report_id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.q.ExecContext(ctx, "DELETE FROM submission_log WHERE report_id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.DeleteShareToken(ctx, ShareEntityReport, id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.q.ExecContext(ctx, "DELETE FROM report_token WHERE report_id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = r.q.ExecContext(ctx, "DELETE FROM report_column WHERE report_id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.q.ExecContext(ctx, "DELETE FROM report WHERE id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateReportToken(ctx context.Context, reportToken *ReportToken) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO report_token (report_id, hash, hint, label, created, created_user_id, "+
+		"last_used, expires) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id", reportToken.ReportId, reportToken.Hash,
+		reportToken.Hint, reportToken.Label, reportToken.Created, reportToken.CreatedUserId, reportToken.LastUsed,
+		reportToken.Expires)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&reportToken.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return postgresError(rows.Err())
+}
+
+// Run given report token query and return every scanned report token
+func (r *postgresRepository) queryReportTokens(ctx context.Context, query string, args ...interface{}) ([]ReportToken, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT id, report_id, hash, hint, label, created, created_user_id, last_used, expires "+
+		"FROM report_token "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reportTokens := []ReportToken{}
+	for rows.Next() {
+		var reportToken ReportToken
+		err := rows.Scan(&reportToken.Id, &reportToken.ReportId, &reportToken.Hash, &reportToken.Hint, &reportToken.Label,
+			&reportToken.Created, &reportToken.CreatedUserId, &reportToken.LastUsed, &reportToken.Expires)
+		if err != nil {
+			return nil, err
+		}
+		reportTokens = append(reportTokens, reportToken)
+	}
+	return reportTokens, rows.Err()
+}
+
+func (r *postgresRepository) GetReportToken(ctx context.Context, hash string) (*ReportToken, error) {
+	reportTokens, err := r.queryReportTokens(ctx, "WHERE hash = $1", hash)
+	if err != nil || len(reportTokens) == 0 {
+		return nil, err
+	}
+	return &reportTokens[0], nil
+}
+
+func (r *postgresRepository) SelectReportToken(ctx context.Context, reportId int) ([]ReportToken, error) {
+	return r.queryReportTokens(ctx, "WHERE report_id = $1 ORDER BY id ASC", reportId)
+}
+
+func (r *postgresRepository) UpdateReportTokenExpires(ctx context.Context, reportToken ReportToken) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE report_token SET expires=$1 WHERE id=$2", reportToken.Expires, reportToken.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) UpdateReportTokenLastUsed(ctx context.Context, reportToken ReportToken) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "UPDATE report_token SET last_used=$1 WHERE id=$2", reportToken.LastUsed, reportToken.Id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteReportToken(ctx context.Context, reportId int, id int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM report_token WHERE report_id=$1 AND id=$2", reportId, id)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) DeleteExpiredReportTokens(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM report_token WHERE expires <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) IncrementRateLimit(ctx context.Context, key string, windowStart time.Time, expires time.Time) (int, error) {
+	var hits int
+	err := r.q.QueryRowContext(ctx, `INSERT INTO rate_limit (key, window_start, expires, hits) VALUES($1, $2, $3, 1)
+		ON CONFLICT (key) DO UPDATE SET
+		hits = CASE WHEN rate_limit.window_start = EXCLUDED.window_start THEN rate_limit.hits + 1 ELSE 1 END,
+		window_start = EXCLUDED.window_start, expires = EXCLUDED.expires
+		RETURNING hits`, key, windowStart, expires).Scan(&hits)
+	return hits, err
+}
+
+func (r *postgresRepository) GetRateLimit(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	var hits int
+	err := r.q.QueryRowContext(ctx, "SELECT hits FROM rate_limit WHERE key = $1 AND window_start = $2", key, windowStart).
+		Scan(&hits)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return hits, err
+}
+
+// Window start of a lockout is its first failure
+func (r *postgresRepository) IncrementLockout(ctx context.Context, key string, now time.Time, expires time.Time) (int, error) {
+	var hits int
+	err := r.q.QueryRowContext(ctx, `INSERT INTO rate_limit (key, window_start, expires, hits) VALUES($1, $2, $3, 1)
+		ON CONFLICT (key) DO UPDATE SET
+		hits = CASE WHEN rate_limit.expires > EXCLUDED.window_start THEN rate_limit.hits + 1 ELSE 1 END,
+		window_start = CASE WHEN rate_limit.expires > EXCLUDED.window_start THEN rate_limit.window_start
+			ELSE EXCLUDED.window_start END,
+		expires = EXCLUDED.expires
+		RETURNING hits`, key, now, expires).Scan(&hits)
+	return hits, err
+}
+
+func (r *postgresRepository) GetLockout(ctx context.Context, key string, now time.Time) (int, time.Time, error) {
+	var hits int
+	var expires time.Time
+	err := r.q.QueryRowContext(ctx, "SELECT hits, expires FROM rate_limit WHERE key = $1 AND expires > $2", key, now).
+		Scan(&hits, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, nil
+	}
+	return hits, expires, err
+}
+
+func (r *postgresRepository) DeleteRateLimit(ctx context.Context, key string) error {
+	_, err := r.q.ExecContext(ctx, "DELETE FROM rate_limit WHERE key = $1", key)
+	return err
+}
+
+func (r *postgresRepository) DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM rate_limit WHERE expires <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateShareToken(ctx context.Context, shareToken *ShareToken) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO share_token (hash, entity, entity_id, expires, created, created_user_id) "+
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id", shareToken.Hash, shareToken.Entity, shareToken.EntityId,
+		shareToken.Expires, shareToken.Created, shareToken.CreatedUserId)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&shareToken.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) GetShareToken(ctx context.Context, hash string) (*ShareToken, error) {
+	rows, err := r.q.QueryContext(ctx, "SELECT id, hash, entity, entity_id, expires, created, created_user_id "+
+		"FROM share_token WHERE hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var shareToken *ShareToken
+	for rows.Next() {
+		shareToken = &ShareToken{}
+		err := rows.Scan(&shareToken.Id, &shareToken.Hash, &shareToken.Entity, &shareToken.EntityId, &shareToken.Expires,
+			&shareToken.Created, &shareToken.CreatedUserId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return shareToken, rows.Err()
+}
+
+func (r *postgresRepository) DeleteShareToken(ctx context.Context, entity string, entityId int) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM share_token WHERE entity = $1 AND entity_id = $2", entity, entityId)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateAuditLog(ctx context.Context, auditLog *AuditLog) error {
+	rows, err := r.q.QueryContext(ctx, "INSERT INTO audit_log (user_id, action, entity, entity_id, detail, created) "+
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id", auditLog.UserId, auditLog.Action, auditLog.Entity,
+		auditLog.EntityId, auditLog.Detail, auditLog.Created)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&auditLog.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Columns of submission_log table in scan order of scanSubmission
+const postgresSubmissionColumns = "id, report_id, replay_id, body, remote_addr, received, status, message"
+
+func scanSubmission(row postgresScanner, submission *Submission) error {
+	return row.Scan(&submission.Id, &submission.ReportId, &submission.ReplayId, &submission.Body,
+		&submission.RemoteAddr, &submission.Received, &submission.Status, &submission.Message)
+}
+
+func (r *postgresRepository) CreateSubmission(ctx context.Context, submission *Submission) error {
+	return r.q.QueryRowContext(ctx, "INSERT INTO submission_log (report_id, replay_id, body, remote_addr, received, status, message) "+
+		"VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id", submission.ReportId, submission.ReplayId, submission.Body,
+		submission.RemoteAddr, submission.Received, submission.Status, submission.Message).Scan(&submission.Id)
+}
+
+func (r *postgresRepository) SelectSubmission(ctx context.Context, reportId int, page int, failed bool) ([]Submission, error) {
+	condition := "TRUE"
+	if failed {
+		condition = fmt.Sprintf("status <> %d", http.StatusOK)
+	}
+	rows, err := r.q.QueryContext(ctx, "SELECT "+postgresSubmissionColumns+" FROM submission_log WHERE report_id = $1 AND "+
+		condition+" ORDER BY id DESC LIMIT $2 OFFSET $3", reportId, SubmissionPageLimit, SubmissionPageLimit*page)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	submissions := []Submission{}
+	for rows.Next() {
+		var submission Submission
+		err := scanSubmission(rows, &submission)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, rows.Err()
+}
+
+func (r *postgresRepository) GetSubmission(ctx context.Context, id int) (*Submission, error) {
+	var submission Submission
+	err := scanSubmission(r.q.QueryRowContext(ctx, "SELECT "+postgresSubmissionColumns+" FROM submission_log WHERE id = $1", id),
+		&submission)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+func (r *postgresRepository) DeleteSubmissions(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.q.ExecContext(ctx, "DELETE FROM submission_log WHERE received < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+func (r *postgresRepository) CreateReportColumns(ctx context.Context, reportColumns []ReportColumn) error {
+	columns := []string{"report_id", "name", "type", "formula", "created", "created_user_id",
+		"enum_values", "decimal_precision", "decimal_scale", "required", "min_value", "max_value", "max_length", "pattern",
+		"unit", "decimals", "dimension"}
+	sql := fmt.Sprintf("INSERT INTO report_column (%s) VALUES %s RETURNING id",
+		strings.Join(columns, ","), core.PrepareQueryBulk(len(columns), len(reportColumns)))
+
+	values := []interface{}{}
+	for _, row := range reportColumns {
+		// Enum values are kept as json array
+		var enumValues interface{}
+		if len(row.EnumValues) > 0 {
+			encoded, err := json.Marshal(row.EnumValues)
+			if err != nil {
+				return err
+			}
+			enumValues = string(encoded)
+		}
+		values = append(values, row.ReportId, row.Name, row.Type, row.Formula, row.Created, row.CreatedUserId,
+			enumValues, row.Precision, row.Scale, row.Required, row.Min, row.Max, row.MaxLength, row.Pattern,
+			row.Unit, row.Decimals, row.Dimension)
+	}
+	rows, err := r.q.QueryContext(ctx, sql, values...)
+	if err != nil {
+		return postgresError(err)
+	}
+	defer rows.Close()
+	index := 0
+	for rows.Next() {
+		err := rows.Scan(&reportColumns[index].Id)
+		if err != nil {
+			return err
+		}
+		index++
+	}
+	return postgresError(rows.Err())
+}
+
+func (r *postgresRepository) PopulateReportColumns(ctx context.Context, report *Report) error {
+	rows, err := r.q.QueryContext(ctx, "SELECT id, report_id, name, type, formula, created, created_user_id, "+
+		"enum_values, decimal_precision, decimal_scale, required, min_value, max_value, max_length, pattern, unit, decimals, "+
+		"dimension "+
+		"FROM report_column WHERE report_id = $1 ORDER BY id ASC", report.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reportColumn ReportColumn
+		var enumValues []byte
+		var min, max sql.NullFloat64
+		var decimals sql.NullInt32
+		err := rows.Scan(&reportColumn.Id, &reportColumn.ReportId, &reportColumn.Name, &reportColumn.Type,
+			&reportColumn.Formula, &reportColumn.Created, &reportColumn.CreatedUserId,
+			&enumValues, &reportColumn.Precision, &reportColumn.Scale, &reportColumn.Required, &min, &max,
+			&reportColumn.MaxLength, &reportColumn.Pattern, &reportColumn.Unit, &decimals, &reportColumn.Dimension)
+		if err != nil {
+			return err
+		}
+		if min.Valid {
+			reportColumn.Min = &min.Float64
+		}
+		if max.Valid {
+			reportColumn.Max = &max.Float64
+		}
+		if decimals.Valid {
+			value := int(decimals.Int32)
+			reportColumn.Decimals = &value
+		}
+		if len(enumValues) > 0 {
+			err = json.Unmarshal(enumValues, &reportColumn.EnumValues)
+			if err != nil {
+				return err
+			}
+		}
+		report.Columns = append(report.Columns, reportColumn)
+	}
+	return nil
+}
+
+// Return columns of per report table which identify a row, report date and dimension columns
+func returnRowKeyColumns(columns []ReportColumn) []string {
+	keyColumns := []string{"report_date"}
+	for _, column := range ReturnDimensionColumns(columns) {
+		keyColumns = append(keyColumns, ReturnReportColumnName(column.Id))
+	}
+	return keyColumns
+}
+
+func returnReportColumnCreationSql(columns []ReportColumn) string {
+	var sb strings.Builder
+	for _, column := range columns {
+		reportColumnName := ReturnReportColumnName(column.Id)
+		// Dimension columns are part of the row key
+		constraint := ""
+		if column.Dimension {
+			constraint = " NOT NULL"
+		}
+		switch column.Type {
+		case ReportColumnTypeStr:
+			sb.WriteString(fmt.Sprintf("%s varchar%s,\n", reportColumnName, constraint))
+		case ReportColumnTypeInt:
+			sb.WriteString(fmt.Sprintf("%s int%s,\n", reportColumnName, constraint))
+		case ReportColumnTypeFloat:
+			sb.WriteString(fmt.Sprintf("%s float,\n", reportColumnName))
+		case ReportColumnTypeBool:
+			sb.WriteString(fmt.Sprintf("%s boolean%s,\n", reportColumnName, constraint))
+		case ReportColumnTypeDate:
+			sb.WriteString(fmt.Sprintf("%s date%s,\n", reportColumnName, constraint))
+		case ReportColumnTypeTimestamp:
+			sb.WriteString(fmt.Sprintf("%s timestamp without time zone,\n", reportColumnName))
+		case ReportColumnTypeDecimal:
+			sb.WriteString(fmt.Sprintf("%s numeric(%d, %d),\n", reportColumnName, column.Precision, column.Scale))
+		case ReportColumnTypeEnum:
+			sb.WriteString(fmt.Sprintf("%s varchar%s,\n", reportColumnName, constraint))
+		case ReportColumnTypeJson:
+			sb.WriteString(fmt.Sprintf("%s jsonb,\n", reportColumnName))
+		case ReportColumnTypeFormula:
+
+		default:
+			panic(fmt.Sprintf("Invalid report column type: %d", column.Type))
+		}
+	}
+	return sb.String()
+}
+
+func (r *postgresRepository) CreateReportDataTable(ctx context.Context, report Report) (err error) {
+	if r.layout != ReportDataLayoutTable {
+		// Long layouts share report_value or report_value_partitioned table
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	tableName := ReturnReportTableName(report.Id)
+	sql := fmt.Sprintf(
+		`CREATE TABLE %s (
+			id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+			report_date timestamp without time zone NOT NULL,
+			sent_date timestamp without time zone NOT NULL,
+			%s
+			CONSTRAINT %s_pk PRIMARY KEY (id)
+		)`,
+		tableName, returnReportColumnCreationSql(report.Columns), tableName)
+	stmt, err := r.q.PrepareContext(ctx, sql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	// Index
+	sql = fmt.Sprintf("CREATE UNIQUE INDEX %s_idx ON %s USING btree(%s)", tableName, tableName,
+		strings.Join(returnRowKeyColumns(report.Columns), ","))
+	stmt, err = r.q.PrepareContext(ctx, sql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Insert report data row, an existing row of the same report date is handled with respect to given submit mode
+func (r *postgresRepository) InsertReportData(ctx context.Context, reportId int, mode string, reportData *ReportData) (bool, error) {
+	if r.layout != ReportDataLayoutTable {
+		return r.insertReportValues(ctx, reportId, mode, reportData)
+	}
+	// Rows are identified by report date and dimension columns
+	report := Report{Id: reportId}
+	err := r.PopulateReportColumns(ctx, &report)
+	if err != nil {
+		return false, err
+	}
+	reportData.DimensionKey, err = ReturnDimensionKey(report.Columns, reportData.ColumnMap)
+	if err != nil {
+		return false, err
+	}
+	tableName := ReturnReportTableName(reportId)
+	// Prepare query columns and values
+	columns := []string{"sent_date", "report_date"}
+	values := []interface{}{reportData.SentDate, reportData.ReportDate}
+	for key, value := range reportData.ColumnMap {
+		columns = append(columns, ReturnReportColumnName(key))
+		values = append(values, value)
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", tableName, strings.Join(columns, ","),
+		core.PrepareQueryBulk(len(columns), 1))
+	if mode == ReportSubmitModeReject {
+		// Unique row key index rejects existing rows
+		sql += " RETURNING id, TRUE"
+	} else {
+		// Prepare update part of the query
+		updateSql := []string{"sent_date=EXCLUDED.sent_date"}
+		for _, reportColumn := range report.Columns {
+			columnName := ReturnReportColumnName(reportColumn.Id)
+			_, submitted := reportData.ColumnMap[reportColumn.Id]
+			switch {
+			case reportColumn.Type == ReportColumnTypeFormula, reportColumn.Dimension:
+			case mode == ReportSubmitModeOverwrite:
+				updateSql = append(updateSql, fmt.Sprintf("%s=EXCLUDED.%s", columnName, columnName))
+			case !submitted:
+			case mode == ReportSubmitModeAccumulate && IsNumericColumnType(reportColumn.Type):
+				updateSql = append(updateSql, fmt.Sprintf("%s=COALESCE(%s.%s, 0)+EXCLUDED.%s",
+					columnName, tableName, columnName, columnName))
+			default:
+				// Merge
+				updateSql = append(updateSql, fmt.Sprintf("%s=EXCLUDED.%s", columnName, columnName))
+			}
+		}
+		// Rows without xmax are inserted by this query
+		sql += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s RETURNING id, (xmax = 0)",
+			strings.Join(returnRowKeyColumns(report.Columns), ","), strings.Join(updateSql, ","))
+	}
+	var inserted bool
+	err = r.q.QueryRowContext(ctx, sql, values...).Scan(&reportData.Id, &inserted)
+	if err != nil {
+		return false, postgresError(err)
+	}
+	return inserted, nil
+}
+
+// Return condition of report date range [from, to) and its arguments, parameters start from given index
+// Zero from or to means the range is unbounded on that side
+func returnReportDateRangeSql(from time.Time, to time.Time, startingIndex int) (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	values := []interface{}{}
+	if !from.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("report_date >= $%d", startingIndex+len(values)))
+		values = append(values, from)
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("report_date < $%d", startingIndex+len(values)))
+		values = append(values, to)
+	}
+	return strings.Join(conditions, " AND "), values
+}
+
+// Return limit clause, non-positive limit is unbounded
+func returnLimitSql(limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", limit)
+}
+
+// Return condition of report date range and dimension values of given filter and its arguments, parameters start
+// from given index. Dimension values are compared as JSON values to the expression of each dimension column.
+func returnReportDataFilterSql(columns []ReportColumn, filter ReportDataFilter, startingIndex int, dimensionSql func(column ReportColumn, index int) string) (string, []interface{}, error) {
+	rangeSql, values := returnReportDateRangeSql(filter.From, filter.To, startingIndex)
+	conditions := []string{rangeSql}
+	dimensionColumns := ReturnDimensionColumns(columns)
+	for columnId := range filter.Dimensions {
+		found := false
+		for _, column := range dimensionColumns {
+			found = found || column.Id == columnId
+		}
+		if !found {
+			return "", nil, fmt.Errorf("column \"%s\" is not a dimension", ReturnReportColumnName(columnId))
+		}
+	}
+	// Dimension columns are in id order so the statement is the same for the same filter
+	for index, column := range dimensionColumns {
+		dimensionValues, ok := filter.Dimensions[column.Id]
+		if !ok {
+			continue
+		}
+		placeholders := make([]string, 0, len(dimensionValues))
+		for _, value := range dimensionValues {
+			placeholders = append(placeholders, fmt.Sprintf("$%d::jsonb", startingIndex+len(values)))
+			values = append(values, value)
+		}
+		if len(placeholders) == 0 {
+			// Nothing is accepted
+			placeholders = append(placeholders, "NULL")
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", dimensionSql(column, index), strings.Join(placeholders, ", ")))
+	}
+	return strings.Join(conditions, " AND "), values, nil
+}
+
+// Return given condition which also keeps only the rows of the first report dates up to given limit
+func returnReportDateLimitSql(tableName string, condition string, limit int) string {
+	return fmt.Sprintf("%s AND report_date IN (SELECT DISTINCT report_date FROM %s WHERE %s ORDER BY report_date ASC%s)",
+		condition, tableName, condition, returnLimitSql(limit))
+}
+
+func (r *postgresRepository) SelectReportData(ctx context.Context, reportId int, from time.Time, to time.Time, limit int) ([]ReportData, error) {
+	return r.FilterReportData(ctx, reportId, ReportDataFilter{From: from, To: to, Limit: limit})
+}
+
+func (r *postgresRepository) FilterReportData(ctx context.Context, reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	if r.layout != ReportDataLayoutTable {
+		return r.selectReportValues(ctx, reportId, filter)
+	}
+	return r.selectReportTable(ctx, reportId, filter)
+}
+
+// Select rows of per report table
+func (r *postgresRepository) selectReportTable(ctx context.Context, reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	report := Report{Id: reportId}
+	err := r.PopulateReportColumns(ctx, &report)
+	if err != nil {
+		return nil, err
+	}
+	tableName := ReturnReportTableName(reportId)
+	condition, values, err := returnReportDataFilterSql(report.Columns, filter, 1, func(column ReportColumn, index int) string {
+		return fmt.Sprintf("to_jsonb(%s)", ReturnReportColumnName(column.Id))
+	})
+	if err != nil {
+		return nil, err
+	}
+	limitSql := returnLimitSql(filter.Limit)
+	if filter.LimitDates {
+		condition = returnReportDateLimitSql(tableName, condition, filter.Limit)
+		limitSql = ""
+	}
+	rows, err := r.q.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY %s ASC, id ASC%s",
+		tableName, condition, strings.Join(returnRowKeyColumns(report.Columns), " ASC, "), limitSql), values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	reportDataList := []ReportData{}
+	for rows.Next() {
+		// Scan each column into an empty interface
+		rowValues := make([]interface{}, len(columns))
+		rowPointers := make([]interface{}, len(columns))
+		for index := range rowValues {
+			rowPointers[index] = &rowValues[index]
+		}
+		err := rows.Scan(rowPointers...)
+		if err != nil {
+			return nil, err
+		}
+		reportData := ReportData{ColumnMap: make(map[int]interface{})}
+		for index, column := range columns {
+			switch column {
+			case "id":
+				reportData.Id = int(rowValues[index].(int64))
+			case "report_date":
+				reportData.ReportDate = rowValues[index].(time.Time)
+			case "sent_date":
+				reportData.SentDate = rowValues[index].(time.Time)
+			default:
+				if rowValues[index] == nil {
+					continue
+				}
+				columnId, err := ReturnColumnId(column)
+				if err != nil {
+					return nil, err
+				}
+				// Json columns are returned as raw bytes
+				if value, ok := rowValues[index].([]byte); ok {
+					rowValues[index] = string(value)
+				}
+				reportData.ColumnMap[columnId] = rowValues[index]
+			}
+		}
+		reportData.DimensionKey, err = ReturnDimensionKey(report.Columns, reportData.ColumnMap)
+		if err != nil {
+			return nil, err
+		}
+		reportDataList = append(reportDataList, reportData)
+	}
+	return reportDataList, rows.Err()
+}
+
+func (r *postgresRepository) CountReportData(ctx context.Context, reportId int, from time.Time, to time.Time) (int64, error) {
+	if r.layout != ReportDataLayoutTable {
+		return r.countReportValues(ctx, reportId, from, to)
+	}
+	rangeSql, values := returnReportDateRangeSql(from, to, 1)
+	var count int64
+	err := r.q.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s WHERE %s",
+		ReturnReportTableName(reportId), rangeSql), values...).Scan(&count)
+	return count, err
+}
+
+// Rows deleted by a single statement, keeps the query parameters below the PostgreSQL limit
+const reportDataDeleteBatchSize = 1000
+
+func (r *postgresRepository) DeleteReportData(ctx context.Context, reportId int, rows []ReportData) (int64, error) {
+	if r.layout != ReportDataLayoutTable {
+		return r.deleteReportValues(ctx, reportId, rows)
+	}
+	var total int64
+	for start := 0; start < len(rows); start += reportDataDeleteBatchSize {
+		end := start + reportDataDeleteBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]interface{}, 0, end-start)
+		for _, row := range rows[start:end] {
+			values = append(values, row.Id)
+		}
+		result, err := r.q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)",
+			ReturnReportTableName(reportId), core.PrepareQueryBulk(1, len(values))), values...)
+		if err != nil {
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
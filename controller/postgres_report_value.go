@@ -0,0 +1,542 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"repgen/core"
+	"strings"
+	"time"
+)
+
+const (
+	ReportValueTableName            = "report_value"
+	ReportValuePartitionedTableName = "report_value_partitioned"
+	ReportValuePartitionNamePattern = "report_value_partitioned_%04d%02d"
+)
+
+// Partitioned parent of the partitioned layout, same as sql/db.sql
+const reportValuePartitionedTableSql = `CREATE TABLE IF NOT EXISTS report_value_partitioned (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	column_id int NOT NULL,
+	sent_date timestamp without time zone NOT NULL,
+	value_str varchar NULL,
+	value_int int NULL,
+	value_float float NULL,
+	value_bool boolean NULL,
+	value_time timestamp without time zone NULL,
+	value_decimal numeric NULL,
+	value_json jsonb NULL,
+	CONSTRAINT report_value_partitioned_pk PRIMARY KEY (report_id, report_date, dimension_key, column_id),
+	CONSTRAINT report_value_partitioned_fk FOREIGN KEY (report_id) REFERENCES report(id),
+	CONSTRAINT report_value_partitioned_fk_1 FOREIGN KEY (column_id) REFERENCES report_column(id)
+) PARTITION BY RANGE (report_date)`
+
+// Row keys of the partitioned layout, same as sql/db.sql
+const reportValuePartitionedRowTableSql = `CREATE TABLE IF NOT EXISTS report_value_partitioned_row (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	CONSTRAINT report_value_partitioned_row_pk PRIMARY KEY (report_id, report_date, dimension_key),
+	CONSTRAINT report_value_partitioned_row_fk FOREIGN KEY (report_id) REFERENCES report(id)
+)`
+
+// Columns of report_value table, value columns are filled with respect to report column type
+var reportValueColumns = []string{"report_id", "report_date", "dimension_key", "column_id", "sent_date", "value_str", "value_int",
+	"value_float", "value_bool", "value_time", "value_decimal", "value_json"}
+
+// Number of report_value columns which identify a value
+const reportValueKeyColumnCount = 4
+
+// Return value column of report_value table which holds given report column type
+func returnReportValueColumn(columnType int) (string, error) {
+	switch columnType {
+	case ReportColumnTypeStr, ReportColumnTypeEnum:
+		return "value_str", nil
+	case ReportColumnTypeInt:
+		return "value_int", nil
+	case ReportColumnTypeFloat:
+		return "value_float", nil
+	case ReportColumnTypeBool:
+		return "value_bool", nil
+	case ReportColumnTypeDate, ReportColumnTypeTimestamp:
+		return "value_time", nil
+	case ReportColumnTypeDecimal:
+		return "value_decimal", nil
+	case ReportColumnTypeJson:
+		return "value_json", nil
+	default:
+		return "", fmt.Errorf("Invalid report column type: %d", columnType)
+	}
+}
+
+// Return table of report values of the configured long layout
+func (r *postgresRepository) reportValueTable() string {
+	if r.layout == ReportDataLayoutPartitioned {
+		return ReportValuePartitionedTableName
+	}
+	return ReportValueTableName
+}
+
+// Return table of row keys of the configured long layout, i.e. report dates and dimension keys of the stored rows
+func (r *postgresRepository) reportValueRowTable() string {
+	return r.reportValueTable() + "_row"
+}
+
+// Values of a row are written by several statements, long layouts insert them in a transaction
+func (s *PostgresStorage) InsertReportData(ctx context.Context, reportId int, mode string, reportData *ReportData) (bool, error) {
+	if s.layout == ReportDataLayoutTable {
+		return s.postgresRepository.InsertReportData(ctx, reportId, mode, reportData)
+	}
+	if s.layout == ReportDataLayoutPartitioned {
+		// Created outside of the transaction so it is remembered
+		err := s.createReportValuePartition(ctx, reportData.ReportDate)
+		if err != nil {
+			return false, err
+		}
+	}
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := tx.InsertReportData(ctx, reportId, mode, reportData)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return inserted, tx.Commit()
+}
+
+// Create partitioned parent and row key tables if the partitioned layout is configured, long layout tables are
+// defined in sql/db.sql
+func (s *PostgresStorage) CreateReportValueTable(ctx context.Context) error {
+	if s.layout != ReportDataLayoutPartitioned {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, reportValuePartitionedTableSql)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, reportValuePartitionedRowTableSql)
+	return err
+}
+
+// Return beginning of the month of given date and the next month
+func returnMonthRange(date time.Time) (time.Time, time.Time) {
+	from := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// Create monthly partition of report_value_partitioned table which covers given date, if it does not exist
+func (r *postgresRepository) createReportValuePartition(ctx context.Context, date time.Time) error {
+	from, to := returnMonthRange(date)
+	partitionName := fmt.Sprintf(ReportValuePartitionNamePattern, from.Year(), from.Month())
+	if _, ok := r.partitions.Load(partitionName); ok {
+		return nil
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		partitionName, ReportValuePartitionedTableName, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	_, err := r.q.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	// Partitions created inside a transaction may be rolled back -> Only remember committed ones
+	if _, ok := r.q.(*sql.DB); ok {
+		r.partitions.Store(partitionName, emptyStruct)
+	}
+	return nil
+}
+
+// Upsert each submitted column value as a separate row of report_value table
+func (r *postgresRepository) insertReportValues(ctx context.Context, reportId int, mode string, reportData *ReportData) (bool, error) {
+	// Value column depends on report column type
+	report := Report{Id: reportId}
+	err := r.PopulateReportColumns(ctx, &report)
+	if err != nil {
+		return false, err
+	}
+	reportColumnMap := make(map[int]ReportColumn)
+	for _, reportColumn := range report.Columns {
+		reportColumnMap[reportColumn.Id] = reportColumn
+	}
+	reportData.DimensionKey, err = ReturnDimensionKey(report.Columns, reportData.ColumnMap)
+	if err != nil {
+		return false, err
+	}
+	if r.layout == ReportDataLayoutPartitioned {
+		err = r.createReportValuePartition(ctx, reportData.ReportDate)
+		if err != nil {
+			return false, err
+		}
+	}
+	// Row key is inserted first, rows of concurrent inserts wait for each other on its primary key
+	var inserted bool
+	err = r.q.QueryRowContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (report_id, report_date, dimension_key) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING true",
+		r.reportValueRowTable()), reportId, reportData.ReportDate, reportData.DimensionKey).Scan(&inserted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	// Existing row is handled with respect to submit mode
+	exists := !inserted
+	if exists && mode == ReportSubmitModeReject {
+		return false, ErrDuplicate
+	}
+	if exists && mode == ReportSubmitModeOverwrite {
+		_, err = r.q.ExecContext(ctx, fmt.Sprintf(
+			"DELETE FROM %s WHERE report_id = $1 AND report_date = $2 AND dimension_key = $3",
+			r.reportValueTable()), reportId, reportData.ReportDate, reportData.DimensionKey)
+		if err != nil {
+			return false, err
+		}
+	}
+	// Prepare query values
+	values := []interface{}{}
+	count := 0
+	for columnId, value := range reportData.ColumnMap {
+		reportColumn, ok := reportColumnMap[columnId]
+		if !ok {
+			return false, fmt.Errorf("report id %d has no column id %d", reportId, columnId)
+		}
+		// Dimension values of a kept row are equal to submitted ones
+		if exists && mode != ReportSubmitModeOverwrite && reportColumn.Dimension {
+			continue
+		}
+		valueColumn, err := returnReportValueColumn(reportColumn.Type)
+		if err != nil {
+			return false, err
+		}
+		row := make([]interface{}, len(reportValueColumns))
+		row[0], row[1], row[2], row[3], row[4] = reportId, reportData.ReportDate, reportData.DimensionKey, columnId,
+			reportData.SentDate
+		for index, column := range reportValueColumns {
+			if column == valueColumn {
+				row[index] = value
+			}
+		}
+		values = append(values, row...)
+		count++
+	}
+	if count == 0 {
+		return !exists, nil
+	}
+	// Update part of the query
+	updateSql := make([]string, 0, len(reportValueColumns))
+	for _, column := range reportValueColumns[reportValueKeyColumnCount:] {
+		switch column {
+		case "value_int", "value_float", "value_decimal":
+			if mode == ReportSubmitModeAccumulate {
+				updateSql = append(updateSql, fmt.Sprintf("%s=COALESCE(%s.%s, 0)+EXCLUDED.%s",
+					column, r.reportValueTable(), column, column))
+				continue
+			}
+		}
+		updateSql = append(updateSql, fmt.Sprintf("%s=EXCLUDED.%s", column, column))
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO UPDATE SET %s",
+		r.reportValueTable(),
+		strings.Join(reportValueColumns, ","),
+		core.PrepareQueryBulk(len(reportValueColumns), count),
+		strings.Join(reportValueColumns[:reportValueKeyColumnCount], ","),
+		strings.Join(updateSql, ","),
+	)
+	_, err = r.q.ExecContext(ctx, query, values...)
+	if err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
+
+// Move rows of given per report table into report_value table
+func (r *postgresRepository) migrateReportTable(ctx context.Context, report *Report, drop bool) (int64, error) {
+	tableName := ReturnReportTableName(report.Id)
+	if r.layout == ReportDataLayoutPartitioned {
+		// Create partitions covering every report date of the table
+		var minDate, maxDate sql.NullTime
+		err := r.q.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT min(report_date), max(report_date) FROM %s", tableName)).Scan(&minDate, &maxDate)
+		if err != nil {
+			return 0, err
+		}
+		if minDate.Valid {
+			for date, _ := returnMonthRange(minDate.Time); !date.After(maxDate.Time); date = date.AddDate(0, 1, 0) {
+				err = r.createReportValuePartition(ctx, date)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	var total int64
+	// Rows of reports with dimension columns are migrated one by one
+	hasDimension := len(ReturnDimensionColumns(report.Columns)) > 0
+	if hasDimension {
+		count, err := r.migrateReportTableRows(ctx, report)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	for _, reportColumn := range report.Columns {
+		if hasDimension || reportColumn.Type == ReportColumnTypeFormula {
+			continue
+		}
+		valueColumn, err := returnReportValueColumn(reportColumn.Type)
+		if err != nil {
+			return 0, err
+		}
+		columnName := ReturnReportColumnName(reportColumn.Id)
+		result, err := r.q.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (report_id, report_date, column_id, sent_date, %s)
+			SELECT $1, report_date, $2, sent_date, %s FROM %s WHERE %s IS NOT NULL
+			ON CONFLICT (report_id, report_date, dimension_key, column_id) DO NOTHING`,
+			r.reportValueTable(), valueColumn, columnName, tableName, columnName),
+			report.Id, reportColumn.Id)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += rows
+	}
+	// Row keys of the migrated values
+	_, err := r.q.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (report_id, report_date, dimension_key)
+		SELECT DISTINCT report_id, report_date, dimension_key FROM %s WHERE report_id = $1
+		ON CONFLICT DO NOTHING`, r.reportValueRowTable(), r.reportValueTable()), report.Id)
+	if err != nil {
+		return 0, err
+	}
+	if drop {
+		_, err := r.q.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", tableName))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// Move rows of given per report table into report_value table one by one,
+// dimension key of each row is built from its dimension column values
+func (r *postgresRepository) migrateReportTableRows(ctx context.Context, report *Report) (int64, error) {
+	reportDataList, err := r.selectReportTable(ctx, report.Id, ReportDataFilter{})
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for index := range reportDataList {
+		reportData := &reportDataList[index]
+		for _, reportColumn := range report.Columns {
+			if reportColumn.Type == ReportColumnTypeFormula {
+				delete(reportData.ColumnMap, reportColumn.Id)
+			}
+		}
+		_, err = r.insertReportValues(ctx, report.Id, ReportSubmitModeMerge, reportData)
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(reportData.ColumnMap))
+	}
+	return total, nil
+}
+
+// Move report data of every per report table into report_value table,
+// each report is migrated in its own transaction so the migration can be resumed
+func (s *PostgresStorage) MigrateReportData(ctx context.Context, drop bool) error {
+	if s.layout == ReportDataLayoutTable {
+		return errors.New("report data layout is table, nothing to migrate")
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM report ORDER BY id ASC")
+	if err != nil {
+		return err
+	}
+	reportIds := []int{}
+	for rows.Next() {
+		var reportId int
+		err := rows.Scan(&reportId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		reportIds = append(reportIds, reportId)
+	}
+	rows.Close()
+
+	for _, reportId := range reportIds {
+		// Skip reports without a per report table e.g. migrated and dropped before
+		tableName := ReturnReportTableName(reportId)
+		var exists bool
+		err := s.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", tableName).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		report := Report{Id: reportId}
+		err = s.PopulateReportColumns(ctx, &report)
+		if err != nil {
+			return err
+		}
+		tx, err := s.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		count, err := tx.(*postgresTransaction).migrateReportTable(ctx, &report, drop)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration of %s is failed: %w", tableName, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		log.Printf("{MigrateReportData} %s: %d values are migrated.\n", tableName, count)
+	}
+	return nil
+}
+
+// Return condition which limits report_value rows of given report to the oldest rows of given filter,
+// dimension values are read from the dimension key of given columns
+func returnReportValueFilterSql(tableName string, reportId int, columns []ReportColumn, filter ReportDataFilter) (string, []interface{}, error) {
+	filterSql, values, err := returnReportDataFilterSql(columns, filter, 2, func(column ReportColumn, index int) string {
+		// Rows without dimensions have an empty key which is not JSON
+		return fmt.Sprintf("(CASE WHEN dimension_key <> '' THEN dimension_key::jsonb -> %d END)", index)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	values = append([]interface{}{reportId}, values...)
+	condition := fmt.Sprintf("report_id = $1 AND %s", filterSql)
+	switch {
+	case filter.Limit <= 0:
+	case filter.LimitDates:
+		condition = returnReportDateLimitSql(tableName, condition, filter.Limit)
+	default:
+		condition = fmt.Sprintf(
+			"%s AND (report_date, dimension_key) IN (SELECT DISTINCT report_date, dimension_key FROM %s WHERE %s "+
+				"ORDER BY report_date ASC, dimension_key ASC%s)",
+			condition, tableName, condition, returnLimitSql(filter.Limit))
+	}
+	return condition, values, nil
+}
+
+// Collect report_value rows of each report date and dimension key into a single report data
+func (r *postgresRepository) selectReportValues(ctx context.Context, reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	report := Report{Id: reportId}
+	if len(filter.Dimensions) > 0 {
+		err := r.PopulateReportColumns(ctx, &report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	condition, values, err := returnReportValueFilterSql(r.reportValueTable(), reportId, report.Columns, filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.q.QueryContext(ctx, fmt.Sprintf(
+		`SELECT report_date, dimension_key, column_id, sent_date, value_str, value_int, value_float, value_bool, value_time,
+		value_decimal, value_json
+		FROM %s WHERE %s ORDER BY report_date ASC, dimension_key ASC`,
+		r.reportValueTable(), condition), values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reportDataList := []ReportData{}
+	for rows.Next() {
+		var reportDate, sentDate time.Time
+		var dimensionKey string
+		var columnId int
+		var valueStr sql.NullString
+		var valueInt sql.NullInt64
+		var valueFloat sql.NullFloat64
+		var valueBool sql.NullBool
+		var valueTime sql.NullTime
+		var valueDecimal, valueJson sql.NullString
+		err := rows.Scan(&reportDate, &dimensionKey, &columnId, &sentDate, &valueStr, &valueInt, &valueFloat,
+			&valueBool, &valueTime, &valueDecimal, &valueJson)
+		if err != nil {
+			return nil, err
+		}
+		last := len(reportDataList) - 1
+		if last < 0 || !reportDataList[last].ReportDate.Equal(reportDate) || reportDataList[last].DimensionKey != dimensionKey {
+			reportDataList = append(reportDataList, ReportData{ReportDate: reportDate, DimensionKey: dimensionKey,
+				ColumnMap: make(map[int]interface{})})
+			last++
+		}
+		reportData := &reportDataList[last]
+		if sentDate.After(reportData.SentDate) {
+			reportData.SentDate = sentDate
+		}
+		switch {
+		case valueStr.Valid:
+			reportData.ColumnMap[columnId] = valueStr.String
+		case valueInt.Valid:
+			reportData.ColumnMap[columnId] = valueInt.Int64
+		case valueFloat.Valid:
+			reportData.ColumnMap[columnId] = valueFloat.Float64
+		case valueBool.Valid:
+			reportData.ColumnMap[columnId] = valueBool.Bool
+		case valueTime.Valid:
+			reportData.ColumnMap[columnId] = valueTime.Time
+		case valueDecimal.Valid:
+			reportData.ColumnMap[columnId] = valueDecimal.String
+		case valueJson.Valid:
+			reportData.ColumnMap[columnId] = valueJson.String
+		}
+	}
+	return reportDataList, rows.Err()
+}
+
+func (r *postgresRepository) countReportValues(ctx context.Context, reportId int, from time.Time, to time.Time) (int64, error) {
+	condition, values, err := returnReportValueFilterSql(r.reportValueTable(), reportId, nil, ReportDataFilter{From: from, To: to})
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = r.q.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT count(*) FROM (SELECT DISTINCT report_date, dimension_key FROM %s WHERE %s) AS report_row",
+		r.reportValueTable(), condition), values...).Scan(&count)
+	return count, err
+}
+
+// Delete report_value rows of given rows, returns the count of deleted rows rather than values
+func (r *postgresRepository) deleteReportValues(ctx context.Context, reportId int, rows []ReportData) (int64, error) {
+	var total int64
+	for start := 0; start < len(rows); start += reportDataDeleteBatchSize {
+		end := start + reportDataDeleteBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]interface{}, 0, 2*(end-start)+1)
+		for _, row := range rows[start:end] {
+			values = append(values, row.ReportDate, row.DimensionKey)
+		}
+		values = append(values, reportId)
+		var count int64
+		err := r.q.QueryRowContext(ctx, fmt.Sprintf(
+			`WITH deleted AS (DELETE FROM %s WHERE report_id = $%d AND (report_date, dimension_key) IN (%s)
+			RETURNING report_date, dimension_key)
+			SELECT count(*) FROM (SELECT DISTINCT report_date, dimension_key FROM deleted) AS report_row`,
+			r.reportValueTable(), len(values), core.PrepareQueryBulk(2, end-start)), values...).Scan(&count)
+		if err != nil {
+			return 0, err
+		}
+		_, err = r.q.ExecContext(ctx, fmt.Sprintf(
+			"DELETE FROM %s WHERE report_id = $%d AND (report_date, dimension_key) IN (%s)",
+			r.reportValueRowTable(), len(values), core.PrepareQueryBulk(2, end-start)), values...)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
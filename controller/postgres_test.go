@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReturnReportColumnCreationSql(t *testing.T) {
+	sql := returnReportColumnCreationSql([]ReportColumn{
+		{Id: 1, Type: ReportColumnTypeStr, Dimension: true},
+		{Id: 2, Type: ReportColumnTypeBool},
+		{Id: 3, Type: ReportColumnTypeDate, Dimension: true},
+		{Id: 4, Type: ReportColumnTypeTimestamp},
+		{Id: 5, Type: ReportColumnTypeDecimal, Precision: 12, Scale: 4},
+		{Id: 6, Type: ReportColumnTypeEnum, EnumValues: []string{"a"}},
+		{Id: 7, Type: ReportColumnTypeJson},
+		{Id: 8, Type: ReportColumnTypeFormula, Formula: "c_5 * 2"},
+	})
+	expected := []string{
+		ReturnReportColumnName(1) + " varchar NOT NULL,",
+		ReturnReportColumnName(2) + " boolean,",
+		ReturnReportColumnName(3) + " date NOT NULL,",
+		ReturnReportColumnName(4) + " timestamp without time zone,",
+		ReturnReportColumnName(5) + " numeric(12, 4),",
+		ReturnReportColumnName(6) + " varchar,",
+		ReturnReportColumnName(7) + " jsonb,",
+	}
+	// Formulas are computed on select and have no column
+	if lines := strings.Split(strings.TrimSpace(sql), "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("sql:\n%s", sql)
+	}
+}
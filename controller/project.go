@@ -1,7 +1,8 @@
 package controller
 
 import (
-	"repgen/core"
+	"context"
+	"fmt"
 	"time"
 )
 
@@ -10,56 +11,106 @@ type Project struct {
 	Name          string    `json:"name"`
 	Created       time.Time `json:"created"`
 	CreatedUserId int       `json:"-"`
+	// Nil falls back to config default
+	RetentionDays *int `json:"retention_days"`
+	// Archived projects are hidden and their reports reject submits
+	Archived *time.Time `json:"archived"`
+	// Default IANA time zone of new reports
+	TimeZone string `json:"time_zone"`
 }
 
 const (
 	ProjectNameMaxLength = 200
-	ProjectPageLimit     = 10
 )
 
-func CreateProject(project *Project) error {
-	rows, err := core.Database.Query("INSERT INTO project (name, created, created_user_id) VALUES($1, $2, $3) RETURNING id",
-		project.Name, project.Created, project.CreatedUserId)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(&project.Id)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func CreateProject(ctx context.Context, repo Repository, project *Project) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateProject(ctx, project)
 }
 
-func UpdateProject(project *Project) (int64, error) {
-	result, err := core.Database.Exec("UPDATE project SET name = $1 WHERE id = $2", project.Name, project.Id)
-	if err != nil {
-		return 0, err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return rows, nil
+func UpdateProject(ctx context.Context, repo Repository, project *Project) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateProject(ctx, project)
 }
 
-func SelectProject(page int) ([]Project, error) {
-	rows, err := core.Database.Query("SELECT id, name, created, created_user_id FROM project ORDER BY id ASC LIMIT $1 OFFSET $2 ",
-		ProjectPageLimit, ProjectPageLimit*page)
-	if err != nil {
-		return nil, err
+// Return a page of projects matching given query
+func SelectProject(ctx context.Context, repo Repository, query ListQuery) ([]Project, ListPage, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	projects, total, err := repo.SelectProject(ctx, query.fetchQuery())
+	if err != nil || len(projects) <= query.Limit {
+		return projects, ListPage{Total: total}, err
 	}
-	defer rows.Close()
-	projects := []Project{}
-	for rows.Next() {
-		var project Project
-		err := rows.Scan(&project.Id, &project.Name, &project.Created, &project.CreatedUserId)
+	last := projects[query.Limit-1]
+	page := query.returnNextPage(total, ListCursor{Name: last.Name, Created: last.Created, Id: last.Id})
+	return projects[:query.Limit], page, nil
+}
+
+func GetProject(ctx context.Context, repo Repository, id int) (*Project, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetProject(ctx, id)
+}
+
+func UpdateProjectRetention(ctx context.Context, repo Repository, project Project) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateProjectRetention(ctx, project)
+}
+
+func UpdateProjectArchived(ctx context.Context, repo Repository, project Project) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateProjectArchived(ctx, project)
+}
+
+func DeleteProject(ctx context.Context, repo Repository, id int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteProject(ctx, id)
+}
+
+// Archive project if archived date is set, restore it otherwise and record it to audit log
+func ArchiveProject(ctx context.Context, project Project, userId int) (int64, error) {
+	var rows int64
+	err := WithTransaction(ctx, func(tx Repository) error {
+		var err error
+		rows, err = UpdateProjectArchived(ctx, tx, project)
+		if err != nil || rows != 1 {
+			return err
+		}
+		auditLog := AuditLog{UserId: userId, Action: AuditActionRestore, Entity: AuditEntityProject,
+			EntityId: project.Id, Detail: project.Name, Created: time.Now().UTC()}
+		if project.Archived != nil {
+			auditLog.Action = AuditActionArchive
+		}
+		return CreateAuditLog(ctx, tx, &auditLog)
+	})
+	return rows, err
+}
+
+// Delete project with every report of it and record it to audit log
+func DeleteProjectPermanently(ctx context.Context, project Project, userId int) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		reports, err := SelectProjectReports(ctx, tx, project.Id)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		projects = append(projects, project)
-	}
-	return projects, nil
+		for _, report := range reports {
+			err = deleteReport(ctx, tx, report, userId)
+			if err != nil {
+				return err
+			}
+		}
+		rows, err := DeleteProject(ctx, tx, project.Id)
+		if err != nil {
+			return err
+		} else if rows != 1 {
+			return fmt.Errorf("project id %d does not exist", project.Id)
+		}
+		return CreateAuditLog(ctx, tx, &AuditLog{UserId: userId, Action: AuditActionDelete, Entity: AuditEntityProject,
+			EntityId: project.Id, Detail: project.Name, Created: time.Now().UTC()})
+	})
 }
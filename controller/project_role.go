@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"repgen/core"
+	"time"
+)
+
+// Role of a user in a project, roles are given by the group claims of single sign-on
+type ProjectRole struct {
+	ProjectId int       `json:"project_id"`
+	UserId    int       `json:"-"`
+	Role      string    `json:"role"`
+	Created   time.Time `json:"created"`
+}
+
+const (
+	ProjectRoleViewer = "viewer"
+	ProjectRoleEditor = "editor"
+	ProjectRoleOwner  = "owner"
+)
+
+// Rank of each role, a user in multiple groups gets the highest role of a project
+var ProjectRoleRankMap = map[string]int{
+	ProjectRoleViewer: 1,
+	ProjectRoleEditor: 2,
+	ProjectRoleOwner:  3,
+}
+
+// Return true if a group is mapped to given project by config, access to such projects is limited by project roles
+func IsProjectRoleManaged(projectId int) bool {
+	if core.Config == nil {
+		return false
+	}
+	for _, groupRole := range core.Config.Oidc.GroupRoles {
+		if groupRole.ProjectId == projectId {
+			return true
+		}
+	}
+	return false
+}
+
+// Return role of given user in given project, empty if the user has no role. Creators own their projects, and every
+// user owns the projects which are not managed by roles.
+func ReturnUserProjectRole(ctx context.Context, repo Repository, userId int, project *Project) (string, error) {
+	if !IsProjectRoleManaged(project.Id) || project.CreatedUserId == userId {
+		return ProjectRoleOwner, nil
+	}
+	projectRoles, err := SelectProjectRoles(ctx, repo, userId)
+	if err != nil {
+		return "", err
+	}
+	for _, projectRole := range projectRoles {
+		if projectRole.ProjectId == project.Id {
+			return projectRole.Role, nil
+		}
+	}
+	return "", nil
+}
+
+// Return role of each project given to the members of given groups with respect to config
+func ReturnGroupProjectRoles(groups []string) map[int]string {
+	roles := make(map[int]string)
+	if core.Config == nil {
+		return roles
+	}
+	groupMap := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		groupMap[group] = emptyStruct
+	}
+	for _, groupRole := range core.Config.Oidc.GroupRoles {
+		if _, ok := groupMap[groupRole.Group]; !ok {
+			continue
+		}
+		if ProjectRoleRankMap[groupRole.Role] > ProjectRoleRankMap[roles[groupRole.ProjectId]] {
+			roles[groupRole.ProjectId] = groupRole.Role
+		}
+	}
+	return roles
+}
+
+func CreateProjectRoles(ctx context.Context, repo Repository, projectRoles []ProjectRole) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateProjectRoles(ctx, projectRoles)
+}
+
+func SelectProjectRoles(ctx context.Context, repo Repository, userId int) ([]ProjectRole, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectProjectRoles(ctx, userId)
+}
+
+// Delete every project role of given user
+func DeleteProjectRoles(ctx context.Context, repo Repository, userId int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteProjectRoles(ctx, userId)
+}
+
+// Replace project roles of the user with given roles of project ids, roles of missing projects are skipped
+func ReplaceProjectRoles(ctx context.Context, repo Repository, userId int, roles map[int]string, now time.Time) error {
+	_, err := DeleteProjectRoles(ctx, repo, userId)
+	if err != nil {
+		return err
+	}
+	projectRoles := make([]ProjectRole, 0, len(roles))
+	for projectId, role := range roles {
+		project, err := GetProject(ctx, repo, projectId)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			continue
+		}
+		projectRoles = append(projectRoles, ProjectRole{ProjectId: projectId, UserId: userId, Role: role, Created: now})
+	}
+	if len(projectRoles) == 0 {
+		return nil
+	}
+	return CreateProjectRoles(ctx, repo, projectRoles)
+}
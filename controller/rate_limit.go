@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"repgen/core"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitStore counts hits of keys in fixed windows,
+// the in-process store serves a single instance and PostgreSQL storage is shared by every instance
+type RateLimitStore interface {
+	// Add a hit to given key in the window starting at given time and return hits of the window,
+	// hits of a previous window are reset
+	IncrementRateLimit(ctx context.Context, key string, windowStart time.Time, expires time.Time) (int, error)
+	// Return hits of given key in the window starting at given time
+	GetRateLimit(ctx context.Context, key string, windowStart time.Time) (int, error)
+	DeleteRateLimit(ctx context.Context, key string) error
+	// Delete counters of windows which are over before given time
+	DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error)
+	// Add a failure to given key and keep the failures until given time, failures which are expired at now are reset,
+	// returns the failures
+	IncrementLockout(ctx context.Context, key string, now time.Time, expires time.Time) (int, error)
+	// Return failures of given key and the time they are kept until, zero if they are expired at given time
+	GetLockout(ctx context.Context, key string, now time.Time) (int, time.Time, error)
+}
+
+// Allowed hits of a key in a window, zero limit disables it
+type RateLimit struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreShared = "shared"
+	RateLimitLoginIp     = "login_ip"
+	RateLimitLoginEmail  = "login_email"
+	RateLimitSubmitIp    = "submit_ip"
+	RateLimitSubmitToken = "submit_token"
+	// Password reset requests share the limits of login
+	RateLimitResetIp    = "reset_ip"
+	RateLimitResetEmail = "reset_email"
+	// Failed password checks of an email, the email is locked for the window after its last failure
+	// when the limit is reached
+	RateLimitLoginFailure = "login_failure"
+	// Expired counters are removed at most once in this duration
+	rateLimitCleanupInterval = time.Minute
+)
+
+var RateLimits RateLimitStore
+
+var rateLimitCleanup struct {
+	sync.Mutex
+	last time.Time
+}
+
+// Initialize rate limit store with respect to config
+func InitializeRateLimit() {
+	switch core.Config.RateLimit.Store {
+	case RateLimitStoreMemory, "":
+		RateLimits = NewMemoryRateLimitStore()
+	case RateLimitStoreShared:
+		store, ok := Store.(RateLimitStore)
+		if !ok {
+			// In-memory storage serves a single instance anyway
+			log.Println("Shared rate limit store requires postgresql storage, using in-process store.")
+			store = NewMemoryRateLimitStore()
+		}
+		RateLimits = store
+	default:
+		panic(fmt.Sprintf("Invalid rate limit store: %s", core.Config.RateLimit.Store))
+	}
+}
+
+// Return rate limit of given name with respect to config
+func ReturnRateLimit(name string) RateLimit {
+	if core.Config == nil {
+		return RateLimit{Name: name}
+	}
+	config := core.Config.RateLimit
+	rateLimit := RateLimit{Name: name, Window: time.Duration(config.WindowSeconds) * time.Second}
+	switch name {
+	case RateLimitLoginIp, RateLimitResetIp:
+		rateLimit.Limit = config.LoginIp
+	case RateLimitLoginEmail, RateLimitResetEmail:
+		rateLimit.Limit = config.LoginEmail
+	case RateLimitSubmitIp:
+		rateLimit.Limit = config.SubmitIp
+	case RateLimitSubmitToken:
+		rateLimit.Limit = config.SubmitToken
+	case RateLimitLoginFailure:
+		rateLimit.Limit = config.LockoutFailures
+		rateLimit.Window = time.Duration(config.LockoutMinutes) * time.Minute
+	}
+	return rateLimit
+}
+
+// Return true if given rate limit is applied
+func isRateLimitEnabled(rateLimit RateLimit) bool {
+	return RateLimits != nil && rateLimit.Limit > 0 && rateLimit.Window > 0
+}
+
+// Return key and window of given rate limit and key at given time
+func returnRateLimitWindow(rateLimit RateLimit, key string, now time.Time) (string, time.Time, time.Time) {
+	windowStart := now.Truncate(rateLimit.Window)
+	return rateLimit.Name + ":" + key, windowStart, windowStart.Add(rateLimit.Window)
+}
+
+// Count a hit of given key and return the duration to wait if the rate limit is exceeded, zero otherwise
+func TakeRateLimit(ctx context.Context, rateLimit RateLimit, key string, now time.Time) (time.Duration, error) {
+	if !isRateLimitEnabled(rateLimit) {
+		return 0, nil
+	}
+	cleanupRateLimits(ctx, now)
+	storeKey, windowStart, windowEnd := returnRateLimitWindow(rateLimit, key, now)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	hits, err := RateLimits.IncrementRateLimit(ctx, storeKey, windowStart, windowEnd)
+	if err != nil || hits <= rateLimit.Limit {
+		return 0, err
+	}
+	return windowEnd.Sub(now), nil
+}
+
+// Count a failure of given key, failures are kept for the window after the last one
+// so the key is locked for the whole window once the failures reach the limit
+func TakeLockout(ctx context.Context, rateLimit RateLimit, key string, now time.Time) error {
+	if !isRateLimitEnabled(rateLimit) {
+		return nil
+	}
+	cleanupRateLimits(ctx, now)
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	_, err := RateLimits.IncrementLockout(ctx, rateLimit.Name+":"+key, now, now.Add(rateLimit.Window))
+	return err
+}
+
+// Return the duration given key is locked for, zero if it is not locked
+func PeekLockout(ctx context.Context, rateLimit RateLimit, key string, now time.Time) (time.Duration, error) {
+	if !isRateLimitEnabled(rateLimit) {
+		return 0, nil
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	failures, lockedUntil, err := RateLimits.GetLockout(ctx, rateLimit.Name+":"+key, now)
+	if err != nil || failures < rateLimit.Limit {
+		return 0, err
+	}
+	return lockedUntil.Sub(now), nil
+}
+
+// Reset hits of given key e.g. failed logins after a successful one
+func ResetRateLimit(ctx context.Context, rateLimit RateLimit, key string) error {
+	if !isRateLimitEnabled(rateLimit) {
+		return nil
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return RateLimits.DeleteRateLimit(ctx, rateLimit.Name+":"+key)
+}
+
+// Return rate limit key of given email, emails are case insensitive
+func ReturnEmailRateLimitKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Delete expired counters of the store periodically
+func cleanupRateLimits(ctx context.Context, now time.Time) {
+	rateLimitCleanup.Lock()
+	if now.Sub(rateLimitCleanup.last) < rateLimitCleanupInterval {
+		rateLimitCleanup.Unlock()
+		return
+	}
+	rateLimitCleanup.last = now
+	rateLimitCleanup.Unlock()
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	_, err := RateLimits.DeleteExpiredRateLimits(ctx, now)
+	if err != nil {
+		log.Printf("{cleanupRateLimits} ERR: %s\n", err.Error())
+	}
+}
+
+type memoryRateLimitCounter struct {
+	windowStart time.Time
+	expires     time.Time
+	hits        int
+}
+
+// In-process rate limit store of a single instance
+type memoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryRateLimitCounter
+}
+
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{counters: make(map[string]memoryRateLimitCounter)}
+}
+
+func (s *memoryRateLimitStore) IncrementRateLimit(ctx context.Context, key string, windowStart time.Time, expires time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.counters[key]
+	if !counter.windowStart.Equal(windowStart) {
+		counter = memoryRateLimitCounter{windowStart: windowStart, expires: expires}
+	}
+	counter.hits++
+	s.counters[key] = counter
+	return counter.hits, nil
+}
+
+func (s *memoryRateLimitStore) GetRateLimit(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[key]
+	if !ok || !counter.windowStart.Equal(windowStart) {
+		return 0, nil
+	}
+	return counter.hits, nil
+}
+
+func (s *memoryRateLimitStore) IncrementLockout(ctx context.Context, key string, now time.Time, expires time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.counters[key]
+	if !counter.expires.After(now) {
+		counter = memoryRateLimitCounter{windowStart: now}
+	}
+	counter.hits++
+	counter.expires = expires
+	s.counters[key] = counter
+	return counter.hits, nil
+}
+
+func (s *memoryRateLimitStore) GetLockout(ctx context.Context, key string, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter, ok := s.counters[key]
+	if !ok || !counter.expires.After(now) {
+		return 0, time.Time{}, nil
+	}
+	return counter.hits, counter.expires, nil
+}
+
+func (s *memoryRateLimitStore) DeleteRateLimit(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *memoryRateLimitStore) DeleteExpiredRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows int64
+	for key, counter := range s.counters {
+		if !counter.expires.After(before) {
+			delete(s.counters, key)
+			rows++
+		}
+	}
+	return rows, nil
+}
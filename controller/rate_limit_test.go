@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockoutStartsFromLastFailure(t *testing.T) {
+	ctx := context.Background()
+	RateLimits = NewMemoryRateLimitStore()
+	lockout := RateLimit{Name: RateLimitLoginFailure, Limit: 3, Window: 10 * time.Minute}
+	now := time.Date(2026, 10, 19, 10, 9, 0, 0, time.UTC)
+	// Failures are counted across the boundaries of fixed windows
+	for minute := 0; minute < 3; minute++ {
+		if err := TakeLockout(ctx, lockout, "a@example.com", now.Add(time.Duration(minute)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := now.Add(2 * time.Minute)
+	for _, elapsed := range []time.Duration{0, 9 * time.Minute} {
+		retryAfter, err := PeekLockout(ctx, lockout, "a@example.com", last.Add(elapsed))
+		if err != nil || retryAfter != lockout.Window-elapsed {
+			t.Fatalf("locked %s after the last failure: %s %v", elapsed, retryAfter, err)
+		}
+	}
+	retryAfter, err := PeekLockout(ctx, lockout, "a@example.com", last.Add(lockout.Window))
+	if err != nil || retryAfter != 0 {
+		t.Fatalf("lock is not over: %s %v", retryAfter, err)
+	}
+	// Failures are forgotten after the window
+	if err := TakeLockout(ctx, lockout, "a@example.com", last.Add(lockout.Window)); err != nil {
+		t.Fatal(err)
+	}
+	retryAfter, err = PeekLockout(ctx, lockout, "a@example.com", last.Add(lockout.Window))
+	if err != nil || retryAfter != 0 {
+		t.Fatalf("expired failures are counted: %s %v", retryAfter, err)
+	}
+}
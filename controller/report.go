@@ -1,7 +1,9 @@
 package controller
 
 import (
-	"repgen/core"
+	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,97 +12,173 @@ type Report struct {
 	ProjectId     int
 	Name          string
 	Interval      int
-	Token         string
 	Description   string
 	Created       time.Time
 	CreatedUserId int
 	Columns       []ReportColumn
+	// Retention policy, nil retention days falls back to project setting
+	RetentionDays  *int
+	RollupReportId *int
+	RollupFunction string
+	// Archived reports are hidden and reject submits
+	Archived *time.Time
+	// Conflict policy of submits for an existing report date
+	SubmitMode string
+	// IANA time zone of report dates, set on creation
+	TimeZone string
+	// First day of weekly periods as time.Weekday, set on creation
+	WeekStart int
 }
 
 const (
-	ReportNameMaxLength        = 200
-	ReportTokenLength          = 20
-	ReportDescriptionMaxLength = 1000
-	ReportIntervalMonthly      = 0
-	ReportIntervalWeekly       = 1
-	ReportIntervalDaily        = 2
-	ReportIntervalHourly       = 3
-	ReportColumnMaxCount       = 30
-	ReportPageLimit            = 10
+	ReportNameMaxLength          = 200
+	ReportTokenLength            = 20
+	ReportDescriptionMaxLength   = 1000
+	ReportIntervalMonthly        = 0
+	ReportIntervalWeekly         = 1
+	ReportIntervalDaily          = 2
+	ReportIntervalHourly         = 3
+	ReportIntervalMinute         = 4
+	ReportIntervalFiveMinutes    = 5
+	ReportIntervalFifteenMinutes = 6
+	ReportIntervalQuarterly      = 7
+	ReportIntervalYearly         = 8
+	ReportColumnMaxCount         = 30
 )
 
 var emptyStruct struct{}
 var ReportIntervalMap = map[int]struct{}{
-	ReportIntervalMonthly: emptyStruct,
-	ReportIntervalWeekly:  emptyStruct,
-	ReportIntervalDaily:   emptyStruct,
-	ReportIntervalHourly:  emptyStruct,
+	ReportIntervalMonthly:        emptyStruct,
+	ReportIntervalWeekly:         emptyStruct,
+	ReportIntervalDaily:          emptyStruct,
+	ReportIntervalHourly:         emptyStruct,
+	ReportIntervalMinute:         emptyStruct,
+	ReportIntervalFiveMinutes:    emptyStruct,
+	ReportIntervalFifteenMinutes: emptyStruct,
+	ReportIntervalQuarterly:      emptyStruct,
+	ReportIntervalYearly:         emptyStruct,
 }
 
-func CreateReport(report *Report) error {
-	rows, err := core.Database.Query("INSERT INTO report (project_id, name, interval, token, description, created, created_user_id) "+
-		"VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id", report.ProjectId, report.Name, report.Interval, report.Token,
-		report.Description, report.Created, report.CreatedUserId)
-	if err != nil {
-		return err
+func CreateReport(ctx context.Context, repo Repository, report *Report) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateReport(ctx, report)
+}
+
+// Return a page of reports of given project matching given query
+func SelectReport(ctx context.Context, repo Repository, projectId int, query ListQuery) ([]Report, ListPage, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	reports, total, err := repo.SelectReport(ctx, projectId, query.fetchQuery())
+	if err != nil || len(reports) <= query.Limit {
+		return reports, ListPage{Total: total}, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(&report.Id)
+	last := reports[query.Limit-1]
+	page := query.returnNextPage(total, ListCursor{Name: last.Name, Created: last.Created, Id: last.Id})
+	return reports[:query.Limit], page, nil
+}
+
+func GetReport(ctx context.Context, repo Repository, id int) (*Report, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetReport(ctx, id)
+}
+
+func SelectAllReports(ctx context.Context, repo Repository) ([]Report, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectAllReports(ctx)
+}
+
+func SelectProjectReports(ctx context.Context, repo Repository, projectId int) ([]Report, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectProjectReports(ctx, projectId)
+}
+
+func UpdateReportRetention(ctx context.Context, repo Repository, report Report) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateReportRetention(ctx, report)
+}
+
+func UpdateReportArchived(ctx context.Context, repo Repository, report Report) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateReportArchived(ctx, report)
+}
+
+func UpdateReportSubmitMode(ctx context.Context, repo Repository, report Report) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateReportSubmitMode(ctx, report)
+}
+
+func DeleteReport(ctx context.Context, repo Repository, id int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteReport(ctx, id)
+}
+
+// Register report together with its columns, first token and data table in a single transaction,
+// either all of them are created or none
+func RegisterReport(ctx context.Context, report *Report, reportToken *ReportToken) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		err := CreateReport(ctx, tx, report)
 		if err != nil {
 			return err
+		} else if report.Id == 0 {
+			return errors.New("CreateReport is failed, report id is 0")
 		}
-	}
-	return nil
-}
-
-func GetReportByToken(token string) (report *Report, err error) {
-	rows, err := core.Database.Query("SELECT id, project_id, name, interval, token, description, created, created_user_id "+
-		"FROM report WHERE token = $1", token)
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		report = &Report{}
-		err := rows.Scan(&report.Id, &report.ProjectId, &report.Name, &report.Interval, &report.Token,
-			&report.Description, &report.Created, &report.CreatedUserId)
+		for index := range report.Columns {
+			report.Columns[index].ReportId = report.Id
+		}
+		err = CreateReportColumns(ctx, tx, report.Columns)
 		if err != nil {
-			return nil, err
+			return err
 		}
-	}
-	return report, nil
+		reportToken.ReportId = report.Id
+		err = CreateReportToken(ctx, tx, reportToken)
+		if err != nil {
+			return err
+		}
+		return CreateReportDataTable(ctx, tx, *report)
+	})
 }
 
-func SelectReport(reportId int, page int) ([]Report, error) {
-	rows, err := core.Database.Query(
-		`SELECT id, project_id, name, interval, token, description, created, created_user_id FROM report 
-		WHERE project_id = $1 
-		ORDER BY id ASC LIMIT $2 OFFSET $3`,
-		reportId, ReportPageLimit, ReportPageLimit*page)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	reports := []Report{}
-	for rows.Next() {
-		var report Report
-		err := rows.Scan(&report.Id, &report.ProjectId, &report.Name, &report.Interval, &report.Token, &report.Description, &report.Created, &report.CreatedUserId)
-		if err != nil {
-			return nil, err
+// Archive report if archived date is set, restore it otherwise and record it to audit log
+func ArchiveReport(ctx context.Context, report Report, userId int) (int64, error) {
+	var rows int64
+	err := WithTransaction(ctx, func(tx Repository) error {
+		var err error
+		rows, err = UpdateReportArchived(ctx, tx, report)
+		if err != nil || rows != 1 {
+			return err
 		}
-		reports = append(reports, report)
-	}
-	return reports, nil
+		auditLog := AuditLog{UserId: userId, Action: AuditActionRestore, Entity: AuditEntityReport,
+			EntityId: report.Id, Detail: report.Name, Created: time.Now().UTC()}
+		if report.Archived != nil {
+			auditLog.Action = AuditActionArchive
+		}
+		return CreateAuditLog(ctx, tx, &auditLog)
+	})
+	return rows, err
 }
 
-func UpdateReportToken(report Report) (int64, error) {
-	result, err := core.Database.Exec("UPDATE report SET token=$1 WHERE id=$2", report.Token, report.Id)
-	if err != nil {
-		return 0, err
-	}
-	rows, err := result.RowsAffected()
+// Delete report with its columns and data, and record it to audit log
+func DeleteReportPermanently(ctx context.Context, report Report, userId int) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		return deleteReport(ctx, tx, report, userId)
+	})
+}
+
+func deleteReport(ctx context.Context, tx Repository, report Report, userId int) error {
+	rows, err := DeleteReport(ctx, tx, report.Id)
 	if err != nil {
-		return 0, err
+		return err
+	} else if rows != 1 {
+		return fmt.Errorf("report id %d does not exist", report.Id)
 	}
-	return rows, nil
+	return CreateAuditLog(ctx, tx, &AuditLog{UserId: userId, Action: AuditActionDelete, Entity: AuditEntityReport,
+		EntityId: report.Id, Detail: report.Name, Created: time.Now().UTC()})
 }
@@ -1,9 +1,12 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"repgen/core"
-	"strings"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -15,64 +18,147 @@ type ReportColumn struct {
 	Formula       string
 	Created       time.Time
 	CreatedUserId int
+	// Allowed values of enum column
+	EnumValues []string
+	// Total and fractional digits of decimal column
+	Precision int
+	Scale     int
+	// Constraints checked on submit
+	Required  bool
+	Min       *float64
+	Max       *float64
+	MaxLength int
+	Pattern   string
+	// Display metadata e.g. unit "ms" with 2 decimals
+	Unit     string
+	Decimals *int
+	// Dimension columns form the row key together with report date
+	Dimension bool
 }
 
 const (
-	ReportColumnNameMaxLength    = 100
-	ReportColumnTypeStr          = 0
-	ReportColumnTypeInt          = 1
-	ReportColumnTypeFloat        = 2
-	ReportColumnTypeFormula      = 3
-	ReportColumnFormulaMaxLength = 200
+	ReportColumnNameMaxLength     = 100
+	ReportColumnTypeStr           = 0
+	ReportColumnTypeInt           = 1
+	ReportColumnTypeFloat         = 2
+	ReportColumnTypeFormula       = 3
+	ReportColumnTypeBool          = 4
+	ReportColumnTypeDate          = 5
+	ReportColumnTypeTimestamp     = 6
+	ReportColumnTypeDecimal       = 7
+	ReportColumnTypeEnum          = 8
+	ReportColumnTypeJson          = 9
+	ReportColumnFormulaMaxLength  = 200
+	ReportColumnEnumMaxCount      = 100
+	ReportColumnEnumMaxLength     = 100
+	ReportColumnDecimalMaxDigits  = 38
+	ReportColumnPatternMaxLength  = 200
+	ReportColumnUnitMaxLength     = 20
+	ReportColumnDimensionMaxCount = 5
+	ReportColumnDateFormat        = "2006-01-02"
 )
 
 var ReportColumnTypeMap = map[int]struct{}{
-	ReportColumnTypeStr:     emptyStruct,
-	ReportColumnTypeInt:     emptyStruct,
-	ReportColumnTypeFloat:   emptyStruct,
-	ReportColumnTypeFormula: emptyStruct,
+	ReportColumnTypeStr:       emptyStruct,
+	ReportColumnTypeInt:       emptyStruct,
+	ReportColumnTypeFloat:     emptyStruct,
+	ReportColumnTypeFormula:   emptyStruct,
+	ReportColumnTypeBool:      emptyStruct,
+	ReportColumnTypeDate:      emptyStruct,
+	ReportColumnTypeTimestamp: emptyStruct,
+	ReportColumnTypeDecimal:   emptyStruct,
+	ReportColumnTypeEnum:      emptyStruct,
+	ReportColumnTypeJson:      emptyStruct,
 }
 
-func CreateReportColumns(reportColumns []ReportColumn) error {
-	columns := []string{"report_id", "name", "type", "formula", "created", "created_user_id"}
-	sql := fmt.Sprintf("INSERT INTO report_column (%s) VALUES %s RETURNING id",
-		strings.Join(columns, ","), core.PrepareQueryBulk(len(columns), len(reportColumns)))
+// Return true if values of given column type are numbers
+func IsNumericColumnType(columnType int) bool {
+	return columnType == ReportColumnTypeInt || columnType == ReportColumnTypeFloat || columnType == ReportColumnTypeDecimal
+}
 
-	values := []interface{}{}
-	for _, row := range reportColumns {
-		values = append(values, row.ReportId, row.Name, row.Type, row.Formula, row.Created, row.CreatedUserId)
-	}
-	rows, err := core.Database.Query(sql, values...)
-	if err != nil {
-		return err
+// Return true if given column type can be used as dimension
+func IsDimensionColumnType(columnType int) bool {
+	switch columnType {
+	case ReportColumnTypeStr, ReportColumnTypeInt, ReportColumnTypeBool, ReportColumnTypeDate, ReportColumnTypeEnum:
+		return true
 	}
-	defer rows.Close()
-	index := 0
-	for rows.Next() {
-		err := rows.Scan(&reportColumns[index].Id)
-		if err != nil {
-			return err
+	return false
+}
+
+// Return dimension columns of given columns in id order
+func ReturnDimensionColumns(columns []ReportColumn) []ReportColumn {
+	dimensionColumns := []ReportColumn{}
+	for _, column := range columns {
+		if column.Dimension {
+			dimensionColumns = append(dimensionColumns, column)
 		}
-		index++
 	}
-	return nil
+	sort.Slice(dimensionColumns, func(i, j int) bool {
+		return dimensionColumns[i].Id < dimensionColumns[j].Id
+	})
+	return dimensionColumns
 }
 
-func PopulateReportColumns(report *Report) error {
-	rows, err := core.Database.Query("SELECT id, report_id, name, type, formula, created, created_user_id "+
-		"FROM report_column WHERE report_id = $1", report.Id)
-	if err != nil {
-		return err
+// Return key of the dimension values in given column map, empty if there is no dimension column
+func ReturnDimensionKey(columns []ReportColumn, columnMap map[int]interface{}) (string, error) {
+	dimensionColumns := ReturnDimensionColumns(columns)
+	if len(dimensionColumns) == 0 {
+		return "", nil
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var reportColumn ReportColumn
-		err := rows.Scan(&reportColumn.Id, &reportColumn.ReportId, &reportColumn.Name, &reportColumn.Type,
-			&reportColumn.Formula, &reportColumn.Created, &reportColumn.CreatedUserId)
-		if err != nil {
-			return err
+	values := make([]interface{}, len(dimensionColumns))
+	for index, column := range dimensionColumns {
+		value, ok := columnMap[column.Id]
+		if !ok || value == nil {
+			return "", fmt.Errorf("dimension column %s has no value", column.Name)
 		}
-		report.Columns = append(report.Columns, reportColumn)
+		switch v := value.(type) {
+		case time.Time:
+			value = v.UTC().Format(ReportColumnDateFormat)
+		case float64:
+			// Submitted integers are float64, stored ones are int64
+			value = int64(v)
+		case int32:
+			value = int64(v)
+		}
+		values[index] = value
+	}
+	key, err := json.Marshal(values)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return string(key), nil
+}
+
+// Column id -> Compiled pattern of the column
+var reportColumnPatterns sync.Map
+
+type reportColumnPattern struct {
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+// Return compiled pattern of given column, each column is compiled once.
+// Patterns are validated when the report is created.
+func ReturnColumnPattern(reportColumn ReportColumn) (*regexp.Regexp, error) {
+	if cached, ok := reportColumnPatterns.Load(reportColumn.Id); ok && cached.(reportColumnPattern).pattern == reportColumn.Pattern {
+		return cached.(reportColumnPattern).regexp, nil
+	}
+	compiled, err := regexp.Compile(reportColumn.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	reportColumnPatterns.Store(reportColumn.Id, reportColumnPattern{pattern: reportColumn.Pattern, regexp: compiled})
+	return compiled, nil
+}
+
+func CreateReportColumns(ctx context.Context, repo Repository, reportColumns []ReportColumn) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateReportColumns(ctx, reportColumns)
+}
+
+func PopulateReportColumns(ctx context.Context, repo Repository, report *Report) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.PopulateReportColumns(ctx, report)
 }
@@ -1,10 +1,10 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"repgen/core"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -13,6 +13,8 @@ type ReportData struct {
 	ReportDate time.Time
 	SentDate   time.Time
 	ColumnMap  map[int]interface{}
+	// Dimension values of the row, empty if report has no dimension column
+	DimensionKey string
 }
 
 const (
@@ -20,6 +22,34 @@ const (
 	ReportColumnNamePattern = "C%d"
 )
 
+// Storage layouts of report data
+const (
+	ReportDataLayoutTable       = "table"       // One zz_report_<id> table per report
+	ReportDataLayoutLong        = "long"        // Single report_value table with one row per column value
+	ReportDataLayoutPartitioned = "partitioned" // Long layout in report_value_partitioned table, range partitioned by report_date monthly
+)
+
+var ReportDataLayoutMap = map[string]struct{}{
+	ReportDataLayoutTable:       emptyStruct,
+	ReportDataLayoutLong:        emptyStruct,
+	ReportDataLayoutPartitioned: emptyStruct,
+}
+
+// Conflict policies of report data submitted for an existing report date
+const (
+	ReportSubmitModeMerge      = "merge"      // Update submitted columns, keep the others
+	ReportSubmitModeOverwrite  = "overwrite"  // Replace the whole row, columns not submitted are cleared
+	ReportSubmitModeReject     = "reject"     // Append only, existing report dates are rejected with ErrDuplicate
+	ReportSubmitModeAccumulate = "accumulate" // Add submitted numbers to existing values, other columns are merged
+)
+
+var ReportSubmitModeMap = map[string]struct{}{
+	ReportSubmitModeMerge:      emptyStruct,
+	ReportSubmitModeOverwrite:  emptyStruct,
+	ReportSubmitModeReject:     emptyStruct,
+	ReportSubmitModeAccumulate: emptyStruct,
+}
+
 func ReturnReportTableName(reportId int) string {
 	return fmt.Sprintf(ReportTableNamePattern, reportId)
 }
@@ -36,104 +66,54 @@ func ReturnColumnId(reportColumnName string) (int, error) {
 	return columnId, nil
 }
 
-func returnReportColumnCreationSql(columns []ReportColumn) string {
-	var sb strings.Builder
-	for _, column := range columns {
-		reportColumnName := ReturnReportColumnName(column.Id)
-		switch column.Type {
-		case ReportColumnTypeStr:
-			sb.WriteString(fmt.Sprintf("%s varchar,\n", reportColumnName))
-		case ReportColumnTypeInt:
-			sb.WriteString(fmt.Sprintf("%s int,\n", reportColumnName))
-		case ReportColumnTypeFloat:
-			sb.WriteString(fmt.Sprintf("%s float,\n", reportColumnName))
-		case ReportColumnTypeFormula:
-
-		default:
-			panic(fmt.Sprintf("Invalid report column type: %d", column.Type))
-		}
-	}
-	return sb.String()
+func CreateReportDataTable(ctx context.Context, repo Repository, report Report) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateReportDataTable(ctx, report)
 }
 
-func CreateReportDataTable(report Report) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("%s", r)
-		}
-	}()
-
-	tableName := ReturnReportTableName(report.Id)
-	sql := fmt.Sprintf(
-		`CREATE TABLE %s (
-			id int NOT NULL GENERATED ALWAYS AS IDENTITY,
-			report_date timestamp without time zone NOT NULL,
-			sent_date timestamp without time zone NOT NULL,
-			%s
-			CONSTRAINT %s_pk PRIMARY KEY (id)
-		)`,
-		tableName, returnReportColumnCreationSql(report.Columns), tableName)
-	stmt, err := core.Database.Prepare(sql)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
-	if err != nil {
-		return err
-	}
-	// Index
-	sql = fmt.Sprintf("CREATE UNIQUE INDEX %s_idx ON %s USING btree(report_date)", tableName, tableName)
-	stmt, err = core.Database.Prepare(sql)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
-	if err != nil {
-		return err
-	}
-	return nil
+// Insert or update report data row of the report date with respect to given submit mode,
+// returns true if a new row is inserted
+func InsertReportData(ctx context.Context, repo Repository, reportId int, mode string, reportData *ReportData) (bool, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.InsertReportData(ctx, reportId, mode, reportData)
 }
 
-// TODO: report data should be updated if report dates coincide
-// Should index be unique? -> on conflict -> no brin index then
-// Currently, only B-tree indexes can be declared unique.
-func InsertReportData(reportId int, reportData *ReportData) error {
-	// Prepare query columns and values
-	columns := []string{"sent_date"}
-	values := []interface{}{reportData.SentDate}
-	for key, value := range reportData.ColumnMap {
-		columns = append(columns, ReturnReportColumnName(key))
-		values = append(values, value)
-	}
-	// Make values copy for update values
-	valuesUpdate := make([]interface{}, len(values))
-	copy(valuesUpdate, values)
-	// Prepare update part of the query
-	updateSql := core.PrepareQueryBulkUpdate(columns, len(columns)+2)
-	// Add report date to insert part of the query
-	columns = append(columns, "report_date")
-	values = append(values, reportData.ReportDate)
-	// Add update values to overall value slice
-	values = append(values, valuesUpdate...)
-	sql := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES %s ON CONFLICT (report_date) DO UPDATE SET %s RETURNING id",
-		ReturnReportTableName(reportId),
-		strings.Join(columns, ","),
-		core.PrepareQueryBulk(len(columns), 1),
-		updateSql,
-	)
-	rows, err := core.Database.Query(sql, values...)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(&reportData.Id)
-		if err != nil {
-			return err
-		}
+func SelectReportData(ctx context.Context, repo Repository, reportId int, from time.Time, to time.Time, limit int) ([]ReportData, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectReportData(ctx, reportId, from, to, limit)
+}
+
+func FilterReportData(ctx context.Context, repo Repository, reportId int, filter ReportDataFilter) ([]ReportData, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.FilterReportData(ctx, reportId, filter)
+}
+
+// Return key which identifies a row by its report date and dimension values
+func returnRowKey(reportDate time.Time, dimensionKey string) string {
+	return fmt.Sprintf("%d/%s", reportDate.UnixNano(), dimensionKey)
+}
+
+func CountReportData(ctx context.Context, repo Repository, reportId int, from time.Time, to time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CountReportData(ctx, reportId, from, to)
+}
+
+func DeleteReportData(ctx context.Context, repo Repository, reportId int, rows []ReportData) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteReportData(ctx, reportId, rows)
+}
+
+// Move report data of per report tables into the configured report data layout
+func MigrateReportData(ctx context.Context, drop bool) error {
+	storage, ok := Store.(*PostgresStorage)
+	if !ok {
+		return errors.New("report data migration is only supported by PostgreSQL storage")
 	}
-	return nil
+	return storage.MigrateReportData(ctx, drop)
 }
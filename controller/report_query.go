@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const ReportDataQueryMaxLimit = 1000
+
+// Filter and grouping of report data rows by dimension values
+type ReportDataQuery struct {
+	// Report dates between [From, To), zero values are unbounded
+	From time.Time
+	To   time.Time
+	// Dimension column id -> Accepted values, rows matching any of the values are kept
+	Filter map[int][]interface{}
+	// Dimension column ids kept in the result, rows are aggregated over the other dimensions,
+	// nil disables grouping
+	GroupBy []int
+	// Rollup function applied to numeric columns of grouped rows, sum is the default
+	Aggregate string
+	// Zero and larger values are ReportDataQueryMaxLimit
+	Limit int
+}
+
+// Rows of report data selected by the storage
+type ReportDataFilter struct {
+	// Report dates between [From, To), zero values are unbounded
+	From time.Time
+	To   time.Time
+	// Dimension column id -> Dimension values of accepted values, see ReturnDimensionValue
+	Dimensions map[int][]string
+	// Zero is unbounded
+	Limit int
+	// Limit counts report dates rather than rows, so that the rows of each report date are complete
+	LimitDates bool
+}
+
+// Return value of given column in column map as it is in dimension keys, i.e. a JSON value
+func ReturnDimensionValue(reportColumn ReportColumn, columnMap map[int]interface{}) (string, error) {
+	key, err := ReturnDimensionKey([]ReportColumn{reportColumn}, columnMap)
+	if err != nil {
+		return "", err
+	}
+	// Key of a single dimension is a JSON array of a single value
+	return key[1 : len(key)-1], nil
+}
+
+// Select report data of given report with respect to given query, filter and limit are applied by the storage
+func QueryReportData(ctx context.Context, repo Repository, report *Report, query ReportDataQuery) ([]ReportData, error) {
+	reportColumnMap := make(map[int]ReportColumn)
+	for _, reportColumn := range report.Columns {
+		reportColumnMap[reportColumn.Id] = reportColumn
+	}
+	filter := ReportDataFilter{From: query.From, To: query.To, Dimensions: make(map[int][]string), Limit: query.Limit}
+	if filter.Limit <= 0 || filter.Limit > ReportDataQueryMaxLimit {
+		filter.Limit = ReportDataQueryMaxLimit
+	}
+	// Each grouped row is a report date, the rows of limited report dates are enough
+	filter.LimitDates = query.GroupBy != nil
+	// Filter values are compared as dimension values
+	for columnId, values := range query.Filter {
+		reportColumn, ok := reportColumnMap[columnId]
+		if !ok || !reportColumn.Dimension {
+			return nil, fmt.Errorf("report id %d has no dimension column id %d", report.Id, columnId)
+		}
+		for _, value := range values {
+			dimensionValue, err := ReturnDimensionValue(reportColumn, map[int]interface{}{columnId: value})
+			if err != nil {
+				return nil, err
+			}
+			filter.Dimensions[columnId] = append(filter.Dimensions[columnId], dimensionValue)
+		}
+	}
+	rows, err := FilterReportData(ctx, repo, report.Id, filter)
+	if err != nil {
+		return nil, err
+	}
+	if query.GroupBy != nil {
+		rows, err = groupReportData(report, rows, query.GroupBy, query.Aggregate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(rows) > filter.Limit {
+		rows = rows[:filter.Limit]
+	}
+	return rows, nil
+}
+
+// Aggregate rows of each report date and values of given dimensions into a single row,
+// dimensions which are not grouped by are left out
+func groupReportData(report *Report, rows []ReportData, groupBy []int, aggregate string) ([]ReportData, error) {
+	groupByMap := make(map[int]struct{})
+	for _, columnId := range groupBy {
+		groupByMap[columnId] = emptyStruct
+	}
+	// Columns of grouped rows, only grouped dimensions remain dimensions
+	groupColumns := []ReportColumn{}
+	for _, reportColumn := range report.Columns {
+		if reportColumn.Dimension {
+			if _, ok := groupByMap[reportColumn.Id]; !ok {
+				continue
+			}
+		}
+		groupColumns = append(groupColumns, reportColumn)
+	}
+	groupReport := &Report{Id: report.Id, RollupFunction: aggregate, Columns: groupColumns}
+	// Rows are ordered by report date so each group collects the rows of a single report date
+	type group struct {
+		reportDate   time.Time
+		sentDate     time.Time
+		dimensionKey string
+		valueMap     map[int][]interface{}
+	}
+	groups := []*group{}
+	groupMap := make(map[string]*group)
+	for _, row := range rows {
+		dimensionKey, err := ReturnDimensionKey(groupColumns, row.ColumnMap)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%d/%s", row.ReportDate.UnixNano(), dimensionKey)
+		g, ok := groupMap[key]
+		if !ok {
+			g = &group{reportDate: row.ReportDate, dimensionKey: dimensionKey, valueMap: make(map[int][]interface{})}
+			groupMap[key] = g
+			groups = append(groups, g)
+		}
+		if row.SentDate.After(g.sentDate) {
+			g.sentDate = row.SentDate
+		}
+		for columnId, value := range row.ColumnMap {
+			if value != nil {
+				g.valueMap[columnId] = append(g.valueMap[columnId], value)
+			}
+		}
+	}
+	grouped := make([]ReportData, 0, len(groups))
+	for _, g := range groups {
+		row := aggregateRollupValues(groupReport, groupReport, g.valueMap, g.reportDate)
+		row.SentDate = g.sentDate
+		row.DimensionKey = g.dimensionKey
+		grouped = append(grouped, row)
+	}
+	return grouped, nil
+}
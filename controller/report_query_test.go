@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryReportDataFilterAndLimit(t *testing.T) {
+	ctx := context.Background()
+	s, base := newTestMemoryStorage(t)
+	report := createTestReport(t, s, Report{ProjectId: base.ProjectId, CreatedUserId: base.CreatedUserId,
+		Name: "Regions", Interval: ReportIntervalDaily, Columns: []ReportColumn{
+			{Name: "region", Type: ReportColumnTypeStr, Dimension: true},
+			{Name: "shop", Type: ReportColumnTypeInt, Dimension: true},
+			{Name: "amount", Type: ReportColumnTypeInt},
+		}})
+	region, shop, amount := report.Columns[0].Id, report.Columns[1].Id, report.Columns[2].Id
+	for day := 1; day <= 3; day++ {
+		for _, columnMap := range []map[int]interface{}{
+			{region: "eu", shop: 1, amount: 1},
+			{region: "eu", shop: 2, amount: 2},
+			{region: "us", shop: 1, amount: 4},
+		} {
+			reportDate := time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC)
+			_, err := s.InsertReportData(ctx, report.Id, ReportSubmitModeMerge,
+				&ReportData{ReportDate: reportDate, SentDate: reportDate, ColumnMap: columnMap})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Submitted integers are float64
+	rows, err := QueryReportData(ctx, s, &report, ReportDataQuery{
+		Filter: map[int][]interface{}{region: {"eu"}, shop: {float64(2)}}})
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("filter: %+v %v", rows, err)
+	}
+	rows, err = QueryReportData(ctx, s, &report, ReportDataQuery{Filter: map[int][]interface{}{region: {"eu"}}, Limit: 3})
+	if err != nil || len(rows) != 3 || rows[2].ReportDate.Day() != 2 {
+		t.Fatalf("limit: %+v %v", rows, err)
+	}
+	// Each grouped row has every row of its report date
+	rows, err = QueryReportData(ctx, s, &report, ReportDataQuery{GroupBy: []int{}, Limit: 2})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("group: %+v %v", rows, err)
+	}
+	for _, row := range rows {
+		if sum, _ := returnFloatValue(row.ColumnMap[amount]); sum != 7 {
+			t.Fatalf("grouped row is incomplete: %+v", row)
+		}
+	}
+}
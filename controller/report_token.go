@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"repgen/security"
+	"strings"
+	"time"
+)
+
+// Submit token of a report, only its hash is stored so the token is shown once on creation
+type ReportToken struct {
+	Id       int `json:"id"`
+	ReportId int `json:"report_id"`
+	// SHA-256 of the token
+	Hash string `json:"-"`
+	// Leading characters of the token which tell tokens apart
+	Hint          string     `json:"hint"`
+	Label         string     `json:"label"`
+	Created       time.Time  `json:"created"`
+	CreatedUserId int        `json:"-"`
+	LastUsed      *time.Time `json:"last_used"`
+	// Rotated tokens keep working until they expire, nil never expires
+	Expires *time.Time `json:"expires"`
+}
+
+const (
+	// Prefix of report tokens so secret scanners can detect leaked tokens
+	ReportTokenPrefix          = "rpg_"
+	ReportTokenHintLength      = 8
+	ReportTokenLabelMaxLength  = 100
+	ReportTokenDefaultLabel    = "default"
+	ReportTokenMaxCount        = 10
+	ReportTokenGraceMaxMinutes = 7 * 24 * 60
+	// Last used time is updated at most once in this duration to spare a write on every submit
+	reportTokenLastUsedInterval = time.Minute
+)
+
+var ErrReportTokenNotFound = errors.New("report token does not exist")
+
+// Return a report token of given plaintext token, its report id is set by the caller
+func NewReportToken(token string, label string, userId int, created time.Time) ReportToken {
+	hint := strings.TrimPrefix(token, ReportTokenPrefix)
+	if len(hint) > ReportTokenHintLength {
+		hint = hint[:ReportTokenHintLength]
+	}
+	return ReportToken{
+		Hash:          security.HashToken(token),
+		Hint:          hint,
+		Label:         label,
+		Created:       created,
+		CreatedUserId: userId,
+	}
+}
+
+// Return true if given token has the format of a report token,
+// tokens created before prefixes are accepted without prefix
+func IsValidReportToken(token string) bool {
+	return len(strings.TrimPrefix(token, ReportTokenPrefix)) == ReportTokenLength*2
+}
+
+// Return true if given report token is expired at given time
+func IsReportTokenExpired(reportToken ReportToken, now time.Time) bool {
+	return reportToken.Expires != nil && !now.Before(*reportToken.Expires)
+}
+
+func CreateReportToken(ctx context.Context, repo Repository, reportToken *ReportToken) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateReportToken(ctx, reportToken)
+}
+
+func GetReportToken(ctx context.Context, repo Repository, hash string) (*ReportToken, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetReportToken(ctx, hash)
+}
+
+// Select tokens of given report including the expired ones which are not removed yet
+func SelectReportToken(ctx context.Context, repo Repository, reportId int) ([]ReportToken, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectReportToken(ctx, reportId)
+}
+
+func UpdateReportTokenExpires(ctx context.Context, repo Repository, reportToken ReportToken) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateReportTokenExpires(ctx, reportToken)
+}
+
+func UpdateReportTokenLastUsed(ctx context.Context, repo Repository, reportToken ReportToken) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateReportTokenLastUsed(ctx, reportToken)
+}
+
+func DeleteReportToken(ctx context.Context, repo Repository, reportId int, id int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteReportToken(ctx, reportId, id)
+}
+
+// Delete report tokens which are expired before given time
+func DeleteExpiredReportTokens(ctx context.Context, repo Repository, before time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteExpiredReportTokens(ctx, before)
+}
+
+// Return report of given id if one of its tokens is not expired, replays of the submission log whose tokens are
+// redacted are accepted as long as the report takes submits
+func GetReportWithToken(ctx context.Context, repo Repository, reportId int, now time.Time) (*Report, error) {
+	reportTokens, err := SelectReportToken(ctx, repo, reportId)
+	if err != nil {
+		return nil, err
+	}
+	for _, reportToken := range reportTokens {
+		if !IsReportTokenExpired(reportToken, now) {
+			return GetReport(ctx, repo, reportId)
+		}
+	}
+	return nil, nil
+}
+
+// Return report of given plaintext token if the token is not expired, and record the use of the token
+func GetReportByToken(ctx context.Context, repo Repository, token string, now time.Time) (*Report, error) {
+	reportToken, err := GetReportToken(ctx, repo, security.HashToken(token))
+	if err != nil || reportToken == nil || IsReportTokenExpired(*reportToken, now) {
+		return nil, err
+	}
+	if reportToken.LastUsed == nil || now.Sub(*reportToken.LastUsed) >= reportTokenLastUsedInterval {
+		reportToken.LastUsed = &now
+		_, err = UpdateReportTokenLastUsed(ctx, repo, *reportToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return GetReport(ctx, repo, reportToken.ReportId)
+}
+
+// Create given token and let the rotated tokens of its report expire after the grace period,
+// rotated id 0 rotates every active token of the report, zero grace period removes them at once
+func RotateReportToken(ctx context.Context, reportToken *ReportToken, rotatedId int, grace time.Duration) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		reportTokens, err := SelectReportToken(ctx, tx, reportToken.ReportId)
+		if err != nil {
+			return err
+		}
+		expires := reportToken.Created.Add(grace)
+		rotated := 0
+		for _, existing := range reportTokens {
+			if IsReportTokenExpired(existing, reportToken.Created) || (rotatedId != 0 && existing.Id != rotatedId) {
+				continue
+			}
+			rotated++
+			if grace <= 0 {
+				_, err = DeleteReportToken(ctx, tx, existing.ReportId, existing.Id)
+			} else if existing.Expires == nil || existing.Expires.After(expires) {
+				existing.Expires = &expires
+				_, err = UpdateReportTokenExpires(ctx, tx, existing)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if rotatedId != 0 && rotated == 0 {
+			return ErrReportTokenNotFound
+		}
+		return CreateReportToken(ctx, tx, reportToken)
+	})
+}
@@ -0,0 +1,509 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"repgen/core"
+	"time"
+)
+
+const (
+	RetentionActionDelete     = "delete"
+	RetentionActionArchive    = "archive"
+	RetentionDefaultBatchSize = 1000
+	// Archive files of a report are named after the report date and dimension key hash of the first row of each batch
+	RetentionArchiveDirectoryPattern = "report_%d"
+	RetentionArchiveFilePattern      = "%s_%s.jsonl"
+	RollupFunctionSum                = "sum"
+	RollupFunctionAvg                = "avg"
+	RollupFunctionMin                = "min"
+	RollupFunctionMax                = "max"
+)
+
+var RollupFunctionMap = map[string]struct{}{
+	RollupFunctionSum: emptyStruct,
+	RollupFunctionAvg: emptyStruct,
+	RollupFunctionMin: emptyStruct,
+	RollupFunctionMax: emptyStruct,
+}
+
+type RetentionResult struct {
+	ReportId       int       `json:"report_id"`
+	RetentionDays  int       `json:"retention_days"`
+	Cutoff         time.Time `json:"cutoff"`
+	RollupReportId *int      `json:"rollup_report_id"`
+	Rows           int64     `json:"rows"`
+}
+
+// Archived report data row
+type retentionArchiveRow struct {
+	ReportDate time.Time              `json:"report_date"`
+	SentDate   time.Time              `json:"sent_date"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// Return retention days of given report,
+// report setting overrides project setting which overrides config default
+func ReturnRetentionDays(report Report, project *Project) int {
+	if report.RetentionDays != nil {
+		return *report.RetentionDays
+	}
+	if project != nil && project.RetentionDays != nil {
+		return *project.RetentionDays
+	}
+	return core.Config.Retention.DefaultDays
+}
+
+// Return report date before which rows are expired, zero time if rows are kept forever
+func ReturnRetentionCutoff(report Report, project *Project, rollupReport *Report, now time.Time) time.Time {
+	days := ReturnRetentionDays(report, project)
+	if days <= 0 {
+		return time.Time{}
+	}
+	// Days are counted in the time zone of the report
+	cutoff := ReturnPeriodStart(report, now.In(ReturnLocation(report.TimeZone)).AddDate(0, 0, -days))
+	if rollupReport != nil {
+		// Only complete rollup periods are rolled up
+		cutoff = ReturnPeriodStart(*rollupReport, cutoff)
+	}
+	return cutoff
+}
+
+// Fetch project and rollup report of given report and calculate its retention cutoff
+func loadRetention(ctx context.Context, report *Report) (*RetentionResult, *Report, error) {
+	project, err := GetProject(ctx, Store, report.ProjectId)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rollupReport *Report
+	if report.RollupReportId != nil {
+		rollupReport, err = GetReport(ctx, Store, *report.RollupReportId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rollupReport == nil {
+			return nil, nil, fmt.Errorf("rollup report %d of report %d does not exist", *report.RollupReportId, report.Id)
+		}
+		err = PopulateReportColumns(ctx, Store, rollupReport)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(report.Columns) == 0 {
+		err = PopulateReportColumns(ctx, Store, report)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	result := &RetentionResult{
+		ReportId:       report.Id,
+		RetentionDays:  ReturnRetentionDays(*report, project),
+		Cutoff:         ReturnRetentionCutoff(*report, project, rollupReport, time.Now().UTC()),
+		RollupReportId: report.RollupReportId,
+	}
+	return result, rollupReport, nil
+}
+
+// Return how many rows of given report would be removed by its retention policy
+func PreviewRetention(ctx context.Context, report *Report) (*RetentionResult, error) {
+	result, _, err := loadRetention(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	if result.Cutoff.IsZero() {
+		return result, nil
+	}
+	result.Rows, err = CountReportData(ctx, Store, report.Id, time.Time{}, result.Cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Remove expired rows of given report in batches, rows are rolled up and archived before if configured.
+// Rows which cannot be rolled up are kept unless they are archived.
+func ApplyRetention(ctx context.Context, report *Report) (*RetentionResult, error) {
+	result, rollupReport, err := loadRetention(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	if result.Cutoff.IsZero() {
+		return result, nil
+	}
+	batchSize := core.Config.Retention.BatchSize
+	if batchSize <= 0 {
+		batchSize = RetentionDefaultBatchSize
+	}
+	archive := core.Config.Retention.Action == RetentionActionArchive
+	// Rollup periods before start are done, their kept rows are not selected again
+	start := time.Time{}
+	for {
+		var rows []ReportData
+		var deleted int64
+		from, to := start, result.Cutoff
+		err := WithTransaction(ctx, func(tx Repository) error {
+			limit := batchSize
+			if rollupReport != nil {
+				// Oldest expired row determines the rollup period of this batch
+				oldest, err := SelectReportData(ctx, tx, report.Id, start, result.Cutoff, 1)
+				if err != nil || len(oldest) == 0 {
+					return err
+				}
+				from = ReturnPeriodStart(*rollupReport, oldest[0].ReportDate)
+				to = ReturnNextPeriodStart(*rollupReport, from)
+				limit = 0
+			}
+			var err error
+			rows, err = SelectReportData(ctx, tx, report.Id, from, to, limit)
+			if err != nil || len(rows) == 0 {
+				return err
+			}
+			expired := rows
+			if rollupReport != nil {
+				rollups, failed := rollupReportData(report, rollupReport, rows, from)
+				for _, rollup := range rollups {
+					if len(rollup.ColumnMap) == 0 {
+						continue
+					}
+					_, err = InsertReportData(ctx, tx, rollupReport.Id, ReportSubmitModeMerge, &rollup)
+					if err != nil {
+						return err
+					}
+				}
+				if !archive && len(failed) > 0 {
+					expired = returnRetainedRows(rows, failed)
+				}
+			}
+			if archive {
+				// Written before commit, a retried batch rewrites the same file
+				err = archiveReportData(report, rows)
+				if err != nil {
+					return err
+				}
+			}
+			deleted, err = DeleteReportData(ctx, tx, report.Id, expired)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		result.Rows += deleted
+		if rollupReport != nil {
+			start = to
+		}
+	}
+	return result, nil
+}
+
+// Return given rows without the failed ones
+func returnRetainedRows(rows []ReportData, failed []ReportData) []ReportData {
+	failedMap := make(map[string]struct{})
+	for _, row := range failed {
+		failedMap[returnRowKey(row.ReportDate, row.DimensionKey)] = emptyStruct
+	}
+	retained := make([]ReportData, 0, len(rows))
+	for _, row := range rows {
+		if _, ok := failedMap[returnRowKey(row.ReportDate, row.DimensionKey)]; !ok {
+			retained = append(retained, row)
+		}
+	}
+	return retained
+}
+
+// Convert numeric report data value into float
+func returnFloatValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Aggregate given rows into rows of rollup report, one row per dimension values of rollup report, and return the rows
+// which cannot be rolled up. Columns are matched by name, numeric columns are aggregated with the rollup function,
+// other columns keep the latest value
+func rollupReportData(report *Report, rollupReport *Report, rows []ReportData, periodStart time.Time) ([]ReportData, []ReportData) {
+	reportColumnNameMap := make(map[int]string)
+	for _, reportColumn := range report.Columns {
+		reportColumnNameMap[reportColumn.Id] = reportColumn.Name
+	}
+	rollupColumnMap := make(map[string]ReportColumn)
+	for _, reportColumn := range rollupReport.Columns {
+		rollupColumnMap[reportColumn.Name] = reportColumn
+	}
+	// Dimension key -> Rollup column id -> Values in report date order
+	groupMap := make(map[string]map[int][]interface{})
+	groupKeys := []string{}
+	failed := []ReportData{}
+	for _, row := range rows {
+		rollupValueMap := make(map[int]interface{})
+		for columnId, value := range row.ColumnMap {
+			rollupColumn, ok := rollupColumnMap[reportColumnNameMap[columnId]]
+			if !ok || value == nil {
+				continue
+			}
+			rollupValueMap[rollupColumn.Id] = value
+		}
+		dimensionKey, err := ReturnDimensionKey(rollupReport.Columns, rollupValueMap)
+		if err != nil {
+			// Row without dimension values of rollup report cannot be rolled up
+			log.Printf("{rollupReportData} ERR: Report %d at %s: %s\n", report.Id, row.ReportDate, err.Error())
+			failed = append(failed, row)
+			continue
+		}
+		valueMap, ok := groupMap[dimensionKey]
+		if !ok {
+			valueMap = make(map[int][]interface{})
+			groupMap[dimensionKey] = valueMap
+			groupKeys = append(groupKeys, dimensionKey)
+		}
+		for columnId, value := range rollupValueMap {
+			valueMap[columnId] = append(valueMap[columnId], value)
+		}
+	}
+	rollups := make([]ReportData, 0, len(groupKeys))
+	for _, dimensionKey := range groupKeys {
+		rollups = append(rollups, aggregateRollupValues(report, rollupReport, groupMap[dimensionKey], periodStart))
+	}
+	return rollups, failed
+}
+
+// Aggregate values of each rollup column into a single row of rollup report
+func aggregateRollupValues(report *Report, rollupReport *Report, valueMap map[int][]interface{}, periodStart time.Time) ReportData {
+	rollup := ReportData{ReportDate: periodStart, SentDate: time.Now().UTC(), ColumnMap: make(map[int]interface{})}
+	for _, rollupColumn := range rollupReport.Columns {
+		values, ok := valueMap[rollupColumn.Id]
+		if !ok {
+			continue
+		}
+		switch {
+		case rollupColumn.Type == ReportColumnTypeFormula:
+		case rollupColumn.Dimension:
+			// Dimension values are equal within the group
+			rollup.ColumnMap[rollupColumn.Id] = values[0]
+		case rollupColumn.Type == ReportColumnTypeDecimal:
+			// Decimals are aggregated exactly
+			numbers := []*big.Rat{}
+			for _, value := range values {
+				if number, ok := returnRatValue(value); ok {
+					numbers = append(numbers, number)
+				}
+			}
+			if len(numbers) == 0 {
+				continue
+			}
+			rollup.ColumnMap[rollupColumn.Id] = aggregateDecimals(report.RollupFunction, numbers).FloatString(rollupColumn.Scale)
+		case rollupColumn.Type == ReportColumnTypeInt, rollupColumn.Type == ReportColumnTypeFloat:
+			numbers := []float64{}
+			for _, value := range values {
+				if number, ok := returnFloatValue(value); ok {
+					numbers = append(numbers, number)
+				}
+			}
+			if len(numbers) == 0 {
+				continue
+			}
+			aggregate := aggregateNumbers(report.RollupFunction, numbers)
+			if rollupColumn.Type == ReportColumnTypeInt {
+				rollup.ColumnMap[rollupColumn.Id] = int64(math.Round(aggregate))
+			} else {
+				rollup.ColumnMap[rollupColumn.Id] = aggregate
+			}
+		default:
+			// Non numeric columns keep the latest value
+			rollup.ColumnMap[rollupColumn.Id] = values[len(values)-1]
+		}
+	}
+	return rollup
+}
+
+// Apply rollup function to given numbers, sum is the default
+func aggregateNumbers(function string, numbers []float64) float64 {
+	aggregate := numbers[0]
+	for _, number := range numbers[1:] {
+		switch function {
+		case RollupFunctionMin:
+			aggregate = math.Min(aggregate, number)
+		case RollupFunctionMax:
+			aggregate = math.Max(aggregate, number)
+		default:
+			aggregate += number
+		}
+	}
+	if function == RollupFunctionAvg {
+		aggregate /= float64(len(numbers))
+	}
+	return aggregate
+}
+
+// Convert decimal report data value into rational number
+func returnRatValue(value interface{}) (*big.Rat, bool) {
+	switch v := value.(type) {
+	case string:
+		return new(big.Rat).SetString(v)
+	case float64:
+		return new(big.Rat).SetFloat64(v), !math.IsInf(v, 0) && !math.IsNaN(v)
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	}
+	return nil, false
+}
+
+// Apply rollup function to given decimals, sum is the default
+func aggregateDecimals(function string, numbers []*big.Rat) *big.Rat {
+	aggregate := new(big.Rat).Set(numbers[0])
+	for _, number := range numbers[1:] {
+		switch function {
+		case RollupFunctionMin:
+			if number.Cmp(aggregate) < 0 {
+				aggregate.Set(number)
+			}
+		case RollupFunctionMax:
+			if number.Cmp(aggregate) > 0 {
+				aggregate.Set(number)
+			}
+		default:
+			aggregate.Add(aggregate, number)
+		}
+	}
+	if function == RollupFunctionAvg {
+		aggregate.Quo(aggregate, new(big.Rat).SetInt64(int64(len(numbers))))
+	}
+	return aggregate
+}
+
+// Write given batch of rows into its own archive file in the archive directory of the report.
+// The file is named after the first row, so a retried batch replaces its file instead of duplicating the rows.
+func archiveReportData(report *Report, rows []ReportData) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	directory := filepath.Join(core.Config.Retention.ArchiveDirectory, fmt.Sprintf(RetentionArchiveDirectoryPattern, report.Id))
+	err := os.MkdirAll(directory, 0o755)
+	if err != nil {
+		return err
+	}
+	dimensionHash := sha256.Sum256([]byte(rows[0].DimensionKey))
+	fileName := filepath.Join(directory, fmt.Sprintf(RetentionArchiveFilePattern,
+		rows[0].ReportDate.Format("20060102T150405"), hex.EncodeToString(dimensionHash[:4])))
+	// Written into a temporary file which replaces the archive file once it is complete
+	file, err := os.CreateTemp(directory, "batch_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	reportColumnNameMap := make(map[int]string)
+	for _, reportColumn := range report.Columns {
+		reportColumnNameMap[reportColumn.Id] = reportColumn.Name
+	}
+	location := ReturnLocation(report.TimeZone)
+	encoder := json.NewEncoder(file)
+	for _, row := range rows {
+		// Dates are written in the time zone of the report
+		archiveRow := retentionArchiveRow{ReportDate: row.ReportDate.In(location), SentDate: row.SentDate.In(location),
+			Data: make(map[string]interface{})}
+		for columnId, value := range row.ColumnMap {
+			archiveRow.Data[reportColumnNameMap[columnId]] = value
+		}
+		err = encoder.Encode(archiveRow)
+		if err != nil {
+			return err
+		}
+	}
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), fileName)
+}
+
+// Apply retention policy of every report
+func RunRetention(ctx context.Context) {
+	reports, err := SelectAllReports(ctx, Store)
+	if err != nil {
+		log.Printf("{RunRetention} ERR: %s\n", err.Error())
+		return
+	}
+	for index := range reports {
+		result, err := ApplyRetention(ctx, &reports[index])
+		if err != nil {
+			log.Printf("{RunRetention} ERR: Report id %d: %s\n", reports[index].Id, err.Error())
+			continue
+		}
+		if result.Rows > 0 {
+			log.Printf("{RunRetention} Report id %d: %d rows before %s are removed.\n",
+				result.ReportId, result.Rows, result.Cutoff.Format(time.RFC3339))
+		}
+	}
+	// Submission log
+	if core.Config.Retention.SubmissionDays > 0 {
+		cutoff := time.Now().UTC().AddDate(0, 0, -core.Config.Retention.SubmissionDays)
+		rows, err := DeleteSubmissions(ctx, Store, cutoff)
+		if err != nil {
+			log.Printf("{RunRetention} ERR: Submission log: %s\n", err.Error())
+		} else if rows > 0 {
+			log.Printf("{RunRetention} Submission log: %d submissions before %s are removed.\n",
+				rows, cutoff.Format(time.RFC3339))
+		}
+	}
+	// Rotated report tokens
+	rows, err := DeleteExpiredReportTokens(ctx, Store, time.Now().UTC())
+	if err != nil {
+		log.Printf("{RunRetention} ERR: Report tokens: %s\n", err.Error())
+	} else if rows > 0 {
+		log.Printf("{RunRetention} Report tokens: %d expired tokens are removed.\n", rows)
+	}
+	// Password reset tokens
+	rows, err = DeleteExpiredPasswordResets(ctx, Store, time.Now().UTC())
+	if err != nil {
+		log.Printf("{RunRetention} ERR: Password resets: %s\n", err.Error())
+	} else if rows > 0 {
+		log.Printf("{RunRetention} Password resets: %d expired tokens are removed.\n", rows)
+	}
+	// Pending MFA logins
+	rows, err = DeleteExpiredMfaChallenges(ctx, Store, time.Now().UTC())
+	if err != nil {
+		log.Printf("{RunRetention} ERR: MFA challenges: %s\n", err.Error())
+	} else if rows > 0 {
+		log.Printf("{RunRetention} MFA challenges: %d expired challenges are removed.\n", rows)
+	}
+}
+
+// Run retention policies periodically in background until given context is done
+func StartRetentionJob(ctx context.Context) {
+	if core.Config.Retention.JobInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(core.Config.Retention.JobInterval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			RunRetention(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
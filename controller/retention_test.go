@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"repgen/core"
+	"testing"
+	"time"
+)
+
+// Create given report with its columns and data table in the storage of newTestMemoryStorage
+func createTestReport(t *testing.T, s *MemoryStorage, report Report) Report {
+	t.Helper()
+	ctx := context.Background()
+	columns := report.Columns
+	report.Columns = nil
+	if err := s.CreateReport(ctx, &report); err != nil {
+		t.Fatal(err)
+	}
+	for index := range columns {
+		columns[index].ReportId = report.Id
+	}
+	if err := s.CreateReportColumns(ctx, columns); err != nil {
+		t.Fatal(err)
+	}
+	report.Columns = columns
+	if err := s.CreateReportDataTable(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// Return a daily report of region and amount columns rolling up into a monthly report of region dimension,
+// the daily report has an expired row with a region and an expired row without one
+func newTestRetention(t *testing.T, action string) (Report, Report) {
+	t.Helper()
+	ctx := context.Background()
+	s, base := newTestMemoryStorage(t)
+	Store = s
+	core.Config = &core.ConfigBase{}
+	core.Config.Retention.Action = action
+	core.Config.Retention.ArchiveDirectory = t.TempDir()
+	rollupReport := createTestReport(t, s, Report{ProjectId: base.ProjectId, CreatedUserId: base.CreatedUserId,
+		Name: "Monthly", Interval: ReportIntervalMonthly, Columns: []ReportColumn{
+			{Name: "region", Type: ReportColumnTypeStr, Dimension: true},
+			{Name: "amount", Type: ReportColumnTypeInt},
+		}})
+	retentionDays := 30
+	report := createTestReport(t, s, Report{ProjectId: base.ProjectId, CreatedUserId: base.CreatedUserId,
+		Name: "Daily rollup", Interval: ReportIntervalDaily, RetentionDays: &retentionDays,
+		RollupReportId: &rollupReport.Id, RollupFunction: RollupFunctionSum, Columns: []ReportColumn{
+			{Name: "region", Type: ReportColumnTypeStr},
+			{Name: "amount", Type: ReportColumnTypeInt},
+		}})
+	region, amount := report.Columns[0].Id, report.Columns[1].Id
+	for _, columnMap := range []map[int]interface{}{{region: "eu", amount: 1}, {amount: 2}} {
+		reportDate := time.Date(2020, 1, 5+len(columnMap), 0, 0, 0, 0, time.UTC)
+		_, err := s.InsertReportData(ctx, report.Id, ReportSubmitModeMerge,
+			&ReportData{ReportDate: reportDate, SentDate: reportDate, ColumnMap: columnMap})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return report, rollupReport
+}
+
+func TestApplyRetentionKeepsRowsWhichAreNotRolledUp(t *testing.T) {
+	ctx := context.Background()
+	report, rollupReport := newTestRetention(t, RetentionActionDelete)
+	preview, err := PreviewRetention(ctx, &report)
+	if err != nil || preview.Rows != 2 {
+		t.Fatalf("preview: %+v %v", preview, err)
+	}
+	result, err := ApplyRetention(ctx, &report)
+	if err != nil || result.Rows != 1 {
+		t.Fatalf("result: %+v %v", result, err)
+	}
+	rows, err := SelectReportData(ctx, Store, report.Id, time.Time{}, time.Time{}, 0)
+	if err != nil || len(rows) != 1 || rows[0].ColumnMap[report.Columns[1].Id] != 2 {
+		t.Fatalf("row without region is not kept: %+v %v", rows, err)
+	}
+	rollups, err := SelectReportData(ctx, Store, rollupReport.Id, time.Time{}, time.Time{}, 0)
+	if err != nil || len(rollups) != 1 {
+		t.Fatalf("rollups: %+v %v", rollups, err)
+	}
+	// Kept row is not selected again
+	result, err = ApplyRetention(ctx, &report)
+	if err != nil || result.Rows != 0 {
+		t.Fatalf("second run: %+v %v", result, err)
+	}
+}
+
+func TestApplyRetentionArchivesEachBatchOnce(t *testing.T) {
+	ctx := context.Background()
+	report, _ := newTestRetention(t, RetentionActionArchive)
+	rows, err := SelectReportData(ctx, Store, report.Id, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Batch of a failed commit is written again by the retry
+	if err := archiveReportData(&report, rows); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ApplyRetention(ctx, &report)
+	if err != nil || result.Rows != 2 {
+		t.Fatalf("result: %+v %v", result, err)
+	}
+	files, err := filepath.Glob(filepath.Join(core.Config.Retention.ArchiveDirectory, "report_*", "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("archive files: %v %v", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	for _, char := range content {
+		if char == '\n' {
+			lines++
+		}
+	}
+	if lines != 2 {
+		t.Fatalf("archive rows: %s", content)
+	}
+}
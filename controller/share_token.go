@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"time"
+)
+
+// Read only token which gives unauthenticated access to the data of a report, or of every report of a project
+type ShareToken struct {
+	Id int `json:"id"`
+	// Plaintext token, only known on creation
+	Token string `json:"token"`
+	// SHA-256 of the token
+	Hash     string `json:"-"`
+	Entity   string `json:"entity"`
+	EntityId int    `json:"entity_id"`
+	// Nil never expires
+	Expires       *time.Time `json:"expires"`
+	Created       time.Time  `json:"created"`
+	CreatedUserId int        `json:"-"`
+}
+
+const (
+	ShareTokenLength      = 20
+	ShareTokenMaxDays     = 3650
+	ShareEntityProject    = AuditEntityProject
+	ShareEntityReport     = AuditEntityReport
+	ShareFormatJson       = "json"
+	ShareFormatCsv        = "csv"
+	ShareFormatHtml       = "html"
+	ShareDataDefaultLimit = 100
+)
+
+var ShareFormatMap = map[string]struct{}{
+	ShareFormatJson: emptyStruct,
+	ShareFormatCsv:  emptyStruct,
+	ShareFormatHtml: emptyStruct,
+}
+
+// Return true if given share token is expired at given time
+func IsShareTokenExpired(shareToken ShareToken, now time.Time) bool {
+	return shareToken.Expires != nil && !now.Before(*shareToken.Expires)
+}
+
+func CreateShareToken(ctx context.Context, repo Repository, shareToken *ShareToken) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateShareToken(ctx, shareToken)
+}
+
+func GetShareToken(ctx context.Context, repo Repository, hash string) (*ShareToken, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetShareToken(ctx, hash)
+}
+
+// Delete share token of given project or report
+func DeleteShareToken(ctx context.Context, repo Repository, entity string, entityId int) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteShareToken(ctx, entity, entityId)
+}
+
+// Replace share token of the project or report with given one, the previous token stops working at once
+func RotateShareToken(ctx context.Context, shareToken *ShareToken) error {
+	return WithTransaction(ctx, func(tx Repository) error {
+		_, err := DeleteShareToken(ctx, tx, shareToken.Entity, shareToken.EntityId)
+		if err != nil {
+			return err
+		}
+		return CreateShareToken(ctx, tx, shareToken)
+	})
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"repgen/core"
+	"time"
+)
+
+// Repository is implemented by every persistence backend and by their transactions
+type Repository interface {
+	// Users
+	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, user User) (int64, error)
+	UpdateUserPassword(ctx context.Context, user User) (int64, error)
+	GetUser(ctx context.Context, id int) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// List queries return at most query.Limit rows after the cursor and the count of every row matching the query
+	SelectUser(ctx context.Context, query ListQuery) ([]User, int64, error)
+	// Identities of single sign-on
+	CreateUserIdentity(ctx context.Context, userIdentity *UserIdentity) error
+	GetUserIdentity(ctx context.Context, issuer string, subject string) (*UserIdentity, error)
+	// Project roles
+	CreateProjectRoles(ctx context.Context, projectRoles []ProjectRole) error
+	SelectProjectRoles(ctx context.Context, userId int) ([]ProjectRole, error)
+	DeleteProjectRoles(ctx context.Context, userId int) (int64, error)
+	// Two-factor authentication
+	CreateUserMfa(ctx context.Context, userMfa UserMfa) error
+	GetUserMfa(ctx context.Context, userId int) (*UserMfa, error)
+	UpdateUserMfa(ctx context.Context, userMfa UserMfa) (int64, error)
+	// Set last counter only if given counter is newer than the stored one
+	UpdateUserMfaCounter(ctx context.Context, userMfa UserMfa) (int64, error)
+	DeleteUserMfa(ctx context.Context, userId int) (int64, error)
+	CreateRecoveryCodes(ctx context.Context, recoveryCodes []RecoveryCode) error
+	DeleteRecoveryCode(ctx context.Context, userId int, hash string) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, userId int) (int64, error)
+	CreateMfaChallenge(ctx context.Context, mfaChallenge *MfaChallenge) error
+	GetMfaChallenge(ctx context.Context, hash string) (*MfaChallenge, error)
+	IncrementMfaChallengeAttempts(ctx context.Context, id int) (int, error)
+	DeleteMfaChallenge(ctx context.Context, id int) (int64, error)
+	DeleteExpiredMfaChallenges(ctx context.Context, before time.Time) (int64, error)
+	// Password resets
+	CreatePasswordReset(ctx context.Context, passwordReset *PasswordReset) error
+	GetPasswordReset(ctx context.Context, hash string) (*PasswordReset, error)
+	DeletePasswordResets(ctx context.Context, userId int) (int64, error)
+	// Delete password reset of given token hash if it is not expired at given time
+	DeletePasswordReset(ctx context.Context, hash string, now time.Time) (int64, error)
+	DeleteExpiredPasswordResets(ctx context.Context, before time.Time) (int64, error)
+	// User sessions
+	CreateUserSession(ctx context.Context, userSession UserSession) error
+	DeleteUserSession(ctx context.Context, id int) error
+	DeleteAllUserSessions(ctx context.Context, userId int) error
+	GetUserSession(ctx context.Context, session string) (*UserSession, error)
+	SelectUserSession(ctx context.Context, userId int, query ListQuery) ([]UserSession, int64, error)
+	// Projects
+	CreateProject(ctx context.Context, project *Project) error
+	UpdateProject(ctx context.Context, project *Project) (int64, error)
+	SelectProject(ctx context.Context, query ListQuery) ([]Project, int64, error)
+	GetProject(ctx context.Context, id int) (*Project, error)
+	UpdateProjectRetention(ctx context.Context, project Project) (int64, error)
+	UpdateProjectArchived(ctx context.Context, project Project) (int64, error)
+	DeleteProject(ctx context.Context, id int) (int64, error)
+	// Reports
+	CreateReport(ctx context.Context, report *Report) error
+	SelectReport(ctx context.Context, projectId int, query ListQuery) ([]Report, int64, error)
+	GetReport(ctx context.Context, id int) (*Report, error)
+	SelectAllReports(ctx context.Context) ([]Report, error)
+	// Every report of given project, archived or not
+	SelectProjectReports(ctx context.Context, projectId int) ([]Report, error)
+	UpdateReportRetention(ctx context.Context, report Report) (int64, error)
+	UpdateReportArchived(ctx context.Context, report Report) (int64, error)
+	UpdateReportSubmitMode(ctx context.Context, report Report) (int64, error)
+	// Delete report with its columns and data
+	DeleteReport(ctx context.Context, id int) (int64, error)
+	// Report tokens
+	CreateReportToken(ctx context.Context, reportToken *ReportToken) error
+	GetReportToken(ctx context.Context, hash string) (*ReportToken, error)
+	SelectReportToken(ctx context.Context, reportId int) ([]ReportToken, error)
+	UpdateReportTokenExpires(ctx context.Context, reportToken ReportToken) (int64, error)
+	UpdateReportTokenLastUsed(ctx context.Context, reportToken ReportToken) (int64, error)
+	DeleteReportToken(ctx context.Context, reportId int, id int) (int64, error)
+	DeleteExpiredReportTokens(ctx context.Context, before time.Time) (int64, error)
+	// Report columns
+	CreateReportColumns(ctx context.Context, reportColumns []ReportColumn) error
+	PopulateReportColumns(ctx context.Context, report *Report) error
+	// Audit logs
+	CreateAuditLog(ctx context.Context, auditLog *AuditLog) error
+	// Submission log
+	CreateSubmission(ctx context.Context, submission *Submission) error
+	SelectSubmission(ctx context.Context, reportId int, page int, failed bool) ([]Submission, error)
+	GetSubmission(ctx context.Context, id int) (*Submission, error)
+	DeleteSubmissions(ctx context.Context, before time.Time) (int64, error)
+	// Share tokens
+	CreateShareToken(ctx context.Context, shareToken *ShareToken) error
+	GetShareToken(ctx context.Context, hash string) (*ShareToken, error)
+	DeleteShareToken(ctx context.Context, entity string, entityId int) (int64, error)
+	// Report data
+	CreateReportDataTable(ctx context.Context, report Report) error
+	InsertReportData(ctx context.Context, reportId int, mode string, reportData *ReportData) (bool, error)
+	// Report data between [from, to) ordered by report date, zero from/to and limit are unbounded
+	SelectReportData(ctx context.Context, reportId int, from time.Time, to time.Time, limit int) ([]ReportData, error)
+	// Report data of given filter ordered by report date and dimension key
+	FilterReportData(ctx context.Context, reportId int, filter ReportDataFilter) ([]ReportData, error)
+	// Count of rows, i.e. report dates and dimension keys
+	CountReportData(ctx context.Context, reportId int, from time.Time, to time.Time) (int64, error)
+	// Delete given rows which are identified by report date and dimension key, returns the count of deleted rows
+	DeleteReportData(ctx context.Context, reportId int, rows []ReportData) (int64, error)
+}
+
+// Storage is a persistence backend which is able to start transactions
+type Storage interface {
+	Repository
+	Begin(ctx context.Context) (Transaction, error)
+}
+
+// Transaction is a repository whose changes are applied together on commit
+type Transaction interface {
+	Repository
+	Commit() error
+	Rollback() error
+}
+
+const (
+	StorageDriverPostgresql = "postgresql"
+	StorageDriverMemory     = "memory"
+)
+
+// Returned by storage backends when a unique constraint is violated e.g. duplicate email, project name or token
+var ErrDuplicate = errors.New("duplicate key value violates unique constraint")
+var errTransactionDone = errors.New("transaction has already been committed or rolled back")
+
+var Store Storage
+
+// Initialize storage backend with respect to config
+func InitializeStorage() {
+	switch core.Config.Storage.Driver {
+	case StorageDriverPostgresql, "":
+		layout := core.Config.Storage.ReportDataLayout
+		if layout == "" {
+			layout = ReportDataLayoutTable
+		}
+		if _, ok := ReportDataLayoutMap[layout]; !ok {
+			panic(fmt.Sprintf("Invalid report data layout: %s", layout))
+		}
+		core.InitializeDatabase()
+		storage := NewPostgresStorage(core.Database, layout)
+		if err := storage.CreateReportValueTable(context.Background()); err != nil {
+			panic(err)
+		}
+		Store = storage
+	case StorageDriverMemory:
+		Store = NewMemoryStorage()
+		log.Println("Using in-memory storage, data will be lost on shutdown.")
+	default:
+		panic(fmt.Sprintf("Invalid storage driver: %s", core.Config.Storage.Driver))
+	}
+}
+
+// Derive a context for a single query with respect to the configured query timeout
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if core.Config == nil || core.Config.Storage.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(core.Config.Storage.QueryTimeout)*time.Millisecond)
+}
+
+// Run given function inside a transaction,
+// transaction is committed if the function succeeds and rolled back otherwise
+func WithTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	tx, err := Store.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("{WithTransaction} ERR: Rollback failed: %s\n", rollbackErr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
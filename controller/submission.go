@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"time"
+)
+
+// Raw /submit payload with its outcome, submissions are never updated
+type Submission struct {
+	Id int `json:"id"`
+	// Nil if the token does not belong to any report
+	ReportId *int `json:"report_id"`
+	// Submission which is replayed by this one
+	ReplayId   *int      `json:"replay_id"`
+	Body       string    `json:"body"`
+	RemoteAddr string    `json:"remote_addr"`
+	Received   time.Time `json:"received"`
+	// HTTP status and message of the response
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+const (
+	SubmissionPageLimit      = 20
+	SubmissionReplayMaxCount = 100
+	// Token of the payload in the submission log, replays use the report of the submission instead
+	SubmissionRedactedToken = "[redacted]"
+)
+
+// Token field of payloads which are not JSON objects
+var submissionTokenRegexp = regexp.MustCompile(`"token"\s*:\s*"(?:[^"\\]|\\.)*"`)
+
+// Return given /submit payload with its token replaced by SubmissionRedactedToken, payloads which are not JSON
+// objects have every token field replaced
+func RedactSubmissionBody(body string) string {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &payload); err != nil || payload == nil {
+		redacted, _ := json.Marshal(SubmissionRedactedToken)
+		return submissionTokenRegexp.ReplaceAllLiteralString(body, `"token":`+string(redacted))
+	}
+	if _, ok := payload["token"]; !ok {
+		return body
+	}
+	payload["token"], _ = json.Marshal(SubmissionRedactedToken)
+	redacted, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return string(redacted)
+}
+
+func CreateSubmission(ctx context.Context, repo Repository, submission *Submission) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateSubmission(ctx, submission)
+}
+
+// Select submissions of given report newest first, only failed ones if requested
+func SelectSubmission(ctx context.Context, repo Repository, reportId int, page int, failed bool) ([]Submission, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.SelectSubmission(ctx, reportId, page, failed)
+}
+
+func GetSubmission(ctx context.Context, repo Repository, id int) (*Submission, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetSubmission(ctx, id)
+}
+
+// Delete submissions received before given date
+func DeleteSubmissions(ctx context.Context, repo Repository, before time.Time) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteSubmissions(ctx, before)
+}
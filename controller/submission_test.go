@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectSubmission(t *testing.T) {
+	ctx := context.Background()
+	s, report := newTestMemoryStorage(t)
+	otherReportId := report.Id + 1
+	received := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	// Every third submission failed, submissions of other reports and unknown tokens are not listed
+	for index := 0; index < SubmissionPageLimit+5; index++ {
+		submission := Submission{ReportId: &report.Id, Body: strconv.Itoa(index), Received: received, Status: http.StatusOK}
+		if index%3 == 0 {
+			submission.Status = http.StatusBadRequest
+		}
+		if err := CreateSubmission(ctx, s, &submission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, reportId := range []*int{&otherReportId, nil} {
+		if err := CreateSubmission(ctx, s, &Submission{ReportId: reportId, Received: received, Status: http.StatusBadRequest}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	submissions, err := SelectSubmission(ctx, s, report.Id, 0, false)
+	if err != nil || len(submissions) != SubmissionPageLimit || submissions[0].Body != strconv.Itoa(SubmissionPageLimit+4) {
+		t.Fatalf("first page: %d %v", len(submissions), err)
+	}
+	submissions, err = SelectSubmission(ctx, s, report.Id, 1, false)
+	if err != nil || len(submissions) != 5 || submissions[4].Body != "0" {
+		t.Fatalf("second page: %+v %v", submissions, err)
+	}
+	submissions, err = SelectSubmission(ctx, s, report.Id, 0, true)
+	if err != nil || len(submissions) != 9 {
+		t.Fatalf("failed: %+v %v", submissions, err)
+	}
+	for _, submission := range submissions {
+		if submission.Status == http.StatusOK || *submission.ReportId != report.Id {
+			t.Fatalf("failed: %+v", submission)
+		}
+	}
+	if submissions, err = SelectSubmission(ctx, s, report.Id, 2, false); err != nil || len(submissions) != 0 {
+		t.Fatalf("last page: %+v %v", submissions, err)
+	}
+}
+
+func TestRedactSubmissionBody(t *testing.T) {
+	token := "rpg_" + strings.Repeat("ab", ReportTokenLength)
+	for body, expected := range map[string]string{
+		`{"token": "` + token + `", "data": {"amount": 1.50}}`: `{"data":{"amount":1.50},"token":"[redacted]"}`,
+		`{"data": {"amount": 1}}`:                              `{"data": {"amount": 1}}`,
+		// Invalid payloads are recorded as they are except their token
+		`{"token": "` + token + `", "data": `: `{"token":"[redacted]", "data": `,
+		`[1, 2`:                               `[1, 2`,
+	} {
+		if redacted := RedactSubmissionBody(body); redacted != expected {
+			t.Fatalf("%s: %s", body, redacted)
+		}
+	}
+}
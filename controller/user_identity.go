@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Account of a user at an identity provider, the subject is stable while the email may change
+type UserIdentity struct {
+	Id      int
+	UserId  int
+	Issuer  string
+	Subject string
+	Created time.Time
+}
+
+// Returned if no user has the email of an identity and users are not created on first login
+var ErrUserIdentityNotFound = errors.New("no user is linked to the identity")
+
+func CreateUserIdentity(ctx context.Context, repo Repository, userIdentity *UserIdentity) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateUserIdentity(ctx, userIdentity)
+}
+
+func GetUserIdentity(ctx context.Context, repo Repository, issuer string, subject string) (*UserIdentity, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetUserIdentity(ctx, issuer, subject)
+}
+
+// Return the user linked to given identity, the identity is linked to the user of given verified email on first login
+// and a user is created with given unusable password hash if none has the email and creation is allowed.
+// Project roles of the user are replaced with given ones
+func LoginUserIdentity(ctx context.Context, userIdentity UserIdentity, email string, name string, hashedPassword string,
+	create bool, roles map[int]string) (*User, error) {
+	var user *User
+	err := WithTransaction(ctx, func(tx Repository) error {
+		existing, err := GetUserIdentity(ctx, tx, userIdentity.Issuer, userIdentity.Subject)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			user, err = GetUser(ctx, tx, existing.UserId)
+			if err != nil {
+				return err
+			}
+		} else {
+			user, err = GetUserByEmail(ctx, tx, email)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				if !create {
+					return ErrUserIdentityNotFound
+				}
+				user = &User{Email: email, Password: hashedPassword, Name: name, Created: userIdentity.Created}
+				err = CreateUser(ctx, tx, user)
+				if err != nil {
+					return err
+				}
+			}
+			userIdentity.UserId = user.Id
+			err = CreateUserIdentity(ctx, tx, &userIdentity)
+			if err != nil {
+				return err
+			}
+		}
+		if user == nil {
+			return ErrUserIdentityNotFound
+		}
+		return ReplaceProjectRoles(ctx, tx, user.Id, roles, userIdentity.Created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
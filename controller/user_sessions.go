@@ -1,7 +1,7 @@
 package controller
 
 import (
-	"repgen/core"
+	"context"
 	"time"
 )
 
@@ -12,48 +12,39 @@ type UserSession struct {
 	Created time.Time
 }
 
-func CreateUserSession(userSession UserSession) error {
-	rows, err := core.Database.Query("INSERT INTO user_session (user_id, session, created) VALUES($1, $2, $3)",
-		userSession.UserId, userSession.Session, userSession.Created)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	return nil
+func CreateUserSession(ctx context.Context, repo Repository, userSession UserSession) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateUserSession(ctx, userSession)
 }
 
-func DeleteUserSession(id int) error {
-	rows, err := core.Database.Query("DELETE FROM user_session WHERE id = $1", id)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	return nil
+func DeleteUserSession(ctx context.Context, repo Repository, id int) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteUserSession(ctx, id)
 }
 
-func DeleteAllUserSessions(userId int) error {
-	rows, err := core.Database.Query("DELETE FROM user_session WHERE user_id = $1", userId)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	return nil
+func DeleteAllUserSessions(ctx context.Context, repo Repository, userId int) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.DeleteAllUserSessions(ctx, userId)
 }
 
-func GetUserSession(session string) (*UserSession, error) {
-	rows, err := core.Database.Query("SELECT id, user_id, session, created FROM user_session WHERE session = $1", session)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func GetUserSession(ctx context.Context, repo Repository, session string) (*UserSession, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetUserSession(ctx, session)
+}
 
-	var userSession *UserSession
-	for rows.Next() {
-		userSession = &UserSession{}
-		err := rows.Scan(&userSession.Id, &userSession.UserId, &userSession.Session, &userSession.Created)
-		if err != nil {
-			return nil, err
-		}
+// Return a page of sessions of given user matching given query, sessions are sorted by created date only
+func SelectUserSession(ctx context.Context, repo Repository, userId int, query ListQuery) ([]UserSession, ListPage, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	userSessions, total, err := repo.SelectUserSession(ctx, userId, query.fetchQuery())
+	if err != nil || len(userSessions) <= query.Limit {
+		return userSessions, ListPage{Total: total}, err
 	}
-	return userSession, nil
+	last := userSessions[query.Limit-1]
+	page := query.returnNextPage(total, ListCursor{Created: last.Created, Id: last.Id})
+	return userSessions[:query.Limit], page, nil
 }
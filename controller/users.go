@@ -1,7 +1,7 @@
 package controller
 
 import (
-	"repgen/core"
+	"context"
 	"time"
 )
 
@@ -15,66 +15,49 @@ type User struct {
 
 const (
 	UserEmailMaxLength    = 100
-	UserPasswordMaxLength = 20
+	UserPasswordMaxLength = 1024
 	UserNameMaxLength     = 100
 )
 
-func CreateUser(user *User) error {
-	rows, err := core.Database.Query("INSERT INTO users (email, password, name, created) VALUES($1, $2, $3, $4) RETURNING id",
-		user.Email, user.Password, user.Name, user.Created)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		err := rows.Scan(&user.Id)
-		if err != nil {
-			return err
-		}
+func CreateUser(ctx context.Context, repo Repository, user *User) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.CreateUser(ctx, user)
+}
 
-	}
-	return nil
+func UpdateUser(ctx context.Context, repo Repository, user User) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateUser(ctx, user)
 }
 
-func UpdateUser(user User) (int64, error) {
-	result, err := core.Database.Exec("UPDATE users SET name = $1 WHERE id = $2", user.Name, user.Id)
-	if err != nil {
-		return 0, err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return rows, nil
+func UpdateUserPassword(ctx context.Context, repo Repository, user User) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.UpdateUserPassword(ctx, user)
 }
 
-func UpdateUserPassword(user User) (int64, error) {
-	result, err := core.Database.Exec("UPDATE users SET password = $1 WHERE id = $2", user.Password, user.Id)
-	if err != nil {
-		return 0, err
-	}
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return rows, nil
+func GetUser(ctx context.Context, repo Repository, id int) (*User, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetUser(ctx, id)
 }
 
-func GetUserByEmail(email string) (*User, error) {
-	rows, err := core.Database.Query("SELECT id, email, password, name, created FROM users WHERE email = $1", email)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func GetUserByEmail(ctx context.Context, repo Repository, email string) (*User, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return repo.GetUserByEmail(ctx, email)
+}
 
-	var user *User
-	for rows.Next() {
-		user = &User{}
-		err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Name, &user.Created)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return user, nil
+// Return a page of users matching given query, search matches the name or the email
+func SelectUser(ctx context.Context, repo Repository, query ListQuery) ([]User, ListPage, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	users, total, err := repo.SelectUser(ctx, query.fetchQuery())
+	if err != nil || len(users) <= query.Limit {
+		return users, ListPage{Total: total}, err
+	}
+	last := users[query.Limit-1]
+	page := query.returnNextPage(total, ListCursor{Name: last.Name, Created: last.Created, Id: last.Id})
+	return users[:query.Limit], page, nil
 }
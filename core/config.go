@@ -17,6 +17,124 @@ type ConfigBase struct {
 		Host string `yaml:"host"`
 		Port string `yaml:"port"`
 	} `yaml:"server"`
+	// Storage backend config
+	Storage struct {
+		// postgresql or memory
+		Driver string `yaml:"driver"`
+		// Timeout of a single query in milliseconds, 0 disables it
+		QueryTimeout int `yaml:"query_timeout_ms"`
+		// Report data layout of PostgreSQL: table, long or partitioned
+		ReportDataLayout string `yaml:"report_data_layout"`
+	} `yaml:"storage"`
+	// Report data retention config
+	Retention struct {
+		// Days to keep report data if neither report nor project defines it, 0 keeps forever
+		DefaultDays int `yaml:"default_days"`
+		// Minutes between retention job runs, 0 disables the job
+		JobInterval int `yaml:"job_interval_minutes"`
+		// Maximum number of rows removed at once
+		BatchSize int `yaml:"batch_size"`
+		// delete or archive
+		Action string `yaml:"action"`
+		// Directory of archived rows
+		ArchiveDirectory string `yaml:"archive_dir"`
+		// Days to keep raw submission log, 0 keeps forever
+		SubmissionDays int `yaml:"submission_days"`
+	} `yaml:"retention"`
+	// Report token config
+	Token struct {
+		// Minutes the previous report token keeps working after rotation, 0 invalidates it at once
+		RotationGrace int `yaml:"rotation_grace_minutes"`
+	} `yaml:"token"`
+	// Rate limit config, zero limits are disabled
+	RateLimit struct {
+		// memory keeps counters in process, shared keeps them in PostgreSQL for multiple instances
+		Store string `yaml:"store"`
+		// Seconds of a rate limit window
+		WindowSeconds int `yaml:"window_seconds"`
+		// Login attempts per window of an IP and of an email
+		LoginIp    int `yaml:"login_ip"`
+		LoginEmail int `yaml:"login_email"`
+		// Submits per window of an IP and of a report token
+		SubmitIp    int `yaml:"submit_ip"`
+		SubmitToken int `yaml:"submit_token"`
+		// Failed logins which lock an email for the lockout minutes after the last failure
+		LockoutFailures int `yaml:"lockout_failures"`
+		LockoutMinutes  int `yaml:"lockout_minutes"`
+	} `yaml:"rate_limit"`
+	// Password policy and hashing config
+	Password struct {
+		// Length limits of new passwords, zero values fall back to the defaults
+		MinLength int `yaml:"min_length"`
+		MaxLength int `yaml:"max_length"`
+		// File of breached passwords, one per line, which cannot be used as new passwords
+		BreachedList string `yaml:"breached_list"`
+		// Minutes a password reset token is valid
+		ResetMinutes int `yaml:"reset_minutes"`
+		// Link sent in password reset emails, {token} is replaced with the reset token
+		ResetUrl string `yaml:"reset_url"`
+		// Argon2 parameters of new hashes, passwords hashed with other parameters are hashed again on login
+		Argon2 struct {
+			Memory      uint32 `yaml:"memory_kb"`
+			Iterations  uint32 `yaml:"iterations"`
+			Parallelism uint8  `yaml:"parallelism"`
+			SaltLength  uint32 `yaml:"salt_length"`
+			KeyLength   uint32 `yaml:"key_length"`
+		} `yaml:"argon2"`
+	} `yaml:"password"`
+	// Two-factor authentication config
+	Mfa struct {
+		// Issuer shown by authenticator apps
+		Issuer string `yaml:"issuer"`
+		// Emails of users who are able to reset MFA of other users
+		AdminEmails []string `yaml:"admin_emails"`
+	} `yaml:"mfa"`
+	// OpenID Connect single sign-on config, empty issuer disables it
+	Oidc struct {
+		Issuer       string `yaml:"issuer"`
+		ClientId     string `yaml:"client_id"`
+		ClientSecret string `yaml:"client_secret"`
+		// Callback url registered at the identity provider e.g. http://127.0.0.1:8080/api/v1/login/oidc/callback
+		RedirectUrl string   `yaml:"redirect_url"`
+		Scopes      []string `yaml:"scopes"`
+		// Claim of the group names of the user
+		GroupsClaim string `yaml:"groups_claim"`
+		// Create a user on first login if no user has the verified email
+		AutoCreate bool `yaml:"auto_create"`
+		// Page the browser is redirected to after login, a JSON response is sent if empty
+		SuccessUrl string `yaml:"success_url"`
+		// Project roles given to the members of the groups
+		GroupRoles []struct {
+			Group     string `yaml:"group"`
+			ProjectId int    `yaml:"project_id"`
+			Role      string `yaml:"role"`
+		} `yaml:"group_roles"`
+	} `yaml:"oidc"`
+	// CSRF protection of requests authenticated by the session cookie
+	Csrf struct {
+		// Disable the check e.g. if every client sends a bearer token
+		Disabled bool `yaml:"disabled"`
+		// Paths which are not checked in addition to /submit, a trailing slash matches every path under it
+		ExemptPaths []string `yaml:"exempt_paths"`
+	} `yaml:"csrf"`
+	// CORS config of browser clients on other origins, empty allowed origins disables CORS
+	Cors struct {
+		// Origins e.g. https://app.example.com, * allows every origin
+		AllowedOrigins   []string `yaml:"allowed_origins"`
+		AllowedMethods   []string `yaml:"allowed_methods"`
+		AllowedHeaders   []string `yaml:"allowed_headers"`
+		AllowCredentials bool     `yaml:"allow_credentials"`
+		// Seconds browsers cache a preflight response
+		MaxAge int `yaml:"max_age_seconds"`
+	} `yaml:"cors"`
+	// SMTP config of outgoing emails, emails are logged if host is empty
+	Mail struct {
+		Host     string `yaml:"host"`
+		Port     string `yaml:"port"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		From     string `yaml:"from"`
+	} `yaml:"mail"`
 	// PostgreSQL database config
 	Postgresql struct {
 		Host               string `yaml:"host"`
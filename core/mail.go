@@ -0,0 +1,27 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Send a plain text email with respect to mail config, the email is logged instead if no SMTP host is configured
+func SendMail(to string, subject string, body string) error {
+	if Config == nil || len(Config.Mail.Host) == 0 {
+		log.Printf("{SendMail} To: %s Subject: %s\n%s\n", to, subject, body)
+		return nil
+	}
+	// Header values must not contain line breaks
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", Config.Mail.From, to, subject, body)
+	var auth smtp.Auth
+	if len(Config.Mail.Username) > 0 {
+		auth = smtp.PlainAuth("", Config.Mail.Username, Config.Mail.Password, Config.Mail.Host)
+	}
+	return smtp.SendMail(Config.Mail.Host+":"+Config.Mail.Port, auth, Config.Mail.From, []string{to}, []byte(message))
+}
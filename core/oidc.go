@@ -0,0 +1,287 @@
+package core
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"repgen/security"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoints of an OpenID Connect provider from its discovery document
+type OidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+	// Signing keys of the provider by their kid
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// Verified claims of an ID token
+type OidcClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+const (
+	OidcDefaultGroupsClaim = "groups"
+	// Allowed clock difference with the provider
+	oidcClockSkew = time.Minute
+	// Signing keys are fetched again at most once in this duration when an unknown kid is seen
+	oidcKeysRefreshInterval = time.Minute
+	oidcResponseMaxLength   = 1 << 20
+)
+
+var ErrOidcDisabled = errors.New("oidc is not configured")
+
+var oidcHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+var oidcProvider struct {
+	sync.Mutex
+	provider *OidcProvider
+}
+
+// Return true if single sign-on is configured
+func IsOidcEnabled() bool {
+	return Config != nil && len(Config.Oidc.Issuer) > 0
+}
+
+// Return the configured provider, its discovery document is fetched on first use
+func ReturnOidcProvider(ctx context.Context) (*OidcProvider, error) {
+	if !IsOidcEnabled() {
+		return nil, ErrOidcDisabled
+	}
+	oidcProvider.Lock()
+	defer oidcProvider.Unlock()
+	if oidcProvider.provider != nil {
+		return oidcProvider.provider, nil
+	}
+	issuer := strings.TrimSuffix(Config.Oidc.Issuer, "/")
+	provider := &OidcProvider{}
+	err := oidcGetJson(ctx, issuer+"/.well-known/openid-configuration", provider)
+	if err != nil {
+		return nil, err
+	}
+	// Issuer of the document must be the configured one, otherwise tokens of another issuer could be accepted
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch: %s", provider.Issuer)
+	}
+	if len(provider.AuthorizationEndpoint) == 0 || len(provider.TokenEndpoint) == 0 || len(provider.JwksUri) == 0 {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+	oidcProvider.provider = provider
+	return provider, nil
+}
+
+// Return authorization url which the browser is redirected to
+func (p *OidcProvider) ReturnAuthUrl(state string, nonce string, codeChallenge string) string {
+	scopes := Config.Oidc.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", Config.Oidc.ClientId)
+	values.Set("redirect_uri", Config.Oidc.RedirectUrl)
+	values.Set("scope", strings.Join(scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", codeChallenge)
+	values.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + values.Encode()
+}
+
+// Exchange given authorization code and PKCE code verifier for an ID token
+func (p *OidcProvider) ExchangeCode(ctx context.Context, code string, codeVerifier string) (string, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", Config.Oidc.RedirectUrl)
+	values.Set("code_verifier", codeVerifier)
+	values.Set("client_id", Config.Oidc.ClientId)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if len(Config.Oidc.ClientSecret) > 0 {
+		request.SetBasicAuth(url.QueryEscape(Config.Oidc.ClientId), url.QueryEscape(Config.Oidc.ClientSecret))
+	}
+	response, err := oidcHttpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	var tokenResponse struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(response.Body, oidcResponseMaxLength)).Decode(&tokenResponse)
+	if err != nil {
+		return "", fmt.Errorf("oidc token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK || len(tokenResponse.Error) > 0 {
+		return "", fmt.Errorf("oidc token request failed: %d %s %s", response.StatusCode, tokenResponse.Error,
+			tokenResponse.ErrorDescription)
+	}
+	if len(tokenResponse.IdToken) == 0 {
+		return "", errors.New("oidc token response has no id_token")
+	}
+	return tokenResponse.IdToken, nil
+}
+
+// Verify signature and claims of given ID token against the nonce of the login
+func (p *OidcProvider) VerifyIdToken(ctx context.Context, idToken string, nonce string, now time.Time) (*OidcClaims, error) {
+	claims := map[string]interface{}{}
+	keys, err := p.returnKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	err = security.VerifyJwt(idToken, keys, &claims)
+	if errors.Is(err, security.ErrUnknownJwtKey) {
+		// Provider may have rotated its keys
+		keys, err = p.returnKeys(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		err = security.VerifyJwt(idToken, keys, &claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// <iss>
+	issuer, _ := claims["iss"].(string)
+	if strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, errors.New("id token issuer mismatch")
+	}
+	// <aud> may be a string or an array, azp is required to be the client if there are other audiences
+	audiences := oidcStringList(claims["aud"])
+	if !oidcContains(audiences, Config.Oidc.ClientId) {
+		return nil, errors.New("id token audience mismatch")
+	}
+	if azp, ok := claims["azp"].(string); (ok || len(audiences) > 1) && azp != Config.Oidc.ClientId {
+		return nil, errors.New("id token authorized party mismatch")
+	}
+	// <exp>
+	expires, ok := claims["exp"].(float64)
+	if !ok || now.Add(-oidcClockSkew).After(time.Unix(int64(expires), 0)) {
+		return nil, errors.New("id token is expired")
+	}
+	// <nonce> binds the token to the login of this browser
+	if tokenNonce, _ := claims["nonce"].(string); len(nonce) == 0 || tokenNonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	oidcClaims := &OidcClaims{}
+	oidcClaims.Subject, _ = claims["sub"].(string)
+	oidcClaims.Email, _ = claims["email"].(string)
+	oidcClaims.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		oidcClaims.EmailVerified = verified
+	case string:
+		oidcClaims.EmailVerified = verified == "true"
+	}
+	groupsClaim := Config.Oidc.GroupsClaim
+	if len(groupsClaim) == 0 {
+		groupsClaim = OidcDefaultGroupsClaim
+	}
+	oidcClaims.Groups = oidcStringList(claims[groupsClaim])
+	if len(oidcClaims.Subject) == 0 {
+		return nil, errors.New("id token has no subject")
+	}
+	return oidcClaims, nil
+}
+
+// Return signing keys of the provider, they are fetched again if refresh is requested
+func (p *OidcProvider) returnKeys(ctx context.Context, refresh bool) (map[string]*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil && (!refresh || time.Since(p.keysFetched) < oidcKeysRefreshInterval) {
+		return p.keys, nil
+	}
+	var jwks struct {
+		Keys []security.Jwk `json:"keys"`
+	}
+	err := oidcGetJson(ctx, p.JwksUri, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (len(jwk.Use) > 0 && jwk.Use != "sig") {
+			continue
+		}
+		key, err := security.ParseRsaJwk(jwk)
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return keys, nil
+}
+
+// Fetch given url and decode its JSON body into given value
+func oidcGetJson(ctx context.Context, rawUrl string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := oidcHttpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc request failed: %s %d", rawUrl, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, oidcResponseMaxLength)).Decode(value)
+}
+
+// Return string values of a claim which may be a string or an array
+func oidcStringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func oidcContains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,35 +1,96 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"repgen/api"
+	"repgen/controller"
 	"repgen/core"
+	"repgen/web"
+	// Report time zones do not depend on the zoneinfo of the host
+	_ "time/tzdata"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
 func main() {
+	migrateReportData := flag.Bool("migrate-report-data", false,
+		"Move per report data tables into the configured report data layout and exit")
+	dropMigratedTables := flag.Bool("drop-migrated-tables", false,
+		"Drop per report data tables after their rows are migrated")
+	openApiWrite := flag.String("openapi-write", "",
+		"Write the OpenAPI document of the handlers to given file and exit")
+	openApiCheck := flag.String("openapi-check", "",
+		"Compare given OpenAPI document with the handlers and exit, fails if they differ")
+	flag.Parse()
+	// OpenAPI document does not need config
+	if len(*openApiWrite) > 0 {
+		writeOpenApi(*openApiWrite)
+		return
+	}
+	if len(*openApiCheck) > 0 {
+		checkOpenApi(*openApiCheck)
+		return
+	}
 	// Initialize config file
 	core.InitializeConfig()
-	// Initialize database
-	core.InitializeDatabase()
+	// Initialize storage
+	controller.InitializeStorage()
+	// Report data migration
+	if *migrateReportData {
+		err := controller.MigrateReportData(context.Background(), *dropMigratedTables)
+		if err != nil {
+			log.Fatalf("Report data migration is failed: %s", err.Error())
+		}
+		log.Println("Report data migration is completed.")
+		return
+	}
+	// Initialize rate limits
+	controller.InitializeRateLimit()
+	// Initialize password policy
+	controller.InitializePasswordPolicy()
+	// Start background jobs
+	controller.StartRetentionJob(context.Background())
 	// Start server
-	mux := http.NewServeMux()
-	mux.HandleFunc("/login", api.LoginHandler)
-	mux.HandleFunc("/logout", api.LogoutHandler)
-	mux.HandleFunc("/logout/all", api.LogoutAllHandler)
-	mux.HandleFunc("/user/create", api.UserCreateHandler)
-	mux.HandleFunc("/user/edit", api.UserEditHandler)
-	mux.HandleFunc("/user/password", api.UserChangePasswordHandler)
-	mux.HandleFunc("/project/create", api.ProjectCreateHandler)
-	mux.HandleFunc("/project/edit", api.ProjectEditHandler)
-	mux.HandleFunc("/project/", api.ProjectSelectHandler)
-	mux.HandleFunc("/report/create", api.ReportCreateHandler)
-	mux.HandleFunc("/report/refresh", api.ReportRefreshTokenHandler)
-	mux.HandleFunc("/report/", api.ReportSelectHandler)
-	mux.HandleFunc("/submit", api.SubmitReportHandler)
+	router := web.NewRouter()
+	router.Use(web.LogMiddleware, web.RecoverMiddleware)
+	api.RegisterRoutes(router)
+
+	// CORS answers preflight requests before the CSRF check
+	handler := web.CorsMiddleware(web.CsrfMiddleware(router))
 
 	log.Println("Listening...")
-	http.ListenAndServe(":80", mux)
+	http.ListenAndServe(":80", handler)
+}
+
+func writeOpenApi(path string) {
+	document, err := api.ReturnOpenApi()
+	if err != nil {
+		log.Fatalf("OpenAPI document is failed: %s", err.Error())
+	}
+	err = os.WriteFile(path, document, 0644)
+	if err != nil {
+		log.Fatalf("OpenAPI document is failed: %s", err.Error())
+	}
+}
+
+func checkOpenApi(path string) {
+	document, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("OpenAPI check is failed: %s", err.Error())
+	}
+	differences, err := api.CompareOpenApi(document)
+	if err != nil {
+		log.Fatalf("OpenAPI check is failed: %s", err.Error())
+	}
+	for _, difference := range differences {
+		log.Println(difference)
+	}
+	if len(differences) > 0 {
+		log.Fatalf("%s differs from the handlers, write it again by -openapi-write", path)
+	}
+	log.Printf("%s matches the handlers.", path)
 }
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -26,6 +27,28 @@ var p = &params{
 	saltLength:  16,
 	keyLength:   32,
 }
+
+// Set argon2 parameters of new hashes, zero values keep the current ones
+func SetHashParams(memory uint32, iterations uint32, parallelism uint8, saltLength uint32, keyLength uint32) {
+	next := *p
+	if memory > 0 {
+		next.memory = memory
+	}
+	if iterations > 0 {
+		next.iterations = iterations
+	}
+	if parallelism > 0 {
+		next.parallelism = parallelism
+	}
+	if saltLength > 0 {
+		next.saltLength = saltLength
+	}
+	if keyLength > 0 {
+		next.keyLength = keyLength
+	}
+	p = &next
+}
+
 var ErrInvalidHash = errors.New("the encoded hash is not in the correct format")
 var ErrIncompatibleVersion = errors.New("incompatible version of argon2")
 
@@ -63,6 +86,32 @@ func GenerateHashFromPassword(password string) (encodedHash string, err error) {
 	return encodedHash, nil
 }
 
+// Hash of a random password with the current parameters, see ReturnDummyHash
+var dummyHash struct {
+	sync.Mutex
+	params *params
+	hash   string
+}
+
+// Return hash of a random password with the current parameters, logins of unknown emails are compared with it
+// so they take as long as the logins of registered emails
+func ReturnDummyHash() (string, error) {
+	dummyHash.Lock()
+	defer dummyHash.Unlock()
+	if dummyHash.params != p {
+		password, err := generateRandomBytes(p.keyLength)
+		if err != nil {
+			return "", err
+		}
+		hash, err := GenerateHashFromPassword(string(password))
+		if err != nil {
+			return "", err
+		}
+		dummyHash.params, dummyHash.hash = p, hash
+	}
+	return dummyHash.hash, nil
+}
+
 // Decode given hash string and return values
 func decodeHash(encodedHash string) (p *params, salt, hash []byte, err error) {
 	values := strings.Split(encodedHash, "$")
@@ -119,3 +168,13 @@ func ComparePasswordAndHash(password, encodedHash string) (match bool, err error
 	}
 	return false, nil
 }
+
+// Return true if given encoded hash is generated with parameters other than the current ones,
+// so the password should be hashed again once it is known
+func NeedsRehash(encodedHash string) (bool, error) {
+	hashParams, _, _, err := decodeHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	return *hashParams != *p, nil
+}
@@ -0,0 +1,130 @@
+package security
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// JSON web key of a JWKS document, only RSA keys are used
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ,omitempty"`
+}
+
+const JwtAlgorithmRs256 = "RS256"
+
+var ErrInvalidJwt = errors.New("the jwt is not in the correct format")
+var ErrInvalidJwtSignature = errors.New("the jwt signature is not valid")
+var ErrUnknownJwtKey = errors.New("the jwt is signed by an unknown key")
+
+// Return RSA public key of given JWK
+func ParseRsaJwk(jwk Jwk) (*rsa.PublicKey, error) {
+	if jwk.Kty != "RSA" {
+		return nil, errors.New("the jwk is not an rsa key")
+	}
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("the jwk exponent is too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// Return JWK of given RSA public key
+func ReturnRsaJwk(kid string, key *rsa.PublicKey) Jwk {
+	return Jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: JwtAlgorithmRs256,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// Verify RS256 signature of given compact JWT with the key of its kid and decode its claims into given value,
+// ErrUnknownJwtKey is returned if the kid is not in given keys e.g. the signer rotated its keys
+func VerifyJwt(token string, keys map[string]*rsa.PublicKey, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidJwt
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidJwt
+	}
+	var header jwtHeader
+	err = json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return ErrInvalidJwt
+	}
+	// Algorithm is fixed so a token cannot choose a weaker one e.g. none
+	if header.Alg != JwtAlgorithmRs256 {
+		return ErrInvalidJwtSignature
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return ErrUnknownJwtKey
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidJwt
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	if err != nil {
+		return ErrInvalidJwtSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidJwt
+	}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return ErrInvalidJwt
+	}
+	return nil
+}
+
+// Return a compact JWT of given claims signed with RS256
+func SignJwt(claims interface{}, kid string, key *rsa.PrivateKey) (string, error) {
+	headerBytes, err := json.Marshal(jwtHeader{Alg: JwtAlgorithmRs256, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
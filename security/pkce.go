@@ -0,0 +1,24 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Random bytes of a PKCE code verifier, encoded to 43 characters
+const PkceVerifierLength = 32
+
+// Generate a PKCE code verifier of RFC 7636
+func GenerateCodeVerifier() (string, error) {
+	randomBytes, err := generateRandomBytes(PkceVerifierLength)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// Return S256 code challenge of given code verifier
+func ReturnCodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
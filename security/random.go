@@ -2,6 +2,7 @@ package security
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -15,3 +16,9 @@ func GenerateRandomHex(length int) (string, error) {
 	}
 	return hex.EncodeToString(randomBytes), nil
 }
+
+// Return hex encoded SHA-256 of given token, tokens are random so a fast hash is enough to store them
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
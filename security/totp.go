@@ -0,0 +1,118 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters of RFC 6238, authenticator apps use these defaults
+const (
+	TotpSecretLength = 20
+	TotpDigits       = 6
+	TotpPeriod       = 30
+	// Accepted time steps before and after the current one to tolerate clock drift
+	TotpSkew = 1
+)
+
+var ErrInvalidTotpSecret = errors.New("the totp secret is not valid base32")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generate a base32 encoded random TOTP secret
+func GenerateTotpSecret() (string, error) {
+	randomBytes, err := generateRandomBytes(TotpSecretLength)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(randomBytes), nil
+}
+
+// Return otpauth URI of given secret, authenticator apps enroll it from a QR code of the URI
+func ReturnTotpUri(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(TotpDigits))
+	values.Set("period", fmt.Sprint(TotpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Return time step of given time
+func ReturnTotpCounter(now time.Time) int64 {
+	return now.Unix() / TotpPeriod
+}
+
+// Return TOTP code of given secret at given time step
+func ReturnTotpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", ErrInvalidTotpSecret
+	}
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < TotpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TotpDigits, value%modulo), nil
+}
+
+// Validate given code at given time and return its time step,
+// codes of time steps up to the last accepted one are rejected so a code is used once
+func ValidateTotpCode(secret string, code string, now time.Time, lastCounter int64) (int64, bool, error) {
+	if len(code) != TotpDigits {
+		return 0, false, nil
+	}
+	current := ReturnTotpCounter(now)
+	for counter := current - TotpSkew; counter <= current+TotpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := ReturnTotpCode(secret, counter)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// Generate a recovery code of given byte length, grouped by 4 characters e.g. 1a2b-3c4d-5e6f-7a8b
+func GenerateRecoveryCode(length int) (string, error) {
+	randomBytes, err := generateRandomBytes(uint32(length))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%x", randomBytes)
+	groups := make([]string, 0, len(code)/4+1)
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	groups = append(groups, code)
+	return strings.Join(groups, "-"), nil
+}
+
+// Return recovery code without separators and in lower case, so it is hashed the same however it is typed
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
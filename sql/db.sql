@@ -1,3 +1,7 @@
+-- Trigram indexes of list searches
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+
 CREATE TABLE public.users (
 	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
 	email varchar NOT NULL,
@@ -7,6 +11,7 @@ CREATE TABLE public.users (
 	CONSTRAINT users_pk PRIMARY KEY (id),
 	CONSTRAINT users_un UNIQUE (email)
 );
+CREATE INDEX users_search_idx ON public.users USING gin (lower("name") gin_trgm_ops, lower(email) gin_trgm_ops);
 
 
 CREATE TABLE public.user_sessions (
@@ -20,15 +25,95 @@ CREATE TABLE public.user_sessions (
 );
 
 
+-- Password reset tokens, only SHA-256 of the tokens is stored
+CREATE TABLE public.password_reset (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT password_reset_pk PRIMARY KEY (id),
+	CONSTRAINT password_reset_un UNIQUE (hash),
+	CONSTRAINT password_reset_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+-- TOTP two-factor authentication, recovery codes and pending logins store SHA-256 of the codes
+CREATE TABLE public.user_mfa (
+	user_id integer NOT NULL,
+	secret varchar NOT NULL,
+	enabled boolean NOT NULL DEFAULT false,
+	last_counter bigint NOT NULL DEFAULT 0,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT user_mfa_pk PRIMARY KEY (user_id),
+	CONSTRAINT user_mfa_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+CREATE TABLE public.recovery_code (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT recovery_code_pk PRIMARY KEY (id),
+	CONSTRAINT recovery_code_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX recovery_code_user_id_idx ON public.recovery_code (user_id);
+
+
+CREATE TABLE public.mfa_challenge (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	created timestamp without time zone NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	CONSTRAINT mfa_challenge_pk PRIMARY KEY (id),
+	CONSTRAINT mfa_challenge_un UNIQUE (hash),
+	CONSTRAINT mfa_challenge_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+-- Identity provider accounts of single sign-on users
+CREATE TABLE public.user_identity (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	issuer varchar NOT NULL,
+	subject varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT user_identity_pk PRIMARY KEY (id),
+	CONSTRAINT user_identity_un UNIQUE (issuer, subject),
+	CONSTRAINT user_identity_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
 CREATE TABLE public.project (
 	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
 	name varchar NOT NULL,
 	created timestamp without time zone NOT NULL,
 	created_user_id int NOT NULL,
+	retention_days int NULL,
+	archived timestamp without time zone NULL,
+	time_zone varchar NOT NULL DEFAULT 'UTC',
 	CONSTRAINT project_pk PRIMARY KEY (id),
 	CONSTRAINT project_un UNIQUE (name),
 	CONSTRAINT project_fk FOREIGN KEY (created_user_id) REFERENCES public.users(id)
 );
+CREATE INDEX project_name_idx ON public.project (lower("name"), id);
+CREATE INDEX project_search_idx ON public.project USING gin (lower("name") gin_trgm_ops);
+
+
+-- Project roles given by group claims of single sign-on
+CREATE TABLE public.project_role (
+	project_id integer NOT NULL,
+	user_id integer NOT NULL,
+	role varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT project_role_pk PRIMARY KEY (project_id, user_id),
+	CONSTRAINT project_role_fk FOREIGN KEY (project_id) REFERENCES public.project(id) ON DELETE CASCADE,
+	CONSTRAINT project_role_fk_1 FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX project_role_user_id_idx ON public.project_role (user_id);
 
 
 CREATE TABLE public.report (
@@ -36,16 +121,42 @@ CREATE TABLE public.report (
 	project_id int NOT NULL,
 	"name" varchar NOT NULL,
 	"interval" int NOT NULL,
-	token varchar NOT NULL,
 	description varchar NULL,
 	created timestamp without time zone NOT NULL,
 	created_user_id int NOT NULL,
+	retention_days int NULL,
+	rollup_report_id int NULL,
+	rollup_function varchar NOT NULL DEFAULT '',
+	archived timestamp without time zone NULL,
+	submit_mode varchar NOT NULL DEFAULT 'merge',
+	time_zone varchar NOT NULL DEFAULT 'UTC',
+	week_start int NOT NULL DEFAULT 1,
 	CONSTRAINT report_pk PRIMARY KEY (id),
 	CONSTRAINT report_fk FOREIGN KEY (project_id) REFERENCES public.project(id),
-	CONSTRAINT report_fk_1 FOREIGN KEY (created_user_id) REFERENCES public.users(id)
+	CONSTRAINT report_fk_1 FOREIGN KEY (created_user_id) REFERENCES public.users(id),
+	CONSTRAINT report_fk_2 FOREIGN KEY (rollup_report_id) REFERENCES public.report(id)
 );
-CREATE INDEX report_name_idx ON public.report ("name");
-CREATE UNIQUE INDEX report_token_idx ON public.report (token);
+CREATE INDEX report_name_idx ON public.report (project_id, lower("name"), id);
+CREATE INDEX report_search_idx ON public.report USING gin (lower("name") gin_trgm_ops);
+
+
+-- Submit tokens of reports, only SHA-256 of the tokens is stored
+CREATE TABLE public.report_token (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	report_id int NOT NULL,
+	hash varchar NOT NULL,
+	hint varchar NOT NULL,
+	"label" varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	created_user_id int NOT NULL,
+	last_used timestamp without time zone NULL,
+	expires timestamp without time zone NULL,
+	CONSTRAINT report_token_pk PRIMARY KEY (id),
+	CONSTRAINT report_token_un UNIQUE (hash),
+	CONSTRAINT report_token_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_token_fk_1 FOREIGN KEY (created_user_id) REFERENCES public.users(id)
+);
+CREATE INDEX report_token_report_idx ON public.report_token (report_id);
 
 
 CREATE TABLE public.report_column (
@@ -56,8 +167,133 @@ CREATE TABLE public.report_column (
 	formula varchar NULL DEFAULT NULL,
 	created timestamp without time zone NOT NULL,
 	created_user_id int NOT NULL,
+	enum_values jsonb NULL,
+	decimal_precision int NOT NULL DEFAULT 0,
+	decimal_scale int NOT NULL DEFAULT 0,
+	required boolean NOT NULL DEFAULT false,
+	min_value float NULL,
+	max_value float NULL,
+	max_length int NOT NULL DEFAULT 0,
+	pattern varchar NOT NULL DEFAULT '',
+	unit varchar NOT NULL DEFAULT '',
+	decimals int NULL,
+	dimension boolean NOT NULL DEFAULT false,
 	CONSTRAINT report_column_pk PRIMARY KEY (id),
 	CONSTRAINT report_column_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
 	CONSTRAINT report_column_fk_1 FOREIGN KEY (created_user_id) REFERENCES public.users(id)
 );
 CREATE INDEX report_column_name_idx ON public.report_column ("name");
+
+
+CREATE TABLE public.audit_log (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id int NOT NULL,
+	"action" varchar NOT NULL,
+	entity varchar NOT NULL,
+	entity_id int NOT NULL,
+	detail varchar NOT NULL DEFAULT '',
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT audit_log_pk PRIMARY KEY (id),
+	CONSTRAINT audit_log_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX audit_log_entity_idx ON public.audit_log (entity, entity_id);
+
+
+-- Read only tokens of projects and reports
+CREATE TABLE public.share_token (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	hash varchar NOT NULL,
+	entity varchar NOT NULL,
+	entity_id int NOT NULL,
+	expires timestamp without time zone NULL,
+	created timestamp without time zone NOT NULL,
+	created_user_id int NOT NULL,
+	CONSTRAINT share_token_pk PRIMARY KEY (id),
+	CONSTRAINT share_token_un UNIQUE (hash),
+	CONSTRAINT share_token_entity_un UNIQUE (entity, entity_id),
+	CONSTRAINT share_token_fk FOREIGN KEY (created_user_id) REFERENCES public.users(id)
+);
+
+
+-- Hit counters of rate limits shared by every instance
+CREATE TABLE public.rate_limit (
+	"key" varchar NOT NULL,
+	window_start timestamp without time zone NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	hits int NOT NULL,
+	CONSTRAINT rate_limit_pk PRIMARY KEY ("key")
+);
+CREATE INDEX rate_limit_expires_idx ON public.rate_limit (expires);
+
+
+-- Append only log of raw /submit payloads
+CREATE TABLE public.submission_log (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	report_id int NULL,
+	replay_id int NULL,
+	body varchar NOT NULL,
+	remote_addr varchar NOT NULL,
+	received timestamp without time zone NOT NULL,
+	status int NOT NULL,
+	message varchar NOT NULL,
+	CONSTRAINT submission_log_pk PRIMARY KEY (id),
+	CONSTRAINT submission_log_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
+CREATE INDEX submission_log_report_idx ON public.submission_log (report_id, id);
+CREATE INDEX submission_log_received_idx ON public.submission_log (received);
+
+
+-- Report data in long layout (storage.report_data_layout: long)
+CREATE TABLE public.report_value (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	column_id int NOT NULL,
+	sent_date timestamp without time zone NOT NULL,
+	value_str varchar NULL,
+	value_int int NULL,
+	value_float float NULL,
+	value_bool boolean NULL,
+	value_time timestamp without time zone NULL,
+	value_decimal numeric NULL,
+	value_json jsonb NULL,
+	CONSTRAINT report_value_pk PRIMARY KEY (report_id, report_date, dimension_key, column_id),
+	CONSTRAINT report_value_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_value_fk_1 FOREIGN KEY (column_id) REFERENCES public.report_column(id)
+);
+-- Row keys of report_value, inserting a key decides whether a row is new
+CREATE TABLE public.report_value_row (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	CONSTRAINT report_value_row_pk PRIMARY KEY (report_id, report_date, dimension_key),
+	CONSTRAINT report_value_row_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
+
+-- Report data in partitioned layout (storage.report_data_layout: partitioned)
+-- Monthly partitions e.g. report_value_partitioned_202610 are created on demand
+CREATE TABLE public.report_value_partitioned (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	column_id int NOT NULL,
+	sent_date timestamp without time zone NOT NULL,
+	value_str varchar NULL,
+	value_int int NULL,
+	value_float float NULL,
+	value_bool boolean NULL,
+	value_time timestamp without time zone NULL,
+	value_decimal numeric NULL,
+	value_json jsonb NULL,
+	CONSTRAINT report_value_partitioned_pk PRIMARY KEY (report_id, report_date, dimension_key, column_id),
+	CONSTRAINT report_value_partitioned_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_value_partitioned_fk_1 FOREIGN KEY (column_id) REFERENCES public.report_column(id)
+) PARTITION BY RANGE (report_date);
+-- Row keys of report_value_partitioned
+CREATE TABLE public.report_value_partitioned_row (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	dimension_key varchar NOT NULL DEFAULT '',
+	CONSTRAINT report_value_partitioned_row_pk PRIMARY KEY (report_id, report_date, dimension_key),
+	CONSTRAINT report_value_partitioned_row_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
@@ -0,0 +1,298 @@
+-- Schema changes for existing installations, run the sections newer than your installation in order
+
+
+-- Long and partitioned report data layouts
+CREATE TABLE public.report_value (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	column_id int NOT NULL,
+	sent_date timestamp without time zone NOT NULL,
+	value_str varchar NULL,
+	value_int int NULL,
+	value_float float NULL,
+	CONSTRAINT report_value_pk PRIMARY KEY (report_id, report_date, column_id),
+	CONSTRAINT report_value_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_value_fk_1 FOREIGN KEY (column_id) REFERENCES public.report_column(id)
+);
+CREATE TABLE public.report_value_partitioned (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	column_id int NOT NULL,
+	sent_date timestamp without time zone NOT NULL,
+	value_str varchar NULL,
+	value_int int NULL,
+	value_float float NULL,
+	CONSTRAINT report_value_partitioned_pk PRIMARY KEY (report_id, report_date, column_id),
+	CONSTRAINT report_value_partitioned_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_value_partitioned_fk_1 FOREIGN KEY (column_id) REFERENCES public.report_column(id)
+) PARTITION BY RANGE (report_date);
+
+
+-- Data retention policies
+ALTER TABLE public.project ADD retention_days int NULL;
+ALTER TABLE public.report ADD retention_days int NULL;
+ALTER TABLE public.report ADD rollup_report_id int NULL;
+ALTER TABLE public.report ADD rollup_function varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report ADD CONSTRAINT report_fk_2 FOREIGN KEY (rollup_report_id) REFERENCES public.report(id);
+
+
+-- Archive and delete
+ALTER TABLE public.project ADD archived timestamp without time zone NULL;
+ALTER TABLE public.report ADD archived timestamp without time zone NULL;
+CREATE TABLE public.audit_log (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id int NOT NULL,
+	"action" varchar NOT NULL,
+	entity varchar NOT NULL,
+	entity_id int NOT NULL,
+	detail varchar NOT NULL DEFAULT '',
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT audit_log_pk PRIMARY KEY (id),
+	CONSTRAINT audit_log_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX audit_log_entity_idx ON public.audit_log (entity, entity_id);
+
+
+-- Boolean, date, timestamp, decimal, enum and json column types
+ALTER TABLE public.report_column ADD enum_values jsonb NULL;
+ALTER TABLE public.report_column ADD decimal_precision int NOT NULL DEFAULT 0;
+ALTER TABLE public.report_column ADD decimal_scale int NOT NULL DEFAULT 0;
+ALTER TABLE public.report_value ADD value_bool boolean NULL;
+ALTER TABLE public.report_value ADD value_time timestamp without time zone NULL;
+ALTER TABLE public.report_value ADD value_decimal numeric NULL;
+ALTER TABLE public.report_value ADD value_json jsonb NULL;
+ALTER TABLE public.report_value_partitioned ADD value_bool boolean NULL;
+ALTER TABLE public.report_value_partitioned ADD value_time timestamp without time zone NULL;
+ALTER TABLE public.report_value_partitioned ADD value_decimal numeric NULL;
+ALTER TABLE public.report_value_partitioned ADD value_json jsonb NULL;
+
+
+-- Column constraints and display metadata
+ALTER TABLE public.report_column ADD required boolean NOT NULL DEFAULT false;
+ALTER TABLE public.report_column ADD min_value float NULL;
+ALTER TABLE public.report_column ADD max_value float NULL;
+ALTER TABLE public.report_column ADD max_length int NOT NULL DEFAULT 0;
+ALTER TABLE public.report_column ADD pattern varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_column ADD unit varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_column ADD decimals int NULL;
+
+
+-- Submit modes
+ALTER TABLE public.report ADD submit_mode varchar NOT NULL DEFAULT 'merge';
+-- Row keys of long layouts, inserting a key decides whether a row is new
+CREATE TABLE public.report_value_row (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	CONSTRAINT report_value_row_pk PRIMARY KEY (report_id, report_date),
+	CONSTRAINT report_value_row_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
+INSERT INTO public.report_value_row (report_id, report_date)
+	SELECT DISTINCT report_id, report_date FROM public.report_value;
+-- Also created on startup by the partitioned layout
+CREATE TABLE IF NOT EXISTS public.report_value_partitioned_row (
+	report_id int NOT NULL,
+	report_date timestamp without time zone NOT NULL,
+	CONSTRAINT report_value_partitioned_row_pk PRIMARY KEY (report_id, report_date),
+	CONSTRAINT report_value_partitioned_row_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
+INSERT INTO public.report_value_partitioned_row (report_id, report_date)
+	SELECT DISTINCT report_id, report_date FROM public.report_value_partitioned
+	ON CONFLICT DO NOTHING;
+
+
+-- Submission log
+CREATE TABLE public.submission_log (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	report_id int NULL,
+	replay_id int NULL,
+	body varchar NOT NULL,
+	remote_addr varchar NOT NULL,
+	received timestamp without time zone NOT NULL,
+	status int NOT NULL,
+	message varchar NOT NULL,
+	CONSTRAINT submission_log_pk PRIMARY KEY (id),
+	CONSTRAINT submission_log_fk FOREIGN KEY (report_id) REFERENCES public.report(id)
+);
+CREATE INDEX submission_log_report_idx ON public.submission_log (report_id, id);
+CREATE INDEX submission_log_received_idx ON public.submission_log (received);
+
+
+-- Dimension columns
+-- Unique report date index of existing zz_report_<id> tables stays valid as they have no dimension column
+ALTER TABLE public.report_column ADD dimension boolean NOT NULL DEFAULT false;
+ALTER TABLE public.report_value ADD dimension_key varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_value DROP CONSTRAINT report_value_pk;
+ALTER TABLE public.report_value ADD CONSTRAINT report_value_pk PRIMARY KEY (report_id, report_date, dimension_key, column_id);
+ALTER TABLE public.report_value_partitioned ADD dimension_key varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_value_partitioned DROP CONSTRAINT report_value_partitioned_pk;
+ALTER TABLE public.report_value_partitioned ADD CONSTRAINT report_value_partitioned_pk
+	PRIMARY KEY (report_id, report_date, dimension_key, column_id);
+ALTER TABLE public.report_value_row ADD dimension_key varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_value_row DROP CONSTRAINT report_value_row_pk;
+ALTER TABLE public.report_value_row ADD CONSTRAINT report_value_row_pk PRIMARY KEY (report_id, report_date, dimension_key);
+ALTER TABLE public.report_value_partitioned_row ADD dimension_key varchar NOT NULL DEFAULT '';
+ALTER TABLE public.report_value_partitioned_row DROP CONSTRAINT report_value_partitioned_row_pk;
+ALTER TABLE public.report_value_partitioned_row ADD CONSTRAINT report_value_partitioned_row_pk
+	PRIMARY KEY (report_id, report_date, dimension_key);
+
+
+-- Time zones
+ALTER TABLE public.project ADD time_zone varchar NOT NULL DEFAULT 'UTC';
+ALTER TABLE public.report ADD time_zone varchar NOT NULL DEFAULT 'UTC';
+
+
+-- Week start
+ALTER TABLE public.report ADD week_start int NOT NULL DEFAULT 1;
+
+
+-- Share tokens
+CREATE TABLE public.share_token (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	token varchar NOT NULL,
+	entity varchar NOT NULL,
+	entity_id int NOT NULL,
+	expires timestamp without time zone NULL,
+	created timestamp without time zone NOT NULL,
+	created_user_id int NOT NULL,
+	CONSTRAINT share_token_pk PRIMARY KEY (id),
+	CONSTRAINT share_token_un UNIQUE (token),
+	CONSTRAINT share_token_entity_un UNIQUE (entity, entity_id),
+	CONSTRAINT share_token_fk FOREIGN KEY (created_user_id) REFERENCES public.users(id)
+);
+
+
+-- Hashed share tokens
+-- Existing plaintext tokens keep working with their hash
+ALTER TABLE public.share_token ADD hash varchar NULL;
+UPDATE public.share_token SET hash = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+ALTER TABLE public.share_token ALTER COLUMN hash SET NOT NULL;
+ALTER TABLE public.share_token DROP CONSTRAINT share_token_un;
+ALTER TABLE public.share_token DROP COLUMN token;
+ALTER TABLE public.share_token ADD CONSTRAINT share_token_un UNIQUE (hash);
+
+
+-- Hashed report tokens
+-- Existing plaintext tokens keep working with their hash
+CREATE TABLE public.report_token (
+	id int NOT NULL GENERATED ALWAYS AS IDENTITY,
+	report_id int NOT NULL,
+	hash varchar NOT NULL,
+	hint varchar NOT NULL,
+	"label" varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	created_user_id int NOT NULL,
+	last_used timestamp without time zone NULL,
+	expires timestamp without time zone NULL,
+	CONSTRAINT report_token_pk PRIMARY KEY (id),
+	CONSTRAINT report_token_un UNIQUE (hash),
+	CONSTRAINT report_token_fk FOREIGN KEY (report_id) REFERENCES public.report(id),
+	CONSTRAINT report_token_fk_1 FOREIGN KEY (created_user_id) REFERENCES public.users(id)
+);
+CREATE INDEX report_token_report_idx ON public.report_token (report_id);
+INSERT INTO public.report_token (report_id, hash, hint, "label", created, created_user_id)
+	SELECT id, encode(sha256(convert_to(token, 'UTF8')), 'hex'), left(token, 8), 'default', created, created_user_id
+	FROM public.report;
+DROP INDEX public.report_token_idx;
+ALTER TABLE public.report DROP COLUMN token;
+
+
+-- Report tokens are redacted in the submission log
+-- Payloads are not parsed, so a data column named token is redacted as well
+UPDATE public.submission_log
+	SET body = regexp_replace(body, '"token"\s*:\s*"([^"\\]|\\.)*"', '"token":"[redacted]"', 'g')
+	WHERE body LIKE '%"token"%';
+
+
+-- Shared rate limits
+CREATE TABLE public.rate_limit (
+	"key" varchar NOT NULL,
+	window_start timestamp without time zone NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	hits int NOT NULL,
+	CONSTRAINT rate_limit_pk PRIMARY KEY ("key")
+);
+CREATE INDEX rate_limit_expires_idx ON public.rate_limit (expires);
+
+
+-- Password resets
+CREATE TABLE public.password_reset (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT password_reset_pk PRIMARY KEY (id),
+	CONSTRAINT password_reset_un UNIQUE (hash),
+	CONSTRAINT password_reset_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+-- Two-factor authentication
+CREATE TABLE public.user_mfa (
+	user_id integer NOT NULL,
+	secret varchar NOT NULL,
+	enabled boolean NOT NULL DEFAULT false,
+	last_counter bigint NOT NULL DEFAULT 0,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT user_mfa_pk PRIMARY KEY (user_id),
+	CONSTRAINT user_mfa_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+CREATE TABLE public.recovery_code (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT recovery_code_pk PRIMARY KEY (id),
+	CONSTRAINT recovery_code_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX recovery_code_user_id_idx ON public.recovery_code (user_id);
+
+
+CREATE TABLE public.mfa_challenge (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	hash varchar NOT NULL,
+	expires timestamp without time zone NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT mfa_challenge_pk PRIMARY KEY (id),
+	CONSTRAINT mfa_challenge_un UNIQUE (hash),
+	CONSTRAINT mfa_challenge_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+
+-- Single sign-on
+CREATE TABLE public.user_identity (
+	id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+	user_id integer NOT NULL,
+	issuer varchar NOT NULL,
+	subject varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT user_identity_pk PRIMARY KEY (id),
+	CONSTRAINT user_identity_un UNIQUE (issuer, subject),
+	CONSTRAINT user_identity_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+CREATE TABLE public.project_role (
+	project_id integer NOT NULL,
+	user_id integer NOT NULL,
+	role varchar NOT NULL,
+	created timestamp without time zone NOT NULL,
+	CONSTRAINT project_role_pk PRIMARY KEY (project_id, user_id),
+	CONSTRAINT project_role_fk FOREIGN KEY (project_id) REFERENCES public.project(id) ON DELETE CASCADE,
+	CONSTRAINT project_role_fk_1 FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+CREATE INDEX project_role_user_id_idx ON public.project_role (user_id);
+
+
+-- Sorted list pages
+CREATE INDEX project_name_idx ON public.project (lower("name"), id);
+DROP INDEX public.report_name_idx;
+CREATE INDEX report_name_idx ON public.report (project_id, lower("name"), id);
+-- Searches match any part of the name
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX users_search_idx ON public.users USING gin (lower("name") gin_trgm_ops, lower(email) gin_trgm_ops);
+CREATE INDEX project_search_idx ON public.project USING gin (lower("name") gin_trgm_ops);
+CREATE INDEX report_search_idx ON public.report USING gin (lower("name") gin_trgm_ops);
@@ -21,7 +21,7 @@ func ParseCookieSessionOptional(r *http.Request) (*controller.UserSession, error
 		return nil, err
 	}
 	// A cookie exists -> Check validity
-	userSession, err := controller.GetUserSession(sessionCookie.Value)
+	userSession, err := controller.GetUserSession(r.Context(), controller.Store, sessionCookie.Value)
 	if err != nil {
 		return nil, err
 	}
@@ -33,18 +33,16 @@ func ParseCookieSession(r *http.Request) (*controller.UserSession, error) {
 	sessionCookie, err := r.Cookie(CookieKeySession)
 	if err != nil || sessionCookie == nil {
 		// Token does not exist inside cookie
-		response := &Response{Status: http.StatusUnauthorized, Message: "Invalid authentication!"}
-		return nil, response
+		return nil, ReturnError(ErrorCodeUnauthenticated, "Invalid authentication!")
 	}
 	// A cookie exists -> Check validity
-	userSession, err := controller.GetUserSession(sessionCookie.Value)
+	userSession, err := controller.GetUserSession(r.Context(), controller.Store, sessionCookie.Value)
 	if err != nil {
 		return nil, err
 	}
 	if userSession == nil {
 		// Token does not exist in database
-		response := &Response{Status: http.StatusUnauthorized, Message: "Invalid authentication!"}
-		return nil, response
+		return nil, ReturnError(ErrorCodeUnauthenticated, "Invalid authentication!")
 	}
 	return userSession, nil
 }
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"repgen/core"
+)
+
+var corsDefaultMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+var corsDefaultHeaders = []string{"Content-Type", HeaderCsrfToken, "Authorization"}
+
+// Add CORS headers for allowed origins and answer their preflight requests
+func CorsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(origin) == 0 || core.Config == nil || len(core.Config.Cors.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == "OPTIONS" && len(r.Header.Get("Access-Control-Request-Method")) > 0
+		allowed, wildcard := isCorsOriginAllowed(origin)
+		if !allowed {
+			if preflight {
+				SendHttpMethod(w, http.StatusForbidden)
+				return
+			}
+			// Browser does not expose the response to the page
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Credentials are never allowed for every origin, any site could read responses of logged in users
+		if wildcard {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if core.Config.Cors.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+HeaderCsrfToken)
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		methods := core.Config.Cors.AllowedMethods
+		if len(methods) == 0 {
+			methods = corsDefaultMethods
+		}
+		headers := core.Config.Cors.AllowedHeaders
+		if len(headers) == 0 {
+			headers = corsDefaultHeaders
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		if core.Config.Cors.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(core.Config.Cors.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Return true if given origin is allowed and whether it is allowed by the * wildcard
+func isCorsOriginAllowed(origin string) (bool, bool) {
+	for _, allowedOrigin := range core.Config.Cors.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowedOrigin, "/"), origin) {
+			return true, false
+		}
+	}
+	for _, allowedOrigin := range core.Config.Cors.AllowedOrigins {
+		if allowedOrigin == "*" {
+			return true, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"repgen/core"
+	"repgen/security"
+)
+
+const CsrfTokenLength = 32
+
+// Double submit cookie which browser clients copy to the CSRF header, other origins cannot read it
+const CookieKeyCsrf = "csrf"
+const HeaderCsrfToken = "X-CSRF-Token"
+
+// Paths authenticated by the request itself instead of the session cookie
+var csrfExemptPaths = []string{ApiPrefix + "/submit", "/submit"}
+
+// Generate a CSRF token and append it to cookie, it is readable by scripts unlike the session cookie. The token is
+// also sent in the CSRF header since a frontend on another origin cannot read the cookie.
+func SetCsrfCookie(w http.ResponseWriter, r *http.Request) (string, error) {
+	token, err := security.GenerateRandomHex(CsrfTokenLength)
+	if err != nil {
+		return "", err
+	}
+	cookie := &http.Cookie{
+		Name:     CookieKeyCsrf,
+		Value:    token,
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, cookie)
+	w.Header().Set(HeaderCsrfToken, token)
+	return token, nil
+}
+
+// Reject state changing requests with a session cookie unless the CSRF header matches the CSRF cookie
+func CsrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (core.Config != nil && core.Config.Csrf.Disabled) || isCsrfExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Requests without a session cookie cannot be forged on behalf of a user
+		if _, err := r.Cookie(CookieKeySession); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		safeMethod := r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS"
+		csrfCookie, err := r.Cookie(CookieKeyCsrf)
+		if err != nil || len(csrfCookie.Value) == 0 {
+			// Sessions created before CSRF protection get their token on the next request
+			_, err = SetCsrfCookie(w, r)
+			if err != nil {
+				log.Printf("{CsrfMiddleware} ERR: %s\n", err.Error())
+				SendHttpMethod(w, http.StatusInternalServerError)
+				return
+			}
+			if !safeMethod {
+				response := ReturnError(ErrorCodeInvalidCsrfToken, "Invalid CSRF token.")
+				SendJsonResponse(w, response, response.Status)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !safeMethod {
+			csrfHeader := r.Header.Get(HeaderCsrfToken)
+			if len(csrfHeader) == 0 || subtle.ConstantTimeCompare([]byte(csrfHeader), []byte(csrfCookie.Value)) != 1 {
+				response := ReturnError(ErrorCodeInvalidCsrfToken, "Invalid CSRF token.")
+				SendJsonResponse(w, response, response.Status)
+				return
+			}
+		}
+		// Frontends on another origin read the token of the session from responses
+		w.Header().Set(HeaderCsrfToken, csrfCookie.Value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Return true if the path is exempt, a bearer token does not exempt a request which also carries the session cookie
+func isCsrfExempt(r *http.Request) bool {
+	paths := csrfExemptPaths
+	if core.Config != nil {
+		paths = append(paths[:len(paths):len(paths)], core.Config.Csrf.ExemptPaths...)
+	}
+	for _, path := range paths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"net/http"
+)
+
+// Stable error codes which clients branch on instead of messages, each code is always sent with the same status
+const (
+	// Request
+	ErrorCodeBadRequest           = "bad_request"
+	ErrorCodeInvalidJson          = "invalid_json"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeBodyTooLarge         = "body_too_large"
+	// Fields of the request, the field is named in the response
+	ErrorCodeFieldRequired    = "field_required"
+	ErrorCodeFieldInvalid     = "field_invalid"
+	ErrorCodeFieldUnknown     = "field_unknown"
+	ErrorCodeFieldTooLong     = "field_too_long"
+	ErrorCodeFieldTooShort    = "field_too_short"
+	ErrorCodeFieldOutOfRange  = "field_out_of_range"
+	ErrorCodeFieldDuplicate   = "field_duplicate"
+	ErrorCodePasswordBreached = "password_breached"
+	ErrorCodeInvalidMfaCode   = "invalid_mfa_code"
+	// Several invalid items, each of them is in the details of the response
+	ErrorCodeValidationFailed = "validation_failed"
+	// Authentication
+	ErrorCodeUnauthenticated    = "unauthenticated"
+	ErrorCodeInvalidCredentials = "invalid_credentials"
+	ErrorCodeInvalidToken       = "invalid_token"
+	ErrorCodeSsoFailed          = "sso_failed"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeInvalidCsrfToken   = "invalid_csrf_token"
+	ErrorCodeRateLimited        = "rate_limited"
+	// Resources
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeAlreadyExists    = "already_exists"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeLimitExceeded    = "limit_exceeded"
+	ErrorCodeArchived         = "archived"
+	ErrorCodeInternal         = "internal_error"
+)
+
+// Map: Error code -> HTTP status
+var errorCodeStatusMap = map[string]int{
+	ErrorCodeBadRequest:           http.StatusBadRequest,
+	ErrorCodeInvalidJson:          http.StatusBadRequest,
+	ErrorCodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	ErrorCodeBodyTooLarge:         http.StatusRequestEntityTooLarge,
+	ErrorCodeFieldRequired:        http.StatusBadRequest,
+	ErrorCodeFieldInvalid:         http.StatusBadRequest,
+	ErrorCodeFieldUnknown:         http.StatusBadRequest,
+	ErrorCodeFieldTooLong:         http.StatusBadRequest,
+	ErrorCodeFieldTooShort:        http.StatusBadRequest,
+	ErrorCodeFieldOutOfRange:      http.StatusBadRequest,
+	ErrorCodeFieldDuplicate:       http.StatusBadRequest,
+	ErrorCodePasswordBreached:     http.StatusBadRequest,
+	ErrorCodeInvalidMfaCode:       http.StatusBadRequest,
+	ErrorCodeValidationFailed:     http.StatusBadRequest,
+	ErrorCodeUnauthenticated:      http.StatusUnauthorized,
+	ErrorCodeInvalidCredentials:   http.StatusUnauthorized,
+	ErrorCodeInvalidToken:         http.StatusUnauthorized,
+	ErrorCodeSsoFailed:            http.StatusUnauthorized,
+	ErrorCodeForbidden:            http.StatusForbidden,
+	ErrorCodeInvalidCsrfToken:     http.StatusForbidden,
+	ErrorCodeRateLimited:          http.StatusTooManyRequests,
+	ErrorCodeNotFound:             http.StatusNotFound,
+	ErrorCodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	ErrorCodeAlreadyExists:        http.StatusConflict,
+	ErrorCodeConflict:             http.StatusConflict,
+	ErrorCodeLimitExceeded:        http.StatusConflict,
+	ErrorCodeArchived:             http.StatusGone,
+	ErrorCodeInternal:             http.StatusInternalServerError,
+}
+
+// Map: HTTP status -> Error code of responses which are sent by status only
+var statusErrorCodeMap = map[int]string{
+	http.StatusBadRequest:            ErrorCodeBadRequest,
+	http.StatusUnauthorized:          ErrorCodeUnauthenticated,
+	http.StatusForbidden:             ErrorCodeForbidden,
+	http.StatusNotFound:              ErrorCodeNotFound,
+	http.StatusMethodNotAllowed:      ErrorCodeMethodNotAllowed,
+	http.StatusConflict:              ErrorCodeConflict,
+	http.StatusRequestEntityTooLarge: ErrorCodeBodyTooLarge,
+	http.StatusTooManyRequests:       ErrorCodeRateLimited,
+	http.StatusInternalServerError:   ErrorCodeInternal,
+}
+
+// Return error response of given code, its status is decided by the code
+func ReturnError(code string, message string) *Response {
+	status, ok := errorCodeStatusMap[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return &Response{Status: status, Code: code, Message: message}
+}
+
+// Return error response of given code which is caused by given field of the request, nested fields are
+// written as a path e.g. definition[2].name
+func ReturnFieldError(code string, field string, message string) *Response {
+	response := ReturnError(code, message)
+	response.Field = field
+	return response
+}
+
+// Return a single error of given item errors, several errors are sent together as validation_failed
+func ReturnDetailsError(message string, details []Response) *Response {
+	if len(details) == 1 {
+		return &details[0]
+	}
+	response := ReturnError(ErrorCodeValidationFailed, message)
+	response.Details = details
+	return response
+}
+
+// Return error code of given status, responses sent by status only get the generic code of the status
+func returnStatusErrorCode(status int) string {
+	if code, ok := statusErrorCodeMap[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrorCodeInternal
+	}
+	return ErrorCodeBadRequest
+}
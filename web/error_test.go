@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReturnErrorStatus(t *testing.T) {
+	expected := map[string]int{
+		ErrorCodeBadRequest:           http.StatusBadRequest,
+		ErrorCodeInvalidJson:          http.StatusBadRequest,
+		ErrorCodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+		ErrorCodeBodyTooLarge:         http.StatusRequestEntityTooLarge,
+		ErrorCodeFieldRequired:        http.StatusBadRequest,
+		ErrorCodeFieldInvalid:         http.StatusBadRequest,
+		ErrorCodeFieldUnknown:         http.StatusBadRequest,
+		ErrorCodeFieldTooLong:         http.StatusBadRequest,
+		ErrorCodeFieldTooShort:        http.StatusBadRequest,
+		ErrorCodeFieldOutOfRange:      http.StatusBadRequest,
+		ErrorCodeFieldDuplicate:       http.StatusBadRequest,
+		ErrorCodePasswordBreached:     http.StatusBadRequest,
+		ErrorCodeInvalidMfaCode:       http.StatusBadRequest,
+		ErrorCodeValidationFailed:     http.StatusBadRequest,
+		ErrorCodeUnauthenticated:      http.StatusUnauthorized,
+		ErrorCodeInvalidCredentials:   http.StatusUnauthorized,
+		ErrorCodeInvalidToken:         http.StatusUnauthorized,
+		ErrorCodeSsoFailed:            http.StatusUnauthorized,
+		ErrorCodeForbidden:            http.StatusForbidden,
+		ErrorCodeInvalidCsrfToken:     http.StatusForbidden,
+		ErrorCodeRateLimited:          http.StatusTooManyRequests,
+		ErrorCodeNotFound:             http.StatusNotFound,
+		ErrorCodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+		ErrorCodeAlreadyExists:        http.StatusConflict,
+		ErrorCodeConflict:             http.StatusConflict,
+		ErrorCodeLimitExceeded:        http.StatusConflict,
+		ErrorCodeArchived:             http.StatusGone,
+		ErrorCodeInternal:             http.StatusInternalServerError,
+		// Codes without a status are server errors
+		"unknown": http.StatusInternalServerError,
+	}
+	for code, status := range expected {
+		response := ReturnError(code, "Message.")
+		if response.Status != status || response.Code != code || response.Message != "Message." {
+			t.Errorf("%s: %+v, expected status %d", code, response, status)
+		}
+	}
+	// New codes are added to the table above
+	for code := range errorCodeStatusMap {
+		if _, ok := expected[code]; !ok {
+			t.Errorf("%s is not tested", code)
+		}
+	}
+}
+
+func TestReturnStatusErrorCode(t *testing.T) {
+	for status, code := range map[int]string{
+		http.StatusBadRequest:          ErrorCodeBadRequest,
+		http.StatusUnauthorized:        ErrorCodeUnauthenticated,
+		http.StatusNotFound:            ErrorCodeNotFound,
+		http.StatusTooManyRequests:     ErrorCodeRateLimited,
+		http.StatusTeapot:              ErrorCodeBadRequest,
+		http.StatusBadGateway:          ErrorCodeInternal,
+		http.StatusInternalServerError: ErrorCodeInternal,
+	} {
+		if returned := returnStatusErrorCode(status); returned != code {
+			t.Errorf("%d: %s, expected %s", status, returned, code)
+		}
+	}
+	// Status of each generic code is the status it is returned for
+	for status, code := range statusErrorCodeMap {
+		if errorCodeStatusMap[code] != status {
+			t.Errorf("%d: %s has status %d", status, code, errorCodeStatusMap[code])
+		}
+	}
+}
+
+func TestReturnDetailsError(t *testing.T) {
+	required := *ReturnFieldError(ErrorCodeFieldRequired, "data.amount", "Column is required: amount")
+	unknown := *ReturnFieldError(ErrorCodeFieldUnknown, "data.price", "Column does not exist: price")
+	// Single error is returned as it is
+	response := ReturnDetailsError("Report data is invalid.", []Response{required})
+	if response.Code != ErrorCodeFieldRequired || response.Field != "data.amount" || response.Status != http.StatusBadRequest ||
+		len(response.Details) != 0 {
+		t.Fatalf("single detail: %+v", response)
+	}
+	response = ReturnDetailsError("Report data is invalid.", []Response{required, unknown})
+	if response.Code != ErrorCodeValidationFailed || response.Status != http.StatusBadRequest || len(response.Field) != 0 ||
+		response.Message != "Report data is invalid." || len(response.Details) != 2 || response.Details[1].Field != "data.price" {
+		t.Fatalf("details: %+v", response)
+	}
+}
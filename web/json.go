@@ -9,32 +9,35 @@ import (
 	"strings"
 )
 
-// Parse HTTP POST body and send response if any anomaly happens
-func ParsePostBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	err := DecodeJSONBody(w, r, dst)
-	if err != nil {
-		var errorResponse *Response
-		if errors.As(err, &errorResponse) {
-			SendJsonResponse(w, errorResponse, errorResponse.Status)
-		} else {
-			SendHttpMethod(w, http.StatusInternalServerError)
-		}
-	}
-	return err
-}
+// Max HTTP body size 1048576 = 1024 * 1024
+const MaxBodySize = 1048576
 
 // Decode request body into given struct format
 func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	// Content type check
+	err := CheckJSONContentType(r)
+	if err != nil {
+		return err
+	}
+	// Set max HTTP body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+	return DecodeJSON(r.Body, dst)
+}
+
+// Return error response if request content type is not JSON
+func CheckJSONContentType(r *http.Request) error {
 	contentType := r.Header["Content-Type"]
 	if len(contentType) != 1 || contentType[0] != "application/json" {
 		msg := "Content-Type header is not application/json"
-		return &Response{Status: http.StatusUnsupportedMediaType, Message: msg}
+		return ReturnError(ErrorCodeUnsupportedMediaType, msg)
 	}
-	// Set max HTTP body size 1048576 = 1024 * 1024
-	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	return nil
+}
+
+// Decode single JSON object of given reader into given struct format
+func DecodeJSON(reader io.Reader, dst interface{}) error {
 	// Decode HTTP request body
-	dec := json.NewDecoder(r.Body)
+	dec := json.NewDecoder(reader)
 	dec.DisallowUnknownFields()
 	err := dec.Decode(&dst)
 	if err != nil {
@@ -44,31 +47,31 @@ func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 		switch {
 		case errors.As(err, &syntaxError):
 			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d).", syntaxError.Offset)
-			return &Response{Status: http.StatusBadRequest, Message: msg}
+			return ReturnError(ErrorCodeInvalidJson, msg)
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			msg := "Request body contains badly-formed JSON."
-			return &Response{Status: http.StatusBadRequest, Message: msg}
+			return ReturnError(ErrorCodeInvalidJson, msg)
 
 		case errors.As(err, &unmarshalTypeError):
 			msg := fmt.Sprintf("Request body contains an invalid value for the %s field (at position %d).",
 				unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			return &Response{Status: http.StatusBadRequest, Message: msg}
+			return ReturnFieldError(ErrorCodeFieldInvalid, unmarshalTypeError.Field, msg)
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field \"")
 			fieldName = strings.TrimSuffix(fieldName, "\"")
 			msg := fmt.Sprintf("Request body contains unknown field: %s", fieldName)
-			return &Response{Status: http.StatusBadRequest, Message: msg}
+			return ReturnFieldError(ErrorCodeFieldUnknown, fieldName, msg)
 
 		case errors.Is(err, io.EOF):
 			msg := "Request body must not be empty."
-			return &Response{Status: http.StatusBadRequest, Message: msg}
+			return ReturnError(ErrorCodeInvalidJson, msg)
 
 		case err.Error() == "http: request body too large":
 			// Value set in http.Server.MaxHeaderBytes
 			msg := "Request body must not be larger than 1MB"
-			return &Response{Status: http.StatusRequestEntityTooLarge, Message: msg}
+			return ReturnError(ErrorCodeBodyTooLarge, msg)
 
 		default:
 			return err
@@ -78,7 +81,7 @@ func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
 		msg := "Request body must only contain a single JSON object"
-		return &Response{Status: http.StatusBadRequest, Message: msg}
+		return ReturnError(ErrorCodeInvalidJson, msg)
 	}
 
 	return nil
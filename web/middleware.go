@@ -0,0 +1,86 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"repgen/controller"
+)
+
+// Response writer which keeps the status of the response for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Log every request with its status and duration, and the error of requests failed by the server
+func LogMiddleware(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		err := next(recorder, r)
+		status := recorder.status
+		if err != nil {
+			status = ReturnErrorStatus(err)
+		}
+		// Client errors are only in the access log
+		if err != nil && status >= http.StatusInternalServerError {
+			route := ReturnRoute(r)
+			if len(route) == 0 {
+				route = r.Method + " " + r.URL.Path
+			}
+			log.Printf("{%s} ERR: %s\n", route, err.Error())
+		}
+		log.Printf("%s %s %d %s\n", r.Method, r.URL.Path, status, time.Since(start).Round(time.Microsecond))
+		return err
+	}
+}
+
+// Turn a panic of the handler into an internal server error so the server keeps running
+func RecoverMiddleware(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("{RecoverMiddleware} ERR: %v\n%s", recovered, debug.Stack())
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+		return next(w, r)
+	}
+}
+
+// Require a valid session cookie, the session is returned by ReturnUserSession in the handler
+func AuthMiddleware(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		userSession, err := ParseCookieSession(r)
+		if err != nil {
+			return err
+		}
+		return next(w, r.WithContext(context.WithValue(r.Context(), contextKeyUserSession, userSession)))
+	}
+}
+
+// Return session of a request authenticated by AuthMiddleware
+func ReturnUserSession(r *http.Request) *controller.UserSession {
+	userSession, _ := r.Context().Value(contextKeyUserSession).(*controller.UserSession)
+	return userSession
+}
+
+// Return HTTP status given error is sent with
+func ReturnErrorStatus(err error) int {
+	var response *Response
+	if errors.As(err, &response) {
+		return response.Status
+	}
+	return http.StatusInternalServerError
+}
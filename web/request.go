@@ -0,0 +1,52 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Return IP address of the client which sent the request
+func ReturnRemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Return positive integer value of given path parameter
+func ParsePathId(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(PathParam(r, name))
+	if err != nil || id < 1 {
+		return 0, ReturnFieldError(ErrorCodeNotFound, name, fmt.Sprintf("Invalid path parameter: %s", name))
+	}
+	return id, nil
+}
+
+// Return integer value of given query parameter, zero if it is empty
+func ParseQueryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ReturnFieldError(ErrorCodeFieldInvalid, name, fmt.Sprintf("Field is invalid: %s", name))
+	}
+	return number, nil
+}
+
+// Return boolean value of given query parameter, false if it is empty
+func ParseQueryBool(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if len(value) == 0 {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ReturnFieldError(ErrorCodeFieldInvalid, name, fmt.Sprintf("Field is invalid: %s", name))
+	}
+	return flag, nil
+}
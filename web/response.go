@@ -2,12 +2,25 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Response struct {
-	Status  int    `json:"-"`
+	Status int `json:"status,omitempty"`
+	// Stable error code, empty on success
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
+	// Request field which caused the error e.g. definition[2].name
+	Field string `json:"field,omitempty"`
+	// Errors of each invalid item of the request
+	Details []Response `json:"details,omitempty"`
+	// Seconds sent as Retry-After header, zero omits the header
+	RetryAfter int `json:"-"`
 }
 
 func (response *Response) Error() string {
@@ -21,10 +34,20 @@ func SendResponse(w http.ResponseWriter, response []byte, httpStatusCode int) {
 	w.Write(response)
 }
 
+// Send the given byte array with its content type and HTTP status as response to the ResponseWriter
+func SendContentResponse(w http.ResponseWriter, contentType string, response []byte, httpStatusCode int) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(httpStatusCode)
+	w.Write(response)
+}
+
 // Send given HTTP method to the ResponseWriter,
 // If the response cannot be serialized; send HTTP internal server error (500)
 func SendHttpMethod(w http.ResponseWriter, httpStatus int) {
-	response := Response{Message: http.StatusText(httpStatus)}
+	response := Response{Status: httpStatus, Message: http.StatusText(httpStatus)}
+	if httpStatus >= http.StatusBadRequest {
+		response.Code = returnStatusErrorCode(httpStatus)
+	}
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -32,8 +55,55 @@ func SendHttpMethod(w http.ResponseWriter, httpStatus int) {
 	SendResponse(w, responseBytes, httpStatus)
 }
 
+// Send given error as response, errors other than *Response are sent as internal server error
+func SendError(w http.ResponseWriter, err error) {
+	response := ReturnErrorResponse(err)
+	if response == nil {
+		SendHttpMethod(w, http.StatusInternalServerError)
+		return
+	}
+	SendJsonResponse(w, response, response.Status)
+}
+
+// Return *Response of given error with its error code set, nil if the error is not a *Response
+func ReturnErrorResponse(err error) *Response {
+	var response *Response
+	if !errors.As(err, &response) {
+		return nil
+	}
+	// Shared error values are not modified
+	if len(response.Code) == 0 {
+		copied := *response
+		copied.Code = returnStatusErrorCode(copied.Status)
+		response = &copied
+	}
+	return response
+}
+
+// Return too many requests response which tells the client to retry after given duration
+func ReturnTooManyRequests(message string, retryAfter time.Duration) *Response {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	response := ReturnError(ErrorCodeRateLimited, fmt.Sprintf("%s, retry after %d seconds.", message, seconds))
+	response.RetryAfter = seconds
+	return response
+}
+
 // Turn given struct to bytes and send it with HTTP status
 func SendJsonResponse(w http.ResponseWriter, response interface{}, httpStatus int) {
+	// Retry-After header of rate limited responses
+	switch r := response.(type) {
+	case *Response:
+		if r != nil && r.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(r.RetryAfter))
+		}
+	case Response:
+		if r.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(r.RetryAfter))
+		}
+	}
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		SendHttpMethod(w, http.StatusInternalServerError)
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Prefix of versioned endpoints
+const ApiPrefix = "/api/v1"
+
+// Handler of a route, a returned error is sent as the response by SendError
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Middleware wraps a handler e.g. to authenticate the request before it is handled
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type contextKey int
+
+const (
+	contextKeyRoute contextKey = iota
+	contextKeyPathParams
+	contextKeyUserSession
+)
+
+type route struct {
+	method  string
+	pattern string
+	// Literal segments, {name} segments are path parameters
+	segments []string
+	handler  HandlerFunc
+}
+
+// Router dispatches requests by method and path, path parameters are written as {name} e.g. /projects/{id}/reports
+type Router struct {
+	routes      []route
+	middlewares []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Append middlewares which wrap every request, the first one is the outermost
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+// Register handler of given method and pattern, given middlewares wrap only this route inside of the router middlewares
+func (router *Router) Handle(method string, pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		handler = middlewares[index](handler)
+	}
+	router.routes = append(router.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+func (router *Router) Get(pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	router.Handle(http.MethodGet, pattern, handler, middlewares...)
+}
+
+func (router *Router) Post(pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	router.Handle(http.MethodPost, pattern, handler, middlewares...)
+}
+
+func (router *Router) Put(pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	router.Handle(http.MethodPut, pattern, handler, middlewares...)
+}
+
+func (router *Router) Patch(pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	router.Handle(http.MethodPatch, pattern, handler, middlewares...)
+}
+
+func (router *Router) Delete(pattern string, handler HandlerFunc, middlewares ...Middleware) {
+	router.Handle(http.MethodDelete, pattern, handler, middlewares...)
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	var matched *route
+	var params map[string]string
+	allowed := []string{}
+	for index := range router.routes {
+		candidate := &router.routes[index]
+		candidateParams, ok := candidate.match(segments)
+		if !ok {
+			continue
+		}
+		if candidate.method != r.Method {
+			allowed = append(allowed, candidate.method)
+			continue
+		}
+		// Literal segments win over path parameters e.g. /projects/archived over /projects/{id}
+		if matched == nil || candidate.isMoreSpecific(matched) {
+			matched, params = candidate, candidateParams
+		}
+	}
+	var handler HandlerFunc
+	switch {
+	case matched != nil:
+		handler = matched.handler
+		ctx := context.WithValue(r.Context(), contextKeyRoute, matched.method+" "+matched.pattern)
+		r = r.WithContext(context.WithValue(ctx, contextKeyPathParams, params))
+	case len(allowed) > 0:
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		handler = func(w http.ResponseWriter, r *http.Request) error {
+			return ReturnError(ErrorCodeMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		}
+	default:
+		handler = func(w http.ResponseWriter, r *http.Request) error {
+			return ReturnError(ErrorCodeNotFound, http.StatusText(http.StatusNotFound))
+		}
+	}
+	// Router middlewares wrap unmatched requests too so every response is logged and rendered the same way
+	for index := len(router.middlewares) - 1; index >= 0; index-- {
+		handler = router.middlewares[index](handler)
+	}
+	err := handler(w, r)
+	if err != nil {
+		SendError(w, err)
+	}
+}
+
+// Return path parameters of given request segments if they match the route
+func (route *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for index, segment := range route.segments {
+		if name, ok := returnParamName(segment); ok {
+			if len(segments[index]) == 0 {
+				return nil, false
+			}
+			params[name] = segments[index]
+		} else if segment != segments[index] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Return true if the first differing segment of the route is literal and the one of other is a parameter
+func (route *route) isMoreSpecific(other *route) bool {
+	for index, segment := range route.segments {
+		_, param := returnParamName(segment)
+		_, otherParam := returnParamName(other.segments[index])
+		if param != otherParam {
+			return otherParam
+		}
+	}
+	return false
+}
+
+func returnParamName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// Return value of given path parameter of the matched route, empty if it does not exist
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(contextKeyPathParams).(map[string]string)
+	return params[name]
+}
+
+// Return "METHOD pattern" of the matched route, empty if no route is matched
+func ReturnRoute(r *http.Request) string {
+	route, _ := r.Context().Value(contextKeyRoute).(string)
+	return route
+}
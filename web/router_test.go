@@ -0,0 +1,130 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Return a handler which writes given text, the route and the path parameters of given names
+func newTestHandler(text string, names ...string) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		params := []string{}
+		for _, name := range names {
+			params = append(params, name+"="+PathParam(r, name))
+		}
+		_, err := w.Write([]byte(text + "|" + ReturnRoute(r) + "|" + strings.Join(params, ",")))
+		return err
+	}
+}
+
+// Serve a request of given method and path, return the response
+func serveTestRequest(router *Router, method string, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestRouterMatch(t *testing.T) {
+	router := NewRouter()
+	router.Get("/projects", newTestHandler("list"))
+	router.Get("/projects/archived", newTestHandler("archived"))
+	router.Get("/projects/{id}", newTestHandler("get", "id"))
+	router.Delete("/projects/{id}", newTestHandler("delete", "id"))
+	router.Delete("/reports/{id}/tokens/{token_id}", newTestHandler("revoke", "id", "token_id"))
+	for _, test := range []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodGet, "/projects", "list|GET /projects|"},
+		{http.MethodGet, "/projects/", "list|GET /projects|"},
+		{http.MethodGet, "/projects/7", "get|GET /projects/{id}|id=7"},
+		{http.MethodGet, "/projects/7/", "get|GET /projects/{id}|id=7"},
+		{http.MethodDelete, "/projects/7", "delete|DELETE /projects/{id}|id=7"},
+		// Literal segments win over path parameters regardless of the registration order
+		{http.MethodGet, "/projects/archived", "archived|GET /projects/archived|"},
+		{http.MethodDelete, "/reports/3/tokens/9", "revoke|DELETE /reports/{id}/tokens/{token_id}|id=3,token_id=9"},
+	} {
+		w := serveTestRequest(router, test.method, test.path)
+		if w.Code != http.StatusOK || w.Body.String() != test.expected {
+			t.Errorf("%s %s: %d %s, expected %s", test.method, test.path, w.Code, w.Body.String(), test.expected)
+		}
+	}
+}
+
+func TestRouterNotMatched(t *testing.T) {
+	router := NewRouter()
+	router.Get("/projects/{id}", newTestHandler("get", "id"))
+	router.Delete("/projects/{id}", newTestHandler("delete", "id"))
+	router.Get("/projects", newTestHandler("list"))
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+		code   string
+		allow  string
+	}{
+		{http.MethodPost, "/projects/7", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "DELETE, GET"},
+		{http.MethodPatch, "/projects", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "GET"},
+		{http.MethodGet, "/projects/7/reports", http.StatusNotFound, ErrorCodeNotFound, ""},
+		{http.MethodGet, "/users", http.StatusNotFound, ErrorCodeNotFound, ""},
+	} {
+		w := serveTestRequest(router, test.method, test.path)
+		var response Response
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != test.status || response.Code != test.code || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s: %d %+v, Allow: %q", test.method, test.path, w.Code, response, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	calls := []string{}
+	middleware := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) error {
+				calls = append(calls, name+":"+PathParam(r, "id"))
+				return next(w, r)
+			}
+		}
+	}
+	router := NewRouter()
+	router.Use(middleware("router1"), middleware("router2"))
+	router.Get("/projects/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		calls = append(calls, "handler")
+		return nil
+	}, middleware("route1"), middleware("route2"))
+	serveTestRequest(router, http.MethodGet, "/projects/7")
+	// Router middlewares are outermost and path parameters are available to every middleware
+	if expected := "router1:7,router2:7,route1:7,route2:7,handler"; strings.Join(calls, ",") != expected {
+		t.Fatalf("calls: %v, expected %s", calls, expected)
+	}
+	// Unmatched requests pass through router middlewares only
+	calls = calls[:0]
+	if w := serveTestRequest(router, http.MethodGet, "/users"); w.Code != http.StatusNotFound {
+		t.Fatalf("status: %d", w.Code)
+	}
+	if expected := "router1:,router2:"; strings.Join(calls, ",") != expected {
+		t.Fatalf("calls: %v, expected %s", calls, expected)
+	}
+}
+
+func TestRouterHandlerError(t *testing.T) {
+	router := NewRouter()
+	router.Get("/projects/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		return ReturnFieldError(ErrorCodeFieldInvalid, "id", "Field is invalid: id")
+	})
+	w := serveTestRequest(router, http.MethodGet, "/projects/x")
+	var response Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || response.Code != ErrorCodeFieldInvalid || response.Field != "id" {
+		t.Fatalf("%d %+v", w.Code, response)
+	}
+}